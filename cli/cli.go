@@ -3,20 +3,25 @@ package cli
 
 import (
 	"bufio"
-	"bytes"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fstab/h2c/cli/cmdline"
+	"github.com/fstab/h2c/cli/conformance"
 	"github.com/fstab/h2c/cli/daemon"
 	"github.com/fstab/h2c/cli/rpc"
 	"github.com/fstab/h2c/cli/util"
 	"github.com/fstab/h2c/cli/wiretap"
 	"github.com/fstab/h2c/http2client"
+	"github.com/fstab/h2c/http2client/failure"
 	"github.com/fstab/h2c/http2client/frames"
 )
 
@@ -31,91 +36,159 @@ func Run() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	msg, err := runCommand(ipc, cmd)
+	if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+		return daemon.JsonResult(msg, err)
+	}
+	return msg, err
+}
+
+func runCommand(ipc rpc.IpcManager, cmd *rpc.Command) (string, error) {
+	var err error
 	switch cmd.Name {
 	case cmdline.VERSION_COMMAND.Name():
+		if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+			data, err := json.Marshal(map[string]string{"version": http2client.VERSION, "build_date": http2client.BUILD_DATE})
+			return string(data), err
+		}
 		return "h2c version " + http2client.VERSION + " build date " + http2client.BUILD_DATE + ".", nil
+	case cmdline.COMPLETION_COMMAND.Name():
+		script, err := cmdline.CompletionScript(cmd.Args[0])
+		if err == nil && cmdline.JSON_OPTION.IsSet(cmd.Options) {
+			data, err := json.Marshal(map[string]string{"script": script})
+			return string(data), err
+		}
+		return script, err
 	case cmdline.START_COMMAND.Name():
 		frameTypesToBeDumped, err := getFrameTypesToBeDumped(cmd.Options)
 		if err != nil {
 			return "", err
 		}
-		return "", startDaemon(ipc, frameTypesToBeDumped)
+		dumpFormat := daemon.TEXT_FORMAT
+		if cmdline.DUMP_FORMAT_OPTION.IsSet(cmd.Options) {
+			dumpFormat = cmdline.DUMP_FORMAT_OPTION.Get(cmd.Options)
+		}
+		return "", startDaemon(ipc, frameTypesToBeDumped, cmd.Options, cmdline.DUMP_FILE_OPTION.Get(cmd.Options), dumpFormat, cmdline.PCAP_FILE_OPTION.Get(cmd.Options), cmdline.RULE_OPTION.GetAll(cmd.Options))
 	case cmdline.WIRETAP_COMMAND.Name():
-		return "", wiretap.Run(cmd.Args[0], cmd.Args[1])
-	default:
+		return "", wiretap.Run(cmd.Args[0], cmd.Args[1], cmdline.PCAP_FILE_OPTION.Get(cmd.Options))
+	case cmdline.CONFORMANCE_COMMAND.Name():
+		return runConformanceTests(cmd)
+	case cmdline.WATCH_COMMAND.Name():
 		if !ipc.IsListening() {
-			if cmdline.STOP_COMMAND.Name() == cmd.Name {
-				return "", fmt.Errorf("h2c is not running.")
-			} else {
-				fmt.Fprintf(os.Stderr, "h2ccc is not running. Starting h2c as a background process.\n")
-				err = runDaemonShellCommand()
-				if err != nil {
-					return "", fmt.Errorf("Failed. In order to start the background process manually, run '%v'.", cmdline.StartCmd)
-				}
-			}
+			return "", fmt.Errorf("h2c is not running.")
+		}
+		return "", watch(cmd, ipc)
+	case cmdline.SHELL_COMMAND.Name():
+		if err = startInBackgroundIfNotRunning(ipc); err != nil {
+			return "", err
+		}
+		return "", shell(ipc)
+	case cmdline.RUN_COMMAND.Name():
+		if err = startInBackgroundIfNotRunning(ipc); err != nil {
+			return "", err
+		}
+		return "", runScript(ipc, cmd)
+	default:
+		if !ipc.IsListening() && cmdline.STOP_COMMAND.Name() == cmd.Name {
+			return "", fmt.Errorf("h2c is not running.")
+		}
+		if err = startInBackgroundIfNotRunning(ipc); err != nil {
+			return "", err
 		}
 		res := sendCommand(cmd, ipc)
 		if res.Error != nil {
-			return res.Message, fmt.Errorf("%v", *res.Error)
+			return res.Message, res.Err()
+		} else if cmd.Name == cmdline.HAR_COMMAND.Name() {
+			return "", writeHarFile(cmd.Args[1], res.Message)
 		} else {
 			return res.Message, nil
 		}
 	}
 }
 
+// 'h2c conformance' runs in the command line process, because it uses its own connections.
+func runConformanceTests(cmd *rpc.Command) (string, error) {
+	timeout := conformance.DEFAULT_TIMEOUT
+	if cmdline.TIMEOUT_OPTION.IsSet(cmd.Options) {
+		seconds, err := strconv.Atoi(cmdline.TIMEOUT_OPTION.Get(cmd.Options))
+		if err != nil || seconds <= 0 {
+			return "", fmt.Errorf("%v: invalid timeout", cmdline.TIMEOUT_OPTION.Get(cmd.Options))
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+	report, err := conformance.Run(cmd.Args[0], timeout)
+	if err != nil {
+		return "", err
+	}
+	msg := report.String()
+	if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+		data, err := json.Marshal(report)
+		if err != nil {
+			return "", err
+		}
+		msg = string(data)
+	}
+	if report.Failed() > 0 {
+		return msg, failure.New(failure.ASSERTION_FAILED, "%v of %v conformance tests failed.", report.Failed(), len(report.Results))
+	}
+	return msg, nil
+}
+
 // Get list of frame types in the 'h2c start --dump --include ...' command.
-// Returns nil if no frame should be dumped (--dump option missing).
+// Returns nil if no frame should be dumped (--dump and --dump-file option missing).
 // Returns an error if the command line has a syntax error, like an unknown frame type or --include and --exclude both used at the same time.
-func getFrameTypesToBeDumped(options map[string]string) ([]frames.Type, error) {
-	if !cmdline.DUMP_OPTION.IsSet(options) {
+func getFrameTypesToBeDumped(options map[string][]string) ([]frames.Type, error) {
+	if !cmdline.DUMP_OPTION.IsSet(options) && !cmdline.DUMP_FILE_OPTION.IsSet(options) {
 		if cmdline.INCLUDE_FRAMES_OPTION.IsSet(options) {
 			return nil, fmt.Errorf("Syntax error: Cannot use %v without %v.", cmdline.INCLUDE_FRAMES_OPTION.Name(), cmdline.DUMP_OPTION.Name())
 		} else if cmdline.EXCLUDE_FRAMES_OPTION.IsSet(options) {
 			return nil, fmt.Errorf("Syntax error: Cannot use %v without %v.", cmdline.EXCLUDE_FRAMES_OPTION.Name(), cmdline.DUMP_OPTION.Name())
+		} else if cmdline.DUMP_FORMAT_OPTION.IsSet(options) {
+			return nil, fmt.Errorf("Syntax error: Cannot use %v without %v.", cmdline.DUMP_FORMAT_OPTION.Name(), cmdline.DUMP_OPTION.Name())
+		} else if cmdline.DUMP_STREAM_OPTION.IsSet(options) {
+			return nil, fmt.Errorf("Syntax error: Cannot use %v without %v.", cmdline.DUMP_STREAM_OPTION.Name(), cmdline.DUMP_OPTION.Name())
+		} else if cmdline.HEADER_NAME_OPTION.IsSet(options) {
+			return nil, fmt.Errorf("Syntax error: Cannot use %v without %v.", cmdline.HEADER_NAME_OPTION.Name(), cmdline.DUMP_OPTION.Name())
+		} else if cmdline.TIMESTAMPS_OPTION.IsSet(options) {
+			return nil, fmt.Errorf("Syntax error: Cannot use %v without %v.", cmdline.TIMESTAMPS_OPTION.Name(), cmdline.DUMP_OPTION.Name())
+		} else if cmdline.HEX_OPTION.IsSet(options) {
+			return nil, fmt.Errorf("Syntax error: Cannot use %v without %v.", cmdline.HEX_OPTION.Name(), cmdline.DUMP_OPTION.Name())
+		} else if cmdline.PREVIEW_OPTION.IsSet(options) {
+			return nil, fmt.Errorf("Syntax error: Cannot use %v without %v.", cmdline.PREVIEW_OPTION.Name(), cmdline.DUMP_OPTION.Name())
+		} else if cmdline.HPACK_OPTION.IsSet(options) {
+			return nil, fmt.Errorf("Syntax error: Cannot use %v without %v.", cmdline.HPACK_OPTION.Name(), cmdline.DUMP_OPTION.Name())
 		} else {
 			return nil, nil
 		}
+	} else if cmdline.DUMP_OPTION.IsSet(options) && cmdline.DUMP_FILE_OPTION.IsSet(options) {
+		return nil, fmt.Errorf("Syntax error: Cannot use %v together with %v.", cmdline.DUMP_OPTION.Name(), cmdline.DUMP_FILE_OPTION.Name())
 	} else {
 		if cmdline.INCLUDE_FRAMES_OPTION.IsSet(options) && cmdline.EXCLUDE_FRAMES_OPTION.IsSet(options) {
 			return nil, fmt.Errorf("Syntax error: Cannot use %v together with %v.", cmdline.INCLUDE_FRAMES_OPTION.Name(), cmdline.EXCLUDE_FRAMES_OPTION.Name())
 		} else if cmdline.INCLUDE_FRAMES_OPTION.IsSet(options) {
-			return parseListOfFrameTypes(cmdline.INCLUDE_FRAMES_OPTION.Get(options))
+			return util.ParseListOfFrameTypes(cmdline.INCLUDE_FRAMES_OPTION.Get(options))
 		} else if cmdline.EXCLUDE_FRAMES_OPTION.IsSet(options) {
-			excluded, err := parseListOfFrameTypes(cmdline.EXCLUDE_FRAMES_OPTION.Get(options))
+			excluded, err := util.ParseListOfFrameTypes(cmdline.EXCLUDE_FRAMES_OPTION.Get(options))
 			if err != nil {
 				return nil, err
 			}
-			return excludeToInclude(excluded), nil
+			return util.ExcludeToInclude(excluded), nil
 		} else {
 			return frames.AllFrameTypes(), nil
 		}
 	}
 }
 
-func parseListOfFrameTypes(list string) ([]frames.Type, error) {
-	result := make([]frames.Type, 0)
-	for _, name := range strings.Split(list, ",") {
-		t, ok := frames.FrameNameToType(strings.TrimSpace(name))
-		if !ok {
-			return nil, fmt.Errorf("Syntax error: %v unknown.", strings.TrimSpace(name))
-		}
-		result = append(result, t)
-	}
-	return result, nil
-}
-
-// Turns the 'h2c start --dump --exclude ...' option into the equivalent '--include ...' option.
-func excludeToInclude(excluded []frames.Type) []frames.Type {
-	included := make([]frames.Type, 0)
-	for _, t := range frames.AllFrameTypes() {
-		if !util.SliceContainsFrameType(excluded, t) {
-			included = append(included, t)
-		}
-	}
-	if len(included) == 0 {
+func startInBackgroundIfNotRunning(ipc rpc.IpcManager) error {
+	if ipc.IsListening() {
 		return nil
 	}
-	return included
+	fmt.Fprintf(os.Stderr, "h2c is not running. Starting h2c as a background process.\n")
+	err := runDaemonShellCommand()
+	if err != nil {
+		return fmt.Errorf("Failed. In order to start the background process manually, run '%v'.", cmdline.StartCmd)
+	}
+	return nil
 }
 
 // There are two ways of specifying payload data for PUT and POST: The --file option and the --data option.
@@ -123,6 +196,12 @@ func excludeToInclude(excluded []frames.Type) []frames.Type {
 // This is a bit of a hack, but that way we don't need to read the file later.
 func applySpecialConventions(cmd *rpc.Command) (*rpc.Command, error) {
 	var err error
+	if cmd.Name == cmdline.GET_COMMAND.Name() && cmdline.PARALLEL_OPTION.IsSet(cmd.Options) {
+		cmd, err = mapParallelFile2Args(cmd)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if cmd.Name == cmdline.POST_COMMAND.Name() || cmd.Name == cmdline.PUT_COMMAND.Name() {
 		if cmdline.DATA_OPTION.IsSet(cmd.Options) && cmdline.FILE_OPTION.IsSet(cmd.Options) {
 			return nil, fmt.Errorf("Syntax error: --data and --file cannot be used together.")
@@ -133,6 +212,12 @@ func applySpecialConventions(cmd *rpc.Command) (*rpc.Command, error) {
 			}
 		}
 	}
+	if cmd.Name == cmdline.SEND_FRAME_COMMAND.Name() && strings.HasPrefix(cmdline.PAYLOAD_OPTION.Get(cmd.Options), "@") {
+		cmd, err = mapPayloadFile2Hex(cmd)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return cmd, nil
 }
 
@@ -159,7 +244,60 @@ func mapFile2Data(cmd *rpc.Command) (*rpc.Command, error) {
 	return cmd, nil
 }
 
-func startDaemon(ipc rpc.IpcManager, frameTypesToBeDumped []frames.Type) error {
+// 'h2c send-frame --payload @file' sends the content of file. The file is read here, and the payload is replaced with the hex encoded content.
+func mapPayloadFile2Hex(cmd *rpc.Command) (*rpc.Command, error) {
+	filename := strings.TrimPrefix(cmdline.PAYLOAD_OPTION.Get(cmd.Options), "@")
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %v: %v", filename, err.Error())
+	}
+	cmdline.PAYLOAD_OPTION.Set(hex.EncodeToString(data), cmd.Options)
+	return cmd, nil
+}
+
+// The paths in the --parallel file are appended to the paths given as args. Empty lines and lines starting with '#' are ignored.
+func mapParallelFile2Args(cmd *rpc.Command) (*rpc.Command, error) {
+	var (
+		filename string
+		data     []byte
+		err      error
+	)
+	filename = cmdline.PARALLEL_OPTION.Get(cmd.Options)
+	if filename == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read paths from stdin: %v", err.Error())
+		}
+	} else {
+		data, err = ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %v: %v", filename, err.Error())
+		}
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			cmd.Args = append(cmd.Args, line)
+		}
+	}
+	if len(cmd.Args) == 0 {
+		return nil, fmt.Errorf("%v: No paths found.", filename)
+	}
+	cmdline.PARALLEL_OPTION.Delete(cmd.Options)
+	return cmd, nil
+}
+
+// The HAR file is written by the command line rather than by the h2c process,
+// so that relative paths are resolved against the user's working directory.
+func writeHarFile(filename string, har string) error {
+	err := ioutil.WriteFile(filename, []byte(har+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to write %v: %v", filename, err.Error())
+	}
+	return nil
+}
+
+func startDaemon(ipc rpc.IpcManager, frameTypesToBeDumped []frames.Type, dumpOptions map[string][]string, dumpFile string, dumpFormat string, pcapFile string, rules []string) error {
 	if ipc.IsListening() {
 		return socketInUseError(ipc)
 	}
@@ -167,7 +305,7 @@ func startDaemon(ipc rpc.IpcManager, frameTypesToBeDumped []frames.Type) error {
 	if err != nil {
 		return err
 	}
-	return daemon.Run(sock, frameTypesToBeDumped)
+	return daemon.Run(sock, frameTypesToBeDumped, dumpOptions, dumpFile, dumpFormat, pcapFile, rules)
 }
 
 func socketInUseError(ipc rpc.IpcManager) error {
@@ -179,7 +317,7 @@ func socketInUseError(ipc rpc.IpcManager) error {
 }
 
 func pidCommandSuccessful(ipc rpc.IpcManager) bool {
-	pidCmd, _ := rpc.NewCommand(cmdline.PID_COMMAND.Name(), make([]string, 0), make(map[string]string))
+	pidCmd, _ := rpc.NewCommand(cmdline.PID_COMMAND.Name(), make([]string, 0), make(map[string][]string))
 	res := sendCommand(pidCmd, ipc)
 	return res.Error == nil && isNumber(res.Message)
 }
@@ -202,24 +340,70 @@ func sendCommand(cmd *rpc.Command, ipc rpc.IpcManager) *rpc.Result {
 	if err != nil {
 		return communicationError(err)
 	}
-	responseBuffer := bytes.NewBuffer(nil)
-	_, err = io.Copy(responseBuffer, conn)
-	if err != nil {
-		if cmd.Name == cmdline.STOP_COMMAND.Name() && len(responseBuffer.Bytes()) > 0 {
-			// Ignore. This seems to happen on windows when the connection is closed because of the 'stop' command.
-		} else {
+	// Event Results with partial output, like the responses of 'h2c get /a /b' as they complete, are printed immediately.
+	// Results are read with ReadString() rather than a Scanner, because there is no limit for the size of a response body.
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if cmd.Name == cmdline.STOP_COMMAND.Name() && len(line) > 0 {
+				// Ignore. This seems to happen on windows when the connection is closed because of the 'stop' command.
+			} else if err == io.EOF && len(line) == 0 {
+				return communicationError(io.ErrUnexpectedEOF)
+			} else if err != io.EOF {
+				return communicationError(err)
+			}
+		}
+		res, err := rpc.UnmarshalResult(strings.TrimSuffix(line, "\n"))
+		if err != nil {
 			return communicationError(err)
 		}
+		if !res.IsEvent {
+			return res
+		}
+		fmt.Println(res.Message)
 	}
-	res, err := rpc.UnmarshalResult(string(responseBuffer.Bytes()))
+}
+
+// Unlike sendCommand(), watch receives a stream of results, one per line, until the h2c process closes the connection.
+// Each result is printed immediately.
+func watch(cmd *rpc.Command, ipc rpc.IpcManager) error {
+	conn, err := ipc.Dial()
 	if err != nil {
-		return communicationError(err)
+		return communicationFailure(err)
+	}
+	defer conn.Close()
+	base64cmd, err := cmd.Marshal()
+	if err != nil {
+		return communicationFailure(err)
+	}
+	_, err = conn.Write([]byte(base64cmd + "\n"))
+	if err != nil {
+		return communicationFailure(err)
+	}
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		res, err := rpc.UnmarshalResult(scanner.Text())
+		if err != nil {
+			return communicationFailure(err)
+		}
+		if res.Error != nil {
+			return res.Err()
+		}
+		fmt.Println(res.Message)
 	}
-	return res
+	if scanner.Err() != nil {
+		return communicationFailure(scanner.Err())
+	}
+	return nil
 }
 
 func communicationError(err error) *rpc.Result {
-	return rpc.NewResult("", fmt.Errorf("Failed to communicate with h2c process: %v", err.Error()))
+	return rpc.NewResult("", communicationFailure(err))
+}
+
+func communicationFailure(err error) error {
+	return fmt.Errorf("Failed to communicate with h2c process: %v", err.Error())
 }
 
 func isNumber(s string) bool {
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/fstab/h2c/cli/rpc"
+)
+
+// pipeIpc connects sendCommand() to a fake h2c process, which reads the command and writes the given results.
+type pipeIpc struct {
+	results []*rpc.Result
+}
+
+func (p *pipeIpc) IsListening() bool             { return true }
+func (p *pipeIpc) Listen() (net.Listener, error) { return nil, nil }
+func (p *pipeIpc) InUseErrorMessage() string     { return "" }
+func (p *pipeIpc) Dial() (net.Conn, error) {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		if _, err := bufio.NewReader(server).ReadString('\n'); err != nil {
+			return
+		}
+		for _, res := range p.results {
+			encoded, err := res.Marshal()
+			if err != nil {
+				return
+			}
+			if _, err = server.Write([]byte(encoded + "\n")); err != nil {
+				return
+			}
+		}
+	}()
+	return client, nil
+}
+
+func TestSendCommandWithLargeResult(t *testing.T) {
+	body := strings.Repeat("a", 64*1024*1024) // the encoded Result is a line of more than 64 MB
+	ipc := &pipeIpc{results: []*rpc.Result{rpc.NewEventResult("event"), rpc.NewResult(body, nil)}}
+	cmd, err := rpc.NewCommand("get", []string{"/"}, make(map[string][]string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := sendCommand(cmd, ipc)
+	if res.Error != nil {
+		t.Fatalf("Unexpected error: %v", res.Err())
+	}
+	if res.Message != body {
+		t.Errorf("Expected a message of %v bytes, but got %v bytes.", len(body), len(res.Message))
+	}
+}
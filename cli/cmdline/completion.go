@@ -0,0 +1,69 @@
+package cmdline
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/fstab/h2c/http2client/frames"
+)
+
+// Commands where the argument is a path, so paths from earlier requests are offered for tab completion.
+var pathCommands = []*command{GET_COMMAND, PUT_COMMAND, POST_COMMAND, PUSH_CANCEL_COMMAND}
+
+// Complete returns the candidates for tab completion of the last word of a partially typed command line.
+//
+// words are the words before the last word, starting with the command name.
+// paths are offered as candidates for the <path> argument of get, put, and post.
+// Each candidate replaces the last word.
+func Complete(words []string, lastWord string, paths []string) []string {
+	if len(words) == 0 {
+		return withPrefix(commandNames(), lastWord)
+	}
+	cmd, err := findCommand(words)
+	if err != nil {
+		return nil
+	}
+	if opt := findOption(words[len(words)-1], cmd); opt != nil && opt.hasParam {
+		if opt.completeParam == nil {
+			return nil
+		}
+		return opt.completeParam(lastWord)
+	}
+	if strings.HasPrefix(lastWord, "-") {
+		names := make([]string, 0)
+		for _, opt := range optionsForCommand(cmd) {
+			names = append(names, opt.long)
+		}
+		return withPrefix(names, lastWord)
+	}
+	for _, pathCommand := range pathCommands {
+		if cmd == pathCommand {
+			return withPrefix(paths, lastWord)
+		}
+	}
+	return nil
+}
+
+// Frame types are comma separated, like "HEADERS,DATA". Only the last frame type is completed.
+func completeFrameTypes(prefix string) []string {
+	i := strings.LastIndex(prefix, ",")
+	names := make([]string, 0)
+	for _, t := range frames.AllFrameTypes() {
+		names = append(names, prefix[:i+1]+t.String())
+	}
+	return withPrefix(names, prefix)
+}
+
+// withPrefix returns the sorted candidates starting with prefix, without duplicates.
+func withPrefix(candidates []string, prefix string) []string {
+	result := make([]string, 0)
+	found := make(map[string]bool)
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) && !found[candidate] {
+			result = append(result, candidate)
+			found[candidate] = true
+		}
+	}
+	sort.Strings(result)
+	return result
+}
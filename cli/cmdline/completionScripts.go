@@ -0,0 +1,197 @@
+package cmdline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CompletionScript generates the tab completion script for 'h2c completion bash|zsh|fish'.
+// The script is generated from the commands and options tables, so it is always up to date.
+//
+// Options without completeParam complete file names, because that is the best guess for an unknown parameter.
+func CompletionScript(shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return bashCompletionScript(), nil
+	case "zsh":
+		return zshCompletionScript(), nil
+	case "fish":
+		return fishCompletionScript(), nil
+	default:
+		return "", fmt.Errorf("%v: Unsupported shell. Supported shells are bash, zsh, and fish.", shell)
+	}
+}
+
+func bashCompletionScript() string {
+	var b strings.Builder
+	b.WriteString("# bash completion for h2c, generated with 'h2c completion bash'.\n")
+	b.WriteString("# To enable it, run 'source <(h2c completion bash)', or add this line to ~/.bashrc.\n\n")
+	b.WriteString("_h2c() {\n")
+	b.WriteString("    local cur prev cmd i\n")
+	b.WriteString("    cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	b.WriteString("    prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	b.WriteString("    for ((i = 1; i < COMP_CWORD; i++)); do\n")
+	b.WriteString("        if [[ \"${COMP_WORDS[i]}\" != -* ]]; then\n")
+	b.WriteString("            cmd=\"${COMP_WORDS[i]}\"\n")
+	b.WriteString("            break\n")
+	b.WriteString("        fi\n")
+	b.WriteString("    done\n")
+	b.WriteString("    if [[ -z \"$cmd\" ]]; then\n")
+	b.WriteString("        COMPREPLY=($(compgen -W \"" + strings.Join(commandNames(), " ") + "\" -- \"$cur\"))\n")
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    case \"$cmd\" in\n")
+	for _, cmd := range commands {
+		b.WriteString("    " + cmd.name + ")\n")
+		b.WriteString("        case \"$prev\" in\n")
+		for _, opt := range optionsForCommand(cmd) {
+			if !opt.hasParam {
+				continue
+			}
+			b.WriteString("        " + opt.short + "|" + opt.long + ")\n")
+			if opt.completeParam != nil {
+				// Comma separated lists, like '--include HEADERS,DATA', complete the word after the last comma.
+				b.WriteString("            COMPREPLY=($(compgen -P \"${cur%\"${cur##*,}\"}\" -W \"" + strings.Join(opt.completeParam(""), " ") + "\" -- \"${cur##*,}\"))\n")
+			}
+			b.WriteString("            return\n")
+			b.WriteString("            ;;\n")
+		}
+		b.WriteString("        esac\n")
+		b.WriteString("        if [[ \"$cur\" == -* ]]; then\n")
+		b.WriteString("            COMPREPLY=($(compgen -W \"" + strings.Join(optionNames(cmd), " ") + "\" -- \"$cur\"))\n")
+		b.WriteString("        fi\n")
+		b.WriteString("        ;;\n")
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("}\n\n")
+	b.WriteString("complete -o default -F _h2c h2c\n")
+	return b.String()
+}
+
+func zshCompletionScript() string {
+	var b strings.Builder
+	b.WriteString("#compdef h2c\n")
+	b.WriteString("# zsh completion for h2c, generated with 'h2c completion zsh'.\n")
+	b.WriteString("# To enable it, run 'source <(h2c completion zsh)', or save it as _h2c in a directory in $fpath.\n\n")
+	b.WriteString("_h2c() {\n")
+	b.WriteString("    local state\n")
+	b.WriteString("    _arguments -C '1: :->command' '*:: :->args'\n")
+	b.WriteString("    case $state in\n")
+	b.WriteString("    command)\n")
+	b.WriteString("        local -a commands\n")
+	b.WriteString("        commands=(\n")
+	for _, cmd := range commands {
+		b.WriteString("            " + shellQuote(cmd.name+":"+firstSentence(cmd.description)) + "\n")
+	}
+	b.WriteString("        )\n")
+	b.WriteString("        _describe -t commands 'h2c command' commands\n")
+	b.WriteString("        ;;\n")
+	b.WriteString("    args)\n")
+	b.WriteString("        case $words[1] in\n")
+	for _, cmd := range commands {
+		b.WriteString("        " + cmd.name + ")\n")
+		b.WriteString("            _arguments")
+		for _, opt := range optionsForCommand(cmd) {
+			b.WriteString(" \\\n                " + zshOptionSpec(opt))
+		}
+		b.WriteString(" \\\n                '*: :_files'\n")
+		b.WriteString("            ;;\n")
+	}
+	b.WriteString("        esac\n")
+	b.WriteString("        ;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("}\n\n")
+	b.WriteString("if [[ \"$funcstack[1]\" == \"_h2c\" ]]; then\n")
+	b.WriteString("    _h2c \"$@\"\n")
+	b.WriteString("else\n")
+	b.WriteString("    compdef _h2c h2c\n")
+	b.WriteString("fi\n")
+	return b.String()
+}
+
+// Like "'(-t --timeout)'{-t,--timeout}'[Timeout in seconds.]:value:_files'"
+func zshOptionSpec(opt *option) string {
+	exclusion := "'(" + opt.short + " " + opt.long + ")'"
+	if opt.isRepeatable {
+		exclusion = "'*'"
+	}
+	spec := "[" + strings.NewReplacer("[", "\\[", "]", "\\]").Replace(firstSentence(opt.description)) + "]"
+	if opt.hasParam {
+		if opt.completeParam != nil {
+			spec += ":value:_sequence compadd - " + strings.Join(opt.completeParam(""), " ")
+		} else {
+			spec += ":value:_files"
+		}
+	}
+	return exclusion + "{" + opt.short + "," + opt.long + "}" + shellQuote(spec)
+}
+
+func fishCompletionScript() string {
+	var b strings.Builder
+	b.WriteString("# fish completion for h2c, generated with 'h2c completion fish'.\n")
+	b.WriteString("# To enable it, run 'h2c completion fish | source', or save it as ~/.config/fish/completions/h2c.fish.\n\n")
+	b.WriteString("complete -c h2c -f\n")
+	for _, cmd := range commands {
+		b.WriteString("complete -c h2c -n __fish_use_subcommand -a " + cmd.name + " -d " + fishQuote(firstSentence(cmd.description)) + "\n")
+	}
+	for _, cmd := range commands {
+		for _, opt := range optionsForCommand(cmd) {
+			line := "complete -c h2c -n " + fishQuote("__fish_seen_subcommand_from "+cmd.name) +
+				" -s " + strings.TrimPrefix(opt.short, "-") + " -l " + strings.TrimPrefix(opt.long, "--")
+			if opt.hasParam {
+				if opt.completeParam != nil {
+					line += " -r -a " + fishQuote(strings.Join(opt.completeParam(""), " "))
+				} else {
+					line += " -r -F"
+				}
+			}
+			b.WriteString(line + " -d " + fishQuote(firstSentence(opt.description)) + "\n")
+		}
+	}
+	return b.String()
+}
+
+func commandNames() []string {
+	result := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		result = append(result, cmd.name)
+	}
+	return result
+}
+
+func optionsForCommand(cmd *command) []*option {
+	result := make([]*option, 0)
+	for _, opt := range options {
+		if opt.supportsCommand(cmd) {
+			result = append(result, opt)
+		}
+	}
+	return result
+}
+
+func optionNames(cmd *command) []string {
+	result := make([]string, 0)
+	for _, opt := range optionsForCommand(cmd) {
+		result = append(result, opt.short, opt.long)
+	}
+	return result
+}
+
+// The first sentence of the description, because some shells show the description in a single line.
+func firstSentence(description string) string {
+	description = strings.ReplaceAll(description, "\n", " ")
+	if i := strings.Index(description, ". "); i >= 0 {
+		return description[:i+1]
+	}
+	return description
+}
+
+// Single quotes for bash and zsh. A single quote in s is written as \' between two quoted parts.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "'\\''") + "'"
+}
+
+// Single quotes for fish, where \' and \\ are escape sequences.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer("\\", "\\\\", "'", "\\'").Replace(s) + "'"
+}
@@ -0,0 +1,57 @@
+package cmdline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompleteCommand(t *testing.T) {
+	assertCandidates(t, Complete(nil, "pu", nil), "push-cancel", "push-list", "put")
+}
+
+func TestCompleteOption(t *testing.T) {
+	assertCandidates(t, Complete([]string{"get"}, "--t", nil), "--timeout")
+	assertCandidates(t, Complete([]string{"ping"}, "--i", nil), "--interval")
+}
+
+func TestCompleteFrameTypes(t *testing.T) {
+	assertCandidates(t, Complete([]string{"start", "--dump", "--include"}, "HEADERS,P", nil), "HEADERS,PING", "HEADERS,PRIORITY", "HEADERS,PUSH_PROMISE")
+}
+
+func TestCompletePath(t *testing.T) {
+	paths := []string{"/index.html", "/img/logo.png", "/index.html"}
+	assertCandidates(t, Complete([]string{"get", "-i"}, "/i", paths), "/img/logo.png", "/index.html")
+	assertCandidates(t, Complete([]string{"get", "--timeout"}, "/i", paths))
+	assertCandidates(t, Complete([]string{"set"}, "/i", paths))
+}
+
+func TestCompletionScriptsComplete(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		script, err := CompletionScript(shell)
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %v", shell, err)
+		}
+		for _, cmd := range commands {
+			if !strings.Contains(script, cmd.name) {
+				t.Errorf("Command %v missing in %v completion script.", cmd.name, shell)
+			}
+		}
+		for _, opt := range options {
+			if !strings.Contains(script, strings.TrimPrefix(opt.long, "--")) {
+				t.Errorf("Option %v missing in %v completion script.", opt.long, shell)
+			}
+		}
+		if !strings.Contains(script, "PUSH_PROMISE") {
+			t.Errorf("Frame types missing in %v completion script.", shell)
+		}
+	}
+	if _, err := CompletionScript("ksh"); err == nil {
+		t.Error("Expected error for unsupported shell.")
+	}
+}
+
+func assertCandidates(t *testing.T, actual []string, expected ...string) {
+	if strings.Join(actual, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected candidates %v, but got %v", expected, actual)
+	}
+}
@@ -1,14 +1,21 @@
 package cmdline
 
 import (
+	"path"
 	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fstab/h2c/http2client/frames"
 )
 
+const UNLIMITED_ARGS = -1
+
 type command struct {
 	name         string
 	description  string
 	minArgs      int
-	maxArgs      int
+	maxArgs      int // UNLIMITED_ARGS if there is no limit
 	areArgsValid func([]string) bool
 	usage        string
 }
@@ -40,14 +47,15 @@ var (
 		usage:       "h2c disconnect",
 	}
 	GET_COMMAND = &command{
-		name:        "get",
-		description: "Perform a GET request.",
-		minArgs:     1,
-		maxArgs:     1,
+		name: "get",
+		description: "Perform a GET request. With multiple paths, all requests are sent at once on the same connection,\n" +
+			"and each response is shown as soon as it is complete.",
+		minArgs: 1,
+		maxArgs: UNLIMITED_ARGS,
 		areArgsValid: func(args []string) bool {
 			return true
 		},
-		usage: "h2c get [options] <path>",
+		usage: "h2c get [options] <path> [<path> ...]",
 	}
 	PUT_COMMAND = &command{
 		name:        "put",
@@ -70,27 +78,31 @@ var (
 		usage: "h2c post [options] <path>",
 	}
 	SET_COMMAND = &command{
-		name:        "set",
-		description: "Set a header. The header will be included in any subsequent request.",
-		minArgs:     2,
-		maxArgs:     2,
+		name: "set",
+		description: "Set a header. The header will be included in any subsequent request.\n" +
+			"Use --for-origin and --for-path to include the header only in matching requests.\n" +
+			"Pseudo-headers like :authority may be set to override the default values.\n" +
+			"Without arguments, the headers defined with 'h2c set' are listed.",
+		minArgs: 0,
+		maxArgs: 2,
 		areArgsValid: func(args []string) bool {
-			return true
+			return len(args) == 2
 		},
-		usage: "h2c set <header-name> <header-value>",
+		usage: "h2c set [options] [<header-name> <header-value>]",
 	}
 	UNSET_COMMAND = &command{
 		name: "unset",
 		description: "Undo 'h2c set'. The header will no longer be included in subsequent requests.\n" +
 			"If <header-value> is omitted, all headers with <header-name> are removed.\n" +
 			"Otherwise, only the specific value is removed but other headers with the same\n" +
-			"name remain.",
+			"name remain.\n" +
+			"Use --for-origin and --for-path to remove a header that was set with these options.",
 		minArgs: 1,
 		maxArgs: 2,
 		areArgsValid: func(args []string) bool {
 			return true
 		},
-		usage: "h2c unset <header-name> [<header-value>]",
+		usage: "h2c unset [options] <header-name> [<header-value>]",
 	}
 	PING_COMMAND = &command{
 		name:        "ping",
@@ -120,6 +132,156 @@ var (
 		maxArgs:     0,
 		usage:       "h2c push-list",
 	}
+	PUSH_CANCEL_COMMAND = &command{
+		name: "push-cancel",
+		description: "Cancel a push promise. This sends RST_STREAM with error code CANCEL.\n" +
+			"The push promise is identified by its stream id or by its path, as shown in 'h2c push-list'.",
+		minArgs: 1,
+		maxArgs: 1,
+		areArgsValid: func(args []string) bool {
+			return true
+		},
+		usage: "h2c push-cancel <path|id>",
+	}
+	SEND_FRAME_COMMAND = &command{
+		name: "send-frame",
+		description: "Write a frame on the current connection as is, bypassing the stream state machine.\n" +
+			"Use --payload for arbitrary frames, or --headers, --setting, --error-code, and --increment for well-formed frames.\n" +
+			"Frames received on streams opened with send-frame are not processed. Use 'h2c start --dump' or 'h2c watch --frames' to see them.\n" +
+			"Example: h2c send-frame --type HEADERS --stream 1 --flags END_STREAM,END_HEADERS --headers ':method: GET' --headers ':path: /' ...",
+		minArgs: 0,
+		maxArgs: 0,
+		usage:   "h2c send-frame [options]",
+	}
+	RULE_COMMAND = &command{
+		name: "rule",
+		description: "Add, list, or remove fault injection rules, which drop, delay, duplicate, or corrupt frames.\n" +
+			"A rule is an action, a frame type, and optional conditions, like 'drop WINDOW_UPDATE stream=0 count=3',\n" +
+			"'delay DATA 200ms', 'duplicate incoming PING', or 'corrupt HEADERS'. Actions are drop, delay <duration>,\n" +
+			"duplicate, and corrupt. Rules apply to outgoing frames unless 'incoming' is given, and to all matching frames\n" +
+			"unless 'count=<n>' is given. If multiple rules match a frame, only the first one is applied.\n" +
+			"Rules can also be given on start with 'h2c start --rule <rule>'.",
+		minArgs: 1,
+		maxArgs: UNLIMITED_ARGS,
+		areArgsValid: func(args []string) bool {
+			switch args[0] {
+			case "add":
+				return len(args) > 1
+			case "rm":
+				return len(args) == 2 && regexp.MustCompile("^[0-9]+$").MatchString(args[1])
+			case "list":
+				return len(args) == 1
+			default:
+				return false
+			}
+		},
+		usage: "h2c rule add <rule>\n" +
+			"       h2c rule list\n" +
+			"       h2c rule rm <id>",
+	}
+	DUMP_COMMAND = &command{
+		name: "dump",
+		description: "Turn the frame dump on or off while h2c is running, without losing the connection.\n" +
+			"Frames are dumped where 'h2c start' writes them, i.e. to the console of the h2c process, or to the --dump-file.\n" +
+			"Without --include or --exclude, all frame types are dumped. Without arguments, the current setting is shown.",
+		minArgs: 0,
+		maxArgs: 1,
+		areArgsValid: func(args []string) bool {
+			return args[0] == "on" || args[0] == "off"
+		},
+		usage: "h2c dump [options] [on|off]",
+	}
+	HISTORY_COMMAND = &command{
+		name:        "history",
+		description: "List the requests sent so far. Use the number in the first column with 'h2c replay'.",
+		minArgs:     0,
+		maxArgs:     0,
+		usage:       "h2c history",
+	}
+	REPLAY_COMMAND = &command{
+		name: "replay",
+		description: "Send a request from 'h2c history' again, with the same headers and body.\n" +
+			"The request is sent on the current connection.",
+		minArgs: 1,
+		maxArgs: 1,
+		areArgsValid: func(args []string) bool {
+			return regexp.MustCompile("^[0-9]+$").MatchString(args[0])
+		},
+		usage: "h2c replay [options] <n>",
+	}
+	BENCH_COMMAND = &command{
+		name: "bench",
+		description: "Send GET requests on new connections and measure requests/s, bytes/s, and latency.\n" +
+			"The current connection is not affected. Use --rate to limit the load on the server.",
+		minArgs: 1,
+		maxArgs: 1,
+		areArgsValid: func(args []string) bool {
+			return true
+		},
+		usage: "h2c bench [options] <url>",
+	}
+	CONFORMANCE_COMMAND = &command{
+		name: "conformance",
+		description: "Check how a server reacts to frames that violate the HTTP/2 protocol, like h2spec.\n" +
+			"Each test runs on a new cleartext connection, h2c does not need to be running. The exit code is 1 if a test failed.\n" +
+			"Without --timeout, the server has 2 seconds to react in each test.",
+		minArgs: 1,
+		maxArgs: 1,
+		areArgsValid: func(args []string) bool {
+			return regexp.MustCompile("^[^:]+:[0-9]+$").MatchString(args[0])
+		},
+		usage: "h2c conformance [options] <host:port>",
+	}
+	HAR_COMMAND = &command{
+		name: "har",
+		description: "Export the requests and responses of all connections as a HAR file.\n" +
+			"HAR files can be opened with the developer tools of most web browsers.",
+		minArgs: 2,
+		maxArgs: 2,
+		areArgsValid: func(args []string) bool {
+			return args[0] == "export"
+		},
+		usage: "h2c har export <file>",
+	}
+	WATCH_COMMAND = &command{
+		name: "watch",
+		description: "Print events as they happen, until interrupted with Ctrl-C.\n" +
+			"Without options, push promises, stream state changes, RST_STREAM, GOAWAY, and ping round trip times are shown.",
+		minArgs: 0,
+		maxArgs: 0,
+		usage:   "h2c watch [options]",
+	}
+	SHELL_COMMAND = &command{
+		name: "shell",
+		description: "Run h2c commands interactively. Type commands without the 'h2c' prefix, like 'get /index.html'.\n" +
+			"Push promises and GOAWAY frames are shown as they arrive. Type 'exit' or press Ctrl-D to quit.\n" +
+			"The command history is saved in ~/.h2c_history.",
+		minArgs: 0,
+		maxArgs: 0,
+		usage:   "h2c shell",
+	}
+	RUN_COMMAND = &command{
+		name: "run",
+		description: "Run a script with h2c commands, variables, and expect steps, and report the result of each step.\n" +
+			"Use '-' to read the script from stdin. The exit code is 1 if an expect step failed. See the README for the script format.",
+		minArgs: 1,
+		maxArgs: 1,
+		areArgsValid: func(args []string) bool {
+			return true
+		},
+		usage: "h2c run [options] <script>",
+	}
+	COMPLETION_COMMAND = &command{
+		name: "completion",
+		description: "Print a tab completion script for bash, zsh, or fish.\n" +
+			"Example: Run 'source <(h2c completion bash)' to enable tab completion in the current bash session.",
+		minArgs: 1,
+		maxArgs: 1,
+		areArgsValid: func(args []string) bool {
+			return args[0] == "bash" || args[0] == "zsh" || args[0] == "fish"
+		},
+		usage: "h2c completion bash|zsh|fish",
+	}
 	STOP_COMMAND = &command{
 		name:        "stop",
 		description: "Stop the h2c process.",
@@ -133,7 +295,7 @@ var (
 			"The wiretap command listens on localhost:port and fowards all traffic to remotehost:port.",
 		minArgs: 2,
 		maxArgs: 2,
-		usage:   "h2c wiretap <localhost:port> <remotehost:port>\n",
+		usage:   "h2c wiretap [options] <localhost:port> <remotehost:port>\n",
 	}
 	VERSION_COMMAND = &command{
 		name:        "version",
@@ -160,40 +322,69 @@ var commands = []*command{
 	PING_COMMAND,
 	PID_COMMAND,
 	PUSH_LIST_COMMAND,
+	PUSH_CANCEL_COMMAND,
+	SEND_FRAME_COMMAND,
+	RULE_COMMAND,
+	DUMP_COMMAND,
 	STREAM_INFO_COMMAND,
+	HISTORY_COMMAND,
+	REPLAY_COMMAND,
+	BENCH_COMMAND,
+	CONFORMANCE_COMMAND,
+	HAR_COMMAND,
+	WATCH_COMMAND,
+	SHELL_COMMAND,
+	RUN_COMMAND,
+	COMPLETION_COMMAND,
 	STOP_COMMAND,
 	WIRETAP_COMMAND,
 	VERSION_COMMAND,
 }
 
 type option struct {
-	short        string
-	long         string
-	description  string
-	commands     []*command
-	hasParam     bool
-	isParamValid func(string) bool
+	short         string
+	long          string
+	description   string
+	commands      []*command
+	hasParam      bool
+	isParamValid  func(string) bool
+	isRepeatable  bool                         // option may be used multiple times, use GetAll() to get all values.
+	completeParam func(prefix string) []string // candidates for tab completion of the parameter, may be nil.
 }
 
 func (o *option) Name() string {
 	return o.long
 }
 
-func (o *option) IsSet(m map[string]string) bool {
+func (o *option) IsSet(m map[string][]string) bool {
 	_, ok := m[o.long]
 	return ok
 }
 
-func (o *option) Get(m map[string]string) string {
+// Get returns the value of the option. For repeatable options, this is the first value.
+func (o *option) Get(m map[string][]string) string {
+	val, _ := m[o.long]
+	if len(val) == 0 {
+		return ""
+	}
+	return val[0]
+}
+
+// GetAll returns the values of a repeatable option in the order they appeared on the command line.
+func (o *option) GetAll(m map[string][]string) []string {
 	val, _ := m[o.long]
 	return val
 }
 
-func (o *option) Set(val string, m map[string]string) {
-	m[o.long] = val
+func (o *option) Set(val string, m map[string][]string) {
+	m[o.long] = []string{val}
+}
+
+func (o *option) Add(val string, m map[string][]string) {
+	m[o.long] = append(m[o.long], val)
 }
 
-func (o *option) Delete(m map[string]string) {
+func (o *option) Delete(m map[string][]string) {
 	delete(m, o.long)
 }
 
@@ -201,28 +392,83 @@ var (
 	INCLUDE_FRAMES_OPTION = &option{
 		short:       "-i",
 		long:        "--include",
-		description: "Use with --dump to show only the specified frame times. Example: --include HEADERS,CONTINUATION",
-		commands:    []*command{START_COMMAND},
+		description: "Use with --dump or --dump-file to show only the specified frame times. Example: --include HEADERS,CONTINUATION",
+		commands:    []*command{START_COMMAND, DUMP_COMMAND},
 		hasParam:    true,
 		isParamValid: func(param string) bool {
-			return regexp.MustCompile("^[A-Za-z_]+(,\\s*[A-Za-z_]+)?$").MatchString(param)
+			return regexp.MustCompile("^[A-Za-z_]+(,\\s*[A-Za-z_]+)*$").MatchString(param)
 		},
+		completeParam: completeFrameTypes,
 	}
 	EXCLUDE_FRAMES_OPTION = &option{
 		short:       "-e",
 		long:        "--exclude",
-		description: "Use with --dump to exclude the specified frame times. Example: --exclude PING,PRIORITY",
-		commands:    []*command{START_COMMAND},
+		description: "Use with --dump or --dump-file to exclude the specified frame times. Example: --exclude PING,PRIORITY",
+		commands:    []*command{START_COMMAND, DUMP_COMMAND},
 		hasParam:    true,
 		isParamValid: func(param string) bool {
 			return INCLUDE_FRAMES_OPTION.isParamValid(param)
 		},
+		completeParam: completeFrameTypes,
+	}
+	DUMP_STREAM_OPTION = &option{
+		short:       "-s",
+		long:        "--stream",
+		description: "Use with --dump or --dump-file to show only the frames of the specified stream. Frames on stream 0, like SETTINGS, are not shown.",
+		commands:    []*command{START_COMMAND, DUMP_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			_, err := strconv.ParseUint(param, 10, 31)
+			return err == nil
+		},
+	}
+	HEADER_NAME_OPTION = &option{
+		short:       "-n",
+		long:        "--header-name",
+		description: "Use with --dump or --dump-file to show only the frames of streams with a header name matching the regular expression, like --header-name '^x-request-id$'. Frames on stream 0 are not shown.",
+		commands:    []*command{START_COMMAND, DUMP_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			_, err := regexp.Compile(param)
+			return err == nil
+		},
+	}
+	TIMESTAMPS_OPTION = &option{
+		short:       "-t",
+		long:        "--timestamps",
+		description: "Use with --dump or --dump-file to prefix each frame with a timestamp. Either 'absolute' (the time of day) or 'relative' (seconds since the first frame of the connection).",
+		commands:    []*command{START_COMMAND, DUMP_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return param == "absolute" || param == "relative"
+		},
+		completeParam: func(prefix string) []string {
+			return withPrefix([]string{"absolute", "relative"}, prefix)
+		},
+	}
+	HEX_OPTION = &option{
+		short:       "-x",
+		long:        "--hex",
+		description: "Use with --dump or --dump-file to show a hex dump of each frame as it is encoded on the wire.",
+		commands:    []*command{START_COMMAND, DUMP_COMMAND},
+	}
+	PREVIEW_OPTION = &option{
+		short:       "-b",
+		long:        "--preview",
+		description: "Use with --dump or --dump-file to show a preview of the payload of DATA frames: UTF-8 text as is, JSON pretty printed, gRPC messages with their boundaries, anything else as hex.",
+		commands:    []*command{START_COMMAND, DUMP_COMMAND},
+	}
+	HPACK_OPTION = &option{
+		short:       "-c",
+		long:        "--hpack",
+		description: "Use with --dump or --dump-file to show how each header is HPACK encoded (indexed or literal, Huffman coding), and the size of the dynamic table after each header block.",
+		commands:    []*command{START_COMMAND, DUMP_COMMAND},
 	}
 	INCLUDE_HEADERS_OPTION = &option{
 		short:       "-i",
 		long:        "--include",
 		description: "Show response headers in the output.",
-		commands:    []*command{GET_COMMAND, PUT_COMMAND, POST_COMMAND},
+		commands:    []*command{GET_COMMAND, PUT_COMMAND, POST_COMMAND, REPLAY_COMMAND},
 		hasParam:    false,
 	}
 	INCLUDE_CLOSED_STREAMS_OPTION = &option{
@@ -236,12 +482,43 @@ var (
 		short:       "-t",
 		long:        "--timeout",
 		description: "Timeout in seconds while waiting for response.",
-		commands:    []*command{GET_COMMAND, PUT_COMMAND, POST_COMMAND},
+		commands:    []*command{GET_COMMAND, PUT_COMMAND, POST_COMMAND, REPLAY_COMMAND, BENCH_COMMAND, CONFORMANCE_COMMAND},
 		hasParam:    true,
 		isParamValid: func(param string) bool {
 			return regexp.MustCompile("^[0-9]+$").MatchString(param)
 		},
 	}
+	HEADER_OPTION = &option{
+		short:        "-H",
+		long:         "--header",
+		description:  "Add a header to this request, like --header 'Accept: text/plain'. May be used multiple times. Overrides headers with the same name set with 'h2c set'.",
+		commands:     []*command{GET_COMMAND, PUT_COMMAND, POST_COMMAND, BENCH_COMMAND},
+		hasParam:     true,
+		isRepeatable: true,
+		isParamValid: func(param string) bool {
+			return regexp.MustCompile("^[^:\\s]+:").MatchString(param)
+		},
+	}
+	FOR_ORIGIN_OPTION = &option{
+		short:       "-o",
+		long:        "--for-origin",
+		description: "Include the header only in requests to the specified origin, like 'https://example.com'.",
+		commands:    []*command{SET_COMMAND, UNSET_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return regexp.MustCompile("^https?://[^/]+/?$").MatchString(param)
+		},
+	}
+	FOR_PATH_OPTION = &option{
+		short:       "-p",
+		long:        "--for-path",
+		description: "Include the header only in requests where the path starts with the specified prefix, like '/api/'.",
+		commands:    []*command{SET_COMMAND, UNSET_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return strings.HasPrefix(param, "/")
+		},
+	}
 	CONTENT_TYPE_OPTION = &option{
 		short:       "-c",
 		long:        "--content-type",
@@ -252,6 +529,27 @@ var (
 			return true
 		},
 	}
+	PCAP_FILE_OPTION = &option{
+		short:       "-p",
+		long:        "--pcap-file",
+		description: "Write all frames to the specified file in pcapng format, which can be opened with Wireshark. The file will be overwritten.",
+		commands:    []*command{START_COMMAND, WIRETAP_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return len(param) > 0
+		},
+	}
+	RULE_OPTION = &option{
+		short:        "-r",
+		long:         "--rule",
+		description:  "Add a fault injection rule, like --rule 'drop WINDOW_UPDATE stream=0 count=3'. May be used multiple times. See 'h2c rule --help' for the syntax.",
+		commands:     []*command{START_COMMAND},
+		hasParam:     true,
+		isRepeatable: true,
+		isParamValid: func(param string) bool {
+			return len(strings.Fields(param)) >= 2
+		},
+	}
 	DATA_OPTION = &option{
 		short:       "-d",
 		long:        "--data",
@@ -272,6 +570,16 @@ var (
 			return true
 		},
 	}
+	PARALLEL_OPTION = &option{
+		short:       "-P",
+		long:        "--parallel",
+		description: "Read the paths from a file, one per line, and send all requests at once. Use '--parallel -' to read from stdin.",
+		commands:    []*command{GET_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return true
+		},
+	}
 	HELP_OPTION = &option{
 		short:       "-h",
 		long:        "--help",
@@ -286,6 +594,29 @@ var (
 		commands:    []*command{START_COMMAND},
 		hasParam:    false,
 	}
+	DUMP_FILE_OPTION = &option{
+		short:       "-o",
+		long:        "--dump-file",
+		description: "Dump traffic to the specified file instead of the console. The file will be overwritten.",
+		commands:    []*command{START_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return len(param) > 0
+		},
+	}
+	DUMP_FORMAT_OPTION = &option{
+		short:       "-f",
+		long:        "--dump-format",
+		description: "Use with --dump or --dump-file. Either 'text' (the default) or 'json'. With 'json', each frame is dumped as a single line JSON object.",
+		commands:    []*command{START_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return param == "text" || param == "json"
+		},
+		completeParam: func(prefix string) []string {
+			return withPrefix([]string{"text", "json"}, prefix)
+		},
+	}
 	INTERVAL_OPTION = &option{
 		short:       "-i",
 		long:        "--interval",
@@ -303,19 +634,288 @@ var (
 		commands:    []*command{PING_COMMAND},
 		hasParam:    false,
 	}
+	NO_PUSH_OPTION = &option{
+		short:       "-n",
+		long:        "--no-push",
+		description: "Refuse all push promises with REFUSED_STREAM.",
+		commands:    []*command{CONNECT_COMMAND},
+		hasParam:    false,
+	}
+	MAX_PUSHES_OPTION = &option{
+		short:       "-m",
+		long:        "--max-pushes",
+		description: "Accept at most the specified number of push promises on this connection, refuse the others with REFUSED_STREAM.",
+		commands:    []*command{CONNECT_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return regexp.MustCompile("^[0-9]+$").MatchString(param)
+		},
+	}
+	ALLOW_PUSH_OPTION = &option{
+		short:       "-a",
+		long:        "--allow-push",
+		description: "Accept push promises only for the specified paths, refuse the others with REFUSED_STREAM. Example: --allow-push '/css/*,/js/*'",
+		commands:    []*command{CONNECT_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			for _, pattern := range strings.Split(param, ",") {
+				if _, err := path.Match(strings.TrimSpace(pattern), ""); err != nil || strings.TrimSpace(pattern) == "" {
+					return false
+				}
+			}
+			return true
+		},
+	}
+	TIMES_OPTION = &option{
+		short:       "-n",
+		long:        "--times",
+		description: "Send the request the specified number of times, and show status, size, and duration of each response.",
+		commands:    []*command{REPLAY_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return regexp.MustCompile("^[1-9][0-9]*$").MatchString(param)
+		},
+	}
+	REQUESTS_OPTION = &option{
+		short:       "-n",
+		long:        "--requests",
+		description: "Total number of requests. Default is 100, or no limit if --duration is given.",
+		commands:    []*command{BENCH_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return regexp.MustCompile("^[1-9][0-9]*$").MatchString(param)
+		},
+	}
+	CONCURRENT_STREAMS_OPTION = &option{
+		short:       "-c",
+		long:        "--concurrent-streams",
+		description: "Number of concurrent streams on each connection, at most 999, and at most the server's SETTINGS_MAX_CONCURRENT_STREAMS. Default is 1.",
+		commands:    []*command{BENCH_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return regexp.MustCompile("^[1-9][0-9]{0,2}$").MatchString(param)
+		},
+	}
+	CONNECTIONS_OPTION = &option{
+		short:       "-k",
+		long:        "--connections",
+		description: "Number of connections, at most 99. Default is 1.",
+		commands:    []*command{BENCH_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return regexp.MustCompile("^[1-9][0-9]?$").MatchString(param)
+		},
+	}
+	DURATION_OPTION = &option{
+		short:       "-D",
+		long:        "--duration",
+		description: "Stop sending requests after the duration, like 500ms, 10s, or 2m. Stops earlier if the number of --requests is reached.",
+		commands:    []*command{BENCH_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return INTERVAL_OPTION.isParamValid(param)
+		},
+	}
+	RATE_OPTION = &option{
+		short:       "-r",
+		long:        "--rate",
+		description: "Send at most this many requests per second over all connections, like --rate 50 or --rate 0.5",
+		commands:    []*command{BENCH_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return regexp.MustCompile("^[0-9]+(\\.[0-9]+)?$").MatchString(param) && regexp.MustCompile("[1-9]").MatchString(param)
+		},
+	}
+	FAIL_OPTION = &option{
+		short:       "-F",
+		long:        "--fail",
+		description: "Fail if the response has an HTTP status >= 400, like 'curl --fail'. The exit code is 22, and the body is not shown.",
+		commands:    []*command{GET_COMMAND, PUT_COMMAND, POST_COMMAND, REPLAY_COMMAND},
+		hasParam:    false,
+	}
+	WRITE_OUT_OPTION = &option{
+		short: "-w",
+		long:  "--write-out",
+		description: "Print information about the response after the output, like 'curl --write-out'. Times are in seconds since the request was sent. " +
+			"Example: --write-out '%{http_status} %{time_first_byte}\\n'. Variables: %{" + strings.Join(WRITE_OUT_VARIABLES, "}, %{") + "}",
+		commands: []*command{GET_COMMAND, PUT_COMMAND, POST_COMMAND, REPLAY_COMMAND},
+		hasParam: true,
+		isParamValid: func(param string) bool {
+			return isWriteOutTemplateValid(param)
+		},
+	}
+	FRAME_TYPE_OPTION = &option{
+		short:       "-T",
+		long:        "--type",
+		description: "Frame type, like SETTINGS, or a number like 0x0a for unknown frame types. May be omitted with --headers, --setting, or --increment.",
+		commands:    []*command{SEND_FRAME_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			_, isFrameName := frames.FrameNameToType(param)
+			return isFrameName || regexp.MustCompile("^0x[0-9a-fA-F]{1,2}$").MatchString(param)
+		},
+		completeParam: completeFrameTypes,
+	}
+	STREAM_ID_OPTION = &option{
+		short:       "-s",
+		long:        "--stream",
+		description: "Stream id. Default is 0.",
+		commands:    []*command{SEND_FRAME_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			id, err := strconv.ParseUint(param, 10, 31)
+			return err == nil && id < 1<<31
+		},
+	}
+	FLAGS_OPTION = &option{
+		short:       "-f",
+		long:        "--flags",
+		description: "Comma separated list of flags, like END_STREAM,END_HEADERS, or a number like 0x05. Default is END_HEADERS with --headers, and no flags otherwise.",
+		commands:    []*command{SEND_FRAME_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return regexp.MustCompile("^(0x[0-9a-fA-F]{1,2}|[A-Z_]+(,[A-Z_]+)*)$").MatchString(param)
+		},
+	}
+	PAYLOAD_OPTION = &option{
+		short:       "-p",
+		long:        "--payload",
+		description: "Frame payload in hex, like '00 00 00 01', or @file to send the content of file. Default is an empty payload.",
+		commands:    []*command{SEND_FRAME_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return strings.HasPrefix(param, "@") || regexp.MustCompile("^[0-9a-fA-F\\s:]*$").MatchString(param)
+		},
+	}
+	FRAME_HEADERS_OPTION = &option{
+		short:        "-H",
+		long:         "--headers",
+		description:  "Add a header field to the header block of a HEADERS frame, like --headers ':path: /'. May be used multiple times. The header fields are encoded with the connection's HPACK context, in the given order, without validation.",
+		commands:     []*command{SEND_FRAME_COMMAND},
+		hasParam:     true,
+		isRepeatable: true,
+		isParamValid: func(param string) bool {
+			return regexp.MustCompile("^:?[^:\\s]+:").MatchString(param)
+		},
+	}
+	SETTING_OPTION = &option{
+		short:        "-S",
+		long:         "--setting",
+		description:  "Add a setting to a SETTINGS frame, like --setting SETTINGS_MAX_FRAME_SIZE=32768. May be used multiple times.",
+		commands:     []*command{SEND_FRAME_COMMAND},
+		hasParam:     true,
+		isRepeatable: true,
+		isParamValid: func(param string) bool {
+			return regexp.MustCompile("^[A-Z_]+=[0-9]+$").MatchString(param)
+		},
+	}
+	ERROR_CODE_OPTION = &option{
+		short:       "-e",
+		long:        "--error-code",
+		description: "Error code of an RST_STREAM or GOAWAY frame, like CANCEL. The last stream id of GOAWAY frames is 0.",
+		commands:    []*command{SEND_FRAME_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			return regexp.MustCompile("^([A-Z_0-9]+|0x[0-9a-fA-F]{1,8})$").MatchString(param)
+		},
+	}
+	INCREMENT_OPTION = &option{
+		short:       "-i",
+		long:        "--increment",
+		description: "Window size increment of a WINDOW_UPDATE frame.",
+		commands:    []*command{SEND_FRAME_COMMAND},
+		hasParam:    true,
+		isParamValid: func(param string) bool {
+			_, err := strconv.ParseUint(param, 10, 31)
+			return err == nil
+		},
+	}
+	JSON_OPTION = &option{
+		short:       "-j",
+		long:        "--json",
+		description: "Print the result as JSON. Errors are printed as JSON objects with the kind of error and the HTTP/2 error code.",
+		commands:    commands, // json option is available for all commands, commands without output print an empty object.
+		hasParam:    false,
+	}
+	VERBOSE_OPTION = &option{
+		short:       "-v",
+		long:        "--verbose",
+		description: "Show the output of each command, like the response body.",
+		commands:    []*command{RUN_COMMAND},
+		hasParam:    false,
+	}
+	PUSH_EVENTS_OPTION = &option{
+		short:       "-p",
+		long:        "--push",
+		description: "Show push promises.",
+		commands:    []*command{WATCH_COMMAND},
+		hasParam:    false,
+	}
+	STREAM_EVENTS_OPTION = &option{
+		short:       "-s",
+		long:        "--streams",
+		description: "Show stream state changes and RST_STREAM frames received.",
+		commands:    []*command{WATCH_COMMAND},
+		hasParam:    false,
+	}
+	FRAME_EVENTS_OPTION = &option{
+		short:       "-f",
+		long:        "--frames",
+		description: "Show a one line summary for each frame sent or received.",
+		commands:    []*command{WATCH_COMMAND},
+		hasParam:    false,
+	}
 )
 
 var options = []*option{
 	INCLUDE_FRAMES_OPTION,
 	EXCLUDE_FRAMES_OPTION,
+	DUMP_STREAM_OPTION,
+	HEADER_NAME_OPTION,
+	TIMESTAMPS_OPTION,
+	HEX_OPTION,
+	PREVIEW_OPTION,
+	HPACK_OPTION,
 	INCLUDE_HEADERS_OPTION,
 	INCLUDE_CLOSED_STREAMS_OPTION,
 	TIMEOUT_OPTION,
+	HEADER_OPTION,
+	FOR_ORIGIN_OPTION,
+	FOR_PATH_OPTION,
 	CONTENT_TYPE_OPTION,
 	HELP_OPTION,
 	DUMP_OPTION,
+	DUMP_FILE_OPTION,
+	DUMP_FORMAT_OPTION,
+	PCAP_FILE_OPTION,
+	RULE_OPTION,
 	DATA_OPTION,
 	FILE_OPTION,
+	PARALLEL_OPTION,
 	INTERVAL_OPTION,
 	STOP_OPTION,
+	NO_PUSH_OPTION,
+	MAX_PUSHES_OPTION,
+	ALLOW_PUSH_OPTION,
+	TIMES_OPTION,
+	REQUESTS_OPTION,
+	CONCURRENT_STREAMS_OPTION,
+	CONNECTIONS_OPTION,
+	DURATION_OPTION,
+	RATE_OPTION,
+	FAIL_OPTION,
+	WRITE_OUT_OPTION,
+	FRAME_TYPE_OPTION,
+	STREAM_ID_OPTION,
+	FLAGS_OPTION,
+	PAYLOAD_OPTION,
+	FRAME_HEADERS_OPTION,
+	SETTING_OPTION,
+	ERROR_CODE_OPTION,
+	INCREMENT_OPTION,
+	JSON_OPTION,
+	VERBOSE_OPTION,
+	PUSH_EVENTS_OPTION,
+	STREAM_EVENTS_OPTION,
+	FRAME_EVENTS_OPTION,
 }
@@ -6,6 +6,9 @@ func TestConfig(t *testing.T) {
 	if len(commands) != len(HELP_OPTION.commands) {
 		t.Error("Some command does not have a help option.")
 	}
+	if len(commands) != len(JSON_OPTION.commands) {
+		t.Error("Some command does not have a json option.")
+	}
 }
 
 func TestOptionsComplete(t *testing.T) {
@@ -69,3 +72,46 @@ func TestIntervalOption(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteOutOption(t *testing.T) {
+	invalid := []string{
+		"%{unknown}",
+		"%{time_total",
+		"%{http_status} %{}",
+	}
+	valid := []string{
+		"",
+		"%{http_status}",
+		"%{time_first_byte} %{size_download} %{http_status}\\n",
+		"100%",
+	}
+	for _, param := range invalid {
+		if WRITE_OUT_OPTION.isParamValid(param) {
+			t.Error(param, " should not be a valid --write-out template.")
+		}
+	}
+	for _, param := range valid {
+		if !WRITE_OUT_OPTION.isParamValid(param) {
+			t.Error(param, " should be a valid --write-out template.")
+		}
+	}
+	expanded := ExpandWriteOut("%{http_status}\\t%{size_download}\\n", func(variable string) string {
+		return variable
+	})
+	if expanded != "http_status\tsize_download\n" {
+		t.Errorf("Unexpected expansion %q", expanded)
+	}
+}
+
+func TestJsonOptionForAllCommands(t *testing.T) {
+	for _, cmd := range commands {
+		for _, name := range []string{JSON_OPTION.short, JSON_OPTION.long} {
+			_, options, err := parseOptions([]string{cmd.name, name}, cmd)
+			if err != nil {
+				t.Errorf("h2c %v %v: %v", cmd.name, name, err.Error())
+			} else if !JSON_OPTION.IsSet(options) {
+				t.Errorf("h2c %v %v: Option not set.", cmd.name, name)
+			}
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/fstab/h2c/cli/rpc"
+	"strings"
 )
 
 func Parse(args []string) (*rpc.Command, error) {
@@ -16,6 +17,9 @@ func Parse(args []string) (*rpc.Command, error) {
 	if err != nil {
 		return nil, err
 	}
+	if cmd == VERSION_COMMAND && len(args) == 1 && args[0] == "--"+VERSION_COMMAND.name {
+		args = []string{VERSION_COMMAND.name}
+	}
 	remainingArgs, options, err := parseOptions(args, cmd)
 	if err != nil {
 		return nil, err
@@ -23,7 +27,11 @@ func Parse(args []string) (*rpc.Command, error) {
 	if HELP_OPTION.IsSet(options) {
 		return nil, errors.New(help(cmd))
 	}
-	if len(remainingArgs) < cmd.minArgs+1 || len(remainingArgs) > cmd.maxArgs+1 {
+	minArgs := cmd.minArgs
+	if PARALLEL_OPTION.IsSet(options) {
+		minArgs = 0 // The paths are read from the --parallel file.
+	}
+	if len(remainingArgs) < minArgs+1 || (cmd.maxArgs != UNLIMITED_ARGS && len(remainingArgs) > cmd.maxArgs+1) {
 		return nil, errors.New(usage(cmd))
 	}
 	cmdArgs := make([]string, 0)
@@ -36,30 +44,90 @@ func Parse(args []string) (*rpc.Command, error) {
 	return rpc.NewCommand(cmd.name, cmdArgs, options)
 }
 
-func parseOptions(args []string, cmd *command) ([]string, map[string]string, error) {
-	err := fmt.Errorf("Syntax error. Run 'h2c %v %v' for help.", cmd.Name(), HELP_OPTION.Name())
-	foundOptions := make(map[string]string)
-	for _, opt := range options {
-		if opt.supportsCommand(cmd) {
-			i, found := opt.findIndex(args)
-			if found {
+// parseOptions removes the options from args and returns the remaining args, which start with the command name.
+//
+// Options may be written as '--timeout 5', '--timeout=5', '-t 5', or '-t5'.
+// Short options without parameter may be grouped, as in '-it 5' for '-i -t 5'.
+// All args after '--' are treated as regular args, even if they start with '-'.
+func parseOptions(args []string, cmd *command) ([]string, map[string][]string, error) {
+	foundOptions := make(map[string][]string)
+	remainingArgs := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return append(remainingArgs, args[i+1:]...), foundOptions, nil
+		case strings.HasPrefix(arg, "--"):
+			name, param, hasParam := strings.Cut(arg, "=")
+			opt := findOption(name, cmd)
+			if opt == nil {
+				return nil, nil, unknownOptionError(name, cmd)
+			}
+			if opt.hasParam && !hasParam {
+				if i+1 >= len(args) {
+					return nil, nil, missingParamError(opt, cmd)
+				}
+				i++
+				param = args[i]
+			} else if !opt.hasParam && hasParam {
+				return nil, nil, fmt.Errorf("Syntax error: %v does not take a value. Run 'h2c %v %v' for help.", opt.long, cmd.Name(), HELP_OPTION.Name())
+			}
+			if err := addOption(opt, param, foundOptions, cmd); err != nil {
+				return nil, nil, err
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			// group of short options, like '-it 5' or '-t5'
+			for j := 1; j < len(arg); j++ {
+				opt := findOption("-"+arg[j:j+1], cmd)
+				if opt == nil {
+					return nil, nil, unknownOptionError("-"+arg[j:j+1], cmd)
+				}
+				param := ""
 				if opt.hasParam {
-					if len(args) <= i+1 {
-						return nil, nil, err
+					if j+1 < len(arg) {
+						param = arg[j+1:]
+					} else if i+1 < len(args) {
+						i++
+						param = args[i]
+					} else {
+						return nil, nil, missingParamError(opt, cmd)
 					}
-					if !opt.isParamValid(args[i+1]) {
-						return nil, nil, err
-					}
-					opt.Set(args[i+1], foundOptions)
-					args = append(args[:i], args[i+2:]...)
-				} else {
-					opt.Set("", foundOptions)
-					args = append(args[:i], args[i+1:]...)
+				}
+				if err := addOption(opt, param, foundOptions, cmd); err != nil {
+					return nil, nil, err
+				}
+				if opt.hasParam {
+					break
 				}
 			}
+		default:
+			remainingArgs = append(remainingArgs, arg)
 		}
 	}
-	return args, foundOptions, nil
+	return remainingArgs, foundOptions, nil
+}
+
+func addOption(opt *option, param string, foundOptions map[string][]string, cmd *command) error {
+	if opt.IsSet(foundOptions) && !opt.isRepeatable {
+		return fmt.Errorf("Syntax error: %v may only be used once. Run 'h2c %v %v' for help.", opt.long, cmd.Name(), HELP_OPTION.Name())
+	}
+	if !opt.hasParam {
+		opt.Set("", foundOptions)
+		return nil
+	}
+	if !opt.isParamValid(param) {
+		return fmt.Errorf("%v: Invalid value for %v. Run 'h2c %v %v' for help.", param, opt.long, cmd.Name(), HELP_OPTION.Name())
+	}
+	opt.Add(param, foundOptions)
+	return nil
+}
+
+func unknownOptionError(name string, cmd *command) error {
+	return fmt.Errorf("%v: Unknown option for 'h2c %v'. Run 'h2c %v %v' for help.", name, cmd.Name(), cmd.Name(), HELP_OPTION.Name())
+}
+
+func missingParamError(opt *option, cmd *command) error {
+	return fmt.Errorf("Syntax error: %v requires a value. Run 'h2c %v %v' for help.", opt.long, cmd.Name(), HELP_OPTION.Name())
 }
 
 func globalUsage() string {
@@ -111,9 +179,10 @@ func findCommand(args []string) (*command, error) {
 			return cmd, nil
 		}
 	}
+	name, _, hasParam := strings.Cut(args[0], "=")
 	for _, opt := range options {
-		if args[0] == opt.short || args[0] == opt.long {
-			if opt.hasParam {
+		if name == opt.short || name == opt.long {
+			if opt.hasParam && !hasParam {
 				if len(args) < 2 {
 					return nil, errors.New(globalUsage())
 				} else {
@@ -126,13 +195,14 @@ func findCommand(args []string) (*command, error) {
 	return nil, errors.New(args[0] + ": Unknown command. Run 'h2c " + HELP_OPTION.long + "' for help.")
 }
 
-func (opt *option) findIndex(argv []string) (int, bool) {
-	for i, arg := range argv {
-		if arg == opt.short || arg == opt.long {
-			return i, true
+// findOption returns the option with the given short or long name, or nil if cmd has no such option.
+func findOption(name string, cmd *command) *option {
+	for _, opt := range options {
+		if (name == opt.short || name == opt.long) && opt.supportsCommand(cmd) {
+			return opt
 		}
 	}
-	return -1, false
+	return nil
 }
 
 func (opt *option) supportsCommand(cmd *command) bool {
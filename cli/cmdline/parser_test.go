@@ -2,6 +2,7 @@ package cmdline
 
 import (
 	"github.com/fstab/h2c/cli/rpc"
+	"strings"
 	"testing"
 )
 
@@ -10,8 +11,8 @@ func TestGetInclude(t *testing.T) {
 	expectedCmd := &rpc.Command{
 		Name: "get",
 		Args: []string{"path"},
-		Options: map[string]string{
-			"--include": "",
+		Options: map[string][]string{
+			"--include": {""},
 		},
 	}
 	assertSuccess(cmd, expectedCmd, err, t)
@@ -22,11 +23,35 @@ func TestGet(t *testing.T) {
 	expectedCmd := &rpc.Command{
 		Name:    "get",
 		Args:    []string{"path"},
-		Options: make(map[string]string),
+		Options: make(map[string][]string),
 	}
 	assertSuccess(cmd, expectedCmd, err, t)
 }
 
+func TestGetMultiplePaths(t *testing.T) {
+	cmd, err := Parse([]string{"get", "/a", "/b", "/c"})
+	expectedCmd := &rpc.Command{
+		Name:    "get",
+		Args:    []string{"/a", "/b", "/c"},
+		Options: make(map[string][]string),
+	}
+	assertSuccess(cmd, expectedCmd, err, t)
+}
+
+func TestGetParallelWithoutPath(t *testing.T) {
+	cmd, err := Parse([]string{"get", "--parallel", "paths.txt"})
+	expectedCmd := &rpc.Command{
+		Name: "get",
+		Args: make([]string, 0),
+		Options: map[string][]string{
+			"--parallel": {"paths.txt"},
+		},
+	}
+	assertSuccess(cmd, expectedCmd, err, t)
+	cmd, err = Parse([]string{"get"})
+	assertError(cmd, err, t)
+}
+
 func TestEmpty(t *testing.T) {
 	cmd, err := Parse(make([]string, 0))
 	assertError(cmd, err, t)
@@ -37,8 +62,8 @@ func TestDump(t *testing.T) {
 	expectedCmd := &rpc.Command{
 		Name: "start",
 		Args: make([]string, 0),
-		Options: map[string]string{
-			"--dump": "",
+		Options: map[string][]string{
+			"--dump": {""},
 		},
 	}
 	assertSuccess(cmd, expectedCmd, err, t)
@@ -49,13 +74,150 @@ func TestData(t *testing.T) {
 	expectedCmd := &rpc.Command{
 		Name: "post",
 		Args: []string{"some path"},
-		Options: map[string]string{
-			"--data": "some data",
+		Options: map[string][]string{
+			"--data": {"some data"},
+		},
+	}
+	assertSuccess(cmd, expectedCmd, err, t)
+}
+
+func TestRepeatedHeader(t *testing.T) {
+	cmd, err := Parse([]string{"get", "-H", "Accept: text/plain", "--timeout", "3", "--header", "X-Trace:1", "path"})
+	expectedCmd := &rpc.Command{
+		Name: "get",
+		Args: []string{"path"},
+		Options: map[string][]string{
+			"--header":  {"Accept: text/plain", "X-Trace:1"},
+			"--timeout": {"3"},
+		},
+	}
+	assertSuccess(cmd, expectedCmd, err, t)
+}
+
+func TestInvalidHeader(t *testing.T) {
+	cmd, err := Parse([]string{"get", "-H", "no colon", "path"})
+	assertError(cmd, err, t)
+}
+
+func TestRepeatedNonRepeatableOption(t *testing.T) {
+	cmd, err := Parse([]string{"get", "--timeout", "3", "--timeout", "4", "path"})
+	assertError(cmd, err, t)
+}
+
+func TestLongOptionWithEquals(t *testing.T) {
+	cmd, err := Parse([]string{"get", "--timeout=5", "--header=Accept: text/plain", "path"})
+	expectedCmd := &rpc.Command{
+		Name: "get",
+		Args: []string{"path"},
+		Options: map[string][]string{
+			"--timeout": {"5"},
+			"--header":  {"Accept: text/plain"},
+		},
+	}
+	assertSuccess(cmd, expectedCmd, err, t)
+}
+
+func TestGroupedShortOptions(t *testing.T) {
+	cmd, err := Parse([]string{"get", "-it", "5", "path"})
+	expectedCmd := &rpc.Command{
+		Name: "get",
+		Args: []string{"path"},
+		Options: map[string][]string{
+			"--include": {""},
+			"--timeout": {"5"},
+		},
+	}
+	assertSuccess(cmd, expectedCmd, err, t)
+}
+
+func TestShortOptionWithAttachedValue(t *testing.T) {
+	cmd, err := Parse([]string{"get", "-it5", "path"})
+	expectedCmd := &rpc.Command{
+		Name: "get",
+		Args: []string{"path"},
+		Options: map[string][]string{
+			"--include": {""},
+			"--timeout": {"5"},
 		},
 	}
 	assertSuccess(cmd, expectedCmd, err, t)
 }
 
+func TestEndOfOptions(t *testing.T) {
+	cmd, err := Parse([]string{"post", "-d", "-", "--", "-path"})
+	expectedCmd := &rpc.Command{
+		Name: "post",
+		Args: []string{"-path"},
+		Options: map[string][]string{
+			"--data": {"-"},
+		},
+	}
+	assertSuccess(cmd, expectedCmd, err, t)
+}
+
+func TestSameShortNameForDifferentCommands(t *testing.T) {
+	cmd, err := Parse([]string{"ping", "-i", "5s"})
+	expectedCmd := &rpc.Command{
+		Name: "ping",
+		Args: make([]string, 0),
+		Options: map[string][]string{
+			"--interval": {"5s"},
+		},
+	}
+	assertSuccess(cmd, expectedCmd, err, t)
+}
+
+func TestVersion(t *testing.T) {
+	cmd, err := Parse([]string{"--version"})
+	expectedCmd := &rpc.Command{
+		Name:    "version",
+		Args:    make([]string, 0),
+		Options: make(map[string][]string),
+	}
+	assertSuccess(cmd, expectedCmd, err, t)
+}
+
+func TestUnknownOption(t *testing.T) {
+	for _, args := range [][]string{
+		{"get", "--unknown", "path"},
+		{"get", "-x", "path"},
+		{"get", "-ix", "path"},
+		{"get", "--interval", "5s", "path"},
+	} {
+		cmd, err := Parse(args)
+		assertErrorMessage(cmd, err, "Unknown option", t)
+	}
+}
+
+func TestMissingOptionValue(t *testing.T) {
+	cmd, err := Parse([]string{"get", "path", "--timeout"})
+	assertErrorMessage(cmd, err, "--timeout requires a value", t)
+}
+
+func TestUnexpectedOptionValue(t *testing.T) {
+	cmd, err := Parse([]string{"get", "--include=yes", "path"})
+	assertErrorMessage(cmd, err, "--include does not take a value", t)
+}
+
+func TestSplitWords(t *testing.T) {
+	words, err := SplitWords(`get -H 'Accept: text/plain' --header "X-Name: \"h2c\"" /path\ with\ spaces  `)
+	expected := []string{"get", "-H", "Accept: text/plain", "--header", `X-Name: "h2c"`, "/path with spaces"}
+	if err != nil {
+		t.Fatal("Unexpected error: ", err.Error())
+	}
+	if strings.Join(words, "|") != strings.Join(expected, "|") {
+		t.Error("Expected ", expected, ", but got ", words)
+	}
+	words, err = SplitWords(`set x-empty ''`)
+	if err != nil || len(words) != 3 || words[2] != "" {
+		t.Error("Expected empty word in quotes, but got ", words, err)
+	}
+	_, err = SplitWords(`get 'unterminated`)
+	if err == nil {
+		t.Error("Expected error for missing closing quote.")
+	}
+}
+
 func assertSuccess(actual, expected *rpc.Command, err error, t *testing.T) {
 	if err != nil {
 		t.Error("Unexpected error: ", err.Error())
@@ -79,12 +241,20 @@ func assertSuccess(actual, expected *rpc.Command, err error, t *testing.T) {
 		if !exists {
 			t.Error("Expected option ", name, " missing.")
 		}
-		if expectedVal != val {
+		if strings.Join(expectedVal, ",") != strings.Join(val, ",") {
 			t.Error("Expected ", name, " to be ", expectedVal, ", but got ", val, ".")
 		}
 	}
 }
 
+func assertErrorMessage(cmd *rpc.Command, err error, expected string, t *testing.T) {
+	if err == nil {
+		t.Error("Expected error, but got no error.")
+	} else if !strings.Contains(err.Error(), expected) {
+		t.Error("Expected error containing '", expected, "', but got '", err.Error(), "'.")
+	}
+}
+
 func assertError(cmd *rpc.Command, err error, t *testing.T) {
 	if err == nil {
 		t.Error("Expected error, but got no error.")
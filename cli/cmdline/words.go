@@ -0,0 +1,56 @@
+package cmdline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SplitWords splits a command line typed in 'h2c shell' into words, like a Unix shell:
+// Words are separated by whitespace, single and double quotes group words, and backslash escapes the next character.
+func SplitWords(line string) ([]string, error) {
+	result := make([]string, 0)
+	var (
+		word    strings.Builder
+		inWord  bool
+		quote   rune // the current quote character, or 0 if not quoted
+		escaped bool
+	)
+	for _, c := range line {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				result = append(result, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Syntax error: Missing closing %c.", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("Syntax error: Line ends with \\.")
+	}
+	if inWord {
+		result = append(result, word.String())
+	}
+	return result, nil
+}
@@ -0,0 +1,63 @@
+package cmdline
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Variables for --write-out, like '%{time_total}'.
+// time_connect and time_appconnect are the durations of the TCP connect and the TLS handshake of the connection,
+// the other times are measured from when the request was sent to the connection.
+var WRITE_OUT_VARIABLES = []string{
+	"http_status",
+	"stream_id",
+	"size_download",
+	"time_connect",
+	"time_appconnect",
+	"time_headers_sent",
+	"time_request_sent",
+	"time_first_byte",
+	"time_first_data",
+	"time_total",
+}
+
+var writeOutVariableRegexp = regexp.MustCompile("%\\{([^}]*)\\}")
+
+// writeOutVariables returns the variable names used in a --write-out template, in the order of their appearance.
+func writeOutVariables(template string) []string {
+	result := make([]string, 0)
+	for _, match := range writeOutVariableRegexp.FindAllStringSubmatch(template, -1) {
+		result = append(result, match[1])
+	}
+	return result
+}
+
+// ExpandWriteOut replaces the variables in a --write-out template with the values returned by lookup.
+// The escape sequences \n, \r, and \t are replaced with newline, carriage return, and tab.
+func ExpandWriteOut(template string, lookup func(variable string) string) string {
+	result := writeOutVariableRegexp.ReplaceAllStringFunc(template, func(match string) string {
+		return lookup(match[2 : len(match)-1])
+	})
+	return strings.NewReplacer("\\n", "\n", "\\r", "\r", "\\t", "\t").Replace(result)
+}
+
+func isWriteOutTemplateValid(template string) bool {
+	if strings.Contains(writeOutVariableRegexp.ReplaceAllString(template, ""), "%{") {
+		return false // unterminated variable
+	}
+	for _, variable := range writeOutVariables(template) {
+		if !isWriteOutVariable(variable) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWriteOutVariable(variable string) bool {
+	for _, v := range WRITE_OUT_VARIABLES {
+		if v == variable {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+// Package conformance implements 'h2c conformance', which checks how a server reacts to frames that violate RFC 7540.
+//
+// Each test runs on a new connection, because most violations are connection errors.
+// The tests are similar to h2spec, but they work with h2c's cleartext connections and don't require anything else than h2c.
+package conformance
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fstab/h2c/http2client/frames"
+	"golang.org/x/net/http2/hpack"
+)
+
+// Default time to wait for the server's reaction.
+const DEFAULT_TIMEOUT = 2 * time.Second
+
+type testCase struct {
+	section     string // RFC 7540 section, like "6.5"
+	description string
+	// run returns a description of the server's reaction if the test passed.
+	run func(c *testConnection) (string, error)
+}
+
+// Result and Report are printed as JSON with 'h2c conformance --json'.
+type Result struct {
+	Section     string `json:"section"`
+	Description string `json:"description"`
+	Passed      bool   `json:"passed"`
+	Detail      string `json:"detail"` // the server's reaction if the test passed, or the reason why it failed
+}
+
+type Report struct {
+	Target  string    `json:"target"`
+	Results []*Result `json:"results"`
+}
+
+var testCases = []*testCase{
+	{
+		section:     "4.2",
+		description: "Sends a DATA frame larger than SETTINGS_MAX_FRAME_SIZE",
+		run: func(c *testConnection) (string, error) {
+			data := make([]byte, c.serverMaxFrameSize+1)
+			if err := c.send(c.headersFrame(1, c.requestHeaders(), false, 0), frames.NewDataFrame(1, data, true)); err != nil {
+				return "", err
+			}
+			return c.awaitStreamError(1, frames.FRAME_SIZE_ERROR)
+		},
+	},
+	{
+		section:     "4.2",
+		description: "Sends a HEADERS frame larger than SETTINGS_MAX_FRAME_SIZE",
+		run: func(c *testConnection) (string, error) {
+			// Padding is at most 255 bytes, so the header block must be large, too.
+			headers := append(c.requestHeaders(), hpack.HeaderField{Name: "x-large", Value: strings.Repeat("x", int(c.serverMaxFrameSize)*2)})
+			if err := c.send(c.headersFrame(1, headers, true, 255)); err != nil {
+				return "", err
+			}
+			return c.awaitConnectionError(frames.FRAME_SIZE_ERROR)
+		},
+	},
+	{
+		section:     "5.1",
+		description: "Sends a HEADERS frame on a closed stream",
+		run: func(c *testConnection) (string, error) {
+			if err := c.send(c.headersFrame(1, c.requestHeaders(), true, 0)); err != nil {
+				return "", err
+			}
+			if err := c.awaitEndOfStream(1); err != nil {
+				return "", err
+			}
+			if err := c.send(c.headersFrame(1, c.requestHeaders(), true, 0)); err != nil {
+				return "", err
+			}
+			// Re-using the stream ID is also a PROTOCOL_ERROR, see section 5.1.1.
+			return c.awaitStreamError(1, frames.STREAM_CLOSED, frames.PROTOCOL_ERROR)
+		},
+	},
+	{
+		section:     "5.1",
+		description: "Sends a HEADERS frame after sending RST_STREAM",
+		run: func(c *testConnection) (string, error) {
+			if err := c.send(c.headersFrame(1, c.requestHeaders(), false, 0), frames.NewRstStreamFrame(1, frames.CANCEL), c.headersFrame(1, c.requestHeaders(), true, 0)); err != nil {
+				return "", err
+			}
+			return c.awaitStreamError(1, frames.STREAM_CLOSED, frames.PROTOCOL_ERROR)
+		},
+	},
+	{
+		section:     "6.1",
+		description: "Sends a DATA frame on stream 0",
+		run: func(c *testConnection) (string, error) {
+			if err := c.send(frames.NewDataFrame(0, []byte("test"), true)); err != nil {
+				return "", err
+			}
+			return c.awaitConnectionError(frames.PROTOCOL_ERROR)
+		},
+	},
+	{
+		section:     "6.5",
+		description: "Sends a SETTINGS frame with ACK flag and payload",
+		run: func(c *testConnection) (string, error) {
+			payload := []byte{0x00, byte(frames.SETTINGS_ENABLE_PUSH), 0x00, 0x00, 0x00, 0x00}
+			if err := c.send(frames.NewRawFrame(frames.SETTINGS_TYPE, byte(frames.SETTINGS_FLAG_ACK), 0, payload)); err != nil {
+				return "", err
+			}
+			return c.awaitConnectionError(frames.FRAME_SIZE_ERROR)
+		},
+	},
+	{
+		section:     "6.9.1",
+		description: "Sends WINDOW_UPDATE frames increasing the connection window above 2^31-1",
+		run: func(c *testConnection) (string, error) {
+			if err := c.send(frames.NewWindowUpdateFrame(0, 0x7fffffff), frames.NewWindowUpdateFrame(0, 0x7fffffff)); err != nil {
+				return "", err
+			}
+			return c.awaitConnectionError(frames.FLOW_CONTROL_ERROR)
+		},
+	},
+	{
+		section:     "6.9.1",
+		description: "Sends WINDOW_UPDATE frames increasing a stream window above 2^31-1",
+		run: func(c *testConnection) (string, error) {
+			if err := c.send(c.headersFrame(1, c.requestHeaders(), false, 0), frames.NewWindowUpdateFrame(1, 0x7fffffff), frames.NewWindowUpdateFrame(1, 0x7fffffff)); err != nil {
+				return "", err
+			}
+			return c.awaitStreamError(1, frames.FLOW_CONTROL_ERROR)
+		},
+	},
+	{
+		section:     "8.1.2.1",
+		description: "Sends a HEADERS frame with an unknown pseudo-header field",
+		run: func(c *testConnection) (string, error) {
+			return sendMalformedRequest(c, append(c.requestHeaders(), hpack.HeaderField{Name: ":test", Value: "ok"}))
+		},
+	},
+	{
+		section:     "8.1.2.1",
+		description: "Sends a HEADERS frame with the response pseudo-header field :status",
+		run: func(c *testConnection) (string, error) {
+			return sendMalformedRequest(c, append(c.requestHeaders(), hpack.HeaderField{Name: ":status", Value: "200"}))
+		},
+	},
+	{
+		section:     "8.1.2.1",
+		description: "Sends a HEADERS frame with a pseudo-header field after a regular header field",
+		run: func(c *testConnection) (string, error) {
+			headers := c.requestHeaders()
+			headers = append(append(headers[:3:3], hpack.HeaderField{Name: "x-test", Value: "ok"}), headers[3])
+			return sendMalformedRequest(c, headers)
+		},
+	},
+	{
+		section:     "8.1.2.3",
+		description: "Sends a HEADERS frame without the :path pseudo-header field",
+		run: func(c *testConnection) (string, error) {
+			return sendMalformedRequest(c, c.requestHeaders()[:3])
+		},
+	},
+	{
+		section:     "8.1.2.3",
+		description: "Sends a HEADERS frame with a duplicated :path pseudo-header field",
+		run: func(c *testConnection) (string, error) {
+			return sendMalformedRequest(c, append(c.requestHeaders(), hpack.HeaderField{Name: ":path", Value: "/"}))
+		},
+	},
+}
+
+// Malformed requests are stream errors of type PROTOCOL_ERROR, see RFC 7540 section 8.1.2.6.
+func sendMalformedRequest(c *testConnection, headers []hpack.HeaderField) (string, error) {
+	if err := c.send(c.headersFrame(1, headers, true, 0)); err != nil {
+		return "", err
+	}
+	return c.awaitStreamError(1, frames.PROTOCOL_ERROR)
+}
+
+// Run runs all tests against target, which is host:port of a server supporting cleartext HTTP/2 with prior knowledge.
+// An error is returned if the server is not reachable. Failed tests are reported in the Report.
+func Run(target string, timeout time.Duration) (*Report, error) {
+	report := &Report{
+		Target:  target,
+		Results: make([]*Result, 0, len(testCases)),
+	}
+	for _, test := range testCases {
+		c, err := connect(target, timeout)
+		if err != nil {
+			return nil, err
+		}
+		result := &Result{
+			Section:     test.section,
+			Description: test.description,
+		}
+		result.Detail, err = test.run(c)
+		c.close()
+		if err != nil {
+			result.Detail = err.Error()
+		} else {
+			result.Passed = true
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+func (r *Report) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if !result.Passed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// String is a line per test, like
+//
+//	[passed] 6.5      Sends a SETTINGS frame with ACK flag and payload: GOAWAY with FRAME_SIZE_ERROR.
+//
+// followed by a summary. Sections refer to RFC 7540.
+func (r *Report) String() string {
+	lines := []string{fmt.Sprintf("Conformance tests against %v, sections refer to RFC 7540:", r.Target)}
+	for _, result := range r.Results {
+		label := "[passed]"
+		if !result.Passed {
+			label = "[FAILED]"
+		}
+		lines = append(lines, fmt.Sprintf("%v %-8v %v: %v", label, result.Section, result.Description, result.Detail))
+	}
+	lines = append(lines, fmt.Sprintf("%v tests, %v passed, %v failed.", len(r.Results), len(r.Results)-r.Failed(), r.Failed()))
+	return strings.Join(lines, "\n")
+}
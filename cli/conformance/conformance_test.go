@@ -0,0 +1,175 @@
+package conformance
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fstab/h2c/http2client/frames"
+)
+
+// startServer starts a server that sends its SETTINGS, and then calls handle for each connection.
+func startServer(t *testing.T, handle func(conn net.Conn)) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				preface := make([]byte, len(CLIENT_PREFACE))
+				if _, err := io.ReadFull(conn, preface); err != nil {
+					return
+				}
+				writer := frames.NewWriter(conn, frames.NewEncodingContext())
+				writer.WriteFrame(frames.NewSettingsFrame(0, false))
+				writer.Flush()
+				handle(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestServerIgnoringAllFrames(t *testing.T) {
+	target := startServer(t, func(conn net.Conn) {
+		io.Copy(ioutil.Discard, conn)
+	})
+	report, err := Run(target, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.Failed() != len(testCases) {
+		t.Fatalf("Expected all %v tests to fail, but %v failed:\n%v", len(testCases), report.Failed(), report.String())
+	}
+	for _, result := range report.Results {
+		if !strings.HasPrefix(result.Detail, "Timeout after 50ms") {
+			t.Errorf("%v: Unexpected detail: %v", result.Description, result.Detail)
+		}
+	}
+}
+
+func TestServerClosingConnection(t *testing.T) {
+	target := startServer(t, func(conn net.Conn) {
+		reader := frames.NewReader(conn, frames.NewDecodingContext())
+		reader.SetMaxFrameSize(1 << 20)
+		for {
+			frame, err := reader.ReadNextFrame()
+			if err != nil {
+				return
+			}
+			if settings, ok := frame.(*frames.SettingsFrame); ok && !settings.Ack {
+				continue
+			}
+			return // closing the connection is accepted as a connection error
+		}
+	})
+	report, err := Run(target, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, result := range report.Results {
+		// The server closes the connection before the response, which is not what the closed stream test expects.
+		if result.Description == "Sends a HEADERS frame on a closed stream" {
+			if result.Passed {
+				t.Errorf("%v: Expected failure.", result.Description)
+			}
+		} else if !result.Passed || result.Detail != "Connection closed." {
+			t.Errorf("%v: Expected 'Connection closed.', but got %v", result.Description, result.Detail)
+		}
+	}
+}
+
+// startReplyingServer starts a server that sends a frame of an unknown type followed by reply
+// as soon as it receives a frame other than SETTINGS. The frames are read raw, so that malformed frames are accepted.
+func startReplyingServer(t *testing.T, reply frames.Frame) string {
+	return startServer(t, func(conn net.Conn) {
+		header := make([]byte, 9)
+		for {
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return
+			}
+			length := int(header[0])<<16 | int(header[1])<<8 | int(header[2])
+			if _, err := io.CopyN(ioutil.Discard, conn, int64(length)); err != nil {
+				return
+			}
+			if frames.Type(header[3]) != frames.SETTINGS_TYPE {
+				break
+			}
+		}
+		writer := frames.NewWriter(conn, frames.NewEncodingContext())
+		writer.WriteFrame(frames.NewRawFrame(frames.Type(0xfa), 0, 0, []byte("unknown")))
+		writer.WriteFrame(reply)
+		writer.Flush()
+		io.Copy(ioutil.Discard, conn)
+	})
+}
+
+// runTestCase runs a single test against target.
+func runTestCase(t *testing.T, target string, description string) (string, error) {
+	for _, test := range testCases {
+		if test.description == description {
+			c, err := connect(target, time.Second)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer c.close()
+			return test.run(c)
+		}
+	}
+	t.Fatalf("%v: Test not found.", description)
+	return "", nil
+}
+
+func TestExpectedGoAway(t *testing.T) {
+	target := startReplyingServer(t, frames.NewGoAwayFrame(0, 0, frames.PROTOCOL_ERROR))
+	detail, err := runTestCase(t, target, "Sends a DATA frame on stream 0")
+	if err != nil || detail != "GOAWAY with PROTOCOL_ERROR." {
+		t.Errorf("Expected the test to pass with GOAWAY, but got %q, %v", detail, err)
+	}
+}
+
+func TestUnexpectedGoAwayErrorCode(t *testing.T) {
+	target := startReplyingServer(t, frames.NewGoAwayFrame(0, 0, frames.INTERNAL_ERROR))
+	_, err := runTestCase(t, target, "Sends a DATA frame on stream 0")
+	if err == nil || !strings.Contains(err.Error(), "received GOAWAY with INTERNAL_ERROR") {
+		t.Errorf("Expected the test to fail because of the error code, but got %v", err)
+	}
+}
+
+func TestExpectedRstStream(t *testing.T) {
+	target := startReplyingServer(t, frames.NewRstStreamFrame(1, frames.PROTOCOL_ERROR))
+	detail, err := runTestCase(t, target, "Sends a HEADERS frame with an unknown pseudo-header field")
+	if err != nil || detail != "RST_STREAM with PROTOCOL_ERROR." {
+		t.Errorf("Expected the test to pass with RST_STREAM, but got %q, %v", detail, err)
+	}
+}
+
+func TestUnexpectedRstStreamErrorCode(t *testing.T) {
+	target := startReplyingServer(t, frames.NewRstStreamFrame(1, frames.CANCEL))
+	_, err := runTestCase(t, target, "Sends a HEADERS frame with an unknown pseudo-header field")
+	if err == nil || !strings.Contains(err.Error(), "received RST_STREAM with CANCEL") {
+		t.Errorf("Expected the test to fail because of the error code, but got %v", err)
+	}
+}
+
+func TestConnectError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	target := listener.Addr().String()
+	listener.Close()
+	if _, err = Run(target, time.Second); err == nil {
+		t.Fatalf("Expected connect error.")
+	}
+}
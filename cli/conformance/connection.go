@@ -0,0 +1,259 @@
+package conformance
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fstab/h2c/http2client/failure"
+	"github.com/fstab/h2c/http2client/frames"
+	"golang.org/x/net/http2/hpack"
+)
+
+const CLIENT_PREFACE = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// testConnection is a raw HTTP/2 connection. Unlike the Http2Client, it does not maintain any stream state,
+// so tests can send frames that are not allowed in the current state of the stream or connection.
+type testConnection struct {
+	conn               net.Conn
+	authority          string
+	timeout            time.Duration
+	reader             *frames.Reader
+	writer             *frames.Writer
+	headerBlockBuffer  bytes.Buffer
+	encoder            *hpack.Encoder // all header blocks are encoded here, so that the HPACK state is consistent
+	serverMaxFrameSize uint32
+}
+
+// connect sends the connection preface and waits for the server's SETTINGS frame.
+func connect(target string, timeout time.Duration) (*testConnection, error) {
+	conn, err := net.DialTimeout("tcp", target, timeout)
+	if err != nil {
+		return nil, failure.New(failure.CONNECT_ERROR, "Failed to connect to %v: %v", target, err.Error())
+	}
+	c := &testConnection{
+		conn:               conn,
+		authority:          target,
+		timeout:            timeout,
+		reader:             frames.NewReader(conn, frames.NewDecodingContext()),
+		writer:             frames.NewWriter(conn, frames.NewEncodingContext()),
+		serverMaxFrameSize: frames.DEFAULT_MAX_FRAME_SIZE,
+	}
+	c.encoder = hpack.NewEncoder(&c.headerBlockBuffer)
+	if _, err = conn.Write([]byte(CLIENT_PREFACE)); err != nil {
+		conn.Close()
+		return nil, failure.New(failure.CONNECT_ERROR, "Failed to write client preface to %v: %v", target, err.Error())
+	}
+	if err = c.send(frames.NewSettingsFrame(0, false)); err != nil {
+		conn.Close()
+		return nil, failure.New(failure.CONNECT_ERROR, "Failed to write SETTINGS frame to %v: %v", target, err.Error())
+	}
+	c.conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		frame, err := c.readFrame()
+		if err != nil {
+			conn.Close()
+			return nil, failure.New(failure.PROTOCOL_ERROR, "%v: No SETTINGS frame received after the connection preface: %v", target, err.Error())
+		}
+		if settings, ok := frame.(*frames.SettingsFrame); ok && !settings.Ack {
+			c.handleSettings(settings)
+			return c, nil
+		}
+	}
+}
+
+// readFrame reads the next frame. Frames of unknown types are skipped, as required by RFC 7540 section 4.1.
+func (c *testConnection) readFrame() (frames.Frame, error) {
+	for {
+		frame, err := c.reader.ReadNextFrame()
+		var unknownFrameType *frames.UnknownFrameTypeError
+		if errors.As(err, &unknownFrameType) {
+			continue
+		}
+		return frame, err
+	}
+}
+
+func (c *testConnection) close() {
+	c.conn.Close()
+}
+
+// send writes the frames with a single write, so that the server receives all of them even if it closes the connection after the first one.
+func (c *testConnection) send(frameList ...frames.Frame) error {
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	for _, frame := range frameList {
+		if err := c.writer.WriteFrame(frame); err != nil {
+			return err
+		}
+	}
+	return c.writer.Flush()
+}
+
+func (c *testConnection) handleSettings(settings *frames.SettingsFrame) {
+	if frames.SETTINGS_MAX_FRAME_SIZE.IsSet(settings) {
+		c.serverMaxFrameSize = frames.SETTINGS_MAX_FRAME_SIZE.Get(settings)
+	}
+	c.send(frames.NewSettingsFrame(0, true))
+}
+
+// The headers for a request to "/" that the server should accept.
+func (c *testConnection) requestHeaders() []hpack.HeaderField {
+	return []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: "http"},
+		{Name: ":authority", Value: c.authority},
+		{Name: ":path", Value: "/"},
+	}
+}
+
+// headersFrame encodes the headers in the given order, without checking if they are valid.
+// padLength > 0 adds padding, which is used to create HEADERS frames of a specific size.
+func (c *testConnection) headersFrame(streamId uint32, headers []hpack.HeaderField, endStream bool, padLength int) *frames.RawFrame {
+	defer c.headerBlockBuffer.Reset()
+	for _, header := range headers {
+		c.encoder.WriteField(header)
+	}
+	flags := byte(frames.HEADERS_FLAG_END_HEADERS)
+	if endStream {
+		flags |= byte(frames.HEADERS_FLAG_END_STREAM)
+	}
+	payload := c.headerBlockBuffer.Bytes()
+	if padLength > 0 {
+		flags |= byte(frames.HEADERS_FLAG_PADDED)
+		payload = append(append([]byte{byte(padLength)}, payload...), make([]byte, padLength)...)
+	} else {
+		payload = append([]byte{}, payload...)
+	}
+	return frames.NewRawFrame(frames.HEADERS_TYPE, flags, streamId, payload)
+}
+
+// awaitConnectionError waits for a GOAWAY frame with one of the error codes. As in h2spec,
+// the server may also close the TCP connection without sending GOAWAY.
+func (c *testConnection) awaitConnectionError(codes ...frames.ErrorCode) (string, error) {
+	return c.awaitError(0, codes)
+}
+
+// awaitStreamError waits for an RST_STREAM frame on the stream with one of the error codes.
+// As a connection error is the more severe reaction, GOAWAY with one of the error codes is also accepted.
+func (c *testConnection) awaitStreamError(streamId uint32, codes ...frames.ErrorCode) (string, error) {
+	return c.awaitError(streamId, codes)
+}
+
+func (c *testConnection) awaitError(streamId uint32, codes []frames.ErrorCode) (string, error) {
+	expected := "GOAWAY with " + joinErrorCodes(codes)
+	if streamId != 0 {
+		expected = "RST_STREAM or " + expected
+	}
+	c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+	for {
+		frame, err := c.readFrame()
+		if err != nil {
+			if isConnectionClosed(err) {
+				return "Connection closed.", nil
+			}
+			return "", c.readError(err, expected)
+		}
+		switch f := frame.(type) {
+		case *frames.GoAwayFrame:
+			if !containsErrorCode(codes, f.ErrorCode) {
+				return "", fmt.Errorf("Expected %v, but received GOAWAY with %v.", expected, f.ErrorCode)
+			}
+			return fmt.Sprintf("GOAWAY with %v.", f.ErrorCode), nil
+		case *frames.RstStreamFrame:
+			if streamId == 0 || f.StreamId != streamId {
+				continue
+			}
+			if !containsErrorCode(codes, f.ErrorCode) {
+				return "", fmt.Errorf("Expected %v, but received RST_STREAM with %v.", expected, f.ErrorCode)
+			}
+			return fmt.Sprintf("RST_STREAM with %v.", f.ErrorCode), nil
+		case *frames.HeadersFrame:
+			if streamId != 0 && f.StreamId == streamId {
+				return "", fmt.Errorf("Expected %v, but received a response with status %v.", expected, status(f))
+			}
+		case *frames.SettingsFrame:
+			if !f.Ack {
+				c.handleSettings(f)
+			}
+		}
+	}
+}
+
+// awaitEndOfStream waits until the response on the stream is complete.
+func (c *testConnection) awaitEndOfStream(streamId uint32) error {
+	expected := fmt.Sprintf("the response on stream %v", streamId)
+	c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+	for {
+		frame, err := c.readFrame()
+		if err != nil {
+			return c.readError(err, expected)
+		}
+		switch f := frame.(type) {
+		case *frames.HeadersFrame:
+			if f.StreamId == streamId && f.EndStream {
+				return nil
+			}
+		case *frames.DataFrame:
+			if f.StreamId == streamId && f.EndStream {
+				return nil
+			}
+		case *frames.GoAwayFrame:
+			return fmt.Errorf("Expected %v, but received GOAWAY with %v.", expected, f.ErrorCode)
+		case *frames.RstStreamFrame:
+			if f.StreamId == streamId {
+				return fmt.Errorf("Expected %v, but received RST_STREAM with %v.", expected, f.ErrorCode)
+			}
+		case *frames.SettingsFrame:
+			if !f.Ack {
+				c.handleSettings(f)
+			}
+		}
+	}
+}
+
+func (c *testConnection) readError(err error, expected string) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("Timeout after %v: Expected %v.", c.timeout, expected)
+	}
+	if isConnectionClosed(err) {
+		return fmt.Errorf("Expected %v, but the connection was closed.", expected)
+	}
+	return fmt.Errorf("Expected %v, but failed to read frame: %v", expected, err.Error())
+}
+
+func isConnectionClosed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+func status(f *frames.HeadersFrame) string {
+	for _, header := range f.Headers {
+		if header.Name == ":status" {
+			return header.Value
+		}
+	}
+	return "unknown"
+}
+
+func containsErrorCode(codes []frames.ErrorCode, code frames.ErrorCode) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Like "STREAM_CLOSED or PROTOCOL_ERROR".
+func joinErrorCodes(codes []frames.ErrorCode) string {
+	names := make([]string, 0, len(codes))
+	for _, code := range codes {
+		names = append(names, code.String())
+	}
+	return strings.Join(names, " or ")
+}
@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/fstab/h2c/cli/cmdline"
+	"github.com/fstab/h2c/cli/rpc"
+	"github.com/fstab/h2c/http2client"
+)
+
+// Without --requests and --duration, 'h2c bench' sends this many requests.
+const DEFAULT_BENCH_REQUESTS = 100
+
+type jsonBenchResult struct {
+	Url               string             `json:"url"`
+	Requests          int                `json:"requests"`
+	Failed            int                `json:"failed"`
+	RstStreams        int                `json:"rst_streams"`
+	ConcurrentStreams int                `json:"concurrent_streams"` // per connection, limited by the server's SETTINGS_MAX_CONCURRENT_STREAMS
+	ElapsedMs         float64            `json:"elapsed_ms"`
+	RequestsPerSecond float64            `json:"requests_per_second"`
+	Bytes             int64              `json:"bytes"`
+	BytesPerSecond    float64            `json:"bytes_per_second"`
+	StatusCodes       map[string]int     `json:"status_codes"`
+	Errors            map[string]int     `json:"errors"`
+	LatencyMs         map[string]float64 `json:"latency_ms"` // min, p50, p90, p99, max
+}
+
+func executeBench(h2c *http2client.Http2Client, cmd *rpc.Command) (string, error) {
+	options, err := makeBenchOptions(cmd)
+	if err != nil {
+		return "", err
+	}
+	result, err := h2c.Bench(cmd.Args[0], *options)
+	if err != nil {
+		return "", err
+	}
+	if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+		return toJson(makeJsonBenchResult(result))
+	}
+	return result.String(), nil
+}
+
+func makeBenchOptions(cmd *rpc.Command) (*http2client.BenchOptions, error) {
+	var err error
+	options := &http2client.BenchOptions{
+		Concurrency: 1,
+		Connections: 1,
+	}
+	if options.TimeoutInSeconds, err = getTimeout(cmd); err != nil {
+		return nil, err
+	}
+	if options.Headers, err = getHeaders(cmd); err != nil {
+		return nil, err
+	}
+	if cmdline.REQUESTS_OPTION.IsSet(cmd.Options) {
+		if options.Requests, err = strconv.Atoi(cmdline.REQUESTS_OPTION.Get(cmd.Options)); err != nil {
+			return nil, fmt.Errorf("%v: invalid number of requests", cmdline.REQUESTS_OPTION.Get(cmd.Options))
+		}
+	}
+	if cmdline.DURATION_OPTION.IsSet(cmd.Options) {
+		if options.Duration, err = parseTimeInterval(cmdline.DURATION_OPTION.Get(cmd.Options)); err != nil {
+			return nil, err
+		}
+	} else if options.Requests == 0 {
+		options.Requests = DEFAULT_BENCH_REQUESTS
+	}
+	if cmdline.CONCURRENT_STREAMS_OPTION.IsSet(cmd.Options) {
+		if options.Concurrency, err = strconv.Atoi(cmdline.CONCURRENT_STREAMS_OPTION.Get(cmd.Options)); err != nil {
+			return nil, fmt.Errorf("%v: invalid number of concurrent streams", cmdline.CONCURRENT_STREAMS_OPTION.Get(cmd.Options))
+		}
+	}
+	if cmdline.CONNECTIONS_OPTION.IsSet(cmd.Options) {
+		if options.Connections, err = strconv.Atoi(cmdline.CONNECTIONS_OPTION.Get(cmd.Options)); err != nil {
+			return nil, fmt.Errorf("%v: invalid number of connections", cmdline.CONNECTIONS_OPTION.Get(cmd.Options))
+		}
+	}
+	if cmdline.RATE_OPTION.IsSet(cmd.Options) {
+		if options.Rate, err = strconv.ParseFloat(cmdline.RATE_OPTION.Get(cmd.Options), 64); err != nil || options.Rate <= 0 {
+			return nil, fmt.Errorf("%v: invalid rate", cmdline.RATE_OPTION.Get(cmd.Options))
+		}
+	}
+	return options, nil
+}
+
+func makeJsonBenchResult(result *http2client.BenchResult) *jsonBenchResult {
+	errors := make(map[string]int)
+	for kind, count := range result.Errors {
+		errors[string(kind)] = count
+	}
+	latency := make(map[string]float64)
+	if len(result.Latencies) > 0 {
+		latency["min"] = durationInMilliseconds(result.Latencies[0])
+		latency["p50"] = durationInMilliseconds(result.Percentile(50))
+		latency["p90"] = durationInMilliseconds(result.Percentile(90))
+		latency["p99"] = durationInMilliseconds(result.Percentile(99))
+		latency["max"] = durationInMilliseconds(result.Latencies[len(result.Latencies)-1])
+	}
+	return &jsonBenchResult{
+		Url:               result.Url,
+		Requests:          result.Requests,
+		Failed:            result.Failed,
+		RstStreams:        result.RstStreams,
+		ConcurrentStreams: result.Concurrency,
+		ElapsedMs:         durationInMilliseconds(result.Elapsed),
+		RequestsPerSecond: result.RequestsPerSecond(),
+		Bytes:             result.Bytes,
+		BytesPerSecond:    result.BytesPerSecond(),
+		StatusCodes:       result.StatusCodes,
+		Errors:            errors,
+		LatencyMs:         latency,
+	}
+}
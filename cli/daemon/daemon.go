@@ -6,9 +6,10 @@ import (
 	"fmt"
 	"github.com/fstab/h2c/cli/cmdline"
 	"github.com/fstab/h2c/cli/rpc"
-	"github.com/fstab/h2c/cli/util"
 	"github.com/fstab/h2c/http2client"
+	"github.com/fstab/h2c/http2client/failure"
 	"github.com/fstab/h2c/http2client/frames"
+	"golang.org/x/net/http2/hpack"
 	"io"
 	"net"
 	"os"
@@ -25,44 +26,84 @@ import (
 //
 // The socket will be closed when the h2c process is terminated.
 //
-// frameTypesToBeDumped is a list of frame types that will be dumped to the console.
-// If it is nil, no frame will be dumped.
+// frameTypesToBeDumped is a list of frame types that will be dumped.
+// If it is nil, no frame will be dumped until the dump is turned on with 'h2c dump on'.
 // If it is frame.AllFrameTypes(), all frames will be dumped.
-func Run(sock net.Listener, frameTypesToBeDumped []frames.Type) error {
+// dumpStreamId and dumpHeaderName restrict the dump to a stream, or to streams with matching header names, see newDumpFilter().
+//
+// Frames are dumped to dumpFile, or to the console if dumpFile is empty.
+// dumpFormat is TEXT_FORMAT or JSON_FORMAT.
+//
+// If pcapFile is not empty, all frames are captured in pcapng format, independent of frameTypesToBeDumped.
+//
+// rules are fault injection rules like 'drop WINDOW_UPDATE stream=0 count=3', see 'h2c rule'.
+// The dump, the pcap file, and 'h2c watch' show the frames on the wire, i.e. outgoing frames after the rules were applied,
+// and incoming frames before the rules are applied.
+func Run(sock net.Listener, frameTypesToBeDumped []frames.Type, dumpOptions map[string][]string, dumpFile string, dumpFormat string, pcapFile string, rules []string) error {
 	var conn net.Conn
 	var err error
 	var h2c = http2client.New()
-	if frameTypesToBeDumped != nil && len(frameTypesToBeDumped) > 0 {
-		h2c.AddFilterForIncomingFrames(makeFrameFilter(DumpIncoming, frameTypesToBeDumped))
-		h2c.AddFilterForOutgoingFrames(makeFrameFilter(DumpOutgoing, frameTypesToBeDumped))
+	h2c.KeepWireBytes() // for the dump and the pcap file
+	for _, text := range rules {
+		if _, err = faultRules.add(text); err != nil {
+			close(sock)
+			return err
+		}
+	}
+	h2c.AddFilterForOutgoingFrames(makeRuleFilter(faultRules, false))
+	filter, err := newDumpFilterFromOptions(frameTypesToBeDumped, dumpOptions, dumpFormat)
+	if err != nil {
+		close(sock)
+		return err
+	}
+	dumper, err := newFrameDumper(dumpFile, dumpFormat, h2c.ConnectionId)
+	if err != nil {
+		close(sock)
+		return err
 	}
+	frameDumps.dumper = dumper
+	closeOnStop = append(closeOnStop, dumper)
+	frameDumps.active.Store(filter)
+	h2c.AddFilterForIncomingFrames(makeDumpFilter(frameDumps))
+	h2c.AddObserverForWrittenFrames(makeDumpObserver(frameDumps, false))
+	if pcapFile != "" {
+		capture, err := newPcapCapture(pcapFile, h2c.Connection)
+		if err != nil {
+			close(sock)
+			return err
+		}
+		closeOnStop = append(closeOnStop, capture)
+		h2c.AddFilterForIncomingFrames(makePcapFilter(capture))
+		h2c.AddObserverForWrittenFrames(makePcapObserver(capture, false))
+	}
+	h2c.AddFilterForIncomingFrames(makeFrameEventFilter("<-", h2c.Events()))
+	h2c.AddFilterForOutgoingFrames(makeFrameEventFilter("->", h2c.Events()))
+	h2c.AddFilterForIncomingFrames(makeRuleFilter(faultRules, true))
 	stopOnSigterm(sock)
 	for {
 		if conn, err = sock.Accept(); err != nil {
 			return fmt.Errorf("Error while waiting for commands: %v", err.Error())
-			stop(sock)
 		}
 		go executeCommandAndCloseConnection(h2c, conn, sock)
 	}
 }
 
-func makeFrameFilter(dumpFunction func(frames.Frame), frameTypesToBeDumped []frames.Type) func(frames.Frame) frames.Frame {
-	return func(frame frames.Frame) frames.Frame {
-		if util.SliceContainsFrameType(frameTypesToBeDumped, frame.Type()) {
-			dumpFunction(frame)
-		}
-		return frame
-	}
-}
-
 func close(sock io.Closer) {
 	if err := sock.Close(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error terminating the h2c process: %v", err.Error())
 	}
 }
 
+// closeOnStop are the files written by the h2c process, like the --dump-file. They are closed when the h2c process stops.
+var closeOnStop []io.Closer
+
 func stop(sock net.Listener) {
 	close(sock)
+	for _, closer := range closeOnStop {
+		if err := closer.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error closing file: %v\n", err.Error())
+		}
+	}
 	os.Exit(0)
 }
 
@@ -75,16 +116,43 @@ func stopOnSigterm(sock net.Listener) {
 	}(sigc)
 }
 
-func execute(h2c *http2client.Http2Client, cmd *rpc.Command) (string, error) {
+// Commands may report partial output with progress() before they return, like the responses of 'h2c get /a /b' as they complete.
+func execute(h2c *http2client.Http2Client, cmd *rpc.Command, progress func(msg string)) (string, error) {
+	msg, err := executeCommand(h2c, cmd, progress)
+	if !cmdline.JSON_OPTION.IsSet(cmd.Options) {
+		return msg, err
+	}
+	return JsonResult(msg, err)
+}
+
+// JsonResult completes the result of a command run with --json, which is a JSON object.
+// Errors are JSON objects as well, i.e. the result has a message and an error.
+// Commands without output return an empty JSON object. If a command returns output along with an error, like
+// 'h2c replay --times 3 --fail', the output is kept, because it already contains the errors.
+// Results that are already complete are not modified, so JsonResult can be applied more than once.
+func JsonResult(msg string, err error) (string, error) {
+	if err != nil && msg == "" {
+		jsonMsg, _ := toJson(struct {
+			Error *jsonError `json:"error"`
+		}{makeJsonError(err)})
+		return jsonMsg, err
+	}
+	if msg == "" {
+		return "{}", nil
+	}
+	return msg, err
+}
+
+func executeCommand(h2c *http2client.Http2Client, cmd *rpc.Command, progress func(msg string)) (string, error) {
 	switch cmd.Name {
 	case cmdline.CONNECT_COMMAND.Name():
 		return executeConnect(h2c, cmd)
 	case cmdline.DISCONNECT_COMMAND.Name():
 		return executeDisconnect(h2c, cmd)
 	case cmdline.PID_COMMAND.Name():
-		return strconv.Itoa(os.Getpid()), nil
+		return executePid(cmd)
 	case cmdline.GET_COMMAND.Name():
-		return executeGet(h2c, cmd)
+		return executeGet(h2c, cmd, progress)
 	case cmdline.PUT_COMMAND.Name():
 		return executePut(h2c, cmd)
 	case cmdline.POST_COMMAND.Name():
@@ -93,12 +161,28 @@ func execute(h2c *http2client.Http2Client, cmd *rpc.Command) (string, error) {
 		return executePing(h2c, cmd)
 	case cmdline.PUSH_LIST_COMMAND.Name():
 		return executePushList(h2c, cmd)
+	case cmdline.PUSH_CANCEL_COMMAND.Name():
+		return h2c.PushCancel(cmd.Args[0])
+	case cmdline.SEND_FRAME_COMMAND.Name():
+		return executeSendFrame(h2c, cmd)
+	case cmdline.RULE_COMMAND.Name():
+		return executeRule(faultRules, cmd)
+	case cmdline.DUMP_COMMAND.Name():
+		return executeDump(frameDumps, cmd)
 	case cmdline.STREAM_INFO_COMMAND.Name():
 		return executeStreamInfo(h2c, cmd)
+	case cmdline.HISTORY_COMMAND.Name():
+		return executeHistory(h2c, cmd)
+	case cmdline.REPLAY_COMMAND.Name():
+		return executeReplay(h2c, cmd)
+	case cmdline.BENCH_COMMAND.Name():
+		return executeBench(h2c, cmd)
+	case cmdline.HAR_COMMAND.Name():
+		return h2c.HarExport()
 	case cmdline.SET_COMMAND.Name():
-		return h2c.SetHeader(cmd.Args[0], cmd.Args[1])
+		return executeSet(h2c, cmd)
 	case cmdline.UNSET_COMMAND.Name():
-		return h2c.UnsetHeader(cmd.Args)
+		return h2c.UnsetHeader(cmd.Args, cmdline.FOR_ORIGIN_OPTION.Get(cmd.Options), cmdline.FOR_PATH_OPTION.Get(cmd.Options))
 	default:
 		return "", fmt.Errorf("%v: unknown command", cmd.Name)
 	}
@@ -109,7 +193,41 @@ func executeConnect(h2c *http2client.Http2Client, cmd *rpc.Command) (string, err
 	if err != nil {
 		return "", err
 	}
-	return h2c.Connect(scheme, host, port)
+	pushPolicy, err := makePushPolicy(cmd)
+	if err != nil {
+		return "", err
+	}
+	return h2c.Connect(scheme, host, port, pushPolicy)
+}
+
+// Returns nil if no push policy option is set, i.e. all push promises are accepted.
+func makePushPolicy(cmd *rpc.Command) (*http2client.PushPolicy, error) {
+	if !cmdline.NO_PUSH_OPTION.IsSet(cmd.Options) && !cmdline.MAX_PUSHES_OPTION.IsSet(cmd.Options) && !cmdline.ALLOW_PUSH_OPTION.IsSet(cmd.Options) {
+		return nil, nil
+	}
+	if cmdline.NO_PUSH_OPTION.IsSet(cmd.Options) && (cmdline.MAX_PUSHES_OPTION.IsSet(cmd.Options) || cmdline.ALLOW_PUSH_OPTION.IsSet(cmd.Options)) {
+		return nil, fmt.Errorf("Syntax error: %v cannot be used together with %v or %v.", cmdline.NO_PUSH_OPTION.Name(), cmdline.MAX_PUSHES_OPTION.Name(), cmdline.ALLOW_PUSH_OPTION.Name())
+	}
+	policy := &http2client.PushPolicy{
+		RefuseAll:    cmdline.NO_PUSH_OPTION.IsSet(cmd.Options),
+		AllowedPaths: make([]string, 0),
+	}
+	if cmdline.MAX_PUSHES_OPTION.IsSet(cmd.Options) {
+		maxPushes, err := strconv.Atoi(cmdline.MAX_PUSHES_OPTION.Get(cmd.Options))
+		if err != nil {
+			return nil, fmt.Errorf("%v: invalid number of pushes", cmdline.MAX_PUSHES_OPTION.Get(cmd.Options))
+		}
+		if maxPushes == 0 {
+			policy.RefuseAll = true
+		}
+		policy.MaxPushes = maxPushes
+	}
+	if cmdline.ALLOW_PUSH_OPTION.IsSet(cmd.Options) {
+		for _, pattern := range strings.Split(cmdline.ALLOW_PUSH_OPTION.Get(cmd.Options), ",") {
+			policy.AllowedPaths = append(policy.AllowedPaths, strings.TrimSpace(pattern))
+		}
+	}
+	return policy, nil
 }
 
 // "https://localhost:8443" -> "https", "localhost", 8443, nil
@@ -155,27 +273,204 @@ func executeDisconnect(h2c *http2client.Http2Client, cmd *rpc.Command) (string,
 	return h2c.Disconnect()
 }
 
-func executeGet(h2c *http2client.Http2Client, cmd *rpc.Command) (string, error) {
+func executeGet(h2c *http2client.Http2Client, cmd *rpc.Command, progress func(msg string)) (string, error) {
 	includeHeaders := cmdline.INCLUDE_HEADERS_OPTION.IsSet(cmd.Options)
-	var timeout int
-	var err error
-	if cmdline.TIMEOUT_OPTION.IsSet(cmd.Options) {
-		timeout, err = strconv.Atoi(cmdline.TIMEOUT_OPTION.Get(cmd.Options))
+	timeout, err := getTimeout(cmd)
+	if err != nil {
+		return "", err
+	}
+	headers, err := getHeaders(cmd)
+	if err != nil {
+		return "", err
+	}
+	if len(cmd.Args) > 1 {
+		return executeParallelGet(h2c, cmd, headers, timeout, progress)
+	}
+	response, err := h2c.Get(cmd.Args[0], headers, timeout)
+	if err != nil {
+		return "", err
+	}
+	return formatResponse(cmd, response, includeHeaders)
+}
+
+// With --fail, a response with HTTP status >= 400 is an error, and the response is not shown.
+func formatResponse(cmd *rpc.Command, response *http2client.Response, includeHeaders bool) (string, error) {
+	if err := checkStatus(cmd, response); err != nil {
+		return "", err
+	}
+	var result string
+	if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+		msg, err := toJson(makeJsonResponse(response))
 		if err != nil {
-			return "", fmt.Errorf("%v: invalid timeout", cmdline.TIMEOUT_OPTION.Get(cmd.Options))
+			return "", err
 		}
+		result = msg
 	} else {
-		timeout = 10
+		result = response.Format(includeHeaders)
 	}
-	return h2c.Get(cmd.Args[0], includeHeaders, timeout)
+	return appendWriteOut(cmd, result, response), nil
+}
+
+func appendWriteOut(cmd *rpc.Command, msg string, response *http2client.Response) string {
+	if cmdline.WRITE_OUT_OPTION.IsSet(cmd.Options) {
+		return msg + writeOut(cmdline.WRITE_OUT_OPTION.Get(cmd.Options), response)
+	}
+	return msg
+}
+
+func checkStatus(cmd *rpc.Command, response *http2client.Response) error {
+	if !cmdline.FAIL_OPTION.IsSet(cmd.Options) {
+		return nil
+	}
+	if status, err := strconv.Atoi(response.Status()); err == nil && status >= 400 {
+		return failure.New(failure.HTTP_ERROR, "The server returned HTTP status %v.", status)
+	}
+	return nil
+}
+
+func executePid(cmd *rpc.Command) (string, error) {
+	if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+		return toJson(struct {
+			Pid int `json:"pid"`
+		}{os.Getpid()})
+	}
+	return strconv.Itoa(os.Getpid()), nil
+}
+
+func executeHistory(h2c *http2client.Http2Client, cmd *rpc.Command) (string, error) {
+	if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+		return toJson(makeJsonRequestLog(h2c.History()))
+	}
+	return h2c.History().String(), nil
+}
+
+func executeSet(h2c *http2client.Http2Client, cmd *rpc.Command) (string, error) {
+	origin := cmdline.FOR_ORIGIN_OPTION.Get(cmd.Options)
+	pathPrefix := cmdline.FOR_PATH_OPTION.Get(cmd.Options)
+	if len(cmd.Args) == 0 {
+		if origin != "" || pathPrefix != "" {
+			return "", fmt.Errorf("Syntax error: Cannot use %v or %v without header.", cmdline.FOR_ORIGIN_OPTION.Name(), cmdline.FOR_PATH_OPTION.Name())
+		}
+		if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+			return toJson(makeJsonCustomHeaderList(h2c.ListHeaders()))
+		}
+		return h2c.ListHeaders().String(), nil
+	}
+	return h2c.SetHeader(cmd.Args[0], cmd.Args[1], origin, pathPrefix)
+}
+
+func executeReplay(h2c *http2client.Http2Client, cmd *rpc.Command) (string, error) {
+	includeHeaders := cmdline.INCLUDE_HEADERS_OPTION.IsSet(cmd.Options)
+	timeout, err := getTimeout(cmd)
+	if err != nil {
+		return "", err
+	}
+	index, err := strconv.Atoi(cmd.Args[0])
+	if err != nil {
+		return "", fmt.Errorf("%v: invalid request number", cmd.Args[0])
+	}
+	times := 1
+	if cmdline.TIMES_OPTION.IsSet(cmd.Options) {
+		times, err = strconv.Atoi(cmdline.TIMES_OPTION.Get(cmd.Options))
+		if err != nil || times < 1 {
+			return "", fmt.Errorf("%v: invalid number of times", cmdline.TIMES_OPTION.Get(cmd.Options))
+		}
+	}
+	if times == 1 {
+		response, err := h2c.Replay(index, timeout)
+		if err != nil {
+			return "", err
+		}
+		return formatResponse(cmd, response, includeHeaders)
+	}
+	// With --fail, all runs are shown, and the first failed run determines the error.
+	var firstErr error
+	runs := make([]jsonReplayRun, 0, times)
+	lines := make([]string, 0, times)
+	for i := 1; i <= times; i++ {
+		response, err := h2c.Replay(index, timeout)
+		if err == nil {
+			err = checkStatus(cmd, response)
+		}
+		if err != nil {
+			runs = append(runs, jsonReplayRun{Error: makeJsonError(err)})
+			lines = append(lines, fmt.Sprintf("%v/%v: failed (%v)", i, times, err.Error()))
+		} else {
+			runs = append(runs, jsonReplayRun{Response: makeJsonResponse(response)})
+			if cmdline.WRITE_OUT_OPTION.IsSet(cmd.Options) {
+				// One line per run, so a trailing newline in the template would produce empty lines.
+				lines = append(lines, strings.TrimSuffix(writeOut(cmdline.WRITE_OUT_OPTION.Get(cmd.Options), response), "\n"))
+			} else {
+				lines = append(lines, fmt.Sprintf("%v/%v: %v (%v bytes, %v)", i, times, response.Status(), len(response.Body), response.Timings.Total().Round(100*time.Microsecond)))
+			}
+		}
+		if err != nil && firstErr == nil && cmdline.FAIL_OPTION.IsSet(cmd.Options) {
+			firstErr = err
+		}
+	}
+	if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+		msg, err := toJson(struct {
+			Runs []jsonReplayRun `json:"runs"`
+		}{runs})
+		if err != nil {
+			return "", err
+		}
+		return msg, firstErr
+	}
+	return strings.Join(lines, "\n"), firstErr
+}
+
+// Headers specified with --header and --content-type.
+func getHeaders(cmd *rpc.Command) ([]hpack.HeaderField, error) {
+	result := make([]hpack.HeaderField, 0)
+	if cmdline.CONTENT_TYPE_OPTION.IsSet(cmd.Options) {
+		result = append(result, hpack.HeaderField{Name: "content-type", Value: cmdline.CONTENT_TYPE_OPTION.Get(cmd.Options)})
+	}
+	for _, nameValue := range cmdline.HEADER_OPTION.GetAll(cmd.Options) {
+		i := strings.Index(nameValue, ":")
+		if i < 1 {
+			return nil, fmt.Errorf("%v: Invalid header. Use 'name: value'.", nameValue)
+		}
+		result = append(result, hpack.HeaderField{
+			Name:  strings.TrimSpace(nameValue[:i]),
+			Value: strings.TrimSpace(nameValue[i+1:]),
+		})
+	}
+	return result, nil
+}
+
+// Timeout in seconds, as specified with --timeout. The default is 10 seconds.
+func getTimeout(cmd *rpc.Command) (int, error) {
+	if !cmdline.TIMEOUT_OPTION.IsSet(cmd.Options) {
+		return 10, nil
+	}
+	timeout, err := strconv.Atoi(cmdline.TIMEOUT_OPTION.Get(cmd.Options))
+	if err != nil {
+		return 0, fmt.Errorf("%v: invalid timeout", cmdline.TIMEOUT_OPTION.Get(cmd.Options))
+	}
+	return timeout, nil
 }
 
 func executePushList(h2c *http2client.Http2Client, cmd *rpc.Command) (string, error) {
-	return h2c.PushList()
+	list, err := h2c.PushList()
+	if err != nil {
+		return "", err
+	}
+	if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+		return toJson(makeJsonPushPromiseList(list))
+	}
+	return list.String(), nil
 }
 
 func executeStreamInfo(h2c *http2client.Http2Client, cmd *rpc.Command) (string, error) {
-	return h2c.StreamInfo(cmdline.INCLUDE_CLOSED_STREAMS_OPTION.IsSet(cmd.Options))
+	list, err := h2c.StreamInfo(cmdline.INCLUDE_CLOSED_STREAMS_OPTION.IsSet(cmd.Options))
+	if err != nil {
+		return "", err
+	}
+	if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+		return toJson(makeJsonStreamList(list))
+	}
+	return list.String(), nil
 }
 
 func executePing(h2c *http2client.Http2Client, cmd *rpc.Command) (string, error) {
@@ -228,23 +523,25 @@ func executePost(h2c *http2client.Http2Client, cmd *rpc.Command) (string, error)
 	return executePutOrPost(h2c, cmd, h2c.Post)
 }
 
-func executePutOrPost(h2c *http2client.Http2Client, cmd *rpc.Command, putOrPost func(path string, data []byte, includeHeaders bool, timeoutInSeconds int) (string, error)) (string, error) {
+func executePutOrPost(h2c *http2client.Http2Client, cmd *rpc.Command, putOrPost func(path string, headers []hpack.HeaderField, data []byte, timeoutInSeconds int) (*http2client.Response, error)) (string, error) {
 	includeHeaders := cmdline.INCLUDE_HEADERS_OPTION.IsSet(cmd.Options)
-	var timeout int
-	var err error
-	if cmdline.TIMEOUT_OPTION.IsSet(cmd.Options) {
-		timeout, err = strconv.Atoi(cmdline.TIMEOUT_OPTION.Get(cmd.Options))
-		if err != nil {
-			return "", fmt.Errorf("%v: invalid timeout", cmdline.TIMEOUT_OPTION.Get(cmd.Options))
-		}
-	} else {
-		timeout = 10
+	timeout, err := getTimeout(cmd)
+	if err != nil {
+		return "", err
+	}
+	headers, err := getHeaders(cmd)
+	if err != nil {
+		return "", err
 	}
 	var data []byte
 	if cmdline.DATA_OPTION.IsSet(cmd.Options) {
 		data = []byte(cmdline.DATA_OPTION.Get(cmd.Options))
 	}
-	return putOrPost(cmd.Args[0], data, includeHeaders, timeout)
+	response, err := putOrPost(cmd.Args[0], headers, data, timeout)
+	if err != nil {
+		return "", err
+	}
+	return formatResponse(cmd, response, includeHeaders)
 }
 
 func executeCommandAndCloseConnection(h2c *http2client.Http2Client, conn net.Conn, sock net.Listener) {
@@ -259,19 +556,30 @@ func executeCommandAndCloseConnection(h2c *http2client.Http2Client, conn net.Con
 	if cmd.Name == cmdline.STOP_COMMAND.Name() {
 		writeResult(conn, "", nil)
 		stop(sock)
+	} else if cmd.Name == cmdline.WATCH_COMMAND.Name() {
+		executeWatch(h2c, cmd, conn)
+	} else if cmd.Name == cmdline.SHELL_COMMAND.Name() {
+		executeShell(h2c, conn, sock)
 	} else {
-		msg, err := execute(h2c, cmd)
+		msg, err := execute(h2c, cmd, func(progress string) {
+			write(conn, rpc.NewEventResult(progress))
+		})
 		writeResult(conn, msg, err)
 	}
 }
 
 func writeResult(conn io.Writer, msg string, err error) {
-	encodedResult, err := rpc.NewResult(msg, err).Marshal()
+	write(conn, rpc.NewResult(msg, err))
+}
+
+// Results are terminated with a newline, because event Results with partial output may be sent before the final Result.
+func write(conn io.Writer, result *rpc.Result) {
+	encodedResult, err := result.Marshal()
 	if err != nil {
 		handleCommunicationError("Failed to encode result: %v", err)
 		return
 	}
-	_, err = conn.Write([]byte(encodedResult))
+	_, err = conn.Write([]byte(encodedResult + "\n"))
 	if err != nil {
 		handleCommunicationError("Error writing result to socket: %v", err.Error())
 		return
@@ -279,5 +587,5 @@ func writeResult(conn io.Writer, msg string, err error) {
 }
 
 func handleCommunicationError(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, "Error communicating with the h2c command line: %v", fmt.Sprintf(format, a))
+	fmt.Fprintf(os.Stderr, "Error communicating with the h2c command line: %v", fmt.Sprintf(format, a...))
 }
@@ -0,0 +1,123 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Maximum number of bytes shown in the preview of a DATA frame.
+const MAX_PREVIEW_SIZE = 1024
+
+// dataPreview returns the lines shown for a DATA frame with 'h2c start --dump --preview'.
+// The preview depends on the content-type of the stream: gRPC messages are shown with their boundaries,
+// JSON is pretty printed if the frame contains a complete JSON document, and UTF-8 text is shown as is.
+// Anything else is shown as hex.
+//
+// grpcRemaining is the number of bytes of a gRPC message that continues from the previous DATA frame of the stream.
+// The number of bytes continuing in the next DATA frame is returned.
+func dataPreview(data []byte, contentType string, grpcRemaining int) ([]string, int) {
+	if len(data) == 0 {
+		return []string{}, grpcRemaining
+	}
+	if strings.HasPrefix(contentType, "application/grpc") {
+		return grpcPreview(data, grpcRemaining)
+	}
+	if strings.Contains(contentType, "json") || json.Valid(data) {
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, data, "", "  ") == nil {
+			return truncatedLines(pretty.Bytes()), 0
+		}
+	}
+	if isText(data) {
+		return truncatedLines(data), 0
+	}
+	return hexPreview(data), 0
+}
+
+func grpcPreview(data []byte, remaining int) ([]string, int) {
+	result := make([]string, 0)
+	if remaining > 0 {
+		n := remaining
+		if n > len(data) {
+			n = len(data)
+		}
+		result = append(result, fmt.Sprintf("gRPC message continued: %v bytes", n))
+		data = data[n:]
+		remaining -= n
+	}
+	for len(data) > 0 {
+		if len(data) < 5 {
+			result = append(result, fmt.Sprintf("gRPC message prefix split across DATA frames: %v bytes", len(data)))
+			return result, 0 // the rest of the prefix is in the next frame, can't tell the message size
+		}
+		compressed := data[0] == 1
+		length := int(binary.BigEndian.Uint32(data[1:5]))
+		data = data[5:]
+		if length > len(data) {
+			result = append(result, fmt.Sprintf("gRPC message: %v bytes, compressed=%v, %v bytes continue in the next DATA frame", length, compressed, length-len(data)))
+			return result, length - len(data)
+		}
+		result = append(result, fmt.Sprintf("gRPC message: %v bytes, compressed=%v", length, compressed))
+		if !compressed && length > 0 {
+			for _, line := range hexPreview(data[:length]) {
+				result = append(result, "  "+line)
+			}
+		}
+		data = data[length:]
+	}
+	return result, remaining
+}
+
+func isText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func truncatedLines(data []byte) []string {
+	truncated := len(data) - MAX_PREVIEW_SIZE
+	if truncated > 0 {
+		data = data[:MAX_PREVIEW_SIZE]
+		for !utf8.Valid(data) { // don't cut UTF-8 characters in half
+			data = data[:len(data)-1]
+			truncated++
+		}
+	}
+	result := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if truncated > 0 {
+		result = append(result, fmt.Sprintf("... %v more bytes", truncated))
+	}
+	return result
+}
+
+// hexPreview shows the first bytes like 'hexdump -C'.
+func hexPreview(data []byte) []string {
+	truncated := len(data) - MAX_PREVIEW_SIZE
+	if truncated > 0 {
+		data = data[:MAX_PREVIEW_SIZE]
+	}
+	result := hexDump(data)
+	if truncated > 0 {
+		result = append(result, fmt.Sprintf("... %v more bytes", truncated))
+	}
+	return result
+}
+
+// hexDump returns lines like
+//
+//	00000000  00 00 04 08 00 00 00 00  00 00 0f 00 01           |.............|
+func hexDump(data []byte) []string {
+	return strings.Split(strings.TrimSuffix(hex.Dump(data), "\n"), "\n")
+}
@@ -0,0 +1,36 @@
+package daemon
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDataPreview(t *testing.T) {
+	lines, _ := dataPreview([]byte(`{"a":[1,2]}`), "application/json", 0)
+	if !reflect.DeepEqual(lines, []string{"{", `  "a": [`, "    1,", "    2", "  ]", "}"}) {
+		t.Errorf("Unexpected JSON preview: %#v", lines)
+	}
+	lines, _ = dataPreview([]byte("hello\nworld\n"), "text/plain", 0)
+	if !reflect.DeepEqual(lines, []string{"hello", "world"}) {
+		t.Errorf("Unexpected text preview: %#v", lines)
+	}
+	lines, _ = dataPreview([]byte{0x00, 0xff}, "", 0)
+	if len(lines) != 1 || lines[0] != "00000000  00 ff                                             |..|" {
+		t.Errorf("Unexpected hex preview: %#v", lines)
+	}
+}
+
+func TestGrpcPreview(t *testing.T) {
+	// a complete message with 2 bytes, and the first 3 bytes of a message with 5 bytes
+	lines, remaining := dataPreview([]byte{0, 0, 0, 0, 2, 'h', 'i', 0, 0, 0, 0, 5, 'a', 'b', 'c'}, "application/grpc+proto", 0)
+	if len(lines) != 3 || lines[0] != "gRPC message: 2 bytes, compressed=false" || lines[2] != "gRPC message: 5 bytes, compressed=false, 2 bytes continue in the next DATA frame" {
+		t.Errorf("Unexpected gRPC preview: %#v", lines)
+	}
+	if remaining != 2 {
+		t.Errorf("Expected 2 remaining bytes, but got %v.", remaining)
+	}
+	lines, remaining = dataPreview([]byte{'d', 'e', 1, 0, 0, 0, 0}, "application/grpc", remaining)
+	if !reflect.DeepEqual(lines, []string{"gRPC message continued: 2 bytes", "gRPC message: 0 bytes, compressed=true"}) || remaining != 0 {
+		t.Errorf("Unexpected gRPC preview: %#v, remaining %v", lines, remaining)
+	}
+}
@@ -0,0 +1,233 @@
+package daemon
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fstab/h2c/cli/cmdline"
+	"github.com/fstab/h2c/cli/rpc"
+	"github.com/fstab/h2c/cli/util"
+	"github.com/fstab/h2c/http2client/frames"
+	"golang.org/x/net/http2/hpack"
+)
+
+// dumpFilter decides which frames are dumped. It is immutable, except for the streams matched with --header-name.
+type dumpFilter struct {
+	frameTypes     []frames.Type
+	hasStreamId    bool
+	streamId       uint32
+	headerName     *regexp.Regexp // may be nil
+	options        *dumpOptions
+	mutex          sync.Mutex
+	connectionId   uint64          // the connection of the matchedStreams, as stream ids are reused on a new connection
+	matchedStreams map[uint32]bool // streams with a header name matching headerName
+}
+
+// dumpSwitch is the dump filter that is currently active.
+// 'h2c dump on|off' replaces the filter atomically, so the frame filters in the frame reader and frame writer go routines
+// see either the old or the new filter, but never a mix of both.
+type dumpSwitch struct {
+	dumper *frameDumper
+	active atomic.Value // *dumpFilter, nil if the dump is off
+}
+
+// The dump is global for the h2c process, like the fault injection rules. The dumper is replaced in Run() with the dumper configured on start.
+var frameDumps = newDumpSwitch(console, nil)
+
+func newDumpSwitch(dumper *frameDumper, filter *dumpFilter) *dumpSwitch {
+	result := &dumpSwitch{
+		dumper: dumper,
+	}
+	result.active.Store(filter)
+	return result
+}
+
+// newDumpFilter returns nil if frameTypes is empty, i.e. if nothing is dumped.
+// streamId and headerName are the parameters of --stream and --header-name, or empty if not set.
+func newDumpFilter(frameTypes []frames.Type, streamId string, headerName string) (*dumpFilter, error) {
+	if len(frameTypes) == 0 {
+		return nil, nil
+	}
+	result := &dumpFilter{
+		frameTypes:     frameTypes,
+		options:        &dumpOptions{},
+		matchedStreams: make(map[uint32]bool),
+	}
+	if streamId != "" {
+		id, err := strconv.ParseUint(streamId, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("%v: invalid stream id", streamId)
+		}
+		result.hasStreamId, result.streamId = true, uint32(id)
+	}
+	if headerName != "" {
+		regex, err := regexp.Compile(headerName)
+		if err != nil {
+			return nil, fmt.Errorf("%v: invalid regular expression", headerName)
+		}
+		result.headerName = regex
+	}
+	return result, nil
+}
+
+// newDumpFilterFromOptions creates the filter for 'h2c start --dump' and 'h2c dump on' from the command line options.
+// The display options like --hex can only be used with the text format.
+func newDumpFilterFromOptions(frameTypes []frames.Type, options map[string][]string, format string) (*dumpFilter, error) {
+	result, err := newDumpFilter(frameTypes, cmdline.DUMP_STREAM_OPTION.Get(options), cmdline.HEADER_NAME_OPTION.Get(options))
+	if err != nil || result == nil {
+		return result, err
+	}
+	if format == JSON_FORMAT {
+		for _, opt := range []string{cmdline.TIMESTAMPS_OPTION.Name(), cmdline.HEX_OPTION.Name(), cmdline.PREVIEW_OPTION.Name(), cmdline.HPACK_OPTION.Name()} {
+			if _, isSet := options[opt]; isSet {
+				return nil, fmt.Errorf("Syntax error: Cannot use %v with the %v dump format.", opt, JSON_FORMAT)
+			}
+		}
+	}
+	result.options = &dumpOptions{
+		timestamps: cmdline.TIMESTAMPS_OPTION.Get(options),
+		hex:        cmdline.HEX_OPTION.IsSet(options),
+		preview:    cmdline.PREVIEW_OPTION.IsSet(options),
+		hpack:      cmdline.HPACK_OPTION.IsSet(options),
+	}
+	return result, nil
+}
+
+// matches is called for each frame, including the frames of types that are not dumped,
+// so that --header-name finds the matching streams even if HEADERS and PUSH_PROMISE frames are not dumped.
+func (f *dumpFilter) matches(connectionId uint64, frame frames.Frame) bool {
+	if f.headerName != nil && !f.matchesHeaderName(connectionId, frame) {
+		return false
+	}
+	if !util.SliceContainsFrameType(f.frameTypes, frame.Type()) {
+		return false
+	}
+	if f.hasStreamId && frame.GetStreamId() != f.streamId {
+		return false
+	}
+	return true
+}
+
+// A stream matches --header-name as soon as a HEADERS or PUSH_PROMISE frame with a matching header name is seen.
+// For PUSH_PROMISE, the promised stream matches as well. Frames of the stream before that are not dumped.
+// The matched streams are forgotten when the frames of a new connection are seen.
+func (f *dumpFilter) matchesHeaderName(connectionId uint64, frame frames.Frame) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if connectionId != f.connectionId {
+		f.connectionId = connectionId
+		f.matchedStreams = make(map[uint32]bool)
+	}
+	switch frame := frame.(type) {
+	case *frames.HeadersFrame:
+		if f.containsHeaderName(frame.Headers) {
+			f.matchedStreams[frame.StreamId] = true
+		}
+	case *frames.PushPromiseFrame:
+		if f.containsHeaderName(frame.Headers) {
+			f.matchedStreams[frame.StreamId] = true
+			f.matchedStreams[frame.PromisedStreamId] = true
+		}
+	}
+	return f.matchedStreams[frame.GetStreamId()]
+}
+
+func (f *dumpFilter) containsHeaderName(headers []hpack.HeaderField) bool {
+	for _, header := range headers {
+		if f.headerName.MatchString(header.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the filter for 'h2c dump' without arguments, like "Dumping HEADERS, DATA frames on stream 3."
+func (f *dumpFilter) String() string {
+	if f == nil {
+		return "Dump is off."
+	}
+	types := "all"
+	if len(f.frameTypes) < len(frames.AllFrameTypes()) {
+		names := make([]string, 0, len(f.frameTypes))
+		for _, t := range f.frameTypes {
+			names = append(names, t.String())
+		}
+		types = strings.Join(names, ", ")
+	}
+	result := fmt.Sprintf("Dumping %v frames", types)
+	if f.hasStreamId {
+		result = fmt.Sprintf("%v on stream %v", result, f.streamId)
+	}
+	if f.headerName != nil {
+		result = fmt.Sprintf("%v of streams with header names matching '%v'", result, f.headerName)
+	}
+	return result + "."
+}
+
+// makeDumpFilter dumps incoming frames. It must be the first incoming filter, so that the frames are dumped as received.
+func makeDumpFilter(dumps *dumpSwitch) func(frames.Frame) []frames.Frame {
+	observer := makeDumpObserver(dumps, true)
+	return func(frame frames.Frame) []frames.Frame {
+		observer(frame)
+		return []frames.Frame{frame}
+	}
+}
+
+// makeDumpObserver dumps outgoing frames after they are written, so that the dump shows the frames as sent.
+func makeDumpObserver(dumps *dumpSwitch, incoming bool) func(frames.Frame) {
+	return func(frame frames.Frame) {
+		// The dumper sees all frames, including the frames that are not shown, to keep track of the HPACK state.
+		var options *dumpOptions
+		if filter := dumps.active.Load().(*dumpFilter); filter != nil && filter.matches(dumps.dumper.currentConnectionId(), frame) {
+			options = filter.options
+		}
+		dumps.dumper.dump(incoming, frame, options)
+	}
+}
+
+func executeDump(dumps *dumpSwitch, cmd *rpc.Command) (string, error) {
+	if len(cmd.Args) == 0 {
+		return formatDumpFilter(dumps.active.Load().(*dumpFilter), cmd)
+	}
+	if cmd.Args[0] == "off" {
+		for _, opt := range []string{cmdline.INCLUDE_FRAMES_OPTION.Name(), cmdline.EXCLUDE_FRAMES_OPTION.Name(), cmdline.DUMP_STREAM_OPTION.Name(), cmdline.HEADER_NAME_OPTION.Name(),
+			cmdline.TIMESTAMPS_OPTION.Name(), cmdline.HEX_OPTION.Name(), cmdline.PREVIEW_OPTION.Name(), cmdline.HPACK_OPTION.Name()} {
+			if _, isSet := cmd.Options[opt]; isSet {
+				return "", fmt.Errorf("Syntax error: Cannot use %v with 'h2c dump off'.", opt)
+			}
+		}
+		dumps.active.Store((*dumpFilter)(nil))
+		return "", nil
+	}
+	frameTypes := frames.AllFrameTypes()
+	var err error
+	switch {
+	case cmdline.INCLUDE_FRAMES_OPTION.IsSet(cmd.Options) && cmdline.EXCLUDE_FRAMES_OPTION.IsSet(cmd.Options):
+		return "", fmt.Errorf("Syntax error: Cannot use %v together with %v.", cmdline.INCLUDE_FRAMES_OPTION.Name(), cmdline.EXCLUDE_FRAMES_OPTION.Name())
+	case cmdline.INCLUDE_FRAMES_OPTION.IsSet(cmd.Options):
+		frameTypes, err = util.ParseListOfFrameTypes(cmdline.INCLUDE_FRAMES_OPTION.Get(cmd.Options))
+	case cmdline.EXCLUDE_FRAMES_OPTION.IsSet(cmd.Options):
+		frameTypes, err = util.ParseListOfFrameTypes(cmdline.EXCLUDE_FRAMES_OPTION.Get(cmd.Options))
+		frameTypes = util.ExcludeToInclude(frameTypes)
+	}
+	if err != nil {
+		return "", err
+	}
+	filter, err := newDumpFilterFromOptions(frameTypes, cmd.Options, dumps.dumper.format)
+	if err != nil {
+		return "", err
+	}
+	dumps.active.Store(filter)
+	return formatDumpFilter(filter, cmd)
+}
+
+func formatDumpFilter(filter *dumpFilter, cmd *rpc.Command) (string, error) {
+	if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+		return toJson(&jsonDump{Dump: filter.String()})
+	}
+	return filter.String(), nil
+}
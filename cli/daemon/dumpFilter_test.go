@@ -0,0 +1,68 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/fstab/h2c/http2client/frames"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestDumpFilterStreamId(t *testing.T) {
+	filter, err := newDumpFilter([]frames.Type{frames.HEADERS_TYPE, frames.DATA_TYPE}, "3", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !filter.matches(1, frames.NewDataFrame(3, []byte("test"), true)) {
+		t.Errorf("Expected DATA frame on stream 3 to match.")
+	}
+	if filter.matches(1, frames.NewDataFrame(1, []byte("test"), true)) || filter.matches(1, frames.NewRstStreamFrame(3, frames.CANCEL)) {
+		t.Errorf("Expected other streams and frame types not to match.")
+	}
+	if filter.String() != "Dumping HEADERS, DATA frames on stream 3." {
+		t.Errorf("Unexpected description: %v", filter.String())
+	}
+}
+
+func TestDumpFilterHeaderName(t *testing.T) {
+	filter, err := newDumpFilter(frames.AllFrameTypes(), "", "^x-trace")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if filter.matches(1, frames.NewDataFrame(1, []byte("test"), false)) {
+		t.Errorf("Expected DATA frame not to match before the HEADERS frame.")
+	}
+	if filter.matches(1, frames.NewHeadersFrame(3, []hpack.HeaderField{{Name: ":path", Value: "/"}})) {
+		t.Errorf("Expected HEADERS frame without x-trace header not to match.")
+	}
+	if !filter.matches(1, frames.NewHeadersFrame(1, []hpack.HeaderField{{Name: ":path", Value: "/"}, {Name: "x-trace-id", Value: "1"}})) {
+		t.Errorf("Expected HEADERS frame with x-trace-id header to match.")
+	}
+	if !filter.matches(1, frames.NewDataFrame(1, []byte("test"), true)) {
+		t.Errorf("Expected DATA frame to match after the HEADERS frame.")
+	}
+	if filter.matches(1, frames.NewSettingsFrame(0, false)) {
+		t.Errorf("Expected frames on stream 0 not to match.")
+	}
+	if filter.String() != "Dumping all frames of streams with header names matching '^x-trace'." {
+		t.Errorf("Unexpected description: %v", filter.String())
+	}
+}
+
+func TestDumpFilterIncludeWithHeaderName(t *testing.T) {
+	filter, err := newDumpFilter([]frames.Type{frames.DATA_TYPE}, "", "^x-trace")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if filter.matches(1, frames.NewHeadersFrame(1, []hpack.HeaderField{{Name: ":path", Value: "/"}, {Name: "x-trace-id", Value: "1"}})) {
+		t.Errorf("Expected HEADERS frame not to match, because only DATA frames are included.")
+	}
+	if !filter.matches(1, frames.NewDataFrame(1, []byte("test"), true)) {
+		t.Errorf("Expected DATA frame of the matching stream to match.")
+	}
+	if filter.matches(1, frames.NewDataFrame(3, []byte("test"), true)) {
+		t.Errorf("Expected DATA frame of another stream not to match.")
+	}
+	if filter.matches(2, frames.NewDataFrame(1, []byte("test"), true)) {
+		t.Errorf("Expected DATA frame of stream 1 on a new connection not to match.")
+	}
+}
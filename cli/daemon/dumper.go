@@ -1,9 +1,23 @@
 package daemon
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
 	"github.com/fatih/color"
 	"github.com/fstab/h2c/http2client/frames"
+	"golang.org/x/net/http2/hpack"
+)
+
+// Dump formats, see 'h2c start --dump-format'
+const (
+	TEXT_FORMAT = "text"
+	JSON_FORMAT = "json"
 )
 
 var (
@@ -15,113 +29,394 @@ var (
 	valueColor     = color.New()
 )
 
-func DumpIncoming(frame frames.Frame) {
-	dump("<-", frame)
+// Timestamps shown with 'h2c start --dump --timestamps'
+const (
+	ABSOLUTE_TIMESTAMPS = "absolute"
+	RELATIVE_TIMESTAMPS = "relative" // relative to the first frame of the connection
+)
+
+var console = newConsoleDumper()
+
+func newConsoleDumper() *frameDumper {
+	return &frameDumper{
+		out:    color.Output,
+		format: TEXT_FORMAT,
+		colors: !color.NoColor,
+	}
+}
+
+// ConnectionDumper dumps the frames of a single connection to the console, see 'h2c wiretap'.
+// The HPACK state is kept per connection, so each connection needs its own ConnectionDumper.
+type ConnectionDumper struct {
+	dumper *frameDumper
+}
+
+func NewConnectionDumper() *ConnectionDumper {
+	return &ConnectionDumper{
+		dumper: newConsoleDumper(),
+	}
+}
+
+func (d *ConnectionDumper) DumpIncoming(frame frames.Frame) {
+	d.dumper.dump(true, frame, &dumpOptions{})
+}
+
+func (d *ConnectionDumper) DumpOutgoing(frame frames.Frame) {
+	d.dumper.dump(false, frame, &dumpOptions{})
+}
+
+// dumpOptions are the options for the text format, like 'h2c start --dump --hex'. They are ignored for the JSON format.
+type dumpOptions struct {
+	timestamps string // ABSOLUTE_TIMESTAMPS, RELATIVE_TIMESTAMPS, or empty
+	hex        bool
+	preview    bool
+	hpack      bool
+}
+
+// frameDumper writes frames to the console or to a file.
+//
+// Incoming frames and outgoing frames are dumped from different go routines.
+// In order to prevent the output from being mixed up, each frame is written with a single call to out.Write().
+//
+// The hex dump and the HPACK details are taken from the frame's WireBytes() and HeaderBlock, i.e. from the bytes on the wire.
+// Incoming frames are dumped by a filter that runs before any other filter, outgoing frames by an observer that runs after
+// the frame was written, see makeDumpFilter() and makeDumpObserver().
+type frameDumper struct {
+	mutex        sync.Mutex
+	out          io.Writer
+	file         *os.File // the --dump-file, nil if frames are written to the console
+	format       string
+	colors       bool
+	connectionId func() uint64 // may be nil
+	connection   *dumpedConnection
+}
+
+// dumpedConnection is the state of the connection that is needed to show the frames.
+// It is reset when the connection id changes.
+type dumpedConnection struct {
+	id       uint64
+	started  time.Time
+	outgoing *dumpedDirection
+	incoming *dumpedDirection
+}
+
+type dumpedDirection struct {
+	table         *dynamicTable
+	contentTypes  map[uint32]string // StreamID -> content-type header
+	grpcRemaining map[uint32]int    // StreamID -> bytes of a gRPC message continuing in the next DATA frame
+}
+
+// frameDetails is what is shown in addition to the frame itself, depending on the dumpOptions.
+type frameDetails struct {
+	timestamp  string
+	encoded    []byte      // nil unless dumpOptions.hex
+	hpack      *hpackBlock // nil unless dumpOptions.hpack
+	hpackError error       // set if the header block could not be analyzed
+	preview    []string    // nil unless dumpOptions.preview
+}
+
+// If filename is empty, frames are written to the console.
+// Colors are used on the console unless the NO_COLOR environment variable is set or the console is not a terminal.
+func newFrameDumper(filename string, format string, connectionId func() uint64) (*frameDumper, error) {
+	if filename == "" {
+		return &frameDumper{
+			out:          color.Output,
+			format:       format,
+			colors:       !color.NoColor,
+			connectionId: connectionId,
+		}, nil
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create dump file: %v", err.Error())
+	}
+	return &frameDumper{
+		out:          file,
+		file:         file,
+		format:       format,
+		colors:       false,
+		connectionId: connectionId,
+	}, nil
 }
 
-func DumpOutgoing(frame frames.Frame) {
-	dump("->", frame)
+// dump writes the frame. If options is nil, the frame is not written, but the HPACK state is updated.
+// Therefore, all frames must be passed to dump(), not only the frames that are shown.
+func (d *frameDumper) dump(incoming bool, frame frames.Frame, options *dumpOptions) {
+	now := time.Now()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	direction := d.currentConnection(now).outgoing
+	if incoming {
+		direction = d.connection.incoming
+	}
+	hpackBlock, hpackErr := direction.observe(frame)
+	if options == nil {
+		return
+	}
+	var data []byte
+	switch d.format {
+	case JSON_FORMAT:
+		line, err := encodeJson(now, incoming, d.connection.id, frame)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to dump %v frame: %v\n", frame.Type(), err.Error())
+			return
+		}
+		data = append(line, '\n')
+	default:
+		details := &frameDetails{}
+		switch options.timestamps {
+		case ABSOLUTE_TIMESTAMPS:
+			details.timestamp = now.Format("15:04:05.000000")
+		case RELATIVE_TIMESTAMPS:
+			details.timestamp = fmt.Sprintf("+%.6fs", now.Sub(d.connection.started).Seconds())
+		}
+		if options.hex {
+			details.encoded = frame.WireBytes()
+			if details.encoded == nil {
+				// Outgoing DATA frames are written as returned by Encode(), which does not depend on the HPACK state.
+				details.encoded, _ = frame.Encode(frames.NewEncodingContext())
+			}
+		}
+		if options.hpack {
+			details.hpack, details.hpackError = hpackBlock, hpackErr
+		}
+		if dataFrame, ok := frame.(*frames.DataFrame); ok && options.preview {
+			details.preview, direction.grpcRemaining[dataFrame.StreamId] = dataPreview(dataFrame.Data, direction.contentTypes[dataFrame.StreamId], direction.grpcRemaining[dataFrame.StreamId])
+		}
+		w := &textWriter{colors: d.colors}
+		if incoming {
+			writeText(w, "<-", frame, details)
+		} else {
+			writeText(w, "->", frame, details)
+		}
+		data = w.buf.Bytes()
+	}
+	if _, err := d.out.Write(data); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to dump %v frame: %v\n", frame.Type(), err.Error())
+	}
+}
+
+// Close closes the dump file. Frames dumped after Close() are discarded.
+func (d *frameDumper) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.out = io.Discard
+	if d.file == nil {
+		return nil
+	}
+	file := d.file
+	d.file = nil
+	return file.Close()
 }
 
-func dump(prefix string, frame frames.Frame) {
-	prefixColor.Printf("%v ", prefix)
+// currentConnectionId is the id of the connection the frames belong to, or 0 if unknown.
+func (d *frameDumper) currentConnectionId() uint64 {
+	if d.connectionId == nil {
+		return 0
+	}
+	return d.connectionId()
+}
+
+func (d *frameDumper) currentConnection(now time.Time) *dumpedConnection {
+	id := d.currentConnectionId()
+	if d.connection == nil || d.connection.id != id {
+		d.connection = &dumpedConnection{
+			id:       id,
+			started:  now,
+			outgoing: newDumpedDirection(),
+			incoming: newDumpedDirection(),
+		}
+	}
+	return d.connection
+}
+
+func newDumpedDirection() *dumpedDirection {
+	return &dumpedDirection{
+		table:         newDynamicTable(),
+		contentTypes:  make(map[uint32]string),
+		grpcRemaining: make(map[uint32]int),
+	}
+}
+
+// observe parses the header block of HEADERS and PUSH_PROMISE frames, so that the dynamic table follows the frames,
+// and remembers the content-type of each stream. Other frames are ignored, and nothing is encoded.
+func (d *dumpedDirection) observe(frame frames.Frame) (*hpackBlock, error) {
+	var (
+		headers []hpack.HeaderField
+		block   []byte
+	)
 	switch f := frame.(type) {
 	case *frames.HeadersFrame:
-		frameTypeColor.Printf("%v", frame.Type())
-		streamIdColor.Printf("(%v)\n", f.StreamId)
-		dumpEndStream(f.EndStream)
-		dumpEndHeaders(f.EndHeaders)
-		if len(f.Headers) == 0 {
-			keyColor.Printf("    {empty}\n")
-		} else {
-			for _, header := range f.Headers {
-				keyColor.Printf("    %v:", header.Name)
-				valueColor.Printf(" %v\n", header.Value)
+		headers, block = f.Headers, f.HeaderBlock
+		for _, header := range headers {
+			if header.Name == "content-type" {
+				d.contentTypes[f.StreamId] = header.Value
 			}
 		}
+	case *frames.PushPromiseFrame:
+		headers, block = f.Headers, f.HeaderBlock
+	default:
+		return nil, nil
+	}
+	if block == nil {
+		return nil, fmt.Errorf("Header block not available, the frame was neither read nor written.")
+	}
+	return parseHeaderBlock(block, headers, d.table)
+}
+
+// textWriter collects the text representation of a frame, so that it can be written in one piece.
+type textWriter struct {
+	buf    bytes.Buffer
+	colors bool
+}
+
+func (w *textWriter) printf(c *color.Color, format string, a ...interface{}) {
+	if w.colors {
+		c.Fprintf(&w.buf, format, a...)
+	} else {
+		fmt.Fprintf(&w.buf, format, a...)
+	}
+}
+
+func writeText(w *textWriter, prefix string, frame frames.Frame, details *frameDetails) {
+	if details.timestamp != "" {
+		w.printf(prefixColor, "%v ", details.timestamp)
+	}
+	w.printf(prefixColor, "%v ", prefix)
+	switch f := frame.(type) {
+	case *frames.HeadersFrame:
+		w.printf(frameTypeColor, "%v", frame.Type())
+		w.printf(streamIdColor, "(%v)\n", f.StreamId)
+		dumpEndStream(w, f.EndStream)
+		dumpEndHeaders(w, f.EndHeaders)
+		dumpHeaders(w, f.Headers, details)
 	case *frames.DataFrame:
-		frameTypeColor.Printf("%v", frame.Type())
-		streamIdColor.Printf("(%v)\n", f.StreamId)
-		dumpEndStream(f.EndStream)
-		keyColor.Printf("    {%v bytes}\n", len(f.Data))
+		w.printf(frameTypeColor, "%v", frame.Type())
+		w.printf(streamIdColor, "(%v)\n", f.StreamId)
+		dumpEndStream(w, f.EndStream)
+		w.printf(keyColor, "    {%v bytes}\n", len(f.Data))
+		for _, line := range details.preview {
+			w.printf(valueColor, "    %v\n", line)
+		}
 	case *frames.PriorityFrame:
-		frameTypeColor.Printf("%v", frame.Type())
-		keyColor.Printf("    Stream dependency:")
-		valueColor.Printf(" %v\n", f.StreamDependencyId)
-		keyColor.Printf("    Weight:")
-		valueColor.Printf(" %v\n", f.Weight)
-		keyColor.Printf("    Exclusive:")
-		valueColor.Printf(" %v\n", f.Exclusive)
+		w.printf(frameTypeColor, "%v", frame.Type())
+		w.printf(keyColor, "    Stream dependency:")
+		w.printf(valueColor, " %v\n", f.StreamDependencyId)
+		w.printf(keyColor, "    Weight:")
+		w.printf(valueColor, " %v\n", f.Weight)
+		w.printf(keyColor, "    Exclusive:")
+		w.printf(valueColor, " %v\n", f.Exclusive)
 	case *frames.SettingsFrame:
-		frameTypeColor.Printf("%v", frame.Type())
-		streamIdColor.Printf("(%v)\n", f.StreamId)
-		dumpAck(f.Ack)
+		w.printf(frameTypeColor, "%v", frame.Type())
+		w.printf(streamIdColor, "(%v)\n", f.StreamId)
+		dumpAck(w, f.Ack)
 		if len(f.Settings) == 0 {
-			keyColor.Printf("    {empty}\n")
+			w.printf(keyColor, "    {empty}\n")
 		} else {
-			for setting, value := range f.Settings {
-				keyColor.Printf("    %v:", setting)
-				valueColor.Printf(" %v\n", value)
+			for _, setting := range f.SortedSettings() {
+				w.printf(keyColor, "    %v:", setting)
+				w.printf(valueColor, " %v\n", f.Settings[setting])
 			}
 		}
 	case *frames.PushPromiseFrame:
-		frameTypeColor.Printf("%v", frame.Type())
-		streamIdColor.Printf("(%v)\n", f.StreamId)
-		dumpEndHeaders(f.EndHeaders)
-		keyColor.Printf("    Promised Stream Id:")
-		valueColor.Printf(" %v\n", f.PromisedStreamId)
-		if len(f.Headers) == 0 {
-			keyColor.Printf("    {empty}\n")
-		} else {
-			for _, header := range f.Headers {
-				keyColor.Printf("    %v:", header.Name)
-				valueColor.Printf(" %v\n", header.Value)
-			}
-		}
+		w.printf(frameTypeColor, "%v", frame.Type())
+		w.printf(streamIdColor, "(%v)\n", f.StreamId)
+		dumpEndHeaders(w, f.EndHeaders)
+		w.printf(keyColor, "    Promised Stream Id:")
+		w.printf(valueColor, " %v\n", f.PromisedStreamId)
+		dumpHeaders(w, f.Headers, details)
 	case *frames.RstStreamFrame:
-		frameTypeColor.Printf("%v", frame.Type())
-		streamIdColor.Printf("(%v)\n", f.StreamId)
-		keyColor.Printf("    Error code:")
-		valueColor.Printf(" %v\n", f.ErrorCode.String())
+		w.printf(frameTypeColor, "%v", frame.Type())
+		w.printf(streamIdColor, "(%v)\n", f.StreamId)
+		w.printf(keyColor, "    Error code:")
+		w.printf(valueColor, " %v\n", f.ErrorCode.String())
 	case *frames.PingFrame:
-		frameTypeColor.Printf("%v", frame.Type())
-		streamIdColor.Printf("(%v)\n", f.StreamId)
-		dumpAck(f.Ack)
-		keyColor.Printf("    payload:")
-		valueColor.Printf(" 0x%016x\n", f.Payload)
+		w.printf(frameTypeColor, "%v", frame.Type())
+		w.printf(streamIdColor, "(%v)\n", f.StreamId)
+		dumpAck(w, f.Ack)
+		w.printf(keyColor, "    payload:")
+		w.printf(valueColor, " 0x%016x\n", f.Payload)
 	case *frames.GoAwayFrame:
-		frameTypeColor.Printf("%v", frame.Type())
-		streamIdColor.Printf("(%v)\n", f.StreamId)
-		keyColor.Printf("    Last stream id:")
-		valueColor.Printf(" %v\n", f.LastStreamId)
-		keyColor.Printf("    Error code:")
-		valueColor.Printf(" %v\n", f.ErrorCode.String())
+		w.printf(frameTypeColor, "%v", frame.Type())
+		w.printf(streamIdColor, "(%v)\n", f.StreamId)
+		w.printf(keyColor, "    Last stream id:")
+		w.printf(valueColor, " %v\n", f.LastStreamId)
+		w.printf(keyColor, "    Error code:")
+		w.printf(valueColor, " %v\n", f.ErrorCode.String())
 	case *frames.WindowUpdateFrame:
-		frameTypeColor.Printf("%v", frame.Type())
-		streamIdColor.Printf("(%v)\n", f.StreamId)
-		keyColor.Printf("    Window size increment:")
-		valueColor.Printf(" %v\n", f.WindowSizeIncrement)
+		w.printf(frameTypeColor, "%v", frame.Type())
+		w.printf(streamIdColor, "(%v)\n", f.StreamId)
+		w.printf(keyColor, "    Window size increment:")
+		w.printf(valueColor, " %v\n", f.WindowSizeIncrement)
+	case *frames.RawFrame:
+		w.printf(frameTypeColor, "%v", frame.Type())
+		w.printf(streamIdColor, "(%v)\n", f.StreamId)
+		w.printf(keyColor, "    Flags:")
+		w.printf(valueColor, " 0x%02x\n", f.Flags)
+		w.printf(keyColor, "    Payload:")
+		w.printf(valueColor, " %v\n", hexOrEmpty(f.Payload))
 	default:
-		frameTypeColor.Printf("UNKNOWN (NOT IMPLEMENTED) FRAME TYPE %v\n", frame.Type())
+		w.printf(frameTypeColor, "UNKNOWN (NOT IMPLEMENTED) FRAME TYPE %v\n", frame.Type())
+	}
+	if details.encoded != nil {
+		for _, line := range hexDump(details.encoded) {
+			w.printf(valueColor, "    %v\n", line)
+		}
+	}
+	w.buf.WriteString("\n")
+}
+
+// dumpHeaders shows the headers of HEADERS and PUSH_PROMISE frames, with their HPACK representation for 'h2c start --dump --hpack'.
+func dumpHeaders(w *textWriter, headers []hpack.HeaderField, details *frameDetails) {
+	if len(headers) == 0 {
+		w.printf(keyColor, "    {empty}\n")
+	}
+	for i, header := range headers {
+		w.printf(keyColor, "    %v:", header.Name)
+		if details.hpack != nil && i < len(details.hpack.fields) {
+			w.printf(valueColor, " %v", header.Value)
+			w.printf(flagColor, " [%v]\n", details.hpack.fields[i])
+		} else {
+			w.printf(valueColor, " %v\n", header.Value)
+		}
+	}
+	if details.hpackError != nil {
+		w.printf(keyColor, "    HPACK:")
+		w.printf(valueColor, " %v\n", details.hpackError.Error())
+	}
+	if details.hpack != nil {
+		for _, size := range details.hpack.tableSizeUpdates {
+			w.printf(keyColor, "    Dynamic table size update:")
+			w.printf(valueColor, " %v bytes\n", size)
+		}
+		w.printf(keyColor, "    Dynamic table size:")
+		w.printf(valueColor, " %v bytes\n", details.hpack.dynamicTableSize)
 	}
-	fmt.Println()
 }
 
-func dumpFlag(name string, isSet bool) {
+func hexOrEmpty(payload []byte) string {
+	if len(payload) == 0 {
+		return "{empty}"
+	}
+	return hex.EncodeToString(payload)
+}
+
+func dumpFlag(w *textWriter, name string, isSet bool) {
 	if isSet {
-		flagColor.Printf("    + %v\n", name)
+		w.printf(flagColor, "    + %v\n", name)
 	} else {
-		flagColor.Printf("    - %v\n", name)
+		w.printf(flagColor, "    - %v\n", name)
 	}
 }
-func dumpEndStream(isSet bool) {
-	dumpFlag("END_STREAM", isSet)
+
+func dumpEndStream(w *textWriter, isSet bool) {
+	dumpFlag(w, "END_STREAM", isSet)
 }
 
-func dumpEndHeaders(isSet bool) {
-	dumpFlag("END_HEADERS", isSet)
+func dumpEndHeaders(w *textWriter, isSet bool) {
+	dumpFlag(w, "END_HEADERS", isSet)
 }
 
-func dumpAck(isSet bool) {
-	dumpFlag("ACK", isSet)
+func dumpAck(w *textWriter, isSet bool) {
+	dumpFlag(w, "ACK", isSet)
 }
@@ -0,0 +1,185 @@
+package daemon
+
+import (
+	"fmt"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// Header field representations, see RFC 7541 section 6.
+const (
+	HPACK_INDEXED                   = "indexed"
+	HPACK_LITERAL_INCREMENTAL       = "literal with incremental indexing"
+	HPACK_LITERAL_WITHOUT_INDEXING  = "literal without indexing"
+	HPACK_LITERAL_NEVER_INDEXED     = "literal never indexed"
+	HPACK_STATIC_TABLE_SIZE         = 61
+	HPACK_DEFAULT_DYNAMIC_TABLE_MAX = 4096
+)
+
+// hpackField describes how a header field is represented in the header block.
+type hpackField struct {
+	representation string
+	index          uint64 // index of the field if indexed, index of the name if the name is indexed, 0 if the name is a literal
+	huffmanName    bool
+	huffmanValue   bool
+}
+
+// hpackBlock describes a header block. fields correspond to the decoded header fields of the frame.
+type hpackBlock struct {
+	fields           []hpackField
+	tableSizeUpdates []uint64
+	dynamicTableSize uint32 // size of the dynamic table after the header block, as defined in RFC 7541 section 4.1
+}
+
+// dynamicTable keeps track of the size of the dynamic table. The entries are not needed, because the decoded header fields are known.
+type dynamicTable struct {
+	entrySizes []uint32 // oldest first
+	size       uint32
+	maxSize    uint32
+}
+
+func newDynamicTable() *dynamicTable {
+	return &dynamicTable{
+		entrySizes: make([]uint32, 0),
+		maxSize:    HPACK_DEFAULT_DYNAMIC_TABLE_MAX,
+	}
+}
+
+func (t *dynamicTable) add(field hpack.HeaderField) {
+	entrySize := field.Size()
+	for len(t.entrySizes) > 0 && t.size+entrySize > t.maxSize {
+		t.evictOldest()
+	}
+	if entrySize > t.maxSize {
+		return // an entry larger than the table empties the table, see RFC 7541 section 4.4
+	}
+	t.entrySizes = append(t.entrySizes, entrySize)
+	t.size += entrySize
+}
+
+func (t *dynamicTable) setMaxSize(maxSize uint32) {
+	t.maxSize = maxSize
+	for t.size > t.maxSize {
+		t.evictOldest()
+	}
+}
+
+func (t *dynamicTable) evictOldest() {
+	t.size -= t.entrySizes[0]
+	t.entrySizes = t.entrySizes[1:]
+}
+
+// parseHeaderBlock analyzes the representations in block, which is the HPACK encoding of headers, and updates the table.
+func parseHeaderBlock(block []byte, headers []hpack.HeaderField, table *dynamicTable) (*hpackBlock, error) {
+	result := &hpackBlock{
+		fields:           make([]hpackField, 0, len(headers)),
+		tableSizeUpdates: make([]uint64, 0),
+	}
+	for len(block) > 0 {
+		var (
+			field   hpackField
+			prefix  uint
+			err     error
+			isField = true
+		)
+		switch {
+		case block[0]&0x80 != 0:
+			field.representation, prefix = HPACK_INDEXED, 7
+		case block[0]&0xc0 == 0x40:
+			field.representation, prefix = HPACK_LITERAL_INCREMENTAL, 6
+		case block[0]&0xe0 == 0x20:
+			isField, prefix = false, 5
+		case block[0]&0xf0 == 0x10:
+			field.representation, prefix = HPACK_LITERAL_NEVER_INDEXED, 4
+		default:
+			field.representation, prefix = HPACK_LITERAL_WITHOUT_INDEXING, 4
+		}
+		field.index, block, err = readHpackInt(block, prefix)
+		if err != nil {
+			return nil, err
+		}
+		if !isField {
+			result.tableSizeUpdates = append(result.tableSizeUpdates, field.index)
+			table.setMaxSize(uint32(field.index))
+			continue
+		}
+		if len(result.fields) >= len(headers) {
+			return nil, fmt.Errorf("Header block contains more header fields than the decoded header list.")
+		}
+		if field.representation != HPACK_INDEXED {
+			if field.index == 0 {
+				if field.huffmanName, block, err = readHpackString(block); err != nil {
+					return nil, err
+				}
+			}
+			if field.huffmanValue, block, err = readHpackString(block); err != nil {
+				return nil, err
+			}
+			if field.representation == HPACK_LITERAL_INCREMENTAL {
+				table.add(headers[len(result.fields)])
+			}
+		}
+		result.fields = append(result.fields, field)
+	}
+	result.dynamicTableSize = table.size
+	return result, nil
+}
+
+// readHpackInt decodes an integer with an n bit prefix, see RFC 7541 section 5.1.
+func readHpackInt(block []byte, n uint) (uint64, []byte, error) {
+	maxPrefix := uint64(1)<<n - 1
+	result := uint64(block[0]) & maxPrefix
+	block = block[1:]
+	if result < maxPrefix {
+		return result, block, nil
+	}
+	for shift := uint(0); len(block) > 0 && shift < 63; shift += 7 {
+		b := block[0]
+		block = block[1:]
+		result += uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return result, block, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("Invalid integer in header block.")
+}
+
+// readHpackString skips a string literal, and returns whether it is Huffman encoded, see RFC 7541 section 5.2.
+func readHpackString(block []byte) (bool, []byte, error) {
+	if len(block) == 0 {
+		return false, nil, fmt.Errorf("Header block truncated.")
+	}
+	huffman := block[0]&0x80 != 0
+	length, block, err := readHpackInt(block, 7)
+	if err != nil {
+		return false, nil, err
+	}
+	if uint64(len(block)) < length {
+		return false, nil, fmt.Errorf("Header block truncated.")
+	}
+	return huffman, block[length:], nil
+}
+
+// String is like "indexed, static table 2" or "literal with incremental indexing, name from dynamic table 62, huffman value".
+func (f hpackField) String() string {
+	result := f.representation
+	switch {
+	case f.representation == HPACK_INDEXED:
+		result = fmt.Sprintf("%v, %v", result, tableIndex(f.index))
+	case f.index > 0:
+		result = fmt.Sprintf("%v, name from %v", result, tableIndex(f.index))
+	case f.huffmanName:
+		result = result + ", huffman name"
+	}
+	if f.huffmanValue {
+		result = result + ", huffman value"
+	}
+	return result
+}
+
+func tableIndex(index uint64) string {
+	if index <= HPACK_STATIC_TABLE_SIZE {
+		return fmt.Sprintf("static table %v", index)
+	}
+	return fmt.Sprintf("dynamic table %v", index)
+}
@@ -0,0 +1,107 @@
+package daemon
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fstab/h2c/http2client/frames"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestParseHeaderBlock(t *testing.T) {
+	headers := []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":path", Value: "/test"},
+		{Name: "x-custom", Value: "value"},
+		{Name: "authorization", Value: "secret", Sensitive: true},
+	}
+	var buf bytes.Buffer
+	encoder := hpack.NewEncoder(&buf)
+	for _, header := range headers {
+		if err := encoder.WriteField(header); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	table := newDynamicTable()
+	block, err := parseHeaderBlock(buf.Bytes(), headers, table)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{
+		"indexed, static table 2",
+		"literal with incremental indexing, name from static table 5, huffman value",
+		"literal with incremental indexing, huffman name, huffman value",
+		"literal never indexed, name from static table 23, huffman value",
+	}
+	if len(block.fields) != len(expected) {
+		t.Fatalf("Expected %v fields, but got %v.", len(expected), len(block.fields))
+	}
+	for i, field := range block.fields {
+		if field.String() != expected[i] {
+			t.Errorf("%v: Expected '%v', but got '%v'.", headers[i].Name, expected[i], field.String())
+		}
+	}
+	expectedSize := headers[1].Size() + headers[2].Size()
+	if block.dynamicTableSize != expectedSize {
+		t.Errorf("Expected dynamic table size %v, but got %v.", expectedSize, block.dynamicTableSize)
+	}
+
+	// The second time, the headers are found in the dynamic table.
+	buf.Reset()
+	for _, header := range headers[1:3] {
+		if err := encoder.WriteField(header); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	block, err = parseHeaderBlock(buf.Bytes(), headers[1:3], table)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if block.fields[0].String() != "indexed, dynamic table 63" || block.fields[1].String() != "indexed, dynamic table 62" {
+		t.Errorf("Unexpected fields: %v", block.fields)
+	}
+	if block.dynamicTableSize != expectedSize {
+		t.Errorf("Expected dynamic table size %v, but got %v.", expectedSize, block.dynamicTableSize)
+	}
+}
+
+func TestParseHeaderBlockTableSizeUpdate(t *testing.T) {
+	table := newDynamicTable()
+	table.add(hpack.HeaderField{Name: "x-custom", Value: "value"})
+	block, err := parseHeaderBlock([]byte{0x20, 0x82}, []hpack.HeaderField{{Name: ":method", Value: "GET"}}, table)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(block.tableSizeUpdates) != 1 || block.tableSizeUpdates[0] != 0 || block.dynamicTableSize != 0 {
+		t.Errorf("Unexpected block: %#v", block)
+	}
+	if _, err = parseHeaderBlock([]byte{0x82, 0x82}, []hpack.HeaderField{{Name: ":method", Value: "GET"}}, table); err == nil {
+		t.Errorf("Expected error for more fields than headers.")
+	}
+}
+
+// The dump must show the header block as sent by the server, even if h2c would have encoded the headers differently.
+func TestDumpShowsReceivedHeaderBlock(t *testing.T) {
+	block := append([]byte{0x88, 0x00, 0x08}, "x-custom"...) // :status 200, literal without indexing, plain name
+	block = append(append(block, 0x05), "value"...)
+	wireBytes := append([]byte{0x00, 0x00, byte(len(block)), byte(frames.HEADERS_TYPE), 0x05, 0x00, 0x00, 0x00, 0x01}, block...)
+	reader := frames.NewReader(bytes.NewReader(wireBytes), frames.NewDecodingContext())
+	reader.SetKeepWireBytes(true)
+	frame, err := reader.ReadNextFrame()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var out bytes.Buffer
+	dumper := &frameDumper{out: &out, format: TEXT_FORMAT}
+	dumper.dump(true, frame, &dumpOptions{hex: true, hpack: true})
+	for _, expected := range []string{
+		"x-custom: value [literal without indexing]",
+		"Dynamic table size: 0 bytes",
+		"00 00 11 01 05 00 00 00  01 88 00 08 78 2d 63 75",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected '%v' in dump:\n%v", expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package daemon
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fstab/h2c/http2client/frames"
+	"golang.org/x/net/http2/hpack"
+)
+
+// jsonFrame is one line in a dump written with 'h2c start --dump-format json'.
+type jsonFrame struct {
+	Timestamp    string                 `json:"timestamp"`
+	Direction    string                 `json:"direction"` // "incoming" or "outgoing"
+	ConnectionId uint64                 `json:"connection_id"`
+	Type         string                 `json:"type"`
+	StreamId     uint32                 `json:"stream_id"`
+	Flags        []string               `json:"flags"`
+	Fields       map[string]interface{} `json:"fields"`
+	Payload      string                 `json:"payload"` // base64 of the payload on the wire, without the 9 byte frame header
+}
+
+type jsonHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// The payload is taken from the frame's WireBytes(), so HEADERS and PUSH_PROMISE show the header block as on the wire.
+func encodeJson(timestamp time.Time, incoming bool, connectionId uint64, frame frames.Frame) ([]byte, error) {
+	result := &jsonFrame{
+		Timestamp:    timestamp.Format(time.RFC3339Nano),
+		Direction:    "outgoing",
+		ConnectionId: connectionId,
+		Type:         frame.Type().String(),
+		StreamId:     frame.GetStreamId(),
+		Flags:        make([]string, 0),
+		Fields:       make(map[string]interface{}),
+	}
+	if incoming {
+		result.Direction = "incoming"
+	}
+	switch f := frame.(type) {
+	case *frames.HeadersFrame:
+		result.Flags = appendFlag(result.Flags, "END_STREAM", f.EndStream)
+		result.Flags = appendFlag(result.Flags, "END_HEADERS", f.EndHeaders)
+		result.Flags = appendFlag(result.Flags, "PRIORITY", f.Priority)
+		result.Fields["headers"] = jsonHeaders(f.Headers)
+	case *frames.DataFrame:
+		result.Flags = appendFlag(result.Flags, "END_STREAM", f.EndStream)
+		result.Fields["length"] = len(f.Data)
+	case *frames.PriorityFrame:
+		result.Fields["stream_dependency"] = f.StreamDependencyId
+		result.Fields["weight"] = f.Weight
+		result.Fields["exclusive"] = f.Exclusive
+	case *frames.SettingsFrame:
+		result.Flags = appendFlag(result.Flags, "ACK", f.Ack)
+		settings := make(map[string]uint32)
+		for setting, value := range f.Settings {
+			settings[setting.String()] = value
+		}
+		result.Fields["settings"] = settings
+	case *frames.PushPromiseFrame:
+		result.Flags = appendFlag(result.Flags, "END_HEADERS", f.EndHeaders)
+		result.Fields["promised_stream_id"] = f.PromisedStreamId
+		result.Fields["headers"] = jsonHeaders(f.Headers)
+	case *frames.RstStreamFrame:
+		result.Fields["error_code"] = f.ErrorCode.String()
+	case *frames.PingFrame:
+		result.Flags = appendFlag(result.Flags, "ACK", f.Ack)
+		result.Fields["payload"] = fmt.Sprintf("0x%016x", f.Payload)
+	case *frames.GoAwayFrame:
+		result.Fields["last_stream_id"] = f.LastStreamId
+		result.Fields["error_code"] = f.ErrorCode.String()
+	case *frames.WindowUpdateFrame:
+		result.Fields["window_size_increment"] = f.WindowSizeIncrement
+	case *frames.RawFrame:
+		result.Fields["flags"] = f.Flags
+	}
+	payload, err := encodePayload(frame)
+	if err != nil {
+		return nil, err
+	}
+	result.Payload = base64.StdEncoding.EncodeToString(payload)
+	return json.Marshal(result)
+}
+
+func appendFlag(flags []string, name string, isSet bool) []string {
+	if isSet {
+		return append(flags, name)
+	}
+	return flags
+}
+
+func jsonHeaders(headers []hpack.HeaderField) []jsonHeader {
+	result := make([]jsonHeader, 0, len(headers))
+	for _, header := range headers {
+		result = append(result, jsonHeader{Name: header.Name, Value: header.Value})
+	}
+	return result
+}
+
+func encodePayload(frame frames.Frame) ([]byte, error) {
+	if wireBytes := frame.WireBytes(); wireBytes != nil {
+		return wireBytes[9:], nil // strip the frame header
+	}
+	if dataFrame, ok := frame.(*frames.DataFrame); ok {
+		return dataFrame.Data, nil // outgoing DATA frames are written without padding
+	}
+	// Only frames that were neither read nor written, which do not occur in the dump.
+	encoded, err := frame.Encode(frames.NewEncodingContext())
+	if err != nil {
+		return nil, err
+	}
+	return encoded[9:], nil // strip the frame header
+}
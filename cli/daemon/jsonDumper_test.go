@@ -0,0 +1,35 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/fstab/h2c/http2client/frames"
+)
+
+// The payload must be the header block as received, not the header block as h2c would have encoded it.
+func TestJsonPayloadFromWireBytes(t *testing.T) {
+	block := append([]byte{0x88, 0x00, 0x08}, "x-custom"...) // :status 200, literal without indexing
+	block = append(append(block, 0x05), "value"...)
+	wireBytes := append([]byte{0x00, 0x00, byte(len(block)), byte(frames.HEADERS_TYPE), 0x05, 0x00, 0x00, 0x00, 0x01}, block...)
+	reader := frames.NewReader(bytes.NewReader(wireBytes), frames.NewDecodingContext())
+	reader.SetKeepWireBytes(true)
+	frame, err := reader.ReadNextFrame()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	line, err := encodeJson(time.Now(), true, 1, frame)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var result jsonFrame
+	if err = json.Unmarshal(line, &result); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Payload != base64.StdEncoding.EncodeToString(block) {
+		t.Errorf("Expected the header block as received, but got %v.", result.Payload)
+	}
+}
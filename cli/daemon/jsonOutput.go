@@ -0,0 +1,277 @@
+package daemon
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fstab/h2c/http2client"
+	"github.com/fstab/h2c/http2client/events"
+	"github.com/fstab/h2c/http2client/failure"
+)
+
+// The types in this file define the output of commands run with --json.
+// Field names use the same snake_case convention as the JSON frame dump.
+
+type jsonResponse struct {
+	Status       int          `json:"status"`
+	Headers      []jsonHeader `json:"headers"`
+	Trailers     []jsonHeader `json:"trailers"`
+	Body         string       `json:"body"`
+	BodyEncoding string       `json:"body_encoding"` // "text" or "base64"
+	Timings      jsonTimings  `json:"timings"`
+}
+
+// Like the HAR timings: send is the time until the request was sent, wait is the time until
+// the first response HEADERS were received, and receive is the time until the response was complete.
+// The fields headers_sent_ms to total_ms are measured from started, and are 0 if unknown.
+// connect_ms and tls_handshake_ms refer to the connection, which may have been established for an earlier request.
+type jsonTimings struct {
+	Started        string  `json:"started"`
+	SendMs         float64 `json:"send_ms"`
+	WaitMs         float64 `json:"wait_ms"`
+	ReceiveMs      float64 `json:"receive_ms"`
+	HeadersSentMs  float64 `json:"headers_sent_ms"`
+	RequestSentMs  float64 `json:"request_sent_ms"`
+	FirstByteMs    float64 `json:"first_byte_ms"`
+	FirstDataMs    float64 `json:"first_data_ms"`
+	TotalMs        float64 `json:"total_ms"`
+	ConnectMs      float64 `json:"connect_ms"`
+	TlsHandshakeMs float64 `json:"tls_handshake_ms"`
+}
+
+type jsonError struct {
+	Kind    string `json:"kind"`
+	Code    string `json:"code,omitempty"` // HTTP/2 error code, like "CANCEL"
+	Message string `json:"message"`
+}
+
+type jsonReplayRun struct {
+	Response *jsonResponse `json:"response,omitempty"`
+	Error    *jsonError    `json:"error,omitempty"`
+}
+
+type jsonStream struct {
+	StreamId          uint32 `json:"stream_id"`
+	Method            string `json:"method"`
+	Path              string `json:"path"`
+	State             string `json:"state"`
+	CachedPushPromise bool   `json:"cached_push_promise"`
+	SendWindow        int64  `json:"send_window"`
+	ReceiveWindow     int64  `json:"receive_window"`
+}
+
+type jsonWindows struct {
+	SendWindow    int64 `json:"send_window"`
+	ReceiveWindow int64 `json:"receive_window"`
+}
+
+type jsonPushPromise struct {
+	StreamId uint32       `json:"stream_id"`
+	Method   string       `json:"method"`
+	Url      string       `json:"url"`
+	Status   string       `json:"status"` // empty if the response HEADERS were not received yet
+	Size     int          `json:"size"`
+	AgeMs    float64      `json:"age_ms"`
+	Headers  []jsonHeader `json:"headers"`
+}
+
+type jsonLoggedRequest struct {
+	Index      int        `json:"index"`
+	Method     string     `json:"method"`
+	Url        string     `json:"url"`
+	Status     string     `json:"status,omitempty"`
+	Size       int        `json:"size"`
+	DurationMs float64    `json:"duration_ms"`
+	Error      *jsonError `json:"error,omitempty"`
+}
+
+type jsonCustomHeader struct {
+	Name       string `json:"name"`
+	Value      string `json:"value"`
+	Origin     string `json:"origin,omitempty"`
+	PathPrefix string `json:"path_prefix,omitempty"`
+}
+
+type jsonEvent struct {
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"`
+	StreamId  uint32 `json:"stream_id"`
+	Message   string `json:"message"`
+}
+
+func toJson(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("Failed to encode result as JSON: %v", err.Error())
+	}
+	return string(data), nil
+}
+
+// Errors that were not classified by the Http2Client, like syntax errors, have kind "error".
+func makeJsonError(err error) *jsonError {
+	if f := failure.Of(err); f != nil {
+		return &jsonError{Kind: string(f.Kind), Code: f.Code, Message: f.Message}
+	}
+	return &jsonError{Kind: "error", Message: err.Error()}
+}
+
+// Binary bodies are base64 encoded.
+func makeJsonResponse(response *http2client.Response) *jsonResponse {
+	status, _ := strconv.Atoi(response.Status())
+	result := &jsonResponse{
+		Status:   status,
+		Headers:  jsonHeaders(response.Headers),
+		Trailers: jsonHeaders(response.Trailers),
+		Timings:  makeJsonTimings(response.Timings),
+	}
+	if utf8.Valid(response.Body) {
+		result.Body = string(response.Body)
+		result.BodyEncoding = "text"
+	} else {
+		result.Body = base64.StdEncoding.EncodeToString(response.Body)
+		result.BodyEncoding = "base64"
+	}
+	return result
+}
+
+func makeJsonTimings(timings http2client.Timings) jsonTimings {
+	return jsonTimings{
+		Started:        timings.Start().Format(time.RFC3339Nano),
+		SendMs:         milliseconds(timings.Start(), timings.RequestSent),
+		WaitMs:         milliseconds(timings.RequestSent, timings.ResponseStarted),
+		ReceiveMs:      milliseconds(timings.ResponseStarted, timings.Completed),
+		HeadersSentMs:  durationInMilliseconds(timings.Since(timings.HeadersSent)),
+		RequestSentMs:  durationInMilliseconds(timings.Since(timings.RequestSent)),
+		FirstByteMs:    durationInMilliseconds(timings.Since(timings.ResponseStarted)),
+		FirstDataMs:    durationInMilliseconds(timings.Since(timings.FirstDataReceived)),
+		TotalMs:        durationInMilliseconds(timings.Total()),
+		ConnectMs:      durationInMilliseconds(timings.Connect()),
+		TlsHandshakeMs: durationInMilliseconds(timings.TlsHandshake()),
+	}
+}
+
+func makeJsonStreamList(list *http2client.StreamList) interface{} {
+	streams := make([]jsonStream, 0, len(list.Streams))
+	for _, info := range list.Streams {
+		streams = append(streams, jsonStream{
+			StreamId:          info.StreamId,
+			Method:            info.Method,
+			Path:              info.Path,
+			State:             info.State,
+			CachedPushPromise: info.IsCachedPushPromise,
+			SendWindow:        info.RemainingSendWindowSize,
+			ReceiveWindow:     info.RemainingReceiveWindowSize,
+		})
+	}
+	return struct {
+		Streams    []jsonStream `json:"streams"`
+		Connection jsonWindows  `json:"connection"`
+	}{
+		Streams: streams,
+		Connection: jsonWindows{
+			SendWindow:    list.RemainingSendWindowSize,
+			ReceiveWindow: list.RemainingReceiveWindowSize,
+		},
+	}
+}
+
+func makeJsonPushPromiseList(list http2client.PushPromiseList) interface{} {
+	pushPromises := make([]jsonPushPromise, 0, len(list))
+	for _, pushPromise := range list {
+		pushPromises = append(pushPromises, jsonPushPromise{
+			StreamId: pushPromise.StreamId,
+			Method:   pushPromise.Method,
+			Url:      pushPromise.Url,
+			Status:   pushPromise.Status,
+			Size:     pushPromise.Size,
+			AgeMs:    durationInMilliseconds(pushPromise.Age),
+			Headers:  jsonHeaders(pushPromise.Headers),
+		})
+	}
+	return struct {
+		PushPromises []jsonPushPromise `json:"push_promises"`
+	}{pushPromises}
+}
+
+func makeJsonRequestLog(log http2client.RequestLog) interface{} {
+	requests := make([]jsonLoggedRequest, 0, len(log))
+	for _, entry := range log {
+		request := jsonLoggedRequest{
+			Index:      entry.Index,
+			Method:     entry.Method,
+			Url:        entry.Url,
+			Status:     entry.Status,
+			Size:       entry.Size,
+			DurationMs: durationInMilliseconds(entry.Duration),
+		}
+		if entry.Err != nil {
+			request.Error = makeJsonError(entry.Err)
+		}
+		requests = append(requests, request)
+	}
+	return struct {
+		Requests []jsonLoggedRequest `json:"requests"`
+	}{requests}
+}
+
+func makeJsonCustomHeaderList(list http2client.CustomHeaderList) interface{} {
+	headers := make([]jsonCustomHeader, 0, len(list))
+	for _, header := range list {
+		headers = append(headers, jsonCustomHeader{
+			Name:       header.Name,
+			Value:      header.Value,
+			Origin:     header.Origin,
+			PathPrefix: header.PathPrefix,
+		})
+	}
+	return struct {
+		Headers []jsonCustomHeader `json:"headers"`
+	}{headers}
+}
+
+func makeJsonEvent(event events.Event) *jsonEvent {
+	return &jsonEvent{
+		Timestamp: event.Time.Format(time.RFC3339Nano),
+		Type:      string(event.Type),
+		StreamId:  event.StreamId,
+		Message:   event.Message,
+	}
+}
+
+// Time between from and to in milliseconds, 0 if unknown.
+func milliseconds(from time.Time, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return 0
+	}
+	return durationInMilliseconds(to.Sub(from))
+}
+
+func durationInMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// jsonRuleAdded is the result of 'h2c rule add'.
+type jsonRuleAdded struct {
+	Id int `json:"id"`
+}
+
+// jsonRule is an entry in 'h2c rule list'.
+type jsonRule struct {
+	Id        int    `json:"id"`
+	Rule      string `json:"rule"`
+	Applied   int    `json:"applied"`
+	Remaining int    `json:"remaining"` // -1 if the rule has no count
+}
+
+type jsonRuleList struct {
+	Rules []*jsonRule `json:"rules"`
+}
+
+// jsonDump is the result of 'h2c dump'.
+type jsonDump struct {
+	Dump string `json:"dump"` // like "Dumping HEADERS, DATA frames on stream 3." or "Dump is off."
+}
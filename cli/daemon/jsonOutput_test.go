@@ -0,0 +1,31 @@
+package daemon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fstab/h2c/cli/cmdline"
+	"github.com/fstab/h2c/http2client"
+)
+
+// Every command run in the h2c process prints a JSON object with --json, including errors like "Not connected".
+func TestJsonOutput(t *testing.T) {
+	h2c := http2client.New()
+	for _, args := range [][]string{
+		{"disconnect"}, {"pid"}, {"get", "/"}, {"put", "/"}, {"post", "/"}, {"ping"}, {"push-list"},
+		{"send-frame", "--type", "PING", "--payload", "0000000000000000"}, {"stream-info"}, {"history"}, {"replay", "1"},
+		{"bench", "-n", "1", "/"}, {"har", "export", "out.har"}, {"set", "x-test", "value"}, {"set"}, {"unset", "x-test"},
+		{"rule", "add", "drop", "DATA"}, {"rule", "list"}, {"rule", "rm", "1"}, {"dump"}, {"dump", "off"},
+	} {
+		cmd, err := cmdline.Parse(append(args, "--json"))
+		if err != nil {
+			t.Errorf("%v: %v", args, err.Error())
+			continue
+		}
+		msg, _ := execute(h2c, cmd, func(string) {})
+		var result map[string]interface{}
+		if err = json.Unmarshal([]byte(msg), &result); err != nil {
+			t.Errorf("%v: Expected a JSON object, but got %q.", args, msg)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package daemon
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fstab/h2c/cli/cmdline"
+	"github.com/fstab/h2c/cli/rpc"
+	"github.com/fstab/h2c/http2client"
+	"golang.org/x/net/http2/hpack"
+)
+
+type jsonParallelResult struct {
+	Path     string        `json:"path"`
+	StreamId uint32        `json:"stream_id,omitempty"` // omitted if no response was received
+	Response *jsonResponse `json:"response,omitempty"`
+	Error    *jsonError    `json:"error,omitempty"`
+}
+
+type jsonParallelSummary struct {
+	Requests             int     `json:"requests"`
+	Failed               int     `json:"failed"`
+	MaxConcurrentStreams int     `json:"max_concurrent_streams"`
+	ElapsedMs            float64 `json:"elapsed_ms"`
+	SumOfDurationsMs     float64 `json:"sum_of_durations_ms"`
+	MinDurationMs        float64 `json:"min_duration_ms"`
+	MaxDurationMs        float64 `json:"max_duration_ms"`
+}
+
+// 'h2c get /a /b /c' sends all requests at once. Each response is reported with progress() as soon as it is complete,
+// labeled with its stream ID. The result is a summary showing how much the streams overlapped.
+// If a request failed, the first failure is returned as the error. With --fail, this includes HTTP status >= 400.
+func executeParallelGet(h2c *http2client.Http2Client, cmd *rpc.Command, headers []hpack.HeaderField, timeout int, progress func(msg string)) (string, error) {
+	includeHeaders := cmdline.INCLUDE_HEADERS_OPTION.IsSet(cmd.Options)
+	var firstErr error
+	results, err := h2c.GetParallel(cmd.Args, headers, timeout, func(result *http2client.ParallelResult) {
+		msg, err := formatParallelResult(cmd, result, includeHeaders)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		progress(msg)
+	})
+	if err != nil {
+		return "", err
+	}
+	summary := results.Summary()
+	if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+		msg, err := toJson(struct {
+			Summary jsonParallelSummary `json:"summary"`
+		}{jsonParallelSummary{
+			Requests:             summary.Requests,
+			Failed:               summary.Failed,
+			MaxConcurrentStreams: summary.MaxConcurrentStreams,
+			ElapsedMs:            durationInMilliseconds(summary.Elapsed),
+			SumOfDurationsMs:     durationInMilliseconds(summary.SumOfDurations),
+			MinDurationMs:        durationInMilliseconds(summary.MinDuration),
+			MaxDurationMs:        durationInMilliseconds(summary.MaxDuration),
+		}})
+		if err != nil {
+			return "", err
+		}
+		return msg, firstErr
+	}
+	return summary.String(), firstErr
+}
+
+// The text output is a label like "[stream 3] /index.html: 200 (1024 bytes, 4.2ms)", followed by the response.
+// Failed requests are shown like "[failed] /index.html: Timeout after 10 seconds."
+func formatParallelResult(cmd *rpc.Command, result *http2client.ParallelResult, includeHeaders bool) (string, error) {
+	err := result.Err
+	if err == nil {
+		err = checkStatus(cmd, result.Response)
+	}
+	if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+		jsonResult := jsonParallelResult{Path: result.Path}
+		if result.Response != nil {
+			jsonResult.StreamId = result.Response.StreamId
+		}
+		if err != nil {
+			jsonResult.Error = makeJsonError(err)
+		} else {
+			jsonResult.Response = makeJsonResponse(result.Response)
+		}
+		msg, jsonErr := toJson(jsonResult)
+		if jsonErr != nil {
+			return jsonErr.Error(), jsonErr
+		}
+		if err != nil {
+			return msg, err
+		}
+		return appendWriteOut(cmd, msg, result.Response), nil
+	}
+	label := fmt.Sprintf("[failed] %v:", result.Path)
+	if result.Response != nil {
+		label = fmt.Sprintf("[stream %v] %v:", result.Response.StreamId, result.Path)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v %v", label, err.Error()), err
+	}
+	msg := fmt.Sprintf("%v %v (%v bytes, %v)", label, result.Response.Status(), len(result.Response.Body), result.Duration.Round(100*time.Microsecond))
+	if formatted := result.Response.Format(includeHeaders); formatted != "" {
+		msg = msg + "\n" + formatted
+	}
+	return appendWriteOut(cmd, msg, result.Response), nil
+}
@@ -0,0 +1,116 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/fstab/h2c/cli/pcapng"
+	"github.com/fstab/h2c/http2client"
+	"github.com/fstab/h2c/http2client/frames"
+)
+
+// pcapCapture writes the frames of all connections to a pcapng file, see 'h2c start --pcap-file'.
+// Each connection becomes a separate TCP flow.
+type pcapCapture struct {
+	mutex      sync.Mutex
+	file       *os.File
+	writer     *pcapng.Writer
+	connection func() *http2client.ConnectionInfo
+	flowId     uint64 // connection id of the current flow
+	flow       *pcapng.Flow
+}
+
+func newPcapCapture(filename string, connection func() *http2client.ConnectionInfo) (*pcapCapture, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create pcap file: %v", err.Error())
+	}
+	writer, err := pcapng.NewWriter(file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to write pcap file: %v", err.Error())
+	}
+	return &pcapCapture{
+		file:       file,
+		writer:     writer,
+		connection: connection,
+	}, nil
+}
+
+// makePcapFilter captures incoming frames as they were read, i.e. before the rules are applied.
+func makePcapFilter(capture *pcapCapture) func(frames.Frame) []frames.Frame {
+	observer := makePcapObserver(capture, true)
+	return func(frame frames.Frame) []frames.Frame {
+		observer(frame)
+		return []frames.Frame{frame}
+	}
+}
+
+// makePcapObserver captures outgoing frames after they are written, so that the pcap file contains the bytes on the wire.
+func makePcapObserver(capture *pcapCapture, incoming bool) func(frames.Frame) {
+	return func(frame frames.Frame) {
+		flow, err := capture.currentFlow()
+		if err == nil && flow != nil {
+			err = flow.WriteFrame(!incoming, frame)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write %v frame to pcap file: %v\n", frame.Type(), err.Error())
+		}
+	}
+}
+
+// The flow is created when the first frame of a new connection is captured. The previous flow is closed at that time.
+func (c *pcapCapture) currentFlow() (*pcapng.Flow, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	info := c.connection()
+	if info == nil || c.file == nil {
+		return nil, nil
+	}
+	if c.flow != nil && c.flowId == info.Id {
+		return c.flow, nil
+	}
+	if c.flow != nil {
+		if err := c.flow.Close(); err != nil {
+			return nil, err
+		}
+	}
+	// h2c does not know the local address, so we use a placeholder with a different port for each connection.
+	client := &net.TCPAddr{
+		IP:   pcapng.PLACEHOLDER_CLIENT.IP,
+		Port: pcapng.PLACEHOLDER_CLIENT.Port + int(info.Id%16384),
+	}
+	server := info.Addr
+	if server == nil || server.IP.To4() == nil {
+		server = &net.TCPAddr{
+			IP:   pcapng.PLACEHOLDER_SERVER.IP,
+			Port: info.Port,
+		}
+	}
+	flow, err := c.writer.NewFlow(client, server)
+	if err != nil {
+		return nil, err
+	}
+	c.flow = flow
+	c.flowId = info.Id
+	return flow, nil
+}
+
+// Close terminates the current flow and closes the pcap file. Frames captured after Close() are ignored.
+func (c *pcapCapture) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	var err error
+	if c.flow != nil {
+		err = c.flow.Close()
+	}
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	c.file = nil
+	return err
+}
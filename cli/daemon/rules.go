@@ -0,0 +1,255 @@
+package daemon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fstab/h2c/cli/cmdline"
+	"github.com/fstab/h2c/cli/rpc"
+	"github.com/fstab/h2c/http2client"
+	"github.com/fstab/h2c/http2client/frames"
+)
+
+// Actions for 'h2c start --rule' and 'h2c rule add'
+const (
+	DROP_ACTION      = "drop"
+	DELAY_ACTION     = "delay"
+	DUPLICATE_ACTION = "duplicate"
+	CORRUPT_ACTION   = "corrupt"
+)
+
+// rule injects a fault into matching frames, like 'drop WINDOW_UPDATE stream=0 count=3'.
+type rule struct {
+	id          int
+	text        string
+	action      string
+	frameType   frames.Type
+	incoming    bool
+	hasStreamId bool
+	streamId    uint32
+	remaining   int // number of frames the rule will still be applied to, or -1 if the rule has no count
+	applied     int
+	delay       time.Duration // only for DELAY_ACTION
+}
+
+// ruleSet is shared between the command handlers adding and removing rules, and the frame filters applying them,
+// which run in the frame reader and frame writer go routines.
+type ruleSet struct {
+	mutex  sync.Mutex
+	rules  []*rule
+	nextId int
+}
+
+// The rules are global for the h2c process, like the console dumper, and apply to all connections.
+var faultRules = newRuleSet()
+
+func newRuleSet() *ruleSet {
+	return &ruleSet{
+		rules:  make([]*rule, 0),
+		nextId: 1,
+	}
+}
+
+// parseRule parses rules like
+//
+//	drop WINDOW_UPDATE stream=0 count=3
+//	delay DATA 200ms
+//	duplicate incoming PING
+//	corrupt HEADERS
+//
+// Rules apply to outgoing frames, unless the 'incoming' keyword is used. Without count, the rule applies to all matching frames.
+func parseRule(text string) (*rule, error) {
+	fields := strings.Fields(text)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("Syntax error in rule '%v': Expected an action and a frame type, like 'drop DATA'.", text)
+	}
+	r := &rule{
+		text:      strings.Join(fields, " "),
+		action:    fields[0],
+		remaining: -1,
+	}
+	switch r.action {
+	case DROP_ACTION, DELAY_ACTION, DUPLICATE_ACTION, CORRUPT_ACTION:
+	default:
+		return nil, fmt.Errorf("Syntax error in rule '%v': Unknown action '%v'. Valid actions are %v, %v, %v, and %v.", text, r.action, DROP_ACTION, DELAY_ACTION, DUPLICATE_ACTION, CORRUPT_ACTION)
+	}
+	hasFrameType := false
+	for _, field := range fields[1:] {
+		var err error
+		switch {
+		case field == "incoming":
+			r.incoming = true
+		case field == "outgoing":
+			r.incoming = false
+		case strings.HasPrefix(field, "stream="):
+			var id uint64
+			id, err = strconv.ParseUint(strings.TrimPrefix(field, "stream="), 10, 31)
+			r.hasStreamId, r.streamId = true, uint32(id)
+		case strings.HasPrefix(field, "count="):
+			r.remaining, err = strconv.Atoi(strings.TrimPrefix(field, "count="))
+			if err == nil && r.remaining <= 0 {
+				err = fmt.Errorf("count must be positive")
+			}
+		default:
+			if frameType, ok := frames.FrameNameToType(field); ok && !hasFrameType {
+				r.frameType, hasFrameType = frameType, true
+			} else if delay, parseErr := time.ParseDuration(field); parseErr == nil && r.action == DELAY_ACTION && delay > 0 {
+				r.delay = delay
+			} else {
+				return nil, fmt.Errorf("Syntax error in rule '%v': Unexpected '%v'.", text, field)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Syntax error in rule '%v': Invalid '%v'.", text, field)
+		}
+	}
+	switch {
+	case !hasFrameType:
+		return nil, fmt.Errorf("Syntax error in rule '%v': Frame type missing.", text)
+	case r.action == DELAY_ACTION && r.delay == 0:
+		return nil, fmt.Errorf("Syntax error in rule '%v': Duration missing, like 'delay DATA 200ms'.", text)
+	case r.action == CORRUPT_ACTION && r.incoming:
+		return nil, fmt.Errorf("Syntax error in rule '%v': Incoming frames cannot be corrupted, because they are already decoded when the rule is applied.", text)
+	}
+	return r, nil
+}
+
+// add returns the id of the new rule.
+func (s *ruleSet) add(text string) (int, error) {
+	r, err := parseRule(text)
+	if err != nil {
+		return 0, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	r.id = s.nextId
+	s.nextId++
+	s.rules = append(s.rules, r)
+	return r.id, nil
+}
+
+func (s *ruleSet) remove(id int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, r := range s.rules {
+		if r.id == id {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%v: No such rule. Run 'h2c rule list' to show the rules.", id)
+}
+
+// list returns a line per rule, like
+//
+//	1  drop WINDOW_UPDATE stream=0 count=3  (applied 1 times, 2 remaining)
+func (s *ruleSet) list() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	lines := make([]string, 0, len(s.rules))
+	for _, r := range s.rules {
+		status := fmt.Sprintf("applied %v times", r.applied)
+		if r.remaining >= 0 {
+			status = fmt.Sprintf("%v, %v remaining", status, r.remaining)
+		}
+		lines = append(lines, fmt.Sprintf("%-3v %v  (%v)", r.id, r.text, status))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (s *ruleSet) jsonList() *jsonRuleList {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := &jsonRuleList{Rules: make([]*jsonRule, 0, len(s.rules))}
+	for _, r := range s.rules {
+		result.Rules = append(result.Rules, &jsonRule{Id: r.id, Rule: r.text, Applied: r.applied, Remaining: r.remaining})
+	}
+	return result
+}
+
+// match returns the first rule matching the frame, and counts the frame for that rule.
+// Returns nil if no rule matches.
+func (s *ruleSet) match(incoming bool, frame frames.Frame) *rule {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, r := range s.rules {
+		if r.incoming != incoming || r.frameType != frame.Type() || r.remaining == 0 {
+			continue
+		}
+		if r.hasStreamId && r.streamId != frame.GetStreamId() {
+			continue
+		}
+		if r.remaining > 0 {
+			r.remaining--
+		}
+		r.applied++
+		return r
+	}
+	return nil
+}
+
+func executeRule(rules *ruleSet, cmd *rpc.Command) (string, error) {
+	switch cmd.Args[0] {
+	case "add":
+		id, err := rules.add(strings.Join(cmd.Args[1:], " "))
+		if err != nil {
+			return "", err
+		}
+		if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+			return toJson(&jsonRuleAdded{Id: id})
+		}
+		return fmt.Sprintf("Added rule %v.", id), nil
+	case "rm":
+		id, err := strconv.Atoi(cmd.Args[1])
+		if err != nil {
+			return "", fmt.Errorf("%v: invalid rule id", cmd.Args[1])
+		}
+		return "", rules.remove(id)
+	default:
+		if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+			return toJson(rules.jsonList())
+		}
+		return rules.list(), nil
+	}
+}
+
+// makeRuleFilter returns a frame filter applying the rules.
+// Rules for outgoing frames must be applied before the frames are dumped, and rules for incoming frames after the frames are dumped,
+// so that the dump shows the frames on the wire.
+func makeRuleFilter(rules *ruleSet, incoming bool) func(frames.Frame) []frames.Frame {
+	return func(frame frames.Frame) []frames.Frame {
+		r := rules.match(incoming, frame)
+		if r == nil {
+			return []frames.Frame{frame}
+		}
+		switch r.action {
+		case DROP_ACTION:
+			return []frames.Frame{}
+		case DELAY_ACTION:
+			return []frames.Frame{http2client.DelayFrame(frame, r.delay)}
+		case DUPLICATE_ACTION:
+			return []frames.Frame{frame, frame}
+		case CORRUPT_ACTION:
+			return []frames.Frame{corrupt(frame)}
+		default:
+			return []frames.Frame{frame}
+		}
+	}
+}
+
+// corrupt inverts all bits of the payload, keeping the frame header intact.
+// Header blocks are encoded with an empty HPACK dynamic table, which does not matter as the result is garbage anyway.
+func corrupt(frame frames.Frame) frames.Frame {
+	encoded, err := frame.Encode(frames.NewEncodingContext())
+	if err != nil {
+		return frame
+	}
+	payload := encoded[9:] // strip the frame header
+	for i := range payload {
+		payload[i] = ^payload[i]
+	}
+	return frames.NewRawFrame(frame.Type(), encoded[4], frame.GetStreamId(), payload)
+}
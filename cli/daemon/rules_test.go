@@ -0,0 +1,77 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fstab/h2c/http2client/frames"
+)
+
+func TestParseRule(t *testing.T) {
+	r, err := parseRule("drop  WINDOW_UPDATE stream=0 count=3")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if r.action != DROP_ACTION || r.frameType != frames.WINDOW_UPDATE_TYPE || !r.hasStreamId || r.streamId != 0 || r.remaining != 3 || r.incoming {
+		t.Errorf("Unexpected rule: %#v", r)
+	}
+	if r.text != "drop WINDOW_UPDATE stream=0 count=3" {
+		t.Errorf("Unexpected text: %v", r.text)
+	}
+	r, err = parseRule("delay incoming DATA 200ms")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if r.delay != 200*time.Millisecond || !r.incoming || r.remaining != -1 {
+		t.Errorf("Unexpected rule: %#v", r)
+	}
+	for _, invalid := range []string{"drop", "explode DATA", "drop FOO", "drop DATA count=0", "drop DATA stream=x", "delay DATA", "drop DATA 200ms", "corrupt incoming HEADERS"} {
+		if _, err = parseRule(invalid); err == nil {
+			t.Errorf("%v: Expected syntax error.", invalid)
+		}
+	}
+}
+
+func TestRuleFilter(t *testing.T) {
+	rules := newRuleSet()
+	for _, text := range []string{"drop WINDOW_UPDATE stream=0 count=2", "duplicate PING", "corrupt DATA stream=3"} {
+		if _, err := rules.add(text); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	filter := makeRuleFilter(rules, false)
+	windowUpdate := frames.NewWindowUpdateFrame(0, 100)
+	for i, expected := range []int{0, 0, 1} {
+		if result := filter(windowUpdate); len(result) != expected {
+			t.Errorf("WINDOW_UPDATE %v: Expected %v frames, but got %v.", i, expected, len(result))
+		}
+	}
+	if result := filter(frames.NewWindowUpdateFrame(1, 100)); len(result) != 1 {
+		t.Errorf("Expected WINDOW_UPDATE on stream 1 not to be dropped.")
+	}
+	if result := filter(frames.NewPingFrame(0, 1, false)); len(result) != 2 {
+		t.Errorf("Expected PING to be duplicated, but got %v frames.", len(result))
+	}
+	if result := makeRuleFilter(rules, true)(frames.NewPingFrame(0, 1, false)); len(result) != 1 {
+		t.Errorf("Expected incoming PING not to be duplicated.")
+	}
+	result := filter(frames.NewDataFrame(3, []byte{0x00, 0xf0}, true))
+	raw, ok := result[0].(*frames.RawFrame)
+	if len(result) != 1 || !ok {
+		t.Fatalf("Expected corrupted DATA frame.")
+	}
+	if raw.FrameType != frames.DATA_TYPE || raw.StreamId != 3 || raw.Flags != byte(frames.DATA_FLAG_END_STREAM) || raw.Payload[0] != 0xff || raw.Payload[1] != 0x0f {
+		t.Errorf("Unexpected corrupted frame: %#v", raw)
+	}
+	if rules.list() != "1   drop WINDOW_UPDATE stream=0 count=2  (applied 2 times, 0 remaining)\n"+
+		"2   duplicate PING  (applied 1 times)\n"+
+		"3   corrupt DATA stream=3  (applied 1 times)" {
+		t.Errorf("Unexpected list:\n%v", rules.list())
+	}
+	if err := rules.remove(2); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := rules.remove(2); err == nil {
+		t.Errorf("Expected error when removing rule twice.")
+	}
+}
@@ -0,0 +1,218 @@
+package daemon
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fstab/h2c/cli/cmdline"
+	"github.com/fstab/h2c/cli/rpc"
+	"github.com/fstab/h2c/http2client"
+	"github.com/fstab/h2c/http2client/frames"
+	"golang.org/x/net/http2/hpack"
+)
+
+func executeSendFrame(h2c *http2client.Http2Client, cmd *rpc.Command) (string, error) {
+	frame, err := makeFrame(cmd)
+	if err != nil {
+		return "", err
+	}
+	return "", h2c.SendFrame(frame)
+}
+
+// makeFrame creates the frame for 'h2c send-frame'. With --headers, the result is a HeadersFrame,
+// because the header block must be encoded with the connection's HPACK context when the frame is written.
+// Otherwise, the result is a RawFrame, and --setting, --error-code, and --increment are just ways to create the payload.
+func makeFrame(cmd *rpc.Command) (frames.Frame, error) {
+	payloadOptions := make([]string, 0)
+	if cmdline.PAYLOAD_OPTION.IsSet(cmd.Options) {
+		payloadOptions = append(payloadOptions, cmdline.PAYLOAD_OPTION.Name())
+	}
+	if cmdline.FRAME_HEADERS_OPTION.IsSet(cmd.Options) {
+		payloadOptions = append(payloadOptions, cmdline.FRAME_HEADERS_OPTION.Name())
+	}
+	if cmdline.SETTING_OPTION.IsSet(cmd.Options) {
+		payloadOptions = append(payloadOptions, cmdline.SETTING_OPTION.Name())
+	}
+	if cmdline.ERROR_CODE_OPTION.IsSet(cmd.Options) {
+		payloadOptions = append(payloadOptions, cmdline.ERROR_CODE_OPTION.Name())
+	}
+	if cmdline.INCREMENT_OPTION.IsSet(cmd.Options) {
+		payloadOptions = append(payloadOptions, cmdline.INCREMENT_OPTION.Name())
+	}
+	if len(payloadOptions) > 1 {
+		return nil, fmt.Errorf("Syntax error: %v cannot be used together.", strings.Join(payloadOptions, " and "))
+	}
+	frameType, err := getFrameType(cmd)
+	if err != nil {
+		return nil, err
+	}
+	var streamId uint32
+	if cmdline.STREAM_ID_OPTION.IsSet(cmd.Options) {
+		id, err := strconv.ParseUint(cmdline.STREAM_ID_OPTION.Get(cmd.Options), 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("%v: invalid stream id", cmdline.STREAM_ID_OPTION.Get(cmd.Options))
+		}
+		streamId = uint32(id)
+	}
+	if cmdline.FRAME_HEADERS_OPTION.IsSet(cmd.Options) {
+		return makeHeadersFrame(cmd, frameType, streamId)
+	}
+	flags, err := getFlags(cmd, frameType)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]byte, 0)
+	switch {
+	case cmdline.PAYLOAD_OPTION.IsSet(cmd.Options):
+		payload, err = hex.DecodeString(regexp.MustCompile("[\\s:]").ReplaceAllString(cmdline.PAYLOAD_OPTION.Get(cmd.Options), ""))
+		if err != nil {
+			return nil, fmt.Errorf("%v: invalid hex payload", cmdline.PAYLOAD_OPTION.Get(cmd.Options))
+		}
+	case cmdline.SETTING_OPTION.IsSet(cmd.Options):
+		if frameType != frames.SETTINGS_TYPE {
+			return nil, fmt.Errorf("Syntax error: %v can only be used with %v frames.", cmdline.SETTING_OPTION.Name(), frames.SETTINGS_TYPE)
+		}
+		for _, setting := range cmdline.SETTING_OPTION.GetAll(cmd.Options) {
+			if payload, err = appendSetting(payload, setting); err != nil {
+				return nil, err
+			}
+		}
+	case cmdline.ERROR_CODE_OPTION.IsSet(cmd.Options):
+		errorCode, err := parseErrorCode(cmdline.ERROR_CODE_OPTION.Get(cmd.Options))
+		if err != nil {
+			return nil, err
+		}
+		switch frameType {
+		case frames.RST_STREAM_TYPE:
+			payload = binary.BigEndian.AppendUint32(payload, uint32(errorCode))
+		case frames.GOAWAY_TYPE:
+			payload = binary.BigEndian.AppendUint32(payload, 0) // last stream id
+			payload = binary.BigEndian.AppendUint32(payload, uint32(errorCode))
+		default:
+			return nil, fmt.Errorf("Syntax error: %v can only be used with %v and %v frames.", cmdline.ERROR_CODE_OPTION.Name(), frames.RST_STREAM_TYPE, frames.GOAWAY_TYPE)
+		}
+	case cmdline.INCREMENT_OPTION.IsSet(cmd.Options):
+		if frameType != frames.WINDOW_UPDATE_TYPE {
+			return nil, fmt.Errorf("Syntax error: %v can only be used with %v frames.", cmdline.INCREMENT_OPTION.Name(), frames.WINDOW_UPDATE_TYPE)
+		}
+		increment, err := strconv.ParseUint(cmdline.INCREMENT_OPTION.Get(cmd.Options), 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("%v: invalid window size increment", cmdline.INCREMENT_OPTION.Get(cmd.Options))
+		}
+		payload = binary.BigEndian.AppendUint32(payload, uint32(increment))
+	}
+	return frames.NewRawFrame(frameType, flags, streamId, payload), nil
+}
+
+// Without --type, the frame type is derived from --headers, --setting, or --increment.
+func getFrameType(cmd *rpc.Command) (frames.Type, error) {
+	switch {
+	case cmdline.FRAME_TYPE_OPTION.IsSet(cmd.Options):
+		name := cmdline.FRAME_TYPE_OPTION.Get(cmd.Options)
+		if frameType, ok := frames.FrameNameToType(name); ok {
+			return frameType, nil
+		}
+		frameType, err := strconv.ParseUint(strings.TrimPrefix(name, "0x"), 16, 8)
+		if err != nil {
+			return 0, fmt.Errorf("%v: invalid frame type", name)
+		}
+		return frames.Type(frameType), nil
+	case cmdline.FRAME_HEADERS_OPTION.IsSet(cmd.Options):
+		return frames.HEADERS_TYPE, nil
+	case cmdline.SETTING_OPTION.IsSet(cmd.Options):
+		return frames.SETTINGS_TYPE, nil
+	case cmdline.INCREMENT_OPTION.IsSet(cmd.Options):
+		return frames.WINDOW_UPDATE_TYPE, nil
+	default:
+		return 0, fmt.Errorf("Syntax error: %v is required. Run 'h2c send-frame --help' for help.", cmdline.FRAME_TYPE_OPTION.Name())
+	}
+}
+
+// Flags are either a number like 0x05, or names like END_STREAM,END_HEADERS, which must be defined for the frame type.
+func getFlags(cmd *rpc.Command, frameType frames.Type) (byte, error) {
+	if !cmdline.FLAGS_OPTION.IsSet(cmd.Options) {
+		return 0, nil
+	}
+	param := cmdline.FLAGS_OPTION.Get(cmd.Options)
+	if strings.HasPrefix(param, "0x") {
+		flags, err := strconv.ParseUint(strings.TrimPrefix(param, "0x"), 16, 8)
+		if err != nil {
+			return 0, fmt.Errorf("%v: invalid flags", param)
+		}
+		return byte(flags), nil
+	}
+	var flags byte
+	for _, name := range strings.Split(param, ",") {
+		flag, ok := frames.FlagNameToFlag(frameType, name)
+		if !ok {
+			return 0, fmt.Errorf("%v: flag not defined for %v frames. Use a number like 0x01 for arbitrary flags.", name, frameType)
+		}
+		flags |= byte(flag)
+	}
+	return flags, nil
+}
+
+// The HeadersFrame only supports the END_STREAM and END_HEADERS flags. Use --payload for HEADERS frames with padding or priority.
+func makeHeadersFrame(cmd *rpc.Command, frameType frames.Type, streamId uint32) (frames.Frame, error) {
+	if frameType != frames.HEADERS_TYPE {
+		return nil, fmt.Errorf("Syntax error: %v can only be used with %v frames.", cmdline.FRAME_HEADERS_OPTION.Name(), frames.HEADERS_TYPE)
+	}
+	headers := make([]hpack.HeaderField, 0)
+	for _, header := range cmdline.FRAME_HEADERS_OPTION.GetAll(cmd.Options) {
+		i := strings.Index(header[1:], ":") + 1 // pseudo header names start with ':'
+		headers = append(headers, hpack.HeaderField{Name: header[:i], Value: strings.TrimSpace(header[i+1:])})
+	}
+	frame := frames.NewHeadersFrame(streamId, headers)
+	frame.EndStream = false
+	if !cmdline.FLAGS_OPTION.IsSet(cmd.Options) {
+		return frame, nil
+	}
+	flags, err := getFlags(cmd, frameType)
+	if err != nil {
+		return nil, err
+	}
+	if flags&^byte(frames.HEADERS_FLAG_END_STREAM|frames.HEADERS_FLAG_END_HEADERS) != 0 {
+		return nil, fmt.Errorf("Syntax error: Only END_STREAM and END_HEADERS can be used with %v. Use %v for other flags.", cmdline.FRAME_HEADERS_OPTION.Name(), cmdline.PAYLOAD_OPTION.Name())
+	}
+	frame.EndStream = flags&byte(frames.HEADERS_FLAG_END_STREAM) != 0
+	frame.EndHeaders = flags&byte(frames.HEADERS_FLAG_END_HEADERS) != 0
+	return frame, nil
+}
+
+// setting is like SETTINGS_MAX_FRAME_SIZE=32768. The SETTINGS_ prefix may be omitted.
+func appendSetting(payload []byte, setting string) ([]byte, error) {
+	i := strings.Index(setting, "=")
+	name := setting[:i]
+	value, err := strconv.ParseUint(setting[i+1:], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%v: invalid setting value", setting)
+	}
+	for id := frames.SETTINGS_HEADER_TABLE_SIZE; id <= frames.SETTINGS_MAX_HEADER_LIST_SIZE; id++ {
+		if id.String() == name || id.String() == "SETTINGS_"+name {
+			payload = binary.BigEndian.AppendUint16(payload, uint16(id))
+			return binary.BigEndian.AppendUint32(payload, uint32(value)), nil
+		}
+	}
+	return nil, fmt.Errorf("%v: unknown setting", name)
+}
+
+// Error codes are names like CANCEL, or numbers like 0xff for unknown error codes.
+func parseErrorCode(name string) (frames.ErrorCode, error) {
+	if strings.HasPrefix(name, "0x") {
+		code, err := strconv.ParseUint(strings.TrimPrefix(name, "0x"), 16, 32)
+		if err != nil {
+			return 0, fmt.Errorf("%v: invalid error code", name)
+		}
+		return frames.ErrorCode(code), nil
+	}
+	for code := frames.NO_ERROR; code <= frames.HTTP_1_1_REQUIRED; code++ {
+		if code.String() == name {
+			return code, nil
+		}
+	}
+	return 0, fmt.Errorf("%v: unknown error code", name)
+}
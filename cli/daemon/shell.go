@@ -0,0 +1,74 @@
+package daemon
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/fstab/h2c/cli/cmdline"
+	"github.com/fstab/h2c/cli/rpc"
+	"github.com/fstab/h2c/http2client"
+	"github.com/fstab/h2c/http2client/events"
+)
+
+// Results are written by the command loop and by the event go routine, so writes must be synchronized.
+type shellConnection struct {
+	mutex sync.Mutex
+	conn  net.Conn
+}
+
+func (s *shellConnection) write(result *rpc.Result) error {
+	encodedResult, err := result.Marshal()
+	if err != nil {
+		handleCommunicationError("Failed to encode result: %v", err)
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = s.conn.Write([]byte(encodedResult + "\n"))
+	return err
+}
+
+// Keeps the connection open for an 'h2c shell' session: Reads one Command per line and writes one Result per line,
+// until the shell closes the connection. Push promises and GOAWAY frames are sent as event Results in between.
+func executeShell(h2c *http2client.Http2Client, conn net.Conn, sock net.Listener) {
+	shell := &shellConnection{conn: conn}
+	subscription := h2c.Events().Subscribe(WATCH_BUFFER_SIZE)
+	defer subscription.Unsubscribe()
+	go func() {
+		for event := range subscription.Events {
+			if event.Type == events.PUSH_PROMISE || event.Type == events.GOAWAY {
+				if shell.write(rpc.NewEventResult(event.String())) != nil {
+					return
+				}
+			}
+		}
+	}()
+	reader := bufio.NewReader(conn)
+	for {
+		encodedCmd, err := reader.ReadString('\n')
+		if err != nil {
+			return // The shell was terminated.
+		}
+		cmd, err := rpc.UnmarshalCommand(encodedCmd)
+		if err != nil {
+			handleCommunicationError("Failed to decode command: %v", err.Error())
+			return
+		}
+		switch cmd.Name {
+		case cmdline.STOP_COMMAND.Name():
+			shell.write(rpc.NewResult("", nil))
+			stop(sock)
+		case cmdline.SHELL_COMMAND.Name(), cmdline.WATCH_COMMAND.Name():
+			err = shell.write(rpc.NewResult("", fmt.Errorf("%v: Not available in 'h2c shell'.", cmd.Name)))
+		default:
+			err = shell.write(rpc.NewResult(execute(h2c, cmd, func(progress string) {
+				shell.write(rpc.NewEventResult(progress))
+			})))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package daemon
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+
+	"github.com/fstab/h2c/cli/cmdline"
+	"github.com/fstab/h2c/cli/rpc"
+	"github.com/fstab/h2c/http2client"
+	"github.com/fstab/h2c/http2client/events"
+	"github.com/fstab/h2c/http2client/frames"
+)
+
+// Number of events buffered for each 'h2c watch' command. If the command line does not read fast enough, events are dropped.
+const WATCH_BUFFER_SIZE = 1024
+
+// The filter publishes a FRAME event for each frame, but only if somebody is watching.
+func makeFrameEventFilter(direction string, bus *events.Bus) func(frames.Frame) []frames.Frame {
+	return func(frame frames.Frame) []frames.Frame {
+		if bus.HasSubscribers() {
+			bus.Publish(events.New(events.FRAME, frame.GetStreamId(), "%v %v", direction, summarize(frame)))
+		}
+		return []frames.Frame{frame}
+	}
+}
+
+// One line summary of a frame, like "DATA 1024 bytes +END_STREAM"
+func summarize(frame frames.Frame) string {
+	switch f := frame.(type) {
+	case *frames.HeadersFrame:
+		return fmt.Sprintf("%v %v header fields%v%v", f.Type(), len(f.Headers), flag("END_STREAM", f.EndStream), flag("END_HEADERS", f.EndHeaders))
+	case *frames.DataFrame:
+		return fmt.Sprintf("%v %v bytes%v", f.Type(), len(f.Data), flag("END_STREAM", f.EndStream))
+	case *frames.SettingsFrame:
+		return fmt.Sprintf("%v %v settings%v", f.Type(), len(f.Settings), flag("ACK", f.Ack))
+	case *frames.PushPromiseFrame:
+		return fmt.Sprintf("%v promised stream id %v", f.Type(), f.PromisedStreamId)
+	case *frames.RstStreamFrame:
+		return fmt.Sprintf("%v %v", f.Type(), f.ErrorCode.String())
+	case *frames.PingFrame:
+		return fmt.Sprintf("%v 0x%016x%v", f.Type(), f.Payload, flag("ACK", f.Ack))
+	case *frames.GoAwayFrame:
+		return fmt.Sprintf("%v last stream id %v, %v", f.Type(), f.LastStreamId, f.ErrorCode.String())
+	case *frames.WindowUpdateFrame:
+		return fmt.Sprintf("%v +%v", f.Type(), f.WindowSizeIncrement)
+	case *frames.RawFrame:
+		return fmt.Sprintf("%v %v bytes raw, flags 0x%02x", f.Type(), len(f.Payload), f.Flags)
+	default:
+		return fmt.Sprintf("%v", frame.Type())
+	}
+}
+
+func flag(name string, isSet bool) string {
+	if isSet {
+		return " +" + name
+	}
+	return ""
+}
+
+// Keeps the connection open and writes one Result per event, until the command line closes the connection.
+func executeWatch(h2c *http2client.Http2Client, cmd *rpc.Command, conn net.Conn) {
+	eventTypes := eventTypesToBeWatched(cmd)
+	subscription := h2c.Events().Subscribe(WATCH_BUFFER_SIZE)
+	defer subscription.Unsubscribe()
+	closed := make(chan bool, 1)
+	go func() {
+		// The command line does not send anything after the command. EOF means the user pressed Ctrl-C.
+		io.Copy(ioutil.Discard, conn)
+		closed <- true
+	}()
+	writer := bufio.NewWriter(conn)
+	for {
+		select {
+		case event := <-subscription.Events:
+			if !eventTypes[event.Type] {
+				continue
+			}
+			msg := event.String()
+			if cmdline.JSON_OPTION.IsSet(cmd.Options) {
+				msg, _ = toJson(makeJsonEvent(event))
+			}
+			encodedResult, err := rpc.NewResult(msg, nil).Marshal()
+			if err != nil {
+				handleCommunicationError("Failed to encode result: %v", err)
+				return
+			}
+			if _, err = writer.WriteString(encodedResult + "\n"); err != nil {
+				return
+			}
+			if err = writer.Flush(); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// GOAWAY and ping RTT are always shown. If no option is given, everything except frames is shown.
+func eventTypesToBeWatched(cmd *rpc.Command) map[events.Type]bool {
+	push := cmdline.PUSH_EVENTS_OPTION.IsSet(cmd.Options)
+	streams := cmdline.STREAM_EVENTS_OPTION.IsSet(cmd.Options)
+	showFrames := cmdline.FRAME_EVENTS_OPTION.IsSet(cmd.Options)
+	if !push && !streams && !showFrames {
+		push, streams = true, true
+	}
+	return map[events.Type]bool{
+		events.PUSH_PROMISE: push,
+		events.STREAM_STATE: streams,
+		events.RST_STREAM:   streams,
+		events.GOAWAY:       true,
+		events.PING_RTT:     true,
+		events.FRAME:        showFrames,
+	}
+}
@@ -0,0 +1,46 @@
+package daemon
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fstab/h2c/cli/cmdline"
+	"github.com/fstab/h2c/http2client"
+)
+
+// writeOut expands the --write-out template for a response. The variables are defined in cmdline.WRITE_OUT_VARIABLES.
+func writeOut(template string, response *http2client.Response) string {
+	timings := response.Timings
+	return cmdline.ExpandWriteOut(template, func(variable string) string {
+		switch variable {
+		case "http_status":
+			return response.Status()
+		case "stream_id":
+			return strconv.FormatUint(uint64(response.StreamId), 10)
+		case "size_download":
+			return strconv.Itoa(len(response.Body))
+		case "time_connect":
+			return seconds(timings.Connect())
+		case "time_appconnect":
+			return seconds(timings.TlsHandshake())
+		case "time_headers_sent":
+			return seconds(timings.Since(timings.HeadersSent))
+		case "time_request_sent":
+			return seconds(timings.Since(timings.RequestSent))
+		case "time_first_byte":
+			return seconds(timings.Since(timings.ResponseStarted))
+		case "time_first_data":
+			return seconds(timings.Since(timings.FirstDataReceived))
+		case "time_total":
+			return seconds(timings.Total())
+		default:
+			return "%{" + variable + "}" // cannot happen, because the template is validated by the command line parser
+		}
+	})
+}
+
+// Like curl, times are shown in seconds with microsecond resolution.
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.6f", d.Seconds())
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"github.com/fstab/h2c/http2client/failure"
+)
+
+// Exit codes of the h2c command line. Where curl has a similar exit code, the same number is used,
+// so that scripts can handle h2c and curl failures alike.
+const (
+	EXIT_OK               = 0
+	EXIT_ASSERTION_FAILED = 1   // An 'expect' step in 'h2c run' or a test in 'h2c conformance' failed.
+	EXIT_CONNECT_ERROR    = 7   // curl: Failed to connect to host.
+	EXIT_PROTOCOL_ERROR   = 16  // curl: A problem was detected in the HTTP2 framing layer.
+	EXIT_HTTP_ERROR       = 22  // curl: HTTP page not retrieved (with --fail).
+	EXIT_TIMEOUT          = 28  // curl: Operation timeout.
+	EXIT_GOAWAY           = 52  // curl: The server did not reply anything.
+	EXIT_CONNECTION_ERROR = 56  // curl: Failure in receiving network data.
+	EXIT_STREAM_ERROR     = 92  // curl: Stream error in the HTTP/2 framing layer.
+	EXIT_ERROR            = 255 // Any other error, like a syntax error or h2c not running.
+)
+
+// ExitCode returns the process exit code for an error returned by Run().
+func ExitCode(err error) int {
+	if err == nil {
+		return EXIT_OK
+	}
+	f := failure.Of(err)
+	if f == nil {
+		return EXIT_ERROR
+	}
+	switch f.Kind {
+	case failure.CONNECT_ERROR:
+		return EXIT_CONNECT_ERROR
+	case failure.PROTOCOL_ERROR:
+		return EXIT_PROTOCOL_ERROR
+	case failure.HTTP_ERROR:
+		return EXIT_HTTP_ERROR
+	case failure.ASSERTION_FAILED:
+		return EXIT_ASSERTION_FAILED
+	case failure.TIMEOUT:
+		return EXIT_TIMEOUT
+	case failure.GOAWAY:
+		return EXIT_GOAWAY
+	case failure.CONNECTION_ERROR:
+		return EXIT_CONNECTION_ERROR
+	case failure.STREAM_ERROR:
+		return EXIT_STREAM_ERROR
+	default:
+		return EXIT_ERROR
+	}
+}
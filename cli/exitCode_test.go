@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/fstab/h2c/cli/rpc"
+	"github.com/fstab/h2c/http2client/failure"
+	"github.com/fstab/h2c/http2client/frames"
+)
+
+func TestExitCodeAfterRpc(t *testing.T) {
+	for err, expected := range map[error]int{
+		failure.New(failure.TIMEOUT, "Timeout after 1 seconds."):                    EXIT_TIMEOUT,
+		failure.New(failure.CONNECT_ERROR, "Failed to connect to localhost:1."):     EXIT_CONNECT_ERROR,
+		failure.New(failure.HTTP_ERROR, "The server returned HTTP status 500."):     EXIT_HTTP_ERROR,
+		failure.New(failure.GOAWAY, "Server sent GOAWAY with error code NO_ERROR."): EXIT_GOAWAY,
+		failure.New(failure.ASSERTION_FAILED, "1 of 3 steps failed."):               EXIT_ASSERTION_FAILED,
+		fmt.Errorf("Syntax error."):                                                 EXIT_ERROR,
+	} {
+		encoded, marshalErr := rpc.NewResult("", err).Marshal()
+		if marshalErr != nil {
+			t.Fatalf("Unexpected error: %v", marshalErr)
+		}
+		res, unmarshalErr := rpc.UnmarshalResult(encoded)
+		if unmarshalErr != nil {
+			t.Fatalf("Unexpected error: %v", unmarshalErr)
+		}
+		if res.Err().Error() != err.Error() {
+			t.Errorf("Expected error message %v, but got %v", err.Error(), res.Err().Error())
+		}
+		if ExitCode(res.Err()) != expected {
+			t.Errorf("Expected exit code %v for %v, but got %v", expected, err.Error(), ExitCode(res.Err()))
+		}
+	}
+	encoded, _ := rpc.NewResult("", failure.NewWithErrorCode(failure.STREAM_ERROR, frames.CANCEL, "Server sent RST_STREAM with error code CANCEL.")).Marshal()
+	res, _ := rpc.UnmarshalResult(encoded)
+	if f := failure.Of(res.Err()); f == nil || f.Kind != failure.STREAM_ERROR || f.Code != frames.CANCEL.String() {
+		t.Errorf("Expected %v with error code %v, but got %#v", failure.STREAM_ERROR, frames.CANCEL, res.Err())
+	}
+	if ExitCode(rpc.NewResult("ok", nil).Err()) != EXIT_OK {
+		t.Errorf("Expected exit code %v without error", EXIT_OK)
+	}
+}
@@ -0,0 +1,206 @@
+package pcapng
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/fstab/h2c/http2client/frames"
+)
+
+const (
+	CLIENT_PREFACE   = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	MAX_SEGMENT_SIZE = 65535 - 40 // Maximum IPv4 packet size minus IPv4 and TCP header.
+)
+
+// Placeholders for endpoints that are unknown or not IPv4.
+// The addresses are from TEST-NET-1, which is reserved for documentation (RFC 5737).
+var (
+	PLACEHOLDER_CLIENT = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 49152}
+	PLACEHOLDER_SERVER = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 80}
+)
+
+const (
+	tcpFlagFin byte = 0x01
+	tcpFlagSyn byte = 0x02
+	tcpFlagPsh byte = 0x08
+	tcpFlagAck byte = 0x10
+)
+
+// Flow is a synthetic TCP connection carrying the frames of one HTTP/2 connection. It is thread safe.
+type Flow struct {
+	mutex     sync.Mutex
+	writer    *Writer
+	client    *net.TCPAddr
+	server    *net.TCPAddr
+	clientSeq uint32 // next sequence number sent by the client
+	serverSeq uint32 // next sequence number sent by the server
+	ipId      uint16
+	closed    bool
+}
+
+// NewFlow writes the TCP three-way handshake followed by the client connection preface.
+// If client or server is nil or not an IPv4 address, a placeholder is used.
+func (w *Writer) NewFlow(client *net.TCPAddr, server *net.TCPAddr) (*Flow, error) {
+	f := &Flow{
+		writer: w,
+		client: ipv4OrPlaceholder(client, PLACEHOLDER_CLIENT),
+		server: ipv4OrPlaceholder(server, PLACEHOLDER_SERVER),
+	}
+	now := time.Now()
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err := f.writeSegment(now, true, tcpFlagSyn, nil); err != nil {
+		return nil, err
+	}
+	if err := f.writeSegment(now, false, tcpFlagSyn|tcpFlagAck, nil); err != nil {
+		return nil, err
+	}
+	if err := f.writeSegment(now, true, tcpFlagAck, nil); err != nil {
+		return nil, err
+	}
+	if err := f.writeSegment(now, true, tcpFlagPsh|tcpFlagAck, []byte(CLIENT_PREFACE)); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func ipv4OrPlaceholder(addr *net.TCPAddr, placeholder *net.TCPAddr) *net.TCPAddr {
+	if addr == nil || addr.IP.To4() == nil {
+		return placeholder
+	}
+	return addr
+}
+
+// WriteFrame writes the frame's WireBytes() as one or more TCP segments.
+// The frame must have been read by a frames.Reader or written by a frames.Writer, so that the header blocks
+// can be decoded by Wireshark with the HPACK state of the connection.
+// DATA frames written by a frames.Writer have no WireBytes(), they are encoded, because the Writer sends them exactly as encoded.
+func (f *Flow) WriteFrame(fromClient bool, frame frames.Frame) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return nil
+	}
+	data := frame.WireBytes()
+	if data == nil {
+		dataFrame, ok := frame.(*frames.DataFrame)
+		if !ok {
+			return fmt.Errorf("%v frame was neither read nor written.", frame.Type())
+		}
+		data, _ = dataFrame.Encode(nil)
+	}
+	now := time.Now()
+	for len(data) > 0 {
+		n := len(data)
+		if n > MAX_SEGMENT_SIZE {
+			n = MAX_SEGMENT_SIZE
+		}
+		if err := f.writeSegment(now, fromClient, tcpFlagPsh|tcpFlagAck, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// Close writes the TCP connection termination. Frames written after Close() are ignored.
+func (f *Flow) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	now := time.Now()
+	if err := f.writeSegment(now, true, tcpFlagFin|tcpFlagAck, nil); err != nil {
+		return err
+	}
+	if err := f.writeSegment(now, false, tcpFlagFin|tcpFlagAck, nil); err != nil {
+		return err
+	}
+	return f.writeSegment(now, true, tcpFlagAck, nil)
+}
+
+func (f *Flow) writeSegment(timestamp time.Time, fromClient bool, flags byte, payload []byte) error {
+	src, dst := f.server, f.client
+	seq, ack := &f.serverSeq, f.clientSeq
+	if fromClient {
+		src, dst = f.client, f.server
+		seq, ack = &f.clientSeq, f.serverSeq
+	}
+	if flags&tcpFlagAck == 0 {
+		ack = 0
+	}
+	f.ipId++
+	packet := encodePacket(src, dst, f.ipId, *seq, ack, flags, payload)
+	*seq += uint32(len(payload))
+	if flags&(tcpFlagSyn|tcpFlagFin) != 0 {
+		*seq++ // SYN and FIN consume one sequence number
+	}
+	return f.writer.writePacket(timestamp, packet)
+}
+
+// encodePacket returns an IPv4 packet containing a TCP segment.
+func encodePacket(src *net.TCPAddr, dst *net.TCPAddr, ipId uint16, seq uint32, ack uint32, flags byte, payload []byte) []byte {
+	totalLength := 20 + 20 + len(payload)
+	packet := make([]byte, totalLength)
+	// IPv4 header
+	ip := packet[0:20]
+	ip[0] = 0x45 // version 4, header length 5 * 4 bytes
+	putUint16(ip[2:], uint16(totalLength))
+	putUint16(ip[4:], ipId)
+	ip[6] = 0x40 // don't fragment
+	ip[8] = 64   // TTL
+	ip[9] = 6    // TCP
+	copy(ip[12:16], src.IP.To4())
+	copy(ip[16:20], dst.IP.To4())
+	putUint16(ip[10:], checksum(0, ip))
+	// TCP header
+	tcp := packet[20:]
+	putUint16(tcp[0:], uint16(src.Port))
+	putUint16(tcp[2:], uint16(dst.Port))
+	putUint32(tcp[4:], seq)
+	putUint32(tcp[8:], ack)
+	tcp[12] = 5 << 4 // header length 5 * 4 bytes
+	tcp[13] = flags
+	putUint16(tcp[14:], 65535) // window size
+	copy(tcp[20:], payload)
+	pseudoHeader := make([]byte, 12)
+	copy(pseudoHeader[0:4], src.IP.To4())
+	copy(pseudoHeader[4:8], dst.IP.To4())
+	pseudoHeader[9] = 6
+	putUint16(pseudoHeader[10:], uint16(len(tcp)))
+	putUint16(tcp[16:], checksum(sum(0, pseudoHeader), tcp))
+	return packet
+}
+
+// Internet checksum as defined in RFC 1071.
+func checksum(initial uint32, data []byte) uint16 {
+	s := sum(initial, data)
+	for s > 0xffff {
+		s = (s >> 16) + (s & 0xffff)
+	}
+	return ^uint16(s)
+}
+
+func sum(initial uint32, data []byte) uint32 {
+	s := initial
+	for i := 0; i+1 < len(data); i += 2 {
+		s += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		s += uint32(data[len(data)-1]) << 8
+	}
+	return s
+}
+
+// Network byte order
+func putUint16(dst []byte, v uint16) {
+	dst[0], dst[1] = byte(v>>8), byte(v)
+}
+
+func putUint32(dst []byte, v uint32) {
+	dst[0], dst[1], dst[2], dst[3] = byte(v>>24), byte(v>>16), byte(v>>8), byte(v)
+}
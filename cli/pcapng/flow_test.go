@@ -0,0 +1,148 @@
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/fstab/h2c/http2client/frames"
+	"golang.org/x/net/http2/hpack"
+)
+
+type packet struct {
+	flags   byte
+	seq     uint32
+	ack     uint32
+	payload []byte
+}
+
+func TestFlow(t *testing.T) {
+	out := &bytes.Buffer{}
+	w, err := NewWriter(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flow, err := w.NewFlow(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 51234}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, MAX_SEGMENT_SIZE+10)
+	if err = flow.WriteFrame(false, &frames.DataFrame{StreamId: 1, Data: data, EndStream: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err = flow.Close(); err != nil {
+		t.Fatal(err)
+	}
+	packets := parse(t, out.Bytes())
+	expectedFlags := []byte{
+		tcpFlagSyn, tcpFlagSyn | tcpFlagAck, tcpFlagAck, // handshake
+		tcpFlagPsh | tcpFlagAck,                          // client preface
+		tcpFlagPsh | tcpFlagAck, tcpFlagPsh | tcpFlagAck, // DATA frame split into two segments
+		tcpFlagFin | tcpFlagAck, tcpFlagFin | tcpFlagAck, tcpFlagAck,
+	}
+	if len(packets) != len(expectedFlags) {
+		t.Fatalf("Expected %v packets, but got %v.", len(expectedFlags), len(packets))
+	}
+	for i, p := range packets {
+		if p.flags != expectedFlags[i] {
+			t.Errorf("Packet %v: expected flags 0x%02x, but got 0x%02x.", i, expectedFlags[i], p.flags)
+		}
+	}
+	if string(packets[3].payload) != CLIENT_PREFACE {
+		t.Errorf("Expected client preface, but got %q.", packets[3].payload)
+	}
+	serverData := append(packets[4].payload, packets[5].payload...)
+	if len(serverData) != 9+len(data) {
+		t.Errorf("Expected %v bytes from server, but got %v.", 9+len(data), len(serverData))
+	}
+	if packets[5].seq != packets[4].seq+uint32(len(packets[4].payload)) {
+		t.Errorf("Sequence numbers not continuous.")
+	}
+	if packets[6].ack != packets[5].seq+uint32(len(packets[5].payload)) {
+		t.Errorf("Client FIN does not acknowledge all data from the server.")
+	}
+}
+
+func TestFlowWritesWireBytes(t *testing.T) {
+	// The second HEADERS frame references the HPACK dynamic table, so re-encoding it would yield different bytes.
+	headers := frames.NewHeadersFrame(1, []hpack.HeaderField{{Name: ":authority", Value: "example.com"}})
+	headers.EndHeaders = true
+	encodingContext := frames.NewEncodingContext()
+	encoded := &bytes.Buffer{}
+	for i := 0; i < 2; i++ {
+		data, err := headers.Encode(encodingContext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded.Write(data)
+	}
+	reader := frames.NewReader(encoded, frames.NewDecodingContext())
+	reader.SetKeepWireBytes(true)
+	if _, err := reader.ReadNextFrame(); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := reader.ReadNextFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reencoded, _ := frame.Encode(frames.NewEncodingContext()); bytes.Equal(reencoded, frame.WireBytes()) {
+		t.Fatalf("Test setup: Expected the second HEADERS frame to reference the dynamic table.")
+	}
+	out := &bytes.Buffer{}
+	w, err := NewWriter(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flow, err := w.NewFlow(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = flow.WriteFrame(true, frame); err != nil {
+		t.Fatal(err)
+	}
+	if err = flow.WriteFrame(true, headers); err == nil {
+		t.Errorf("Expected an error for a HEADERS frame that was neither read nor written.")
+	}
+	packets := parse(t, out.Bytes())
+	if len(packets) != 5 {
+		t.Fatalf("Expected 5 packets, but got %v.", len(packets))
+	}
+	if !bytes.Equal(packets[4].payload, frame.WireBytes()) {
+		t.Errorf("Expected %x, but got %x.", frame.WireBytes(), packets[4].payload)
+	}
+}
+
+// parse the pcapng blocks and verify the checksums of the IPv4 and TCP headers.
+func parse(t *testing.T, data []byte) []packet {
+	result := make([]packet, 0)
+	for len(data) > 0 {
+		blockType := binary.LittleEndian.Uint32(data[0:4])
+		blockLength := binary.LittleEndian.Uint32(data[4:8])
+		if binary.LittleEndian.Uint32(data[blockLength-4:blockLength]) != blockLength {
+			t.Fatalf("Block type 0x%08x: trailing block length mismatch.", blockType)
+		}
+		if blockType == ENHANCED_PACKET_BLOCK_TYPE {
+			capturedLength := binary.LittleEndian.Uint32(data[20:24])
+			ip := data[28 : 28+capturedLength]
+			if checksum(0, ip[0:20]) != 0 {
+				t.Errorf("Invalid IPv4 header checksum.")
+			}
+			pseudoHeader := make([]byte, 12)
+			copy(pseudoHeader[0:8], ip[12:20])
+			pseudoHeader[9] = 6
+			putUint16(pseudoHeader[10:], uint16(len(ip)-20))
+			if checksum(sum(0, pseudoHeader), ip[20:]) != 0 {
+				t.Errorf("Invalid TCP checksum.")
+			}
+			result = append(result, packet{
+				flags:   ip[33],
+				seq:     binary.BigEndian.Uint32(ip[24:28]),
+				ack:     binary.BigEndian.Uint32(ip[28:32]),
+				payload: ip[40:],
+			})
+		}
+		data = data[blockLength:]
+	}
+	return result
+}
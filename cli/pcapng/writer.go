@@ -0,0 +1,93 @@
+// Package pcapng writes captured HTTP/2 frames as a pcapng file that can be opened with Wireshark.
+//
+// h2c never sees the TCP packets, it only sees the frames. Therefore, the bytes of each frame as read or written
+// are wrapped in synthetic IPv4/TCP packets. Each HTTP/2 connection becomes a TCP flow starting with
+// the three-way handshake and the client connection preface, so that Wireshark recognizes it as HTTP/2.
+//
+// The file format is described in https://www.ietf.org/archive/id/draft-tuexen-opsawg-pcapng-05.html
+package pcapng
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	SECTION_HEADER_BLOCK_TYPE        uint32 = 0x0A0D0D0A
+	INTERFACE_DESCRIPTION_BLOCK_TYPE uint32 = 0x00000001
+	ENHANCED_PACKET_BLOCK_TYPE       uint32 = 0x00000006
+	BYTE_ORDER_MAGIC                 uint32 = 0x1A2B3C4D
+	LINKTYPE_RAW                     uint16 = 101 // Packets start with the IPv4 header, there is no link layer header.
+)
+
+// Writer is thread safe.
+type Writer struct {
+	mutex sync.Mutex
+	out   io.Writer
+	err   error // if != nil, the Writer becomes unusable
+}
+
+// NewWriter writes the section header and the interface description for the synthetic packets.
+func NewWriter(out io.Writer) (*Writer, error) {
+	w := &Writer{
+		out: out,
+	}
+	shb := make([]byte, 0, 28)
+	shb = appendUint32(shb, SECTION_HEADER_BLOCK_TYPE)
+	shb = appendUint32(shb, 28)
+	shb = appendUint32(shb, BYTE_ORDER_MAGIC)
+	shb = appendUint16(shb, 1)                  // major version
+	shb = appendUint16(shb, 0)                  // minor version
+	shb = appendUint64(shb, 0xFFFFFFFFFFFFFFFF) // section length not specified
+	shb = appendUint32(shb, 28)
+	idb := make([]byte, 0, 20)
+	idb = appendUint32(idb, INTERFACE_DESCRIPTION_BLOCK_TYPE)
+	idb = appendUint32(idb, 20)
+	idb = appendUint16(idb, LINKTYPE_RAW)
+	idb = appendUint16(idb, 0) // reserved
+	idb = appendUint32(idb, 0) // no snap length limit
+	idb = appendUint32(idb, 20)
+	if _, err := out.Write(append(shb, idb...)); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// writePacket writes an enhanced packet block. Timestamps have microsecond resolution, which is the pcapng default.
+func (w *Writer) writePacket(timestamp time.Time, packet []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	padding := (4 - len(packet)%4) % 4
+	blockLength := uint32(32 + len(packet) + padding)
+	micros := uint64(timestamp.UnixNano() / 1000)
+	block := make([]byte, 0, blockLength)
+	block = appendUint32(block, ENHANCED_PACKET_BLOCK_TYPE)
+	block = appendUint32(block, blockLength)
+	block = appendUint32(block, 0) // interface id
+	block = appendUint32(block, uint32(micros>>32))
+	block = appendUint32(block, uint32(micros))
+	block = appendUint32(block, uint32(len(packet))) // captured length
+	block = appendUint32(block, uint32(len(packet))) // original length
+	block = append(block, packet...)
+	block = append(block, make([]byte, padding)...)
+	block = appendUint32(block, blockLength)
+	_, w.err = w.out.Write(block)
+	return w.err
+}
+
+// Numbers are written in little endian byte order, as indicated by the BYTE_ORDER_MAGIC in the section header.
+func appendUint16(dst []byte, v uint16) []byte {
+	return append(dst, byte(v), byte(v>>8))
+}
+
+func appendUint32(dst []byte, v uint32) []byte {
+	return append(dst, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint64(dst []byte, v uint64) []byte {
+	return appendUint32(appendUint32(dst, uint32(v)), uint32(v>>32))
+}
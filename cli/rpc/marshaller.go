@@ -26,7 +26,7 @@ func unmarshal(data string, v interface{}) error {
 	}
 	err = json.Unmarshal(jsonData, v)
 	if err != nil {
-		return fmt.Errorf("Failed to unmarshal json data: %v %v", err.Error())
+		return fmt.Errorf("Failed to unmarshal json data: %v", err.Error())
 	}
 	return nil
 }
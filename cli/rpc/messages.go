@@ -3,16 +3,34 @@
 // The command line interface uses a simple request/response protocol to communicate with the h2c process:
 //
 // The cli sends a Command struct to the h2c process, and receives a Result struct as result.
+// Commands with partial output, like 'h2c get' with multiple paths, send Results with IsEvent set
+// before the final Result. Results are terminated with newlines.
+//
+// The 'watch' command is an exception: The h2c process sends one Result per line for each event,
+// until the cli closes the connection.
+//
+// The 'shell' command is another exception: The cli sends one Command per line, and the h2c process
+// responds with one Result per line. In between, the h2c process may send Results with IsEvent set
+// to notify the shell of push promises and GOAWAY frames.
 package rpc
 
+import (
+	"fmt"
+
+	"github.com/fstab/h2c/http2client/failure"
+)
+
 // Command struct is sent from the command line interface to the h2c process.
+//
+// Options maps the long option name to the option's values. Most options have a single value,
+// but repeatable options like --header have one value per occurrence on the command line.
 type Command struct {
 	Name    string
 	Args    []string
-	Options map[string]string
+	Options map[string][]string
 }
 
-func NewCommand(name string, args []string, options map[string]string) (*Command, error) {
+func NewCommand(name string, args []string, options map[string][]string) (*Command, error) {
 	return &Command{
 		Name:    name,
 		Args:    args,
@@ -40,17 +58,39 @@ func UnmarshalCommand(encodedCmd string) (*Command, error) {
 
 // Result is sent from the h2c process to the command line interface.
 type Result struct {
-	Message string
-	Error   *string // Should be type error, but this doesn't seem to work well with JSON marshalling.
+	Message   string
+	Error     *string // Should be type error, but this doesn't seem to work well with JSON marshalling.
+	ErrorKind string  // The failure.Kind if Error is a failure.Error, like "timeout". Used to determine the exit code.
+	ErrorCode string  // The HTTP/2 error code if Error is a failure.Error with an error code, like "CANCEL".
+	IsEvent   bool    // Partial output before the final Result, or an event sent asynchronously in an 'h2c shell' session.
 }
 
 func NewResult(msg string, err error) *Result {
 	if err == nil {
-		return &Result{msg, nil}
-	} else {
-		errString := err.Error()
-		return &Result{msg, &errString}
+		return &Result{Message: msg}
+	}
+	errString := err.Error()
+	result := &Result{Message: msg, Error: &errString}
+	if f := failure.Of(err); f != nil {
+		result.ErrorKind = string(f.Kind)
+		result.ErrorCode = f.Code
+	}
+	return result
+}
+
+func NewEventResult(msg string) *Result {
+	return &Result{Message: msg, IsEvent: true}
+}
+
+// Err restores the error sent by the h2c process, including the failure.Kind and the HTTP/2 error code. Returns nil if there was no error.
+func (res *Result) Err() error {
+	if res.Error == nil {
+		return nil
+	}
+	if res.ErrorKind != "" {
+		return &failure.Error{Kind: failure.Kind(res.ErrorKind), Code: res.ErrorCode, Message: *res.Error}
 	}
+	return fmt.Errorf("%v", *res.Error)
 }
 
 // Marshal returns the base64 encoding of Result.
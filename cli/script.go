@@ -0,0 +1,468 @@
+package cli
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	neturl "net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fstab/h2c/cli/cmdline"
+	"github.com/fstab/h2c/cli/rpc"
+	"github.com/fstab/h2c/http2client/failure"
+)
+
+// A script for 'h2c run' has one step per line. Empty lines and lines starting with '#' are ignored.
+//
+// Steps are h2c commands without the 'h2c' prefix, like in 'h2c shell', or one of the following:
+//
+//	let <name> = <value>                           define a variable, used as ${name} in the following lines
+//	capture <name> = status                        capture a value from the last response
+//	capture <name> = header <header-name>
+//	capture <name> = json <path>                   path in the JSON body, like .items[0].id
+//	capture <name> = body
+//	expect status <status>                         status like 200 or 2xx
+//	expect header <header-name>                    header is present
+//	expect header <header-name> equals|contains <value>
+//	expect body contains <text>
+//	expect json <path> [equals|contains <value>]
+//	expect push <path>                             a push promise for path is in 'h2c push-list'
+//	expect no push <path>
+//	wait <duration>                                like 500ms or 2s
+//
+// Variables that are not defined with let or capture are looked up in the environment.
+// Variables are expanded after the line is split into words, so a value with spaces or quotes is a single word.
+// If a command fails, the script is aborted. If an expect step fails, the script continues,
+// and the exit code is EXIT_ASSERTION_FAILED.
+
+// Like in the shell, commands implemented by the command line cannot be used in scripts.
+var notAvailableInScripts = notAvailableInShell
+
+var (
+	scriptVariableRegexp     = regexp.MustCompile("\\$\\{([A-Za-z_][A-Za-z0-9_]*)\\}")
+	scriptVariableNameRegexp = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+	jsonPathRegexp           = regexp.MustCompile("^(\\.[^.\\[\\]]+|\\[[0-9]+\\])+$")
+	jsonPathElementRegexp    = regexp.MustCompile("\\.[^.\\[\\]]+|\\[[0-9]+\\]")
+)
+
+type script struct {
+	ipc       rpc.IpcManager
+	out       io.Writer
+	verbose   bool // show the output of each command
+	variables map[string]string
+	response  *scriptResponse // the last response received with get, put, post, or replay, nil if none
+	passed    int
+	failed    int
+}
+
+// scriptResponse is the relevant part of the output of 'h2c get --json'.
+type scriptResponse struct {
+	Status  int `json:"status"`
+	Headers []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"headers"`
+	Body         string `json:"body"`
+	BodyEncoding string `json:"body_encoding"`
+	Timings      struct {
+		TotalMs float64 `json:"total_ms"`
+	} `json:"timings"`
+}
+
+// runScript runs 'h2c run'. Each step is reported on a line starting with "ok" or "FAIL".
+func runScript(ipc rpc.IpcManager, cmd *rpc.Command) error {
+	lines, err := readScript(cmd.Args[0])
+	if err != nil {
+		return err
+	}
+	s := &script{
+		ipc:       ipc,
+		out:       os.Stdout,
+		verbose:   cmdline.VERBOSE_OPTION.IsSet(cmd.Options),
+		variables: make(map[string]string),
+	}
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err = s.runStep(i+1, line); err != nil {
+			fmt.Fprintf(s.out, "%v steps passed, %v failed.\n", s.passed, s.failed)
+			return fmt.Errorf("Script aborted at line %v: %w", i+1, err)
+		}
+	}
+	fmt.Fprintf(s.out, "%v steps passed, %v failed.\n", s.passed, s.failed)
+	if s.failed > 0 {
+		return failure.New(failure.ASSERTION_FAILED, "%v of %v steps failed.", s.failed, s.passed+s.failed)
+	}
+	return nil
+}
+
+func readScript(filename string) ([]string, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if filename == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %v: %v", filename, err.Error())
+	}
+	return strings.Split(string(data), "\n"), nil
+}
+
+// runStep returns an error if the script must be aborted. Failed expect steps are counted, but don't abort the script.
+func (s *script) runStep(lineNumber int, line string) error {
+	words, err := cmdline.SplitWords(line)
+	if err != nil {
+		s.report(lineNumber, line, err)
+		return err
+	}
+	if len(words) == 0 {
+		err = fmt.Errorf("Syntax error: Empty step.")
+		s.report(lineNumber, line, err)
+		return err
+	}
+	for i := range words {
+		if words[i], err = s.expand(words[i]); err != nil {
+			s.report(lineNumber, line, err)
+			return err
+		}
+	}
+	// The expanded line is only used in the report.
+	expanded, _ := s.expand(line)
+	switch words[0] {
+	case "expect":
+		s.report(lineNumber, expanded, s.expect(words[1:]))
+		return nil
+	case "let":
+		err = s.let(words[1:])
+	case "capture":
+		err = s.capture(words[1:])
+	case "wait":
+		err = waitStep(words[1:])
+	default:
+		var detail string
+		detail, err = s.execute(words)
+		expanded = expanded + detail
+	}
+	s.report(lineNumber, expanded, err)
+	return err
+}
+
+func (s *script) report(lineNumber int, description string, err error) {
+	if err != nil {
+		s.failed++
+		fmt.Fprintf(s.out, "FAIL line %v: %v: %v\n", lineNumber, description, err.Error())
+	} else {
+		s.passed++
+		fmt.Fprintf(s.out, "ok   line %v: %v\n", lineNumber, description)
+	}
+}
+
+// expand replaces ${name} with the value of the variable, or with the environment variable if no such variable is defined.
+func (s *script) expand(line string) (string, error) {
+	var err error
+	result := scriptVariableRegexp.ReplaceAllStringFunc(line, func(match string) string {
+		name := match[2 : len(match)-1]
+		if value, ok := s.variables[name]; ok {
+			return value
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+		if err == nil {
+			err = fmt.Errorf("%v: Undefined variable.", name)
+		}
+		return match
+	})
+	return result, err
+}
+
+func (s *script) let(args []string) error {
+	if len(args) != 3 || args[1] != "=" || !scriptVariableNameRegexp.MatchString(args[0]) {
+		return fmt.Errorf("Syntax error: Expected 'let <name> = <value>'.")
+	}
+	s.variables[args[0]] = args[2]
+	return nil
+}
+
+func (s *script) capture(args []string) error {
+	if len(args) < 3 || args[1] != "=" || !scriptVariableNameRegexp.MatchString(args[0]) {
+		return fmt.Errorf("Syntax error: Expected 'capture <name> = status|header <name>|json <path>|body'.")
+	}
+	value, err := s.lookup(args[2:])
+	if err != nil {
+		return err
+	}
+	s.variables[args[0]] = value
+	return nil
+}
+
+// lookup returns the value of "status", "header <name>", "json <path>", or "body" in the last response.
+func (s *script) lookup(args []string) (string, error) {
+	if s.response == nil {
+		return "", fmt.Errorf("No response received yet.")
+	}
+	switch {
+	case len(args) == 1 && args[0] == "status":
+		return strconv.Itoa(s.response.Status), nil
+	case len(args) == 1 && args[0] == "body":
+		return s.response.body()
+	case len(args) == 2 && args[0] == "header":
+		value, ok := s.response.header(args[1])
+		if !ok {
+			return "", fmt.Errorf("Header %v not found.", args[1])
+		}
+		return value, nil
+	case len(args) == 2 && args[0] == "json":
+		body, err := s.response.body()
+		if err != nil {
+			return "", err
+		}
+		return jsonPath(body, args[1])
+	default:
+		return "", fmt.Errorf("Syntax error: Expected status, header <name>, json <path>, or body.")
+	}
+}
+
+func (s *script) expect(args []string) error {
+	switch {
+	case len(args) == 2 && args[0] == "status":
+		if s.response == nil {
+			return fmt.Errorf("No response received yet.")
+		}
+		if !statusMatches(s.response.Status, args[1]) {
+			return fmt.Errorf("Status is %v.", s.response.Status)
+		}
+		return nil
+	case len(args) == 2 && args[0] == "push":
+		return s.expectPush(args[1], true)
+	case len(args) == 3 && args[0] == "no" && args[1] == "push":
+		return s.expectPush(args[2], false)
+	case len(args) == 3 && args[0] == "body" && args[1] == "contains":
+		body, err := s.lookup([]string{"body"})
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(body, args[2]) {
+			return fmt.Errorf("Body does not contain '%v'.", args[2])
+		}
+		return nil
+	case (len(args) == 2 || len(args) == 4) && (args[0] == "header" || args[0] == "json"):
+		value, err := s.lookup(args[:2])
+		if err != nil {
+			return err
+		}
+		if len(args) == 2 {
+			return nil
+		}
+		switch args[2] {
+		case "equals":
+			if value != args[3] {
+				return fmt.Errorf("Value is '%v'.", value)
+			}
+		case "contains":
+			if !strings.Contains(value, args[3]) {
+				return fmt.Errorf("Value is '%v'.", value)
+			}
+		default:
+			return fmt.Errorf("Syntax error: Expected equals or contains, but got '%v'.", args[2])
+		}
+		return nil
+	default:
+		return fmt.Errorf("Syntax error: Unknown expect step.")
+	}
+}
+
+// Status patterns like "2xx" match all 2xx status codes.
+func statusMatches(status int, pattern string) bool {
+	actual := strconv.Itoa(status)
+	if len(actual) != len(pattern) {
+		return false
+	}
+	for i := range pattern {
+		if pattern[i] != 'x' && pattern[i] != actual[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *script) expectPush(path string, expected bool) error {
+	res := sendCommand(&rpc.Command{
+		Name:    cmdline.PUSH_LIST_COMMAND.Name(),
+		Args:    make([]string, 0),
+		Options: map[string][]string{cmdline.JSON_OPTION.Name(): {""}},
+	}, s.ipc)
+	if res.Error != nil {
+		return res.Err()
+	}
+	var list struct {
+		PushPromises []struct {
+			Url string `json:"url"`
+		} `json:"push_promises"`
+	}
+	if err := json.Unmarshal([]byte(res.Message), &list); err != nil {
+		return fmt.Errorf("Failed to parse the output of push-list: %v", err.Error())
+	}
+	found := false
+	for _, pushPromise := range list.PushPromises {
+		if pushPromise.Url == path {
+			found = true
+		} else if url, err := neturl.Parse(pushPromise.Url); err == nil && url.RequestURI() == path {
+			found = true
+		}
+	}
+	if found && !expected {
+		return fmt.Errorf("Found a push promise for %v.", path)
+	}
+	if !found && expected {
+		return fmt.Errorf("No push promise for %v.", path)
+	}
+	return nil
+}
+
+func waitStep(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Syntax error: Expected 'wait <duration>', like 'wait 500ms'.")
+	}
+	duration, err := time.ParseDuration(args[0])
+	if err != nil || duration < 0 {
+		return fmt.Errorf("%v: Invalid duration.", args[0])
+	}
+	time.Sleep(duration)
+	return nil
+}
+
+// execute runs an h2c command. Requests are sent with --json, so that the response can be used in capture and expect steps.
+// Returns details to be shown in the report, like " -> 200 (50 bytes, 1.2ms)".
+func (s *script) execute(words []string) (string, error) {
+	cmd, err := cmdline.Parse(words)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range notAvailableInScripts {
+		if cmd.Name == name {
+			return "", fmt.Errorf("%v: Not available in 'h2c run'.", cmd.Name)
+		}
+	}
+	if cmd.Name == cmdline.VERSION_COMMAND.Name() {
+		return "", nil
+	}
+	if cmd, err = applySpecialConventions(cmd); err != nil {
+		return "", err
+	}
+	isRequest := isSingleRequest(cmd)
+	if isRequest {
+		cmdline.JSON_OPTION.Set("", cmd.Options)
+	}
+	res := sendCommand(cmd, s.ipc)
+	if res.Error != nil {
+		return "", res.Err()
+	}
+	if !isRequest {
+		if s.verbose && res.Message != "" {
+			fmt.Fprintln(s.out, res.Message)
+		}
+		return "", nil
+	}
+	response := &scriptResponse{}
+	// Decode only the first JSON value, because --write-out may append text.
+	if err = json.NewDecoder(strings.NewReader(res.Message)).Decode(response); err != nil {
+		return "", fmt.Errorf("Failed to parse response: %v", err.Error())
+	}
+	body, err := response.body()
+	if err != nil {
+		return "", err
+	}
+	s.response = response
+	if s.verbose && body != "" {
+		fmt.Fprintln(s.out, strings.TrimSuffix(body, "\n"))
+	}
+	total := time.Duration(response.Timings.TotalMs * float64(time.Millisecond))
+	return fmt.Sprintf(" -> %v (%v bytes, %v)", response.Status, len(body), total.Round(100*time.Microsecond)), nil
+}
+
+// get, put, post, or replay with a single response.
+func isSingleRequest(cmd *rpc.Command) bool {
+	switch cmd.Name {
+	case cmdline.GET_COMMAND.Name():
+		return len(cmd.Args) == 1
+	case cmdline.PUT_COMMAND.Name(), cmdline.POST_COMMAND.Name():
+		return true
+	case cmdline.REPLAY_COMMAND.Name():
+		return !cmdline.TIMES_OPTION.IsSet(cmd.Options)
+	default:
+		return false
+	}
+}
+
+func (r *scriptResponse) header(name string) (string, bool) {
+	for _, header := range r.Headers {
+		if strings.EqualFold(header.Name, name) {
+			return header.Value, true
+		}
+	}
+	return "", false
+}
+
+func (r *scriptResponse) body() (string, error) {
+	if r.BodyEncoding == "base64" {
+		data, err := base64.StdEncoding.DecodeString(r.Body)
+		if err != nil {
+			return "", fmt.Errorf("Failed to decode response body: %v", err.Error())
+		}
+		return string(data), nil
+	}
+	return r.Body, nil
+}
+
+// jsonPath returns the value at a path like .items[0].id in a JSON document.
+// Strings are returned without quotes, other values are returned as JSON.
+func jsonPath(document string, path string) (string, error) {
+	if path != "." && !jsonPathRegexp.MatchString(path) {
+		return "", fmt.Errorf("%v: Invalid JSON path. Example: .items[0].id", path)
+	}
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", fmt.Errorf("Response body is not JSON: %v", err.Error())
+	}
+	for _, element := range jsonPathElementRegexp.FindAllString(path, -1) {
+		if strings.HasPrefix(element, "[") {
+			index, _ := strconv.Atoi(element[1 : len(element)-1])
+			array, ok := value.([]interface{})
+			if !ok || index >= len(array) {
+				return "", fmt.Errorf("%v: Not found in JSON body.", path)
+			}
+			value = array[index]
+		} else {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("%v: Not found in JSON body.", path)
+			}
+			if value, ok = object[element[1:]]; !ok {
+				return "", fmt.Errorf("%v: Not found in JSON body.", path)
+			}
+		}
+	}
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestScriptExpand(t *testing.T) {
+	os.Setenv("H2C_TEST_HOST", "localhost:8443")
+	defer os.Unsetenv("H2C_TEST_HOST")
+	s := &script{variables: map[string]string{"id": "42"}}
+	expanded, err := s.expand("get https://${H2C_TEST_HOST}/items/${id}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expanded != "get https://localhost:8443/items/42" {
+		t.Errorf("Unexpected expansion: %v", expanded)
+	}
+	if _, err = s.expand("get /items/${undefined}"); err == nil {
+		t.Errorf("Expected error for undefined variable.")
+	}
+}
+
+func TestScriptVariableIsSingleWord(t *testing.T) {
+	s := &script{out: &bytes.Buffer{}, variables: map[string]string{"greeting": "hello 'world'"}}
+	if err := s.runStep(1, "let message = ${greeting}"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s.variables["message"] != "hello 'world'" {
+		t.Errorf("Expected the variable to be expanded as a single word, but got %q", s.variables["message"])
+	}
+}
+
+func TestScriptEmptyStep(t *testing.T) {
+	for _, line := range []string{"", " \t"} {
+		s := &script{out: &bytes.Buffer{}, variables: make(map[string]string)}
+		if err := s.runStep(1, line); err == nil {
+			t.Errorf("%q: Expected error for empty step.", line)
+		}
+		if s.failed != 1 {
+			t.Errorf("%q: Expected the step to be reported as failed.", line)
+		}
+	}
+}
+
+func TestJsonPath(t *testing.T) {
+	document := `{"items": [{"id": 7, "name": "a"}, {"id": 12345678901234567890, "tags": ["x"]}], "total": 2}`
+	for path, expected := range map[string]string{
+		".total":            "2",
+		".items[0].name":    "a",
+		".items[1].id":      "12345678901234567890",
+		".items[1].tags":    `["x"]`,
+		".items[1].tags[0]": "x",
+	} {
+		actual, err := jsonPath(document, path)
+		if err != nil {
+			t.Errorf("%v: Unexpected error: %v", path, err)
+		} else if actual != expected {
+			t.Errorf("%v: Expected %v, but got %v", path, expected, actual)
+		}
+	}
+	for _, path := range []string{".missing", ".items[2]", ".total.x", "items", ".items[x]"} {
+		if _, err := jsonPath(document, path); err == nil {
+			t.Errorf("%v: Expected error.", path)
+		}
+	}
+}
+
+func TestStatusMatches(t *testing.T) {
+	for _, pattern := range []string{"204", "2xx", "20x", "xxx"} {
+		if !statusMatches(204, pattern) {
+			t.Errorf("Expected 204 to match %v.", pattern)
+		}
+	}
+	for _, pattern := range []string{"200", "3xx", "2x", "2xxx"} {
+		if statusMatches(204, pattern) {
+			t.Errorf("Expected 204 not to match %v.", pattern)
+		}
+	}
+}
@@ -0,0 +1,398 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fstab/h2c/cli/cmdline"
+	"github.com/fstab/h2c/cli/rpc"
+	"github.com/fstab/h2c/http2client"
+	"golang.org/x/term"
+)
+
+const (
+	SHELL_PROMPT       = "h2c> "
+	SHELL_HISTORY_FILE = ".h2c_history" // in the user's home directory
+	SHELL_HISTORY_SIZE = 1000           // number of lines kept in the history file
+)
+
+// Commands that are implemented by the command line, not by the h2c process, and cannot be used in 'h2c shell'.
+var notAvailableInShell = []string{
+	cmdline.START_COMMAND.Name(),
+	cmdline.WIRETAP_COMMAND.Name(),
+	cmdline.CONFORMANCE_COMMAND.Name(),
+	cmdline.WATCH_COMMAND.Name(),
+	cmdline.SHELL_COMMAND.Name(),
+	cmdline.RUN_COMMAND.Name(),
+	cmdline.COMPLETION_COMMAND.Name(),
+}
+
+// Commands where the argument is a path. The paths are remembered for tab completion.
+var requestCommands = []string{
+	cmdline.GET_COMMAND.Name(),
+	cmdline.PUT_COMMAND.Name(),
+	cmdline.POST_COMMAND.Name(),
+}
+
+// shell runs 'h2c shell'. It keeps a single connection to the h2c process open, sends one Command per line,
+// and receives one Result per line. Event Results, like push promises, are printed as they arrive.
+func shell(ipc rpc.IpcManager) error {
+	conn, err := ipc.Dial()
+	if err != nil {
+		return communicationFailure(err)
+	}
+	defer conn.Close()
+	shellCmd, _ := rpc.NewCommand(cmdline.SHELL_COMMAND.Name(), make([]string, 0), make(map[string][]string))
+	if err = writeCommand(conn, shellCmd); err != nil {
+		return communicationFailure(err)
+	}
+	history := loadShellHistory()
+	console, err := newShellConsole(history)
+	if err != nil {
+		return err
+	}
+	defer console.close()
+	results := make(chan *rpc.Result)
+	go receiveShellResults(conn, console, results)
+	for {
+		line, err := console.readLine()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if console.isTerminal() {
+			appendShellHistory(line)
+		}
+		if line == "exit" || line == "quit" {
+			return nil
+		}
+		done, err := executeShellLine(line, conn, results, console)
+		if err != nil {
+			console.printError(err.Error())
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// executeShellLine runs a single command. Returns done == true if the shell should be terminated.
+func executeShellLine(line string, conn io.Writer, results chan *rpc.Result, console *shellConsole) (bool, error) {
+	words, err := cmdline.SplitWords(line)
+	if err != nil {
+		return false, err
+	}
+	if len(words) == 1 && words[0] == "help" {
+		words = []string{"--help"}
+	}
+	cmd, err := cmdline.Parse(words)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range notAvailableInShell {
+		if cmd.Name == name {
+			return false, fmt.Errorf("%v: Not available in 'h2c shell'.", cmd.Name)
+		}
+	}
+	if cmd.Name == cmdline.VERSION_COMMAND.Name() {
+		console.println("h2c version " + http2client.VERSION + " build date " + http2client.BUILD_DATE + ".")
+		return false, nil
+	}
+	if cmdline.FILE_OPTION.Get(cmd.Options) == "-" {
+		return false, fmt.Errorf("Syntax error: '%v -' is not available in 'h2c shell'.", cmdline.FILE_OPTION.Name())
+	}
+	if cmdline.PARALLEL_OPTION.Get(cmd.Options) == "-" {
+		return false, fmt.Errorf("Syntax error: '%v -' is not available in 'h2c shell'.", cmdline.PARALLEL_OPTION.Name())
+	}
+	cmd, err = applySpecialConventions(cmd)
+	if err != nil {
+		return false, err
+	}
+	if err = writeCommand(conn, cmd); err != nil {
+		return true, communicationFailure(err)
+	}
+	res, ok := <-results
+	if !ok {
+		return true, fmt.Errorf("The h2c process was terminated.")
+	}
+	if res.Error != nil {
+		if res.Message != "" {
+			console.println(res.Message) // the error as JSON object if the command was run with --json
+		}
+		return false, res.Err()
+	}
+	if path, ok := requestPath(cmd); ok {
+		console.addPath(path)
+	}
+	switch {
+	case cmd.Name == cmdline.STOP_COMMAND.Name():
+		return true, nil
+	case cmd.Name == cmdline.HAR_COMMAND.Name():
+		return false, writeHarFile(cmd.Args[1], res.Message)
+	case res.Message != "":
+		console.println(strings.TrimSuffix(res.Message, "\n"))
+	}
+	return false, nil
+}
+
+func writeCommand(conn io.Writer, cmd *rpc.Command) error {
+	base64cmd, err := cmd.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte(base64cmd + "\n"))
+	return err
+}
+
+// Event Results are printed immediately, other Results are passed to the command loop.
+// The results channel is closed when the connection to the h2c process is closed.
+func receiveShellResults(conn io.Reader, console *shellConsole, results chan *rpc.Result) {
+	defer close(results)
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024) // Results may contain large response bodies.
+	for scanner.Scan() {
+		res, err := rpc.UnmarshalResult(scanner.Text())
+		if err != nil {
+			console.printError(communicationFailure(err).Error())
+			return
+		}
+		if res.IsEvent {
+			console.println(res.Message)
+		} else {
+			results <- res
+		}
+	}
+}
+
+func requestPath(cmd *rpc.Command) (string, bool) {
+	for _, name := range requestCommands {
+		if cmd.Name == name && len(cmd.Args) > 0 {
+			return cmd.Args[0], true
+		}
+	}
+	return "", false
+}
+
+// shellConsole reads lines from a terminal with line editing, history, and tab completion.
+// If stdin is not a terminal, lines are read without any of these features, so that commands can be piped into 'h2c shell'.
+type shellConsole struct {
+	terminal *term.Terminal // nil if stdin is not a terminal
+	state    *term.State
+	scanner  *bufio.Scanner
+	mutex    sync.Mutex
+	paths    []string
+}
+
+func newShellConsole(history []string) (*shellConsole, error) {
+	result := &shellConsole{
+		paths: make([]string, 0),
+	}
+	for _, line := range history {
+		if words, err := cmdline.SplitWords(line); err == nil {
+			if cmd, err := cmdline.Parse(words); err == nil {
+				if path, ok := requestPath(cmd); ok {
+					result.paths = append(result.paths, path)
+				}
+			}
+		}
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		result.scanner = bufio.NewScanner(os.Stdin)
+		return result, nil
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initialize terminal: %v", err.Error())
+	}
+	result.state = state
+	terminalIO := &terminalIO{reader: os.Stdin, writer: os.Stdout}
+	result.terminal = term.NewTerminal(terminalIO, SHELL_PROMPT)
+	if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+		result.terminal.SetSize(width, height)
+	}
+	loadTerminalHistory(result.terminal, terminalIO, history)
+	result.terminal.AutoCompleteCallback = result.complete
+	return result, nil
+}
+
+func (c *shellConsole) isTerminal() bool {
+	return c.terminal != nil
+}
+
+func (c *shellConsole) readLine() (string, error) {
+	if c.isTerminal() {
+		line, err := c.terminal.ReadLine()
+		if err == term.ErrPasteIndicator {
+			err = nil
+		}
+		return line, err
+	}
+	if c.scanner.Scan() {
+		return c.scanner.Text(), nil
+	}
+	if c.scanner.Err() != nil {
+		return "", c.scanner.Err()
+	}
+	return "", io.EOF
+}
+
+// println may be called while the user is typing. The terminal moves the prompt below the message.
+func (c *shellConsole) println(msg string) {
+	if c.isTerminal() {
+		c.terminal.Write([]byte(msg + "\n"))
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	fmt.Fprintln(os.Stdout, msg)
+}
+
+func (c *shellConsole) printError(msg string) {
+	if c.isTerminal() {
+		c.println(msg)
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	fmt.Fprintln(os.Stderr, msg)
+}
+
+func (c *shellConsole) addPath(path string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.paths = append(c.paths, path)
+}
+
+func (c *shellConsole) close() {
+	if c.isTerminal() {
+		term.Restore(int(os.Stdin.Fd()), c.state)
+		fmt.Println()
+	}
+}
+
+// complete is called by the terminal when the user presses a key. Tab completes the word left of the cursor.
+// If there are multiple candidates, the common prefix is completed, or the candidates are shown if there is no common prefix.
+func (c *shellConsole) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	prefix := line[:pos]
+	start := strings.LastIndexAny(prefix, " \t") + 1
+	word := prefix[start:]
+	words, err := cmdline.SplitWords(prefix[:start])
+	if err != nil || strings.ContainsAny(word, "'\"\\") {
+		return line, pos, true
+	}
+	c.mutex.Lock()
+	candidates := cmdline.Complete(words, word, c.paths)
+	c.mutex.Unlock()
+	completion := ""
+	switch len(candidates) {
+	case 0:
+		return line, pos, true
+	case 1:
+		completion = candidates[0] + " "
+	default:
+		completion = commonPrefix(candidates)
+		if completion == word {
+			c.println(strings.Join(candidates, "  "))
+			return line, pos, true
+		}
+	}
+	return prefix[:start] + completion + line[pos:], start + len(completion), true
+}
+
+func commonPrefix(words []string) string {
+	result := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, result) {
+			result = result[:len(result)-1]
+		}
+	}
+	return result
+}
+
+// terminalIO is the terminal's input and output. They can be replaced, see loadTerminalHistory().
+type terminalIO struct {
+	reader io.Reader
+	writer io.Writer
+}
+
+func (t *terminalIO) Read(p []byte) (int, error) {
+	return t.reader.Read(p)
+}
+
+func (t *terminalIO) Write(p []byte) (int, error) {
+	return t.writer.Write(p)
+}
+
+// The terminal has no API for initializing the history, so the lines are typed into the terminal with output discarded.
+func loadTerminalHistory(terminal *term.Terminal, terminalIO *terminalIO, history []string) {
+	input, output := terminalIO.reader, terminalIO.writer
+	defer func() {
+		terminalIO.reader, terminalIO.writer = input, output
+	}()
+	terminalIO.reader = strings.NewReader(strings.Join(history, "\r") + "\r")
+	terminalIO.writer = ioutil.Discard
+	for range history {
+		if _, err := terminal.ReadLine(); err != nil {
+			return
+		}
+	}
+}
+
+func shellHistoryFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, SHELL_HISTORY_FILE), nil
+}
+
+// The history is optional, so errors are ignored. If the file is too long, it is truncated.
+func loadShellHistory() []string {
+	filename, err := shellHistoryFile()
+	if err != nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	lines := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > SHELL_HISTORY_SIZE {
+		lines = lines[len(lines)-SHELL_HISTORY_SIZE:]
+		ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	}
+	return lines
+}
+
+func appendShellHistory(line string) {
+	filename, err := shellHistoryFile()
+	if err != nil {
+		return
+	}
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	file.WriteString(line + "\n")
+}
@@ -1,6 +1,11 @@
 package util
 
-import "github.com/fstab/h2c/http2client/frames"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fstab/h2c/http2client/frames"
+)
 
 func SliceContainsFrameType(s []frames.Type, t frames.Type) bool {
 	for _, e := range s {
@@ -10,3 +15,30 @@ func SliceContainsFrameType(s []frames.Type, t frames.Type) bool {
 	}
 	return false
 }
+
+// ParseListOfFrameTypes parses a comma separated list of frame types, like the parameter of --include.
+func ParseListOfFrameTypes(list string) ([]frames.Type, error) {
+	result := make([]frames.Type, 0)
+	for _, name := range strings.Split(list, ",") {
+		t, ok := frames.FrameNameToType(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("Syntax error: %v unknown.", strings.TrimSpace(name))
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+// ExcludeToInclude turns the '--exclude ...' option of 'h2c start --dump' and 'h2c dump on' into the equivalent '--include ...' option.
+func ExcludeToInclude(excluded []frames.Type) []frames.Type {
+	included := make([]frames.Type, 0)
+	for _, t := range frames.AllFrameTypes() {
+		if !SliceContainsFrameType(excluded, t) {
+			included = append(included, t)
+		}
+	}
+	if len(included) == 0 {
+		return nil
+	}
+	return included
+}
@@ -2,8 +2,10 @@ package wiretap
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/fstab/h2c/cli/daemon"
+	"github.com/fstab/h2c/cli/pcapng"
 	"github.com/fstab/h2c/http2client/frames"
 	"golang.org/x/net/http2/hpack"
 	"io"
@@ -68,24 +70,33 @@ zuaJapKwoKydbiLGlhvpcBtsE5ahRo3A62ckaeVi4JX7dXcpqAtM9A==
 
 const CLIENT_PREFACE = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
 
-func Run(local string, remote string) error {
+// If pcapFile is not empty, the frames are also written to pcapFile in pcapng format.
+func Run(local string, remote string, pcapFile string) error {
 	if !strings.Contains(remote, ":") {
 		remote = remote + ":443"
 	}
+	var pcapWriter *pcapng.Writer
+	if pcapFile != "" {
+		file, err := os.Create(pcapFile)
+		if err != nil {
+			return fmt.Errorf("Failed to create pcap file: %v", err.Error())
+		}
+		pcapWriter, err = pcapng.NewWriter(file)
+		if err != nil {
+			return fmt.Errorf("Failed to write pcap file: %v", err.Error())
+		}
+	}
 	listener, err := net.Listen("tcp", local)
 	if err != nil {
 		return err
 	}
-	dumpIncoming := make(chan frames.Frame)
-	dumpOutgoing := make(chan frames.Frame)
-	go dumpFrames(dumpIncoming, dumpOutgoing)
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
 			return err
 		}
 		go func() {
-			err := handleConnection(conn, local, remote, dumpIncoming, dumpOutgoing)
+			err := handleConnection(conn, local, remote, pcapWriter)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error while handling connection: %v\n", err.Error())
 			}
@@ -93,7 +104,7 @@ func Run(local string, remote string) error {
 	}
 }
 
-func handleConnection(conn net.Conn, local, remote string, dumpIncoming, dumpOutgoing chan frames.Frame) error {
+func handleConnection(conn net.Conn, local, remote string, pcapWriter *pcapng.Writer) error {
 	clientConn, err := negotiateH2Protocol(conn)
 	if err != nil {
 		return err
@@ -106,37 +117,92 @@ func handleConnection(conn net.Conn, local, remote string, dumpIncoming, dumpOut
 	if err != nil {
 		return err
 	}
-	go forwardFrames(clientConn, serverConn, remote, dumpOutgoing)
-	go forwardFrames(serverConn, clientConn, local, dumpIncoming)
+	var flow *pcapng.Flow
+	if pcapWriter != nil {
+		flow, err = pcapWriter.NewFlow(tcpAddr(clientConn.RemoteAddr()), tcpAddr(serverConn.RemoteAddr()))
+		if err != nil {
+			return fmt.Errorf("Failed to write pcap file: %v", err.Error())
+		}
+	}
+	clientReader := frames.NewReader(clientConn, frames.NewDecodingContext())
+	serverReader := frames.NewReader(serverConn, frames.NewDecodingContext())
+	dumper := daemon.NewConnectionDumper()
+	// Each side's SETTINGS_MAX_FRAME_SIZE limits the frames read from the other side.
+	go func() {
+		forwardFrames(clientReader, clientConn, serverReader, serverConn, remote, makeForwardedFrameObserver(dumper, flow, true), flow != nil)
+		closeFlow(flow)
+	}()
+	go func() {
+		forwardFrames(serverReader, serverConn, clientReader, clientConn, local, makeForwardedFrameObserver(dumper, flow, false), flow != nil)
+		closeFlow(flow)
+	}()
 	return nil
 }
 
-func dumpFrames(in chan frames.Frame, out chan frames.Frame) {
-	for {
-		select {
-		case frame := <-in:
-			daemon.DumpIncoming(frame)
-		case frame := <-out:
-			daemon.DumpOutgoing(frame)
+// Called when either direction terminates. The second call is a no-op.
+func closeFlow(flow *pcapng.Flow) {
+	if flow != nil {
+		if err := flow.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write pcap file: %v\n", err.Error())
 		}
 	}
 }
 
-func forwardFrames(from net.Conn, to net.Conn, remoteAuthority string, dump chan frames.Frame) {
-	defer from.Close()
+// The observer dumps the forwarded frame to the console and writes it to the pcap flow, if flow is not nil.
+// It is called synchronously after the frame was written, so the dump and the pcap file show the bytes sent to the peer,
+// and the frame is not modified while it is dumped.
+func makeForwardedFrameObserver(dumper *daemon.ConnectionDumper, flow *pcapng.Flow, fromClient bool) func(frames.Frame) {
+	return func(frame frames.Frame) {
+		if fromClient {
+			dumper.DumpOutgoing(frame)
+		} else {
+			dumper.DumpIncoming(frame)
+		}
+		if flow != nil {
+			if err := flow.WriteFrame(fromClient, frame); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write %v frame to pcap file: %v\n", frame.Type(), err.Error())
+			}
+		}
+	}
+}
+
+// Returns nil if addr is not a TCP address. In that case, the pcap flow will use a placeholder.
+func tcpAddr(addr net.Addr) *net.TCPAddr {
+	tcpAddr, _ := addr.(*net.TCPAddr)
+	return tcpAddr
+}
+
+// forwardFrames reads frames from one peer and writes them to the other peer.
+// The reader for the opposite direction is needed to apply the SETTINGS_MAX_FRAME_SIZE advertised by the sending peer.
+// Frames are flushed when no more data is buffered, so bursts of frames are forwarded in a single write.
+// observe is called for each frame after it was forwarded. If keepWireBytes is true, the frames keep the bytes sent to the peer.
+func forwardFrames(from *frames.Reader, fromConn net.Conn, reverse *frames.Reader, to net.Conn, remoteAuthority string, observe func(frames.Frame), keepWireBytes bool) {
+	defer fromConn.Close()
 	defer to.Close()
-	encodingContext := frames.NewEncodingContext()
-	decodingContext := frames.NewDecodingContext()
+	writer := frames.NewWriter(to, frames.NewEncodingContext())
+	writer.SetKeepWireBytes(keepWireBytes)
 	for {
-		frame, err := readNextFrame(from, decodingContext)
+		frame, err := from.ReadNextFrame()
+		var unknownFrameType *frames.UnknownFrameTypeError
+		if errors.As(err, &unknownFrameType) {
+			frame, err = unknownFrameType.Frame, nil // forwarded as is, because the peers may support extension frame types.
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error while reading next frame: %v\n", err.Error())
 			fmt.Fprintf(os.Stderr, "Closing connection.\n")
 			return
 		}
 		fixAuthorityHeader(frame, remoteAuthority)
-		dump <- frame
-		err = writeFrame(to, frame, encodingContext)
+		if settingsFrame, ok := frame.(*frames.SettingsFrame); ok && frames.SETTINGS_MAX_FRAME_SIZE.IsSet(settingsFrame) {
+			reverse.SetMaxFrameSize(frames.SETTINGS_MAX_FRAME_SIZE.Get(settingsFrame))
+		}
+		err = writer.WriteFrame(frame)
+		if err == nil {
+			observe(frame)
+		}
+		if err == nil && from.Buffered() == 0 {
+			err = writer.Flush()
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error while forwarding next frame: %v\n", err.Error())
 			fmt.Fprintf(os.Stderr, "Closing connection.\n")
@@ -182,39 +248,6 @@ func fixAuthorityHeader(frame frames.Frame, remoteAuthority string) {
 	}
 }
 
-// TODO: copy-and-paste from connection
-func readNextFrame(conn net.Conn, context *frames.DecodingContext) (frames.Frame, error) {
-	headerData := make([]byte, 9) // Frame starts with a 9 Bytes header
-	_, err := io.ReadFull(conn, headerData)
-	if err != nil {
-		return nil, err
-	}
-	header := frames.DecodeHeader(headerData)
-	payload := make([]byte, header.Length)
-	_, err = io.ReadFull(conn, payload)
-	if err != nil {
-		return nil, err
-	}
-	decodeFunc := frames.FindDecoder(frames.Type(header.HeaderType))
-	if decodeFunc == nil {
-		return nil, fmt.Errorf("%v: Unknown frame type.", header.HeaderType)
-	}
-	return decodeFunc(header.Flags, header.StreamId, payload, context)
-}
-
-// TODO: copy-and-paste from connection
-func writeFrame(conn net.Conn, frame frames.Frame, context *frames.EncodingContext) error {
-	encodedFrame, err := frame.Encode(context)
-	if err != nil {
-		return fmt.Errorf("Failed to write frame: %v", err.Error())
-	}
-	_, err = conn.Write(encodedFrame)
-	if err != nil {
-		return fmt.Errorf("Failed to write frame: %v", err.Error())
-	}
-	return nil
-}
-
 func negotiateH2Protocol(conn net.Conn) (*tls.Conn, error) {
 	keyPair, err := tls.X509KeyPair([]byte(CERT), []byte(KEY))
 	if err != nil {
@@ -6,10 +6,12 @@ require (
 	github.com/fatih/color v1.15.0
 	// github.com/fstab/h2c v0.0.12
 	golang.org/x/net v0.9.0
+	golang.org/x/term v0.10.0
 )
 
 require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.17 // indirect
-	golang.org/x/sys v0.7.0 // indirect
+	golang.org/x/sys v0.10.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
 )
@@ -0,0 +1,296 @@
+package http2client
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fstab/h2c/http2client/failure"
+	"github.com/fstab/h2c/http2client/frames"
+	"github.com/fstab/h2c/http2client/internal/eventloop"
+	"github.com/fstab/h2c/http2client/internal/eventloop/commands"
+	"golang.org/x/net/http2/hpack"
+)
+
+const (
+	MAX_BENCH_CONCURRENCY = 999 // maximum BenchOptions.Concurrency
+	MAX_BENCH_CONNECTIONS = 99  // maximum BenchOptions.Connections
+)
+
+// BenchOptions configure Bench(). At least one of Requests and Duration must be set.
+type BenchOptions struct {
+	Requests         int           // total number of requests, 0 means no limit
+	Duration         time.Duration // stop sending requests after Duration, 0 means no limit
+	Concurrency      int           // number of concurrent streams on each connection, limited by the server's SETTINGS_MAX_CONCURRENT_STREAMS
+	Connections      int
+	Rate             float64 // maximum number of requests per second over all connections, 0 means no limit
+	TimeoutInSeconds int     // timeout for each request
+	Headers          []hpack.HeaderField
+}
+
+// BenchResult is the result of Bench().
+type BenchResult struct {
+	Url         string
+	Requests    int
+	Failed      int
+	RstStreams  int           // number of RST_STREAM frames received
+	Concurrency int           // concurrent streams per connection, i.e. BenchOptions.Concurrency limited by the server's SETTINGS_MAX_CONCURRENT_STREAMS
+	Bytes       int64         // size of all response bodies
+	Elapsed     time.Duration // from the first request sent until the last request completed
+	StatusCodes map[string]int
+	Errors      map[failure.Kind]int // unclassified errors have Kind "error"
+	Latencies   []time.Duration      // one per successful request, sorted ascending. Failed requests are not included.
+}
+
+// Bench sends GET requests to the URL as fast as the options allow, and measures the latency of each request.
+//
+// The requests are sent on new connections, so that the current connection is not affected.
+// The connections use the same frame filters and event bus as the current connection, so frames can be dumped or watched.
+// Push promises are refused, and the requests are neither recorded in the history nor in the request log.
+func (h2c *Http2Client) Bench(path string, options BenchOptions) (*BenchResult, error) {
+	if h2c.err != nil {
+		return nil, h2c.err
+	}
+	if options.Requests <= 0 && options.Duration <= 0 {
+		return nil, fmt.Errorf("Number of requests or duration required.")
+	}
+	if options.Concurrency <= 0 || options.Connections <= 0 {
+		return nil, fmt.Errorf("Concurrency and number of connections must be at least 1.")
+	}
+	if options.Concurrency > MAX_BENCH_CONCURRENCY || options.Connections > MAX_BENCH_CONNECTIONS {
+		return nil, fmt.Errorf("Concurrency must be at most %v, and number of connections at most %v.", MAX_BENCH_CONCURRENCY, MAX_BENCH_CONNECTIONS)
+	}
+	url, err := h2c.completeUrlWithCurrentConnectionData(path)
+	if err != nil {
+		return nil, err
+	}
+	if url.Scheme != "http" {
+		return nil, fmt.Errorf("%v connections not supported.", url.Scheme)
+	}
+	host, port := hostAndPort(url)
+	if host == "" {
+		return nil, fmt.Errorf("Not connected. Run 'h2c connect' first, or use a full URL.")
+	}
+	b := &bench{
+		options: options,
+		result: &BenchResult{
+			StatusCodes: make(map[string]int),
+			Errors:      make(map[failure.Kind]int),
+			Latencies:   make([]time.Duration, 0),
+		},
+	}
+	// The incoming filters run in the connection's reader go routine, so the counter is updated while holding the mutex.
+	countRstStreams := func(frame frames.Frame) []frames.Frame {
+		if frame.Type() == frames.RST_STREAM_TYPE {
+			b.mutex.Lock()
+			b.result.RstStreams++
+			b.mutex.Unlock()
+		}
+		return []frames.Frame{frame}
+	}
+	incomingFrameFilters := append(append(make([]func(frames.Frame) []frames.Frame, 0), h2c.incomingFrameFilters...), countRstStreams)
+	refuseAll := &PushPolicy{RefuseAll: true}
+	loops := make([]*eventloop.Loop, 0, options.Connections)
+	defer func() {
+		for _, loop := range loops {
+			select {
+			case loop.Shutdown <- true:
+			case <-loop.Done:
+			}
+		}
+	}()
+	for i := 0; i < options.Connections; i++ {
+		loop, err := eventloop.Start(host, port, incomingFrameFilters, h2c.outgoingFrameFilters, h2c.writtenFrameObservers, h2c.keepWireBytes, refuseAll.newAcceptFunc(), h2c.events, nil)
+		if err != nil {
+			return nil, err
+		}
+		loops = append(loops, loop)
+	}
+	concurrency, err := awaitConcurrencyLimit(loops, options.Concurrency, options.TimeoutInSeconds)
+	if err != nil {
+		return nil, err
+	}
+	headers := mergeHeaders(h2c.customHeadersFor(url), options.Headers)
+	b.result.Url = url.String()
+	b.result.Concurrency = concurrency
+	b.started = time.Now()
+	var wg sync.WaitGroup
+	for _, loop := range loops {
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(loop *eventloop.Loop) {
+				defer wg.Done()
+				for b.waitForNextRequest() {
+					cmd := commands.NewHttpCommand("GET", url)
+					for _, header := range headers {
+						if isRequestPseudoHeader(header.Name) {
+							cmd.Request.ReplaceHeader(header.Name, header.Value)
+						} else {
+							cmd.Request.AddHeader(header.Name, header.Value)
+						}
+					}
+					cmd.Timings.Enqueued = time.Now()
+					select {
+					case loop.HttpCommands <- cmd:
+						b.record(cmd, cmd.AwaitCompletion(options.TimeoutInSeconds))
+					case <-loop.Done:
+						b.record(cmd, failure.New(failure.CONNECTION_ERROR, "Connection closed."))
+						return
+					}
+				}
+			}(loop)
+		}
+	}
+	wg.Wait()
+	b.result.Elapsed = time.Since(b.started)
+	sort.Slice(b.result.Latencies, func(i, j int) bool {
+		return b.result.Latencies[i] < b.result.Latencies[j]
+	})
+	return b.result, nil
+}
+
+// awaitConcurrencyLimit waits for the server's initial SETTINGS frame on each connection,
+// so that the number of concurrent streams does not exceed the server's SETTINGS_MAX_CONCURRENT_STREAMS.
+func awaitConcurrencyLimit(loops []*eventloop.Loop, concurrency int, timeoutInSeconds int) (int, error) {
+	timeout := time.After(time.Duration(timeoutInSeconds) * time.Second)
+	for _, loop := range loops {
+		select {
+		case <-loop.ServerSettingsReceived():
+		case <-loop.Done:
+			return 0, failure.New(failure.CONNECTION_ERROR, "Connection closed.")
+		case <-timeout:
+			return 0, failure.New(failure.TIMEOUT, "Timeout while waiting for the server's SETTINGS frame.")
+		}
+		if max := loop.ServerMaxConcurrentStreams(); uint32(concurrency) > max {
+			concurrency = int(max)
+		}
+	}
+	if concurrency == 0 {
+		return 0, fmt.Errorf("The server does not allow any concurrent streams, SETTINGS_MAX_CONCURRENT_STREAMS is 0.")
+	}
+	return concurrency, nil
+}
+
+// bench is the state shared by the workers sending the requests.
+type bench struct {
+	mutex   sync.Mutex
+	options BenchOptions
+	started time.Time
+	issued  int // number of requests that were started
+	result  *BenchResult
+}
+
+// waitForNextRequest returns false if no more requests should be sent. With a rate limit, it waits until the next request is due.
+func (b *bench) waitForNextRequest() bool {
+	b.mutex.Lock()
+	if (b.options.Requests > 0 && b.issued >= b.options.Requests) || (b.options.Duration > 0 && time.Since(b.started) >= b.options.Duration) {
+		b.mutex.Unlock()
+		return false
+	}
+	due := b.started
+	if b.options.Rate > 0 {
+		due = b.started.Add(time.Duration(float64(b.issued) * float64(time.Second) / b.options.Rate))
+	}
+	b.issued++
+	b.mutex.Unlock()
+	if wait := time.Until(due); wait > 0 {
+		time.Sleep(wait)
+	}
+	return b.options.Duration <= 0 || time.Since(b.started) < b.options.Duration
+}
+
+func (b *bench) record(cmd *commands.HttpCommand, err error) {
+	latency := time.Since(cmd.Timings.Enqueued)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.result.Requests++
+	if err != nil {
+		b.result.Failed++
+		kind := failure.Kind("error")
+		if f := failure.Of(err); f != nil {
+			kind = f.Kind
+		}
+		b.result.Errors[kind]++
+		return
+	}
+	b.result.Latencies = append(b.result.Latencies, latency)
+	b.result.StatusCodes[cmd.Response.GetHeader(":status")]++
+	b.result.Bytes += int64(len(cmd.Response.GetBody()))
+}
+
+func (r *BenchResult) RequestsPerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Elapsed.Seconds()
+}
+
+func (r *BenchResult) BytesPerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Elapsed.Seconds()
+}
+
+// Percentile of the latencies, like Percentile(99) for the 99th percentile. Uses the nearest-rank method.
+func (r *BenchResult) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(r.Latencies)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(r.Latencies) {
+		rank = len(r.Latencies) - 1
+	}
+	return r.Latencies[rank]
+}
+
+// String is a multi-line report, like
+//
+//	1000 requests to http://localhost:8080/ in 2.1s, 476.2 requests/s, 23.8 KB/s, 10 concurrent streams per connection
+//	status codes: 200: 995, 503: 2
+//	failed: 3 (stream_error: 2, timeout: 1), RST_STREAM received: 2
+//	latency: min 1.1ms, p50 2ms, p90 3.4ms, p99 8.2ms, max 12ms
+func (r *BenchResult) String() string {
+	lines := []string{
+		fmt.Sprintf("%v requests to %v in %v, %.1f requests/s, %.1f KB/s, %v concurrent streams per connection", r.Requests, r.Url, r.Elapsed.Round(time.Millisecond), r.RequestsPerSecond(), r.BytesPerSecond()/1024, r.Concurrency),
+		"status codes: " + formatCounts(r.StatusCodes),
+	}
+	if r.Failed > 0 {
+		errors := make(map[string]int)
+		for kind, count := range r.Errors {
+			errors[string(kind)] = count
+		}
+		lines = append(lines, fmt.Sprintf("failed: %v (%v), RST_STREAM received: %v", r.Failed, formatCounts(errors), r.RstStreams))
+	} else {
+		lines = append(lines, fmt.Sprintf("failed: 0, RST_STREAM received: %v", r.RstStreams))
+	}
+	if len(r.Latencies) > 0 {
+		round := func(d time.Duration) time.Duration { return d.Round(100 * time.Microsecond) }
+		lines = append(lines, fmt.Sprintf("latency: min %v, p50 %v, p90 %v, p99 %v, max %v",
+			round(r.Latencies[0]), round(r.Percentile(50)), round(r.Percentile(90)), round(r.Percentile(99)), round(r.Latencies[len(r.Latencies)-1])))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Like "200: 998, 503: 2", sorted by key, or "none".
+func formatCounts(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "none"
+	}
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%v: %v", key, counts[key]))
+	}
+	return strings.Join(parts, ", ")
+}
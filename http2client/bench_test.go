@@ -0,0 +1,80 @@
+package http2client
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fstab/h2c/http2client/failure"
+	"golang.org/x/net/http2"
+)
+
+func TestBenchPercentile(t *testing.T) {
+	result := &BenchResult{Latencies: make([]time.Duration, 0, 100)}
+	for i := 1; i <= 100; i++ {
+		result.Latencies = append(result.Latencies, time.Duration(i)*time.Millisecond)
+	}
+	expected := map[float64]time.Duration{
+		0:   1 * time.Millisecond,
+		50:  50 * time.Millisecond,
+		90:  90 * time.Millisecond,
+		99:  99 * time.Millisecond,
+		100: 100 * time.Millisecond,
+	}
+	for p, latency := range expected {
+		if result.Percentile(p) != latency {
+			t.Errorf("Expected p%v to be %v, but got %v", p, latency, result.Percentile(p))
+		}
+	}
+	if (&BenchResult{}).Percentile(50) != 0 {
+		t.Error("Expected 0 for empty results.")
+	}
+}
+
+func TestBenchLimitedByMaxConcurrentStreams(t *testing.T) {
+	var mutex sync.Mutex
+	inProgress, maxInProgress := 0, 0
+	host, port := startTestServerWithConfig(t, &http2.Server{MaxConcurrentStreams: 2}, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		inProgress++
+		if inProgress > maxInProgress {
+			maxInProgress = inProgress
+		}
+		mutex.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mutex.Lock()
+		inProgress--
+		mutex.Unlock()
+		w.Write([]byte("hello"))
+	})
+	result, err := New().Bench("http://"+host+":"+strconv.Itoa(port)+"/", BenchOptions{Requests: 20, Concurrency: 10, Connections: 1, TimeoutInSeconds: 5})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if result.Concurrency != 2 || maxInProgress > 2 {
+		t.Errorf("Expected at most 2 concurrent streams, but got concurrency %v and %v requests in progress.", result.Concurrency, maxInProgress)
+	}
+	if result.Requests != 20 || result.Failed != 0 || result.StatusCodes["200"] != 20 || len(result.Latencies) != 20 || result.Bytes != 100 {
+		t.Errorf("Unexpected result %v", result)
+	}
+}
+
+func TestBenchFailedRequests(t *testing.T) {
+	host, port := startTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler) // The server resets the stream with RST_STREAM.
+	})
+	result, err := New().Bench("http://"+host+":"+strconv.Itoa(port)+"/", BenchOptions{Requests: 5, Concurrency: 1, Connections: 1, TimeoutInSeconds: 5})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Requests != 5 || result.Failed != 5 || result.Errors[failure.STREAM_ERROR] != 5 || result.RstStreams != 5 {
+		t.Errorf("Expected 5 requests reset with RST_STREAM, but got %v", result)
+	}
+	if len(result.Latencies) != 0 {
+		t.Errorf("Expected no latencies for failed requests, but got %v", result.Latencies)
+	}
+}
@@ -0,0 +1,134 @@
+package http2client
+
+import (
+	"fmt"
+	neturl "net/url"
+	"strings"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// customHeader is a header defined with 'h2c set'.
+// If origin or pathPrefix is set, the header is only sent with matching requests.
+type customHeader struct {
+	field      hpack.HeaderField
+	origin     *neturl.URL // nil means any origin
+	pathPrefix string      // empty means any path
+}
+
+var requestPseudoHeaders = []string{":method", ":scheme", ":authority", ":path"}
+
+func isRequestPseudoHeader(name string) bool {
+	for _, pseudoHeader := range requestPseudoHeaders {
+		if name == pseudoHeader {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOrigin parses origins like "https://example.com" or "http://localhost:8080".
+func parseOrigin(origin string) (*neturl.URL, error) {
+	url, err := neturl.Parse(strings.TrimSuffix(origin, "/"))
+	if err != nil || (url.Scheme != "http" && url.Scheme != "https") || url.Host == "" || url.Path != "" || url.RawQuery != "" {
+		return nil, fmt.Errorf("%v: Invalid origin. Use 'https://host' or 'https://host:port'.", origin)
+	}
+	url.Host = strings.ToLower(url.Host)
+	return url, nil
+}
+
+func (h *customHeader) matches(url *neturl.URL) bool {
+	if h.origin != nil {
+		host, port := hostAndPort(h.origin)
+		requestHost, requestPort := hostAndPort(url)
+		if h.origin.Scheme != url.Scheme || host != strings.ToLower(requestHost) || port != requestPort {
+			return false
+		}
+	}
+	return strings.HasPrefix(url.Path, h.pathPrefix)
+}
+
+// hasScope is true if the header was set with the origin and path prefix. origin may be nil.
+func (h *customHeader) hasScope(origin *neturl.URL, pathPrefix string) bool {
+	if h.pathPrefix != pathPrefix || (h.origin == nil) != (origin == nil) {
+		return false
+	}
+	if origin != nil {
+		host, port := hostAndPort(h.origin)
+		otherHost, otherPort := hostAndPort(origin)
+		return h.origin.Scheme == origin.Scheme && host == otherHost && port == otherPort
+	}
+	return true
+}
+
+func (h *customHeader) String() string {
+	return h.info().String()
+}
+
+func (h *customHeader) info() CustomHeader {
+	result := CustomHeader{
+		Name:       h.field.Name,
+		Value:      h.field.Value,
+		PathPrefix: h.pathPrefix,
+	}
+	if h.origin != nil {
+		result.Origin = h.origin.String()
+	}
+	return result
+}
+
+// customHeadersFor returns the headers defined with 'h2c set' that apply to a request for url.
+func (h2c *Http2Client) customHeadersFor(url *neturl.URL) []hpack.HeaderField {
+	result := make([]hpack.HeaderField, 0, len(h2c.customHeaders))
+	for _, header := range h2c.customHeaders {
+		if header.matches(url) {
+			result = append(result, header.field)
+		}
+	}
+	return result
+}
+
+// CustomHeader is a header defined with SetHeader(), as returned by ListHeaders().
+type CustomHeader struct {
+	Name       string
+	Value      string
+	Origin     string // empty if the header is sent to all origins
+	PathPrefix string // empty if the header is sent for all paths
+}
+
+// CustomHeaderList is the result of ListHeaders().
+type CustomHeaderList []CustomHeader
+
+// ListHeaders returns the headers defined with 'h2c set' and their scopes.
+func (h2c *Http2Client) ListHeaders() CustomHeaderList {
+	result := make(CustomHeaderList, 0, len(h2c.customHeaders))
+	for _, header := range h2c.customHeaders {
+		result = append(result, header.info())
+	}
+	return result
+}
+
+// "authorization: Bearer xyz (origin https://example.com, path /api/)"
+func (h CustomHeader) String() string {
+	result := h.Name + ": " + h.Value
+	scopes := make([]string, 0, 2)
+	if h.Origin != "" {
+		scopes = append(scopes, "origin "+h.Origin)
+	}
+	if h.PathPrefix != "" {
+		scopes = append(scopes, "path "+h.PathPrefix)
+	}
+	if len(scopes) > 0 {
+		result = result + " (" + strings.Join(scopes, ", ") + ")"
+	}
+	return result
+}
+
+// String has one line per header.
+func (list CustomHeaderList) String() string {
+	lines := make([]string, 0, len(list))
+	for _, header := range list {
+		lines = append(lines, header.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,71 @@
+package events
+
+import "sync"
+
+// Bus distributes events to all subscribers. It is thread safe.
+//
+// Publish never blocks: If a subscriber does not consume its events fast enough,
+// the events that do not fit into the subscriber's buffer are dropped.
+// That way, a slow subscriber cannot block the event loop.
+type Bus struct {
+	mutex       sync.Mutex
+	subscribers map[*Subscription]bool
+}
+
+type Subscription struct {
+	Events chan Event
+	bus    *Bus
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[*Subscription]bool),
+	}
+}
+
+// Publish is a no-op if the Bus is nil.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for subscription := range b.subscribers {
+		select {
+		case subscription.Events <- event:
+		default:
+			// Subscriber too slow, drop event.
+		}
+	}
+}
+
+// HasSubscribers can be used to avoid creating events that nobody receives.
+func (b *Bus) HasSubscribers() bool {
+	if b == nil {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.subscribers) > 0
+}
+
+func (b *Bus) Subscribe(bufferSize int) *Subscription {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	subscription := &Subscription{
+		Events: make(chan Event, bufferSize),
+		bus:    b,
+	}
+	b.subscribers[subscription] = true
+	return subscription
+}
+
+// Unsubscribe closes the Events channel.
+func (s *Subscription) Unsubscribe() {
+	s.bus.mutex.Lock()
+	defer s.bus.mutex.Unlock()
+	if s.bus.subscribers[s] {
+		delete(s.bus.subscribers, s)
+		close(s.Events)
+	}
+}
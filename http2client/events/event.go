@@ -0,0 +1,40 @@
+// Package events implements notifications about things happening asynchronously on an HTTP/2 connection,
+// like push promises arriving or streams changing their state.
+package events
+
+import (
+	"fmt"
+	"time"
+)
+
+type Type string
+
+const (
+	PUSH_PROMISE Type = "PUSH_PROMISE" // Push promise received from the server.
+	STREAM_STATE Type = "STREAM_STATE" // Stream state transition.
+	RST_STREAM   Type = "RST_STREAM"   // RST_STREAM received from the server.
+	GOAWAY       Type = "GOAWAY"       // GOAWAY received from the server.
+	PING_RTT     Type = "PING_RTT"     // PING ACK received, Message contains the round trip time.
+	FRAME        Type = "FRAME"        // Frame sent or received.
+)
+
+type Event struct {
+	Type     Type
+	Time     time.Time
+	StreamId uint32
+	Message  string
+}
+
+func New(eventType Type, streamId uint32, format string, a ...interface{}) Event {
+	return Event{
+		Type:     eventType,
+		Time:     time.Now(),
+		StreamId: streamId,
+		Message:  fmt.Sprintf(format, a...),
+	}
+}
+
+// "12:03:45.120 PUSH_PROMISE(2): GET https://localhost:8443/style.css"
+func (e Event) String() string {
+	return fmt.Sprintf("%v %v(%v): %v", e.Time.Format("15:04:05.000"), e.Type, e.StreamId, e.Message)
+}
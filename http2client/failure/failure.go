@@ -0,0 +1,56 @@
+// Package failure classifies the errors returned by the Http2Client,
+// so that the command line can report what kind of failure occurred, and not just an error message.
+package failure
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fstab/h2c/http2client/frames"
+)
+
+type Kind string
+
+const (
+	CONNECT_ERROR    Kind = "connect_error"    // Failed to establish the TCP connection or to send the client preface.
+	TIMEOUT          Kind = "timeout"          // No response within the timeout.
+	STREAM_ERROR     Kind = "stream_error"     // The stream was reset with RST_STREAM.
+	CONNECTION_ERROR Kind = "connection_error" // The connection failed while the request was pending.
+	GOAWAY           Kind = "goaway"           // The server sent GOAWAY while the request was pending.
+	PROTOCOL_ERROR   Kind = "protocol_error"   // The server violated the HTTP/2 protocol.
+	HTTP_ERROR       Kind = "http_error"       // HTTP status >= 400. Not used by the Http2Client, only by 'h2c get --fail'.
+	ASSERTION_FAILED Kind = "assertion_failed" // An 'expect' step in 'h2c run' or a test in 'h2c conformance' failed. Not used by the Http2Client.
+)
+
+// Error is an error with a Kind. Code is the HTTP/2 error code, like "CANCEL", or empty if the failure has no error code.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+func New(kind Kind, format string, a ...interface{}) *Error {
+	return &Error{
+		Kind:    kind,
+		Message: fmt.Sprintf(format, a...),
+	}
+}
+
+func NewWithErrorCode(kind Kind, errorCode frames.ErrorCode, format string, a ...interface{}) *Error {
+	result := New(kind, format, a...)
+	result.Code = errorCode.String()
+	return result
+}
+
+// Of returns the classified error, or nil if err was not created with this package.
+func Of(err error) *Error {
+	var result *Error
+	if errors.As(err, &result) {
+		return result
+	}
+	return nil
+}
@@ -1,15 +1,12 @@
 package frames
 
-import (
-	"bytes"
-)
-
 const (
 	DATA_FLAG_END_STREAM Flag = 0x01
 	DATA_FLAG_PADDED     Flag = 0x08
 )
 
 type DataFrame struct {
+	wire
 	StreamId  uint32
 	Data      []byte
 	EndStream bool
@@ -50,11 +47,7 @@ func (f *DataFrame) flags() []Flag {
 }
 
 func (f *DataFrame) Encode(context *EncodingContext) ([]byte, error) {
-	length := uint32(len(f.Data))
-	var result bytes.Buffer
-	result.Write(encodeHeader(f.Type(), f.StreamId, length, f.flags()))
-	result.Write(f.Data)
-	return result.Bytes(), nil
+	return encodeFrame(f.Type(), f.StreamId, f.flags(), f.Data), nil
 }
 
 func (f *DataFrame) GetStreamId() uint32 {
@@ -1,8 +1,6 @@
 package frames
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
 )
 
@@ -26,6 +24,25 @@ type Frame interface {
 	Encode(*EncodingContext) ([]byte, error)
 	Type() Type
 	GetStreamId() uint32
+	// WireBytes returns the frame as it was read by the Reader or written by the Writer, including the 9 bytes frame header.
+	// The Reader and the Writer keep the wire bytes only if SetKeepWireBytes(true) was called.
+	// It is nil for frames that were neither read nor written, and for DATA frames written by the Writer,
+	// because the Writer does not copy the payload. DATA frames are written exactly as returned by Encode().
+	WireBytes() []byte
+	setWireBytes(data []byte)
+}
+
+// wire is embedded in all frame types to implement WireBytes().
+type wire struct {
+	wireBytes []byte
+}
+
+func (w *wire) WireBytes() []byte {
+	return w.wireBytes
+}
+
+func (w *wire) setWireBytes(data []byte) {
+	w.wireBytes = data
 }
 
 func FindDecoder(frameType Type) func(flags byte, streamId uint32, payload []byte, context *DecodingContext) (Frame, error) {
@@ -53,21 +70,25 @@ func FindDecoder(frameType Type) func(flags byte, streamId uint32, payload []byt
 	}
 }
 
-func encodeHeader(frameType Type, streamId uint32, length uint32, flags []Flag) []byte {
-	var result bytes.Buffer
-	bytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(bytes, length)
-	result.Write(bytes[1:])
-	bytes[0] = byte(frameType)
-	result.Write(bytes[0:1])
-	bytes[0] = 0
+// encodeFrame returns the 9 bytes frame header followed by the payload.
+// The result is allocated with the exact size, so there is only one allocation per frame.
+func encodeFrame(frameType Type, streamId uint32, flags []Flag, payload []byte) []byte {
+	result := make([]byte, 0, 9+len(payload))
+	result = appendHeader(result, frameType, streamId, uint32(len(payload)), flags)
+	return append(result, payload...)
+}
+
+// appendHeader appends the 9 bytes frame header to dst.
+func appendHeader(dst []byte, frameType Type, streamId uint32, length uint32, flags []Flag) []byte {
+	var flagsByte byte
 	for _, flag := range flags {
-		flag.set(&bytes[0])
+		flag.set(&flagsByte)
 	}
-	result.Write(bytes[0:1])
-	binary.BigEndian.PutUint32(bytes, streamId)
-	result.Write(bytes)
-	return result.Bytes()
+	return append(dst,
+		byte(length>>16), byte(length>>8), byte(length),
+		byte(frameType),
+		flagsByte,
+		byte(streamId>>24), byte(streamId>>16), byte(streamId>>8), byte(streamId))
 }
 
 type FrameHeader struct {
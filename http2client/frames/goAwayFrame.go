@@ -6,6 +6,7 @@ import (
 )
 
 type GoAwayFrame struct {
+	wire
 	StreamId     uint32
 	LastStreamId uint32
 	ErrorCode    ErrorCode
@@ -36,7 +37,7 @@ func (f *GoAwayFrame) Encode(context *EncodingContext) ([]byte, error) {
 	payload := make([]byte, 8)
 	binary.BigEndian.PutUint32(payload[0:4], f.LastStreamId)
 	binary.BigEndian.PutUint32(payload[4:8], uint32(f.ErrorCode))
-	return payload, nil
+	return encodeFrame(f.Type(), f.StreamId, nil, payload), nil
 }
 
 func (f *GoAwayFrame) GetStreamId() uint32 {
@@ -1,7 +1,6 @@
 package frames
 
 import (
-	"bytes"
 	"fmt"
 	"golang.org/x/net/http2/hpack"
 )
@@ -14,11 +13,15 @@ const (
 )
 
 type HeadersFrame struct {
+	wire
 	StreamId   uint32
 	EndStream  bool
 	EndHeaders bool
 	Priority   bool
 	Headers    []hpack.HeaderField
+	// HeaderBlock is the HPACK encoded header block, without padding and priority.
+	// It is set when the frame is read by the Reader or written by the Writer, if SetKeepWireBytes(true) was called.
+	HeaderBlock []byte
 }
 
 func NewHeadersFrame(streamId uint32, headers []hpack.HeaderField) *HeadersFrame {
@@ -61,14 +64,15 @@ func DecodeHeadersFrame(flags byte, streamId uint32, payload []byte, context *De
 	}
 	headers, err := context.decoder.DecodeFull(payload)
 	if err != nil {
-		return nil, fmt.Errorf("Error decoding header fields: ", err.Error())
+		return nil, fmt.Errorf("Error decoding header fields: %v", err.Error())
 	}
 	return &HeadersFrame{
-		StreamId:   streamId,
-		EndStream:  endStream,
-		EndHeaders: endHeaders,
-		Priority:   priority,
-		Headers:    headers,
+		StreamId:    streamId,
+		EndStream:   endStream,
+		EndHeaders:  endHeaders,
+		Priority:    priority,
+		Headers:     headers,
+		HeaderBlock: payload,
 	}, nil
 }
 
@@ -96,11 +100,7 @@ func (f *HeadersFrame) Encode(context *EncodingContext) ([]byte, error) {
 		}
 	}
 	headerBlockFragment := context.headerBlockBuffer.Bytes()
-	length := uint32(len(headerBlockFragment))
-	var result bytes.Buffer
-	result.Write(encodeHeader(f.Type(), f.StreamId, length, f.flags()))
-	result.Write(headerBlockFragment)
-	return result.Bytes(), nil
+	return encodeFrame(f.Type(), f.StreamId, f.flags(), headerBlockFragment), nil
 }
 
 func (f *HeadersFrame) GetStreamId() uint32 {
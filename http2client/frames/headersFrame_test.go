@@ -28,6 +28,7 @@ func TestEncodeDecode(t *testing.T) {
 	if err != nil {
 		t.Error("Decoding error:", err.Error())
 	}
+	frame.HeaderBlock = data[9:] // the header block without padding and priority
 	if !reflect.DeepEqual(frame, result) {
 		t.Error("Result does not equal expected frame.")
 	}
@@ -56,6 +57,7 @@ func TestPadding(t *testing.T) {
 		if err != nil {
 			t.Error("Decoding error:", err.Error())
 		}
+		frame.HeaderBlock = data[9:]
 		if !reflect.DeepEqual(frame, result) {
 			t.Error("Result does not equal expected frame.")
 		}
@@ -91,7 +93,8 @@ func TestPriority(t *testing.T) {
 	if err != nil {
 		t.Error("Decoding error:", err.Error())
 	}
-	frame.Priority = true // to compare with result
+	frame.Priority = true        // to compare with result
+	frame.HeaderBlock = data[9:] // the header block without padding and priority
 	if !reflect.DeepEqual(frame, result) {
 		t.Error("Result does not equal expected frame.")
 	}
@@ -110,7 +113,8 @@ func TestPaddingAndPriority(t *testing.T) {
 	if err != nil {
 		t.Error("Decoding error:", err.Error())
 	}
-	frame.Priority = true // to compare with result
+	frame.Priority = true        // to compare with result
+	frame.HeaderBlock = data[9:] // the header block without padding and priority
 	if !reflect.DeepEqual(frame, result) {
 		t.Error("Result does not equal expected frame.")
 	}
@@ -1,7 +1,6 @@
 package frames
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 )
@@ -11,6 +10,7 @@ const (
 )
 
 type PingFrame struct {
+	wire
 	StreamId uint32
 	Payload  uint64
 	Ack      bool
@@ -49,12 +49,7 @@ func (f *PingFrame) flags() []Flag {
 func (f *PingFrame) Encode(context *EncodingContext) ([]byte, error) {
 	payloadBytes := make([]byte, 8)
 	binary.BigEndian.PutUint64(payloadBytes, f.Payload)
-
-	length := uint32(8)
-	var result bytes.Buffer
-	result.Write(encodeHeader(f.Type(), f.StreamId, length, f.flags()))
-	result.Write(payloadBytes)
-	return result.Bytes(), nil
+	return encodeFrame(f.Type(), f.StreamId, f.flags(), payloadBytes), nil
 }
 
 func (f *PingFrame) GetStreamId() uint32 {
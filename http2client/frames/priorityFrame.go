@@ -6,6 +6,7 @@ import (
 )
 
 type PriorityFrame struct {
+	wire
 	StreamId           uint32
 	StreamDependencyId uint32
 	Weight             uint8
@@ -27,7 +28,7 @@ func DecodePriorityFrame(flags byte, streamId uint32, payload []byte, context *D
 	}
 	streamDependencyId := uint32_ignoreFirstBit(payload[0:4])
 	weight := payload[4]
-	exclusive := payload[0]&0x80 == 1
+	exclusive := payload[0]&0x80 != 0
 	return NewPriorityFrame(streamId, streamDependencyId, weight, exclusive), nil
 }
 
@@ -42,7 +43,7 @@ func (f *PriorityFrame) Encode(context *EncodingContext) ([]byte, error) {
 	if f.Exclusive {
 		payload[0] |= 0x80
 	}
-	return payload, nil
+	return encodeFrame(f.Type(), f.StreamId, nil, payload), nil
 }
 
 func (f *PriorityFrame) GetStreamId() uint32 {
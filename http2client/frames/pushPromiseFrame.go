@@ -1,7 +1,6 @@
 package frames
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"golang.org/x/net/http2/hpack"
@@ -13,10 +12,14 @@ const (
 )
 
 type PushPromiseFrame struct {
+	wire
 	StreamId         uint32
 	EndHeaders       bool
 	PromisedStreamId uint32
 	Headers          []hpack.HeaderField
+	// HeaderBlock is the HPACK encoded header block, without padding and promised stream id.
+	// It is set when the frame is read by the Reader or written by the Writer, if SetKeepWireBytes(true) was called.
+	HeaderBlock []byte
 }
 
 func NewPushPromiseFrame(streamId uint32, promisedStreamId uint32, headers []hpack.HeaderField) *PushPromiseFrame {
@@ -41,13 +44,14 @@ func DecodePushPromiseFrame(flags byte, streamId uint32, payload []byte, context
 	promisedStreamId := uint32_ignoreFirstBit(payload[0:4])
 	headers, err := context.decoder.DecodeFull(payload[4:])
 	if err != nil {
-		return nil, fmt.Errorf("Error decoding header fields: ", err.Error())
+		return nil, fmt.Errorf("Error decoding header fields: %v", err.Error())
 	}
 	return &PushPromiseFrame{
 		StreamId:         streamId,
 		PromisedStreamId: promisedStreamId,
 		EndHeaders:       endHeaders,
 		Headers:          headers,
+		HeaderBlock:      payload[4:],
 	}, nil
 }
 
@@ -71,15 +75,11 @@ func (f *PushPromiseFrame) Encode(context *EncodingContext) ([]byte, error) {
 			return nil, fmt.Errorf("Failed to encode HEADER frame: %v", err)
 		}
 	}
-	promisedStreamId := make([]byte, 4)
-	binary.BigEndian.PutUint32(promisedStreamId, f.PromisedStreamId)
 	headerBlockFragment := context.headerBlockBuffer.Bytes()
-	length := uint32(len(headerBlockFragment)) + uint32(len(promisedStreamId))
-	var result bytes.Buffer
-	result.Write(encodeHeader(f.Type(), f.StreamId, length, f.flags()))
-	result.Write(promisedStreamId)
-	result.Write(headerBlockFragment)
-	return result.Bytes(), nil
+	payload := make([]byte, 4, 4+len(headerBlockFragment))
+	binary.BigEndian.PutUint32(payload, f.PromisedStreamId)
+	payload = append(payload, headerBlockFragment...)
+	return encodeFrame(f.Type(), f.StreamId, f.flags(), payload), nil
 }
 
 func (f *PushPromiseFrame) GetStreamId() uint32 {
@@ -0,0 +1,33 @@
+package frames
+
+// RawFrame is a frame with arbitrary type, flags, and payload.
+// It is encoded as is, without any validation, so it can be used to send frames that violate the protocol,
+// like a SETTINGS ACK with payload, or a frame larger than SETTINGS_MAX_FRAME_SIZE.
+type RawFrame struct {
+	wire
+	FrameType Type
+	Flags     byte
+	StreamId  uint32
+	Payload   []byte
+}
+
+func NewRawFrame(frameType Type, flags byte, streamId uint32, payload []byte) *RawFrame {
+	return &RawFrame{
+		FrameType: frameType,
+		Flags:     flags,
+		StreamId:  streamId,
+		Payload:   payload,
+	}
+}
+
+func (f *RawFrame) Type() Type {
+	return f.FrameType
+}
+
+func (f *RawFrame) Encode(context *EncodingContext) ([]byte, error) {
+	return encodeFrame(f.FrameType, f.StreamId, []Flag{Flag(f.Flags)}, f.Payload), nil
+}
+
+func (f *RawFrame) GetStreamId() uint32 {
+	return f.StreamId
+}
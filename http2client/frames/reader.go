@@ -0,0 +1,141 @@
+package frames
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// DEFAULT_MAX_FRAME_SIZE is the initial value of SETTINGS_MAX_FRAME_SIZE, as defined in RFC 7540 section 6.5.2.
+const DEFAULT_MAX_FRAME_SIZE uint32 = 1 << 14
+
+// FrameSizeError is returned by the Reader when a frame exceeds the advertised SETTINGS_MAX_FRAME_SIZE.
+// This is a connection error of type FRAME_SIZE_ERROR, see RFC 7540 section 4.2.
+type FrameSizeError struct {
+	FrameType    Type
+	Length       uint32
+	MaxFrameSize uint32
+}
+
+func (err *FrameSizeError) Error() string {
+	return fmt.Sprintf("%v: Received %v frame of length %v, but SETTINGS_MAX_FRAME_SIZE is %v.", err.ErrorCode(), err.FrameType, err.Length, err.MaxFrameSize)
+}
+
+func (err *FrameSizeError) ErrorCode() ErrorCode {
+	return FRAME_SIZE_ERROR
+}
+
+// UnknownFrameTypeError is returned by the Reader for a frame with an unknown type.
+// The frame is read completely, so the next frame can be read after this error.
+// RFC 7540 section 4.1 requires implementations to ignore frames of unknown types.
+// Frame contains the unknown frame as read, so that proxies like 'h2c wiretap' can forward it.
+type UnknownFrameTypeError struct {
+	FrameType Type
+	Frame     *RawFrame
+}
+
+func (err *UnknownFrameTypeError) Error() string {
+	return fmt.Sprintf("%v: Unknown frame type.", err.FrameType)
+}
+
+// Reader reads and decodes frames from a buffered input stream.
+//
+// The header and payload buffers are re-used for each frame, except for DATA frames,
+// because the payload of a DATA frame is referenced by the decoded frame.
+// If SetKeepWireBytes(true) was called, each frame is read into its own buffer instead, which is kept as the frame's WireBytes().
+// The payload of DATA frames and the header block of HEADERS and PUSH_PROMISE frames reference that buffer.
+type Reader struct {
+	in            *bufio.Reader
+	context       *DecodingContext
+	header        [9]byte
+	payload       []byte
+	keepWireBytes bool
+	maxFrameSize  uint32 // accessed atomically, as it may be updated while another go routine reads.
+}
+
+func NewReader(in io.Reader, context *DecodingContext) *Reader {
+	return &Reader{
+		in:           bufio.NewReader(in),
+		context:      context,
+		payload:      make([]byte, DEFAULT_MAX_FRAME_SIZE),
+		maxFrameSize: DEFAULT_MAX_FRAME_SIZE,
+	}
+}
+
+// SetKeepWireBytes must be called before the first frame is read.
+// If keep is true, frames have WireBytes(), and HEADERS and PUSH_PROMISE frames have a HeaderBlock.
+// This is needed for dumping the frames as they were received, but it costs an allocation for each frame.
+func (r *Reader) SetKeepWireBytes(keep bool) {
+	r.keepWireBytes = keep
+}
+
+// SetMaxFrameSize updates the limit for the length of incoming frames.
+// This should be the SETTINGS_MAX_FRAME_SIZE advertised to the peer.
+func (r *Reader) SetMaxFrameSize(size uint32) {
+	atomic.StoreUint32(&r.maxFrameSize, size)
+}
+
+// Buffered returns the number of bytes that can be read without blocking.
+func (r *Reader) Buffered() int {
+	return r.in.Buffered()
+}
+
+func (r *Reader) ReadNextFrame() (Frame, error) {
+	_, err := io.ReadFull(r.in, r.header[:])
+	if err != nil {
+		return nil, err
+	}
+	length := uint32_ignoreFirstBit(r.header[0:3])
+	frameType := Type(r.header[3])
+	flags := r.header[4]
+	streamId := uint32_ignoreFirstBit(r.header[5:9])
+	maxFrameSize := atomic.LoadUint32(&r.maxFrameSize)
+	if length > maxFrameSize {
+		return nil, &FrameSizeError{
+			FrameType:    frameType,
+			Length:       length,
+			MaxFrameSize: maxFrameSize,
+		}
+	}
+	var wireBytes, payload []byte
+	switch {
+	case r.keepWireBytes:
+		wireBytes = make([]byte, 9+length)
+		copy(wireBytes, r.header[:])
+		payload = wireBytes[9:]
+	case frameType == DATA_TYPE:
+		payload = make([]byte, length)
+	default:
+		if uint32(cap(r.payload)) < length {
+			r.payload = make([]byte, length)
+		}
+		payload = r.payload[:length]
+	}
+	_, err = io.ReadFull(r.in, payload)
+	if err != nil {
+		return nil, err
+	}
+	decodeFunc := FindDecoder(frameType)
+	if decodeFunc == nil {
+		frame := NewRawFrame(frameType, flags, streamId, append([]byte(nil), payload...)) // not referencing the re-used buffer
+		frame.setWireBytes(wireBytes)
+		return nil, &UnknownFrameTypeError{FrameType: frameType, Frame: frame}
+	}
+	frame, err := decodeFunc(flags, streamId, payload, r.context)
+	if err != nil {
+		return nil, err
+	}
+	if r.keepWireBytes {
+		frame.setWireBytes(wireBytes)
+	} else {
+		// The header block references the re-used buffer.
+		switch f := frame.(type) {
+		case *HeadersFrame:
+			f.HeaderBlock = nil
+		case *PushPromiseFrame:
+			f.HeaderBlock = nil
+		}
+	}
+	return frame, nil
+}
@@ -0,0 +1,116 @@
+package frames
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWriteAndReadFrames(t *testing.T) {
+	for _, keepWireBytes := range []bool{false, true} {
+		testWriteAndReadFrames(t, keepWireBytes)
+	}
+}
+
+func testWriteAndReadFrames(t *testing.T, keepWireBytes bool) {
+	var buf bytes.Buffer
+	writer := NewWriter(&buf, NewEncodingContext())
+	writer.SetKeepWireBytes(keepWireBytes)
+	written := []Frame{
+		makeExampleFrame(),
+		NewDataFrame(31, []byte("first"), false),
+		NewDataFrame(31, []byte("second"), true),
+		NewRstStreamFrame(31, CANCEL),
+		NewPingFrame(0, 42, true),
+		NewWindowUpdateFrame(0, 1024),
+	}
+	for _, frame := range written {
+		if err := writer.WriteFrame(frame); err != nil {
+			t.Fatal("Write error:", err.Error())
+		}
+	}
+	if buf.Len() != 0 {
+		t.Error("Frames were written before Flush() was called.")
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal("Flush error:", err.Error())
+	}
+	reader := NewReader(&buf, NewDecodingContext())
+	reader.SetKeepWireBytes(keepWireBytes)
+	for _, expected := range written {
+		frame, err := reader.ReadNextFrame()
+		if err != nil {
+			t.Fatal("Read error:", err.Error())
+		}
+		var wireBytes []byte
+		if keepWireBytes {
+			wireBytes, _ = expected.Encode(NewEncodingContext())
+			if expected.Type() != DATA_TYPE {
+				wireBytes = expected.WireBytes() // the Writer keeps the encoded bytes, except for DATA frames
+			}
+		}
+		if !bytes.Equal(frame.WireBytes(), wireBytes) {
+			t.Errorf("Expected %v frame with wire bytes %x, but got %x.", expected.Type(), wireBytes, frame.WireBytes())
+		}
+		expected.setWireBytes(frame.WireBytes())
+		if !reflect.DeepEqual(expected, frame) {
+			t.Errorf("Expected %v frame %v, but got %v.", expected.Type(), expected, frame)
+		}
+	}
+}
+
+func TestDataFramePayloadNotReused(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewWriter(&buf, NewEncodingContext())
+	writer.WriteFrame(NewDataFrame(1, []byte("first"), false))
+	writer.WriteFrame(NewDataFrame(1, []byte("other"), true))
+	writer.Flush()
+	reader := NewReader(&buf, NewDecodingContext())
+	first, _ := reader.ReadNextFrame()
+	reader.ReadNextFrame()
+	if string(first.(*DataFrame).Data) != "first" {
+		t.Errorf("Payload of first DATA frame was overwritten: %q", first.(*DataFrame).Data)
+	}
+}
+
+func TestFrameSizeError(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewWriter(&buf, NewEncodingContext())
+	writer.WriteFrame(NewDataFrame(1, make([]byte, DEFAULT_MAX_FRAME_SIZE+1), true))
+	writer.Flush()
+	_, err := NewReader(bytes.NewReader(buf.Bytes()), NewDecodingContext()).ReadNextFrame()
+	frameSizeError, ok := err.(*FrameSizeError)
+	if !ok {
+		t.Fatalf("Expected FrameSizeError, but got %v.", err)
+	}
+	if frameSizeError.ErrorCode() != FRAME_SIZE_ERROR {
+		t.Errorf("Expected %v, but got %v.", FRAME_SIZE_ERROR, frameSizeError.ErrorCode())
+	}
+	reader := NewReader(bytes.NewReader(buf.Bytes()), NewDecodingContext())
+	reader.SetMaxFrameSize(DEFAULT_MAX_FRAME_SIZE + 1)
+	if _, err = reader.ReadNextFrame(); err != nil {
+		t.Errorf("Unexpected error after increasing max frame size: %v", err.Error())
+	}
+}
+
+func TestUnknownFrameType(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewWriter(&buf, NewEncodingContext())
+	writer.WriteFrame(NewRawFrame(Type(0xbe), 0x01, 3, []byte("unknown")))
+	writer.WriteFrame(NewPingFrame(0, 42, false))
+	writer.Flush()
+	encoded := append([]byte{}, buf.Bytes()[:9+len("unknown")]...)
+	reader := NewReader(&buf, NewDecodingContext())
+	_, err := reader.ReadNextFrame()
+	unknownFrameType, ok := err.(*UnknownFrameTypeError)
+	if !ok {
+		t.Fatalf("Expected UnknownFrameTypeError, but got %v.", err)
+	}
+	if frame, err := reader.ReadNextFrame(); err != nil || frame.Type() != PING_TYPE {
+		t.Errorf("Expected PING frame after the unknown frame, but got %v, %v.", frame, err)
+	}
+	// The PING frame was read into the same buffer, which must not affect the unknown frame.
+	if reencoded, _ := unknownFrameType.Frame.Encode(NewEncodingContext()); !bytes.Equal(reencoded, encoded) {
+		t.Errorf("Expected the unknown frame to be encoded as %x, but got %x.", encoded, reencoded)
+	}
+}
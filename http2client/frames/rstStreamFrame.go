@@ -6,6 +6,7 @@ import (
 )
 
 type RstStreamFrame struct {
+	wire
 	StreamId  uint32
 	ErrorCode ErrorCode
 }
@@ -29,9 +30,9 @@ func (f *RstStreamFrame) Type() Type {
 }
 
 func (f *RstStreamFrame) Encode(context *EncodingContext) ([]byte, error) {
-	result := make([]byte, 4)
-	binary.BigEndian.PutUint32(result, uint32(f.ErrorCode))
-	return result, nil
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(f.ErrorCode))
+	return encodeFrame(f.Type(), f.StreamId, nil, payload), nil
 }
 
 func (f *RstStreamFrame) GetStreamId() uint32 {
@@ -1,10 +1,10 @@
 package frames
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"os"
+	"sort"
 )
 
 type Setting uint16
@@ -40,7 +40,7 @@ func (s Setting) String() string {
 	case SETTINGS_UNKNOWN:
 		return "SETTINGS_UNKNOWN"
 	default:
-		fmt.Fprintf(os.Stderr, "ERROR: Unknown setting %v", s)
+		fmt.Fprintf(os.Stderr, "ERROR: Unknown setting %v", uint16(s))
 		//os.Exit(-1)
 		return ""
 	}
@@ -57,6 +57,7 @@ func (s Setting) Get(f *SettingsFrame) uint32 {
 }
 
 type SettingsFrame struct {
+	wire
 	StreamId uint32
 	Ack      bool
 	Settings map[Setting]uint32
@@ -98,6 +99,16 @@ func isUnknownSetting(setting Setting) bool {
 		setting != SETTINGS_UNKNOWN
 }
 
+// SortedSettings returns the settings ordered by their identifier, so that the frame is always encoded and shown the same way.
+func (f *SettingsFrame) SortedSettings() []Setting {
+	result := make([]Setting, 0, len(f.Settings))
+	for setting := range f.Settings {
+		result = append(result, setting)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
 func (f *SettingsFrame) Type() Type {
 	return SETTINGS_TYPE
 }
@@ -111,18 +122,14 @@ func (f *SettingsFrame) flags() []Flag {
 }
 
 func (f *SettingsFrame) Encode(context *EncodingContext) ([]byte, error) {
-	var result bytes.Buffer
-	length := uint32(len(f.Settings) * 6)
-	result.Write(encodeHeader(f.Type(), f.StreamId, length, f.flags()))
-	for id, value := range f.Settings {
-		idBytes := make([]byte, 2)
-		binary.BigEndian.PutUint16(idBytes, uint16(id))
-		result.Write(idBytes)
-		valueBytes := make([]byte, 4)
-		binary.BigEndian.PutUint32(valueBytes, value)
-		result.Write(valueBytes)
+	payload := make([]byte, 6*len(f.Settings))
+	i := 0
+	for _, id := range f.SortedSettings() {
+		binary.BigEndian.PutUint16(payload[i:i+2], uint16(id))
+		binary.BigEndian.PutUint32(payload[i+2:i+6], f.Settings[id])
+		i += 6
 	}
-	return result.Bytes(), nil
+	return encodeFrame(f.Type(), f.StreamId, f.flags(), payload), nil
 }
 
 func (f *SettingsFrame) GetStreamId() uint32 {
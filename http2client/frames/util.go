@@ -30,3 +30,31 @@ func AllFrameTypes() []Type {
 		// TODO: CONTINUATION
 	}
 }
+
+// FlagNameToFlag returns the flag with the given name, like "END_STREAM", if it is defined for the frame type.
+func FlagNameToFlag(frameType Type, name string) (Flag, bool) {
+	flags := map[Type]map[string]Flag{
+		DATA_TYPE: {
+			"END_STREAM": DATA_FLAG_END_STREAM,
+			"PADDED":     DATA_FLAG_PADDED,
+		},
+		HEADERS_TYPE: {
+			"END_STREAM":  HEADERS_FLAG_END_STREAM,
+			"END_HEADERS": HEADERS_FLAG_END_HEADERS,
+			"PADDED":      HEADERS_FLAG_PADDED,
+			"PRIORITY":    HEADERS_FLAG_PRIORITY,
+		},
+		SETTINGS_TYPE: {
+			"ACK": SETTINGS_FLAG_ACK,
+		},
+		PUSH_PROMISE_TYPE: {
+			"END_HEADERS": PUSH_PROMISE_FLAG_END_HEADERS,
+			"PADDED":      PUSH_PROMISE_FLAG_PADDED,
+		},
+		PING_TYPE: {
+			"ACK": ACK,
+		},
+	}[frameType]
+	flag, ok := flags[name]
+	return flag, ok
+}
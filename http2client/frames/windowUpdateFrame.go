@@ -1,12 +1,12 @@
 package frames
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 )
 
 type WindowUpdateFrame struct {
+	wire
 	StreamId            uint32
 	WindowSizeIncrement uint32
 }
@@ -33,10 +33,7 @@ func (f *WindowUpdateFrame) Encode(context *EncodingContext) ([]byte, error) {
 	payload := make([]byte, 4)
 	binary.BigEndian.PutUint32(payload, uint32(f.WindowSizeIncrement))
 
-	var result bytes.Buffer
-	result.Write(encodeHeader(f.Type(), f.StreamId, uint32(len(payload)), []Flag{}))
-	result.Write(payload)
-	return result.Bytes(), nil
+	return encodeFrame(f.Type(), f.StreamId, nil, payload), nil
 }
 
 func (f *WindowUpdateFrame) GetStreamId() uint32 {
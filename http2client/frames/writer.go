@@ -0,0 +1,67 @@
+package frames
+
+import (
+	"bufio"
+	"io"
+)
+
+// Writer encodes frames and writes them to a buffered output stream.
+//
+// Frames are not sent until Flush() is called, so multiple frames can be sent with a single write to the socket.
+// DATA frames are written without copying the payload into an intermediate buffer.
+// If SetKeepWireBytes(true) was called, other frames keep the encoded bytes as their WireBytes(),
+// and HEADERS and PUSH_PROMISE frames keep their HeaderBlock.
+type Writer struct {
+	out           *bufio.Writer
+	context       *EncodingContext
+	header        []byte
+	keepWireBytes bool
+}
+
+func NewWriter(out io.Writer, context *EncodingContext) *Writer {
+	return &Writer{
+		out:     bufio.NewWriterSize(out, int(DEFAULT_MAX_FRAME_SIZE)+9),
+		context: context,
+		header:  make([]byte, 0, 9),
+	}
+}
+
+// SetKeepWireBytes must be called before the first frame is written.
+// This is needed for dumping the frames as they were sent.
+func (w *Writer) SetKeepWireBytes(keep bool) {
+	w.keepWireBytes = keep
+}
+
+func (w *Writer) WriteFrame(frame Frame) error {
+	if f, ok := frame.(*DataFrame); ok {
+		if w.keepWireBytes {
+			f.setWireBytes(nil) // a DATA frame read by a Reader may have had padding, which is not written.
+		}
+		w.header = appendHeader(w.header[:0], f.Type(), f.StreamId, uint32(len(f.Data)), f.flags())
+		_, err := w.out.Write(w.header)
+		if err != nil {
+			return err
+		}
+		_, err = w.out.Write(f.Data)
+		return err
+	}
+	encodedFrame, err := frame.Encode(w.context)
+	if err != nil {
+		return err
+	}
+	if w.keepWireBytes {
+		frame.setWireBytes(encodedFrame)
+		switch f := frame.(type) {
+		case *HeadersFrame:
+			f.HeaderBlock = encodedFrame[9:] // Encode() never adds padding or priority
+		case *PushPromiseFrame:
+			f.HeaderBlock = encodedFrame[13:] // frame header and promised stream id
+		}
+	}
+	_, err = w.out.Write(encodedFrame)
+	return err
+}
+
+func (w *Writer) Flush() error {
+	return w.out.Flush()
+}
@@ -0,0 +1,225 @@
+package http2client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fstab/h2c/http2client/history"
+	"github.com/fstab/h2c/http2client/internal/util"
+	"golang.org/x/net/http2/hpack"
+)
+
+// HAR 1.2, see http://www.softwareishard.com/blog/har-12-spec/
+type har struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Connection      string      `json:"connection"`
+	WasPushed       int         `json:"_was_pushed,omitempty"` // custom field, same name as in Chrome's HAR export
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	Url         string         `json:"url"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HttpVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HarExport returns the request/response history of all connections as a HAR 1.2 document.
+func (h2c *Http2Client) HarExport() (string, error) {
+	h2c.historyMutex.Lock()
+	histories := make([]*history.History, len(h2c.histories))
+	copy(histories, h2c.histories)
+	h2c.historyMutex.Unlock()
+	result := &har{
+		Log: harLog{
+			Version: "1.2",
+			Creator: harCreator{Name: "h2c", Version: VERSION},
+			Entries: make([]harEntry, 0),
+		},
+	}
+	type startedEntry struct {
+		started time.Time
+		entry   harEntry
+	}
+	all := make([]startedEntry, 0)
+	for _, h := range histories {
+		for _, entry := range h.Entries() {
+			all = append(all, startedEntry{entry.Started, makeHarEntry(h.ConnectionId, entry)})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].started.Before(all[j].started)
+	})
+	for _, e := range all {
+		result.Log.Entries = append(result.Log.Entries, e.entry)
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("Failed to create HAR document: %v", err.Error())
+	}
+	return string(data), nil
+}
+
+func makeHarEntry(connectionId uint64, entry *history.Entry) harEntry {
+	url := &neturl.URL{
+		Scheme: util.FindHeader(":scheme", entry.RequestHeaders),
+		Host:   util.FindHeader(":authority", entry.RequestHeaders),
+	}
+	if parsed, err := neturl.ParseRequestURI(util.FindHeader(":path", entry.RequestHeaders)); err == nil {
+		url.Path = parsed.Path
+		url.RawQuery = parsed.RawQuery
+	}
+	status, _ := strconv.Atoi(util.FindHeader(":status", entry.ResponseHeaders))
+	timings := harTimings{
+		Send:    milliseconds(entry.Started, entry.RequestSent),
+		Wait:    milliseconds(entry.RequestSent, entry.ResponseStarted),
+		Receive: milliseconds(entry.ResponseStarted, entry.Completed),
+	}
+	result := harEntry{
+		StartedDateTime: entry.Started.Format(time.RFC3339Nano),
+		Time:            timings.Send + timings.Wait + timings.Receive,
+		Request: harRequest{
+			Method:      util.FindHeader(":method", entry.RequestHeaders),
+			Url:         url.String(),
+			HttpVersion: "HTTP/2.0",
+			Cookies:     make([]harNameValue, 0),
+			Headers:     harHeaders(entry.RequestHeaders),
+			QueryString: harQueryString(url),
+			HeadersSize: -1,
+			BodySize:    len(entry.RequestBody),
+		},
+		Response: harResponse{
+			Status:      status,
+			StatusText:  http.StatusText(status),
+			HttpVersion: "HTTP/2.0",
+			Cookies:     make([]harNameValue, 0),
+			Headers:     append(harHeaders(entry.ResponseHeaders), harHeaders(entry.ResponseTrailers)...), // HAR has no separate field for trailers.
+			Content:     harResponseContent(entry),
+			RedirectURL: util.FindHeader("location", entry.ResponseHeaders),
+			HeadersSize: -1,
+			BodySize:    len(entry.ResponseBody),
+		},
+		Timings:    timings,
+		Connection: strconv.FormatUint(connectionId, 10),
+	}
+	if len(entry.RequestBody) > 0 {
+		result.Request.PostData = &harPostData{
+			MimeType: util.FindHeader("content-type", entry.RequestHeaders),
+			Text:     string(entry.RequestBody),
+		}
+	}
+	if entry.Pushed {
+		result.WasPushed = 1
+	}
+	return result
+}
+
+// Binary content is base64 encoded.
+func harResponseContent(entry *history.Entry) harContent {
+	result := harContent{
+		Size:     len(entry.ResponseBody),
+		MimeType: util.FindHeader("content-type", entry.ResponseHeaders),
+	}
+	if utf8.Valid(entry.ResponseBody) {
+		result.Text = string(entry.ResponseBody)
+	} else {
+		result.Text = base64.StdEncoding.EncodeToString(entry.ResponseBody)
+		result.Encoding = "base64"
+	}
+	return result
+}
+
+func harHeaders(headers []hpack.HeaderField) []harNameValue {
+	result := make([]harNameValue, 0, len(headers))
+	for _, header := range headers {
+		result = append(result, harNameValue{Name: header.Name, Value: header.Value})
+	}
+	return result
+}
+
+func harQueryString(url *neturl.URL) []harNameValue {
+	result := make([]harNameValue, 0)
+	for name, values := range url.Query() {
+		for _, value := range values {
+			result = append(result, harNameValue{Name: name, Value: value})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Time between from and to in milliseconds. HAR does not allow -1 for send, wait, and receive, so unknown is 0.
+func milliseconds(from time.Time, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return 0
+	}
+	return float64(to.Sub(from)) / float64(time.Millisecond)
+}
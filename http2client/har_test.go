@@ -0,0 +1,53 @@
+package http2client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fstab/h2c/http2client/history"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestMakeHarEntry(t *testing.T) {
+	started := time.Now()
+	entry := makeHarEntry(3, &history.Entry{
+		StreamId: 2,
+		Pushed:   true,
+		RequestHeaders: []hpack.HeaderField{
+			{Name: ":method", Value: "GET"},
+			{Name: ":scheme", Value: "https"},
+			{Name: ":authority", Value: "localhost:8443"},
+			{Name: ":path", Value: "/img/logo.png?v=2"},
+		},
+		ResponseHeaders: []hpack.HeaderField{
+			{Name: ":status", Value: "200"},
+			{Name: "content-type", Value: "image/png"},
+		},
+		ResponseBody:    []byte{0x89, 'P', 'N', 'G'},
+		Started:         started,
+		RequestSent:     started,
+		ResponseStarted: started.Add(2 * time.Millisecond),
+		Completed:       started.Add(5 * time.Millisecond),
+	})
+	if entry.Request.Url != "https://localhost:8443/img/logo.png?v=2" {
+		t.Errorf("Unexpected URL %v", entry.Request.Url)
+	}
+	if len(entry.Request.QueryString) != 1 || entry.Request.QueryString[0].Name != "v" || entry.Request.QueryString[0].Value != "2" {
+		t.Errorf("Unexpected query string %v", entry.Request.QueryString)
+	}
+	if entry.WasPushed != 1 {
+		t.Errorf("Pushed response not marked as pushed.")
+	}
+	if entry.Connection != "3" {
+		t.Errorf("Unexpected connection %v", entry.Connection)
+	}
+	if entry.Response.Status != 200 || entry.Response.StatusText != "OK" {
+		t.Errorf("Unexpected status %v %v", entry.Response.Status, entry.Response.StatusText)
+	}
+	if entry.Response.Content.Encoding != "base64" || entry.Response.Content.Text != "iVBORw==" {
+		t.Errorf("Binary content should be base64 encoded, but got %v %v", entry.Response.Content.Encoding, entry.Response.Content.Text)
+	}
+	if entry.Timings.Send != 0 || entry.Timings.Wait != 2 || entry.Timings.Receive != 3 || entry.Time != 5 {
+		t.Errorf("Unexpected timings %+v, time %v", entry.Timings, entry.Time)
+	}
+}
@@ -0,0 +1,69 @@
+// Package history records the request/response exchanges completed on a connection.
+package history
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// If a connection has more entries, the oldest entries are dropped.
+const MAX_ENTRIES_PER_CONNECTION = 1000
+
+// Entry is a completed request/response exchange.
+type Entry struct {
+	StreamId         uint32
+	Pushed           bool // The response was pushed by the server.
+	RequestHeaders   []hpack.HeaderField
+	RequestBody      []byte
+	ResponseHeaders  []hpack.HeaderField
+	ResponseTrailers []hpack.HeaderField // HEADERS received after the response headers.
+	ResponseBody     []byte
+	Started          time.Time // Stream created, i.e. request about to be sent or PUSH_PROMISE received.
+	RequestSent      time.Time // Request END_STREAM sent. For pushed responses, this is the same as Started.
+	ResponseStarted  time.Time // First response HEADERS received.
+	Completed        time.Time // Response END_STREAM received.
+}
+
+// History of a single connection. It is thread safe, because entries are added
+// in the event loop and read when the user runs a command.
+type History struct {
+	ConnectionId uint64
+	Host         string
+	Port         int
+	mutex        sync.Mutex
+	entries      []*Entry
+}
+
+func New(connectionId uint64, host string, port int) *History {
+	return &History{
+		ConnectionId: connectionId,
+		Host:         host,
+		Port:         port,
+		entries:      make([]*Entry, 0),
+	}
+}
+
+// Add is a no-op if the History is nil.
+func (h *History) Add(entry *Entry) {
+	if h == nil {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if len(h.entries) >= MAX_ENTRIES_PER_CONNECTION {
+		h.entries[0] = nil
+		h.entries = h.entries[1:]
+	}
+	h.entries = append(h.entries, entry)
+}
+
+// Entries returns a copy of the list of entries, in the order in which they were completed.
+func (h *History) Entries() []*Entry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	result := make([]*Entry, len(h.entries))
+	copy(result, h.entries)
+	return result
+}
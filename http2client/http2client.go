@@ -4,13 +4,20 @@ package http2client
 import (
 	"errors"
 	"fmt"
+	"net"
 	neturl "net/url"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/fstab/h2c/http2client/events"
+	"github.com/fstab/h2c/http2client/failure"
 	"github.com/fstab/h2c/http2client/frames"
+	"github.com/fstab/h2c/http2client/history"
+	"github.com/fstab/h2c/http2client/internal/connection"
 	"github.com/fstab/h2c/http2client/internal/eventloop"
 	"github.com/fstab/h2c/http2client/internal/eventloop/commands"
 	"github.com/fstab/h2c/http2client/internal/util"
@@ -18,36 +25,81 @@ import (
 )
 
 type Http2Client struct {
-	loop                 *eventloop.Loop
-	pingTask             util.RepeatedTask   // Set when PingRepeatedly is called.
-	customHeaders        []hpack.HeaderField // filled with 'h2c set'
-	err                  error               // if != nil, the Http2Client becomes unusable
-	incomingFrameFilters []func(frames.Frame) frames.Frame
-	outgoingFrameFilters []func(frames.Frame) frames.Frame
+	loop                  *eventloop.Loop
+	pingTask              util.RepeatedTask // Set when PingRepeatedly is called.
+	customHeaders         []*customHeader   // filled with 'h2c set'
+	err                   error             // if != nil, the Http2Client becomes unusable
+	incomingFrameFilters  []func(frames.Frame) []frames.Frame
+	outgoingFrameFilters  []func(frames.Frame) []frames.Frame
+	writtenFrameObservers []func(frames.Frame)
+	keepWireBytes         bool
+	events                *events.Bus
+	connection            atomic.Value // *ConnectionInfo, for frame filters running in other go routines
+	historyMutex          sync.Mutex
+	histories             []*history.History // one per connection, oldest first
+	requestLogMutex       sync.Mutex
+	requestLog            []*loggedRequest // requests sent with Get(), Put(), Post(), and Replay(), oldest first
+	nextRequestIndex      int
 }
 
 func New() *Http2Client {
 	return &Http2Client{
-		incomingFrameFilters: make([]func(frames.Frame) frames.Frame, 0),
-		outgoingFrameFilters: make([]func(frames.Frame) frames.Frame, 0),
+		incomingFrameFilters:  make([]func(frames.Frame) []frames.Frame, 0),
+		outgoingFrameFilters:  make([]func(frames.Frame) []frames.Frame, 0),
+		writtenFrameObservers: make([]func(frames.Frame), 0),
+		events:                events.NewBus(),
+		histories:             make([]*history.History, 0),
+		requestLog:            make([]*loggedRequest, 0),
+		nextRequestIndex:      1,
 	}
 }
 
-// The filter is called immediately after a frame is read from the server.
-// The filter can be used to inspect and modify the incoming frames.
+// Events are published for all connections created by this client.
+// Subscribers can use the bus to watch push promises, stream state changes, etc.
+func (h2c *Http2Client) Events() *events.Bus {
+	return h2c.events
+}
+
+// The filter is called immediately after a frame is read from the server, before the frame is processed.
+// The filter returns the frames to be processed instead: The frame itself, a modified frame,
+// an empty slice to drop the frame, or multiple frames to duplicate it. Use DelayFrame() to delay the frame.
 // WARNING: The filter will called in another go routine.
-func (h2c *Http2Client) AddFilterForIncomingFrames(filter func(frames.Frame) frames.Frame) {
+func (h2c *Http2Client) AddFilterForIncomingFrames(filter func(frames.Frame) []frames.Frame) {
 	h2c.incomingFrameFilters = append(h2c.incomingFrameFilters, filter)
 }
 
-// The filter is called immediately before a frame is sent to the server.
-// The filter can be used to inspect and modify the outgoing frames.
+// The filter is called immediately before a frame is encoded and sent to the server.
+// The filter returns the frames to be sent instead: The frame itself, a modified frame,
+// an empty slice to drop the frame, or multiple frames to duplicate it. Use DelayFrame() to delay the frame.
+// Filters are called in the order they were added, so a filter sees the frames returned by the previous filters.
 // WARNING: The filter will called in another go routine.
-func (h2c *Http2Client) AddFilterForOutgoingFrames(filter func(frames.Frame) frames.Frame) {
+func (h2c *Http2Client) AddFilterForOutgoingFrames(filter func(frames.Frame) []frames.Frame) {
 	h2c.outgoingFrameFilters = append(h2c.outgoingFrameFilters, filter)
 }
 
-func (h2c *Http2Client) Connect(scheme string, host string, port int) (string, error) {
+// DelayFrame may be returned by a frame filter to pass the frame on after the delay.
+// The following frames are not held back, so they may overtake the delayed frame.
+// The filters added after the delaying filter see the frame when the delay is over.
+func DelayFrame(frame frames.Frame, delay time.Duration) frames.Frame {
+	return connection.NewDelayedFrame(frame, delay)
+}
+
+// The observer is called immediately after a frame is encoded and written, i.e. after the outgoing filters.
+// If KeepWireBytes() was called, frame.WireBytes() returns the bytes as they are sent to the server, see frames.Writer.
+// WARNING: The observer will called in another go routine.
+func (h2c *Http2Client) AddObserverForWrittenFrames(observer func(frames.Frame)) {
+	h2c.writtenFrameObservers = append(h2c.writtenFrameObservers, observer)
+}
+
+// KeepWireBytes makes the frames of new connections keep the bytes on the wire, see frames.Frame.WireBytes().
+// This is needed for filters and observers that dump the frames as they were received or sent.
+// Without it, frames have no WireBytes() and no HeaderBlock, so that buffers can be re-used.
+func (h2c *Http2Client) KeepWireBytes() {
+	h2c.keepWireBytes = true
+}
+
+// Connect to the server. If pushPolicy is nil, all push promises are accepted.
+func (h2c *Http2Client) Connect(scheme string, host string, port int, pushPolicy *PushPolicy) (string, error) {
 	if h2c.err != nil {
 		return "", h2c.err
 	}
@@ -57,14 +109,49 @@ func (h2c *Http2Client) Connect(scheme string, host string, port int) (string, e
 	if h2c.loop != nil && !h2c.loop.IsTerminated() {
 		return "", fmt.Errorf("Already connected to %v:%v.", h2c.loop.Host, h2c.loop.Port)
 	}
-	loop, err := eventloop.Start(host, port, h2c.incomingFrameFilters, h2c.outgoingFrameFilters)
+	connectionId := h2c.ConnectionId() + 1
+	addr, _ := net.ResolveTCPAddr("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	h2c.connection.Store(&ConnectionInfo{
+		Id:   connectionId,
+		Host: host,
+		Port: port,
+		Addr: addr,
+	})
+	h := history.New(connectionId, host, port)
+	loop, err := eventloop.Start(host, port, h2c.incomingFrameFilters, h2c.outgoingFrameFilters, h2c.writtenFrameObservers, h2c.keepWireBytes, pushPolicy.newAcceptFunc(), h2c.events, h)
 	if err != nil {
 		return "", err
 	}
 	h2c.loop = loop
+	h2c.historyMutex.Lock()
+	h2c.histories = append(h2c.histories, h)
+	h2c.historyMutex.Unlock()
 	return "", nil
 }
 
+// ConnectionInfo identifies a connection.
+type ConnectionInfo struct {
+	Id   uint64 // The first connection has id 1, the next one has id 2, etc.
+	Host string
+	Port int
+	Addr *net.TCPAddr // The server address, resolved once when connecting. nil if host could not be resolved.
+}
+
+// Connection returns the current (or most recent) connection, or nil if the client never connected.
+// Frame filters may use this to tell which connection a frame belongs to.
+func (h2c *Http2Client) Connection() *ConnectionInfo {
+	info, _ := h2c.connection.Load().(*ConnectionInfo)
+	return info
+}
+
+// ConnectionId returns the id of the current connection, or 0 if the client never connected.
+func (h2c *Http2Client) ConnectionId() uint64 {
+	if info := h2c.Connection(); info != nil {
+		return info.Id
+	}
+	return 0
+}
+
 func (h2c *Http2Client) isConnected() bool {
 	return h2c.loop != nil && !h2c.loop.IsTerminated()
 }
@@ -72,31 +159,70 @@ func (h2c *Http2Client) isConnected() bool {
 func (h2c *Http2Client) Disconnect() (string, error) {
 	if h2c.isConnected() {
 		// TODO: Send goaway to server.
-		h2c.loop.Shutdown <- true
+		select {
+		case h2c.loop.Shutdown <- true:
+		case <-h2c.loop.Done:
+		}
 		h2c.loop = nil
 	}
 	return "", nil
 }
 
-func (h2c *Http2Client) Get(path string, includeHeaders bool, timeoutInSeconds int) (string, error) {
-	return h2c.putOrPostOrGet("GET", path, nil, includeHeaders, timeoutInSeconds)
+// Get sends a GET request. The headers are sent in addition to the headers defined with SetHeader().
+// If a header has the same name as a header defined with SetHeader(), it replaces that header for this request.
+func (h2c *Http2Client) Get(path string, headers []hpack.HeaderField, timeoutInSeconds int) (*Response, error) {
+	return h2c.putOrPostOrGet("GET", path, headers, nil, timeoutInSeconds)
 }
 
-func (h2c *Http2Client) Put(path string, data []byte, includeHeaders bool, timeoutInSeconds int) (string, error) {
-	return h2c.putOrPostOrGet("PUT", path, data, includeHeaders, timeoutInSeconds)
+func (h2c *Http2Client) Put(path string, headers []hpack.HeaderField, data []byte, timeoutInSeconds int) (*Response, error) {
+	return h2c.putOrPostOrGet("PUT", path, headers, data, timeoutInSeconds)
 }
 
-func (h2c *Http2Client) Post(path string, data []byte, includeHeaders bool, timeoutInSeconds int) (string, error) {
-	return h2c.putOrPostOrGet("POST", path, data, includeHeaders, timeoutInSeconds)
+func (h2c *Http2Client) Post(path string, headers []hpack.HeaderField, data []byte, timeoutInSeconds int) (*Response, error) {
+	return h2c.putOrPostOrGet("POST", path, headers, data, timeoutInSeconds)
 }
 
-func (h2c *Http2Client) putOrPostOrGet(method string, path string, data []byte, includeHeaders bool, timeoutInSeconds int) (string, error) {
+func (h2c *Http2Client) putOrPostOrGet(method string, path string, headers []hpack.HeaderField, data []byte, timeoutInSeconds int) (*Response, error) {
 	if h2c.err != nil {
-		return "", h2c.err
+		return nil, h2c.err
+	}
+	cmd, err := h2c.newHttpCommand(method, path, headers, data)
+	if err != nil {
+		return nil, err
+	}
+	err = h2c.executeHttpCommand(cmd, timeoutInSeconds)
+	if err != nil {
+		return nil, err
+	}
+	return newResponse(cmd), nil
+}
+
+// newHttpCommand creates the request with the headers defined with SetHeader(). If not connected, and the path is a full URL, it connects to the server.
+func (h2c *Http2Client) newHttpCommand(method string, path string, headers []hpack.HeaderField, data []byte) (*commands.HttpCommand, error) {
+	url, err := h2c.connectForUrl(path)
+	if err != nil {
+		return nil, err
 	}
+	cmd := commands.NewHttpCommand(method, url)
+	for _, header := range mergeHeaders(h2c.customHeadersFor(url), headers) {
+		if isRequestPseudoHeader(header.Name) {
+			cmd.Request.ReplaceHeader(header.Name, header.Value)
+		} else {
+			cmd.Request.AddHeader(header.Name, header.Value)
+		}
+	}
+	if data != nil {
+		cmd.Request.SetBody(data, true)
+	}
+	return cmd, nil
+}
+
+// connectForUrl completes the path with the current connection's scheme and authority.
+// If not connected, and the path is a full URL, it connects to the server.
+func (h2c *Http2Client) connectForUrl(path string) (*neturl.URL, error) {
 	url, err := h2c.completeUrlWithCurrentConnectionData(path)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if !h2c.isConnected() {
 		scheme := "http"
@@ -105,38 +231,48 @@ func (h2c *Http2Client) putOrPostOrGet(method string, path string, data []byte,
 		}
 		host, port := hostAndPort(url)
 		if host == "" {
-			return "", fmt.Errorf("Not connected. Run 'h2c connect' first.")
+			return nil, fmt.Errorf("Not connected. Run 'h2c connect' first.")
 		}
-		_, err := h2c.Connect(scheme, host, port)
+		_, err := h2c.Connect(scheme, host, port, nil)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 	if !h2c.urlMatchesCurrentConnection(url) {
-		return "", fmt.Errorf("Cannot query %v while connected to %v", url.Scheme+"://"+url.Host, "http://"+hostAndPortString(h2c.loop.Host, h2c.loop.Port))
-	}
-	cmd := commands.NewHttpCommand(method, url)
-	for _, header := range h2c.customHeaders {
-		cmd.Request.AddHeader(header.Name, header.Value)
-	}
-	if data != nil {
-		cmd.Request.SetBody(data, true)
+		return nil, fmt.Errorf("Cannot query %v while connected to %v", url.Scheme+"://"+url.Host, "http://"+hostAndPortString(h2c.loop.Host, h2c.loop.Port))
 	}
-	h2c.loop.HttpCommands <- cmd
-	err = cmd.AwaitCompletion(timeoutInSeconds)
+	return url, nil
+}
+
+// executeHttpCommand sends the request, waits for the response, and logs the request in the history.
+func (h2c *Http2Client) executeHttpCommand(cmd *commands.HttpCommand, timeoutInSeconds int) error {
+	err := h2c.submitHttpCommand(cmd)
 	if err != nil {
-		return "", err
+		return err
 	}
-	result := ""
-	if includeHeaders {
-		for _, header := range cmd.Response.GetHeaders() {
-			result = result + header.Name + ": " + header.Value + "\n"
-		}
-	}
-	if len(cmd.Response.GetBody()) > 0 {
-		result = result + string(cmd.Response.GetBody())
+	return h2c.awaitHttpCommand(cmd, timeoutInSeconds)
+}
+
+// submitHttpCommand passes the request to the event loop. It fails if the event loop is terminated, e.g. because the connection was closed.
+func (h2c *Http2Client) submitHttpCommand(cmd *commands.HttpCommand) error {
+	cmd.Timings.Enqueued = time.Now()
+	select {
+	case h2c.loop.HttpCommands <- cmd:
+		return nil
+	case <-h2c.loop.Done:
+		return connectionClosedError()
 	}
-	return result, nil
+}
+
+// connectionClosedError is returned when a command cannot be passed to the event loop, because the event loop is terminated.
+func connectionClosedError() error {
+	return failure.New(failure.CONNECTION_ERROR, "Connection closed.")
+}
+
+func (h2c *Http2Client) awaitHttpCommand(cmd *commands.HttpCommand, timeoutInSeconds int) error {
+	err := cmd.AwaitCompletion(timeoutInSeconds)
+	h2c.logRequest(cmd, time.Since(cmd.Timings.Enqueued), err)
+	return err
 }
 
 func (h2c *Http2Client) completeUrlWithCurrentConnectionData(path string) (*neturl.URL, error) {
@@ -145,7 +281,7 @@ func (h2c *Http2Client) completeUrlWithCurrentConnectionData(path string) (*netu
 	}
 	url, err := neturl.Parse(path)
 	if err != nil {
-		return nil, fmt.Errorf("%v: Invalid path.")
+		return nil, fmt.Errorf("%v: Invalid path.", path)
 	}
 	if !h2c.isConnected() {
 		return url, nil
@@ -186,62 +322,213 @@ func hostAndPortString(host string, port int) string {
 	return result
 }
 
-func (h2c *Http2Client) PushList() (string, error) {
+// PushPromise is a cached push promise, as returned by PushList().
+type PushPromise struct {
+	StreamId uint32 // the promised stream
+	Method   string
+	Url      string
+	Status   string // empty if the response HEADERS were not received yet
+	Size     int    // number of body bytes received so far
+	Age      time.Duration
+	Headers  []hpack.HeaderField // request headers without pseudo-headers
+}
+
+// PushPromiseList is the result of PushList().
+type PushPromiseList []PushPromise
+
+// PushList returns the push promises that were received but not yet used by a GET request.
+func (h2c *Http2Client) PushList() (PushPromiseList, error) {
 	if h2c.err != nil {
-		return "", h2c.err
+		return nil, h2c.err
 	}
 	if !h2c.isConnected() {
-		return "", fmt.Errorf("Not connected.")
+		return nil, fmt.Errorf("Not connected.")
 	}
 	cmd := commands.NewMonitoringCommand()
-	h2c.loop.MonitoringCommands <- cmd
+	select {
+	case h2c.loop.MonitoringCommands <- cmd:
+	case <-h2c.loop.Done:
+		return nil, connectionClosedError()
+	}
 	err := cmd.AwaitCompletion(10)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	result := ""
+	result := make(PushPromiseList, 0)
 	for _, info := range cmd.Result.StreamInfo {
+		if !info.IsCachedPushPromise {
+			continue
+		}
+		pushPromise := PushPromise{
+			StreamId: info.StreamId,
+			Method:   info.HttpMethod,
+			Url:      pushedUrl(info),
+			Status:   info.ResponseStatus,
+			Size:     info.ResponseSize,
+			Age:      info.PushPromiseAge,
+			Headers:  make([]hpack.HeaderField, 0),
+		}
+		for _, header := range info.RequestHeaders {
+			if !strings.HasPrefix(header.Name, ":") {
+				pushPromise.Headers = append(pushPromise.Headers, header)
+			}
+		}
+		result = append(result, pushPromise)
+	}
+	return result, nil
+}
+
+// String has one line per push promise, followed by the request headers, like
+// "2: GET https://localhost:8443/style.css (status: 200, size: 1024 bytes, age: 3.2s)"
+func (list PushPromiseList) String() string {
+	result := ""
+	for _, pushPromise := range list {
 		if result != "" {
 			result = result + "\n"
 		}
-		if info.IsCachedPushPromise {
-			result = result + info.Path
+		status := pushPromise.Status
+		if status == "" {
+			status = "pending"
+		}
+		result = result + fmt.Sprintf("%v: %v %v (status: %v, size: %v bytes, age: %v)", pushPromise.StreamId, pushPromise.Method, pushPromise.Url, status, pushPromise.Size, pushPromise.Age.Truncate(time.Millisecond))
+		for _, header := range pushPromise.Headers {
+			result = result + "\n    " + header.Name + ": " + header.Value
 		}
 	}
-	return result, nil
+	return result
 }
 
-func (h2c *Http2Client) StreamInfo(includeClosedStreams bool) (string, error) {
+// Get the URL of a pushed request from the :scheme, :authority, and :path pseudo headers.
+func pushedUrl(info commands.StreamInfo) string {
+	return util.FindHeader(":scheme", info.RequestHeaders) + "://" + util.FindHeader(":authority", info.RequestHeaders) + util.FindHeader(":path", info.RequestHeaders)
+}
+
+// PushCancel sends RST_STREAM with error code CANCEL for cached push promises.
+// The push promise is identified by the promised stream id, or by the path or URL of the pushed request.
+func (h2c *Http2Client) PushCancel(pathOrStreamId string) (string, error) {
 	if h2c.err != nil {
 		return "", h2c.err
 	}
 	if !h2c.isConnected() {
 		return "", fmt.Errorf("Not connected.")
 	}
-	cmd := commands.NewMonitoringCommand()
-	h2c.loop.MonitoringCommands <- cmd
+	var cmd *commands.PushCancelCommand
+	if streamId, err := strconv.ParseUint(pathOrStreamId, 10, 32); err == nil {
+		cmd = commands.NewPushCancelCommandForStreamId(uint32(streamId))
+	} else {
+		url, err := h2c.completeUrlWithCurrentConnectionData(pathOrStreamId)
+		if err != nil {
+			return "", err
+		}
+		cmd = commands.NewPushCancelCommandForUrl(url)
+	}
+	select {
+	case h2c.loop.PushCancelCommands <- cmd:
+	case <-h2c.loop.Done:
+		return "", connectionClosedError()
+	}
 	err := cmd.AwaitCompletion(10)
 	if err != nil {
 		return "", err
 	}
-	result := ""
+	if len(cmd.CanceledStreamIds) == 0 {
+		return "", fmt.Errorf("%v: No such push promise. Run 'h2c push-list' to see the available push promises.", pathOrStreamId)
+	}
+	return "", nil
+}
+
+// StreamInfo describes a stream, as returned by StreamInfo().
+type StreamInfo struct {
+	StreamId                   uint32
+	Method                     string
+	Path                       string
+	State                      string
+	IsCachedPushPromise        bool
+	RemainingSendWindowSize    int64
+	RemainingReceiveWindowSize int64
+}
+
+// StreamList is the result of StreamInfo().
+type StreamList struct {
+	Streams                    []StreamInfo
+	RemainingSendWindowSize    int64 // connection flow-control window
+	RemainingReceiveWindowSize int64 // connection flow-control window
+}
+
+func (h2c *Http2Client) StreamInfo(includeClosedStreams bool) (*StreamList, error) {
+	if h2c.err != nil {
+		return nil, h2c.err
+	}
+	if !h2c.isConnected() {
+		return nil, fmt.Errorf("Not connected.")
+	}
+	cmd := commands.NewMonitoringCommand()
+	select {
+	case h2c.loop.MonitoringCommands <- cmd:
+	case <-h2c.loop.Done:
+		return nil, connectionClosedError()
+	}
+	err := cmd.AwaitCompletion(10)
+	if err != nil {
+		return nil, err
+	}
+	result := &StreamList{
+		Streams:                    make([]StreamInfo, 0, len(cmd.Result.StreamInfo)),
+		RemainingSendWindowSize:    cmd.Result.RemainingSendWindowSize,
+		RemainingReceiveWindowSize: cmd.Result.RemainingReceiveWindowSize,
+	}
 	for _, info := range cmd.Result.StreamInfo {
+		result.Streams = append(result.Streams, StreamInfo{
+			StreamId:                   info.StreamId,
+			Method:                     info.HttpMethod,
+			Path:                       info.Path,
+			State:                      info.State.String(),
+			IsCachedPushPromise:        info.IsCachedPushPromise,
+			RemainingSendWindowSize:    info.RemainingSendWindowSize,
+			RemainingReceiveWindowSize: info.RemainingReceiveWindowSize,
+		})
+	}
+	return result, nil
+}
+
+// String has one line per stream, like "1: GET /index.html closed"
+func (list *StreamList) String() string {
+	result := ""
+	for _, info := range list.Streams {
 		if result != "" {
 			result = result + "\n"
 		}
-		result = result + fmt.Sprintf("%v: %v %v %v", info.StreamId, info.HttpMethod, info.Path, info.State)
+		result = result + fmt.Sprintf("%v: %v %v %v", info.StreamId, info.Method, info.Path, info.State)
 		if info.IsCachedPushPromise {
 			result = result + " (cached push promise)"
 		}
 	}
-	return result, nil
+	return result
 }
 
-func (h2c *Http2Client) SetHeader(name, value string) (string, error) {
-	h2c.customHeaders = append(h2c.customHeaders, hpack.HeaderField{
-		Name:  normalizeHeaderName(name),
-		Value: value,
-	})
+// SetHeader defines a header to be sent with subsequent requests.
+// If origin is not empty, the header is only sent to that origin, like "https://example.com".
+// If pathPrefix is not empty, the header is only sent if the request path starts with pathPrefix.
+// The request pseudo-headers :method, :scheme, :authority, and :path may be set to override the default values.
+func (h2c *Http2Client) SetHeader(name, value, origin, pathPrefix string) (string, error) {
+	header := &customHeader{
+		field: hpack.HeaderField{
+			Name:  normalizeHeaderName(name),
+			Value: value,
+		},
+		pathPrefix: pathPrefix,
+	}
+	if strings.HasPrefix(header.field.Name, ":") && !isRequestPseudoHeader(header.field.Name) {
+		return "", fmt.Errorf("%v: Unknown pseudo-header. Supported pseudo-headers are %v.", name, strings.Join(requestPseudoHeaders, ", "))
+	}
+	if origin != "" {
+		url, err := parseOrigin(origin)
+		if err != nil {
+			return "", err
+		}
+		header.origin = url
+	}
+	h2c.customHeaders = append(h2c.customHeaders, header)
 	return "", nil
 }
 
@@ -253,7 +540,11 @@ func (h2c *Http2Client) PingOnce() (string, error) {
 		return "", fmt.Errorf("Not connected. Run 'h2c connect' first.")
 	}
 	pingCmd := commands.NewPingCommand()
-	h2c.loop.PingCommands <- pingCmd
+	select {
+	case h2c.loop.PingCommands <- pingCmd:
+	case <-h2c.loop.Done:
+		return "", connectionClosedError()
+	}
 	return "", pingCmd.AwaitCompletion(10) // TODO: Hard-coded timeout in seconds.
 }
 
@@ -284,6 +575,26 @@ func (h2c *Http2Client) StopPingRepeatedly() (string, error) {
 	return "", nil
 }
 
+// SendFrame writes the frame on the current connection as is, bypassing the stream state machine.
+// This is used to reproduce server bugs with frames that h2c would never send, see frames.RawFrame.
+// Frames received on streams opened with SendFrame are only visible in the frame dump, see AddFilterForIncomingFrames().
+// Use a *frames.HeadersFrame to send a header block encoded with the connection's HPACK context.
+func (h2c *Http2Client) SendFrame(frame frames.Frame) error {
+	if h2c.err != nil {
+		return h2c.err
+	}
+	if !h2c.isConnected() {
+		return fmt.Errorf("Not connected. Run 'h2c connect' first.")
+	}
+	cmd := commands.NewSendFrameCommand(frame)
+	select {
+	case h2c.loop.SendFrameCommands <- cmd:
+	case <-h2c.loop.Done:
+		return connectionClosedError()
+	}
+	return cmd.AwaitCompletion(10)
+}
+
 // "Content-Type:" -> "content-type"
 func normalizeHeaderName(name string) string {
 	for name[len(name)-1] == ':' {
@@ -293,21 +604,55 @@ func normalizeHeaderName(name string) string {
 	return strings.ToLower(name)
 }
 
-func (h2c *Http2Client) UnsetHeader(nameValue []string) (string, error) {
+// mergeHeaders layers the per-request headers over the headers defined with 'h2c set':
+// A custom header is dropped if a request header with the same name exists.
+func mergeHeaders(customHeaders []hpack.HeaderField, requestHeaders []hpack.HeaderField) []hpack.HeaderField {
+	result := make([]hpack.HeaderField, 0, len(customHeaders)+len(requestHeaders))
+	overridden := make(map[string]bool)
+	for _, header := range requestHeaders {
+		overridden[normalizeHeaderName(header.Name)] = true
+	}
+	for _, header := range customHeaders {
+		if !overridden[header.Name] {
+			result = append(result, header)
+		}
+	}
+	for _, header := range requestHeaders {
+		result = append(result, hpack.HeaderField{
+			Name:  normalizeHeaderName(header.Name),
+			Value: header.Value,
+		})
+	}
+	return result
+}
+
+// UnsetHeader removes headers defined with SetHeader(). Only headers with the same origin and pathPrefix are removed,
+// i.e. if origin and pathPrefix are empty, headers that are sent only to a specific origin or path are kept.
+func (h2c *Http2Client) UnsetHeader(nameValue []string, origin, pathPrefix string) (string, error) {
 	if len(nameValue) != 1 && len(nameValue) != 2 {
 		return "", errors.New("Syntax error.")
 	}
-	remainingHeaders := make([]hpack.HeaderField, 0, len(h2c.customHeaders))
-	matches := func(field hpack.HeaderField) bool {
+	var originUrl *neturl.URL
+	if origin != "" {
+		var err error
+		if originUrl, err = parseOrigin(origin); err != nil {
+			return "", err
+		}
+	}
+	remainingHeaders := make([]*customHeader, 0, len(h2c.customHeaders))
+	matches := func(header *customHeader) bool {
+		if !header.hasScope(originUrl, pathPrefix) {
+			return false
+		}
 		if len(nameValue) == 1 {
-			return field.Name == normalizeHeaderName(nameValue[0])
+			return header.field.Name == normalizeHeaderName(nameValue[0])
 		} else {
-			return field.Name == normalizeHeaderName(nameValue[0]) && field.Value == nameValue[1]
+			return header.field.Name == normalizeHeaderName(nameValue[0]) && header.field.Value == nameValue[1]
 		}
 	}
-	for _, field := range h2c.customHeaders {
-		if !matches(field) {
-			remainingHeaders = append(remainingHeaders, field)
+	for _, header := range h2c.customHeaders {
+		if !matches(header) {
+			remainingHeaders = append(remainingHeaders, header)
 		}
 	}
 	h2c.customHeaders = remainingHeaders
@@ -0,0 +1,135 @@
+package http2client
+
+import (
+	"net/http"
+	neturl "net/url"
+	"testing"
+	"time"
+
+	"github.com/fstab/h2c/http2client/failure"
+	"github.com/fstab/h2c/http2client/frames"
+	"github.com/fstab/h2c/http2client/internal/eventloop"
+	"github.com/fstab/h2c/http2client/internal/eventloop/commands"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestMergeHeaders(t *testing.T) {
+	customHeaders := []hpack.HeaderField{
+		{Name: "accept", Value: "application/json"},
+		{Name: "x-trace", Value: "1"},
+		{Name: "x-trace", Value: "2"},
+	}
+	requestHeaders := []hpack.HeaderField{
+		{Name: "X-Trace", Value: "3"},
+		{Name: "content-type", Value: "text/plain"},
+	}
+	merged := mergeHeaders(customHeaders, requestHeaders)
+	expected := []hpack.HeaderField{
+		{Name: "accept", Value: "application/json"},
+		{Name: "x-trace", Value: "3"},
+		{Name: "content-type", Value: "text/plain"},
+	}
+	if len(merged) != len(expected) {
+		t.Fatalf("Expected %v headers, but got %v", len(expected), merged)
+	}
+	for i := range expected {
+		if merged[i] != expected[i] {
+			t.Errorf("Expected header %v to be %v, but got %v", i, expected[i], merged[i])
+		}
+	}
+}
+
+func TestCustomHeaderScope(t *testing.T) {
+	origin, err := parseOrigin("https://API.example.com/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	header := &customHeader{
+		field:      hpack.HeaderField{Name: "authorization", Value: "Bearer abc"},
+		origin:     origin,
+		pathPrefix: "/v1/",
+	}
+	for url, expected := range map[string]bool{
+		"https://api.example.com/v1/items":     true,
+		"https://api.example.com:443/v1/items": true,
+		"https://api.example.com/v2/items":     false,
+		"http://api.example.com/v1/items":      false,
+		"https://api.example.com:8443/v1/":     false,
+		"https://www.example.com/v1/items":     false,
+	} {
+		parsed, _ := neturl.Parse(url)
+		if header.matches(parsed) != expected {
+			t.Errorf("Expected match for %v to be %v", url, expected)
+		}
+	}
+	if header.String() != "authorization: Bearer abc (origin https://api.example.com, path /v1/)" {
+		t.Errorf("Unexpected string representation %v", header.String())
+	}
+	if _, err = parseOrigin("https://example.com/path"); err == nil {
+		t.Errorf("Expected error for origin with path")
+	}
+}
+
+func TestUnsetHeaderScope(t *testing.T) {
+	h2c := New()
+	h2c.SetHeader("authorization", "global", "", "")
+	h2c.SetHeader("authorization", "api", "https://api.example.com", "")
+	h2c.SetHeader("authorization", "v1", "https://api.example.com", "/v1/")
+	if _, err := h2c.UnsetHeader([]string{"authorization"}, "https://API.example.com:443/", ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(h2c.customHeaders) != 2 || h2c.customHeaders[0].field.Value != "global" || h2c.customHeaders[1].field.Value != "v1" {
+		t.Errorf("Expected only the header for https://api.example.com without path to be removed, but got %v", h2c.ListHeaders())
+	}
+	if _, err := h2c.UnsetHeader([]string{"authorization"}, "", ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(h2c.customHeaders) != 1 || h2c.customHeaders[0].field.Value != "v1" {
+		t.Errorf("Expected only the header without scope to be removed, but got %v", h2c.ListHeaders())
+	}
+}
+
+func TestSubmitAfterEventLoopTerminated(t *testing.T) {
+	host, port := startTestServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	client := New()
+	if _, err := client.Connect("http", host, port, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	loop := client.loop
+	loop.Shutdown <- true
+	<-loop.Done
+	url, _ := neturl.Parse("http://" + hostAndPortString(host, port) + "/")
+	err := client.submitHttpCommand(commands.NewHttpCommand("GET", url))
+	if f := failure.Of(err); f == nil || f.Kind != failure.CONNECTION_ERROR {
+		t.Errorf("Expected connection error, but got %v", err)
+	}
+}
+
+// The commands must not block if the event loop terminates after isConnected() was checked.
+func TestCommandsAfterEventLoopTerminated(t *testing.T) {
+	for name, command := range map[string]func(client *Http2Client) error{
+		"PushList":   func(client *Http2Client) error { _, err := client.PushList(); return err },
+		"PushCancel": func(client *Http2Client) error { _, err := client.PushCancel("2"); return err },
+		"StreamInfo": func(client *Http2Client) error { _, err := client.StreamInfo(false); return err },
+		"PingOnce":   func(client *Http2Client) error { _, err := client.PingOnce(); return err },
+		"SendFrame":  func(client *Http2Client) error { return client.SendFrame(frames.NewPingFrame(0, 0, false)) },
+	} {
+		client := New()
+		loop := &eventloop.Loop{Done: make(chan bool)} // nil command channels, i.e. the event loop never takes the command
+		client.loop = loop
+		result := make(chan error, 1)
+		go func() {
+			result <- command(client)
+		}()
+		time.Sleep(10 * time.Millisecond)
+		close(loop.Done)
+		select {
+		case err := <-result:
+			if f := failure.Of(err); f == nil || f.Kind != failure.CONNECTION_ERROR {
+				t.Errorf("%v: Expected connection error, but got %v", name, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v: Blocked after the event loop terminated.", name)
+		}
+	}
+}
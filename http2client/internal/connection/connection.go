@@ -3,15 +3,21 @@ package connection
 import (
 	"errors"
 	"fmt"
+	"github.com/fstab/h2c/http2client/events"
+	"github.com/fstab/h2c/http2client/failure"
 	"github.com/fstab/h2c/http2client/frames"
+	"github.com/fstab/h2c/http2client/history"
 	"github.com/fstab/h2c/http2client/internal/eventloop/commands"
 	"github.com/fstab/h2c/http2client/internal/stream"
 	"github.com/fstab/h2c/http2client/internal/streamstate"
 	"github.com/fstab/h2c/http2client/internal/util"
 	"golang.org/x/net/http2/hpack"
-	"io"
+	"math"
 	"net"
-	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const CLIENT_PREFACE = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
@@ -22,27 +28,57 @@ type Connection interface {
 	ExecuteHttpCommand(cmd *commands.HttpCommand)
 	ExecuteMonitoringCommand(cmd *commands.MonitoringCommand)
 	ExecutePingCommand(cmd *commands.PingCommand)
+	ExecutePushCancelCommand(cmd *commands.PushCancelCommand)
+	ExecuteSendFrameCommand(cmd *commands.SendFrameCommand)
 	ReadNextFrame() (frames.Frame, error)
+	// Errors from the frame writer go routine. Must be passed to HandleWriteError() in the event loop.
+	WriteErrors() <-chan error
+	HandleWriteError(err error)
+	// Errors from ReadNextFrame(). Must be called in the event loop.
+	HandleReadError(err error)
+	// Incoming frames delayed by a filter, see NewDelayedFrame(). Must be passed to HandleIncomingFrame() in the event loop.
+	DelayedIncomingFrames() <-chan frames.Frame
 	Shutdown()
 	IsShutdown() bool
+	// Closed when the server's first SETTINGS frame is received. May be used in any go routine.
+	ServerSettingsReceived() <-chan bool
+	// The server's SETTINGS_MAX_CONCURRENT_STREAMS, or math.MaxUint32 if there is no limit. May be used in any go routine.
+	ServerMaxConcurrentStreams() uint32
 }
 
 type connection struct {
 	info                       *info
 	settings                   *settings
-	streams                    map[uint32]stream.Stream // StreamID -> *stream
-	promisedStreamCache        map[uint32]stream.Stream // StreamID -> *stream
+	streams                    map[uint32]stream.Stream      // StreamID -> *stream
+	promisedStreamCache        map[uint32]*cachedPushPromise // StreamID -> push promise
+	rawStreams                 map[uint32]bool               // streams opened with SendFrameCommand, not managed by the stream state machine
+	acceptPushPromise          func(requestHeaders []hpack.HeaderField) bool
+	events                     *events.Bus      // may be nil
+	history                    *history.History // may be nil
 	nextPingId                 uint64
-	pendingPingCommands        map[uint64]*commands.PingCommand
+	pendingPings               map[uint64]*pendingPing // PING payload -> ping
 	conn                       net.Conn
-	isShutdown                 bool
-	encodingContext            *frames.EncodingContext
-	decodingContext            *frames.DecodingContext
+	isShutdown                 atomic.Bool // read by the event loop and the frame writer go routine
+	scheduler                  *writeScheduler
+	writeErrors                chan error
+	done                       chan bool   // closed on Shutdown() to terminate the frame writer
+	closeAfterWrites           atomic.Bool // if true, the frame writer terminates when all scheduled frames are written, see closeAfterPendingWrites()
+	closeDone                  sync.Once
+	reader                     *frames.Reader // only used in ReadNextFrame()
+	pendingIncomingFrames      []frames.Frame // only used in ReadNextFrame(), frames returned by the incoming filters that were not read yet
+	delayedIncomingFrames      chan frames.Frame
+	writer                     *frames.Writer // only used in the frame writer go routine
 	remainingSendWindowSize    int64
 	remainingReceiveWindowSize int64
-	incomingFrameFilters       []func(frames.Frame) frames.Frame
-	outgoingFrameFilters       []func(frames.Frame) frames.Frame
-	err                        error // TODO: not used
+	incomingFrameFilters       []func(frames.Frame) []frames.Frame
+	outgoingFrameFilters       []func(frames.Frame) []frames.Frame
+	writtenFrameObservers      []func(frames.Frame) // called in the frame writer go routine after the frame is encoded
+	goAway                     *failure.Error       // set when the server sent GOAWAY. New requests fail with this error.
+	errMutex                   sync.Mutex
+	err                        error // if != nil, the connection failed and cannot be used anymore. Use error() and setError().
+	connectTimings             commands.ConnectTimings
+	serverSettingsReceived     chan bool     // closed when the server's first SETTINGS frame is received
+	serverMaxConcurrentStreams atomic.Uint32 // read by other go routines, see ServerMaxConcurrentStreams()
 }
 
 type info struct {
@@ -50,41 +86,63 @@ type info struct {
 	port int
 }
 
+type cachedPushPromise struct {
+	stream     stream.Stream
+	receivedAt time.Time
+}
+
+type pendingPing struct {
+	cmd    *commands.PingCommand
+	sentAt time.Time
+}
+
 type settings struct {
 	serverFrameSize                       uint32
 	initialSendWindowSizeForNewStreams    uint32
 	initialReceiveWindowSizeForNewStreams uint32
 }
 
-type writeFrameRequest struct {
-	frame frames.Frame
-	task  *util.AsyncTask
-}
-
-func Start(host string, port int, incomingFrameFilters []func(frames.Frame) frames.Frame, outgoingFrameFilters []func(frames.Frame) frames.Frame) (Connection, error) {
+// If keepWireBytes is true, the frames keep the bytes on the wire, see frames.Reader.SetKeepWireBytes().
+// acceptPushPromise is called for each PUSH_PROMISE received. If it returns false, the push promise is refused with REFUSED_STREAM.
+// Events like stream state changes are published on the eventBus, which may be nil.
+// Completed request/response exchanges are recorded in h, which may be nil.
+func Start(host string, port int, incomingFrameFilters []func(frames.Frame) []frames.Frame, outgoingFrameFilters []func(frames.Frame) []frames.Frame, writtenFrameObservers []func(frames.Frame), keepWireBytes bool, acceptPushPromise func(requestHeaders []hpack.HeaderField) bool, eventBus *events.Bus, h *history.History) (Connection, error) {
 	hostAndPort := fmt.Sprintf("%v:%v", host, port)
 	//supportedProtocols := []string{"h2", "h2-16"} // The netty server still uses h2-16, treat it as if it was h2.
-	conn, err := net.Dial("tcp", hostAndPort);
+	connectStarted := time.Now()
+	conn, err := net.Dial("tcp", hostAndPort)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to connect to %v: %v", hostAndPort, err.Error())
-	}
-    /*
-	if !util.SliceContainsString(supportedProtocols, conn.ConnectionState().NegotiatedProtocol) {
-		return nil, fmt.Errorf("Server does not support HTTP/2 protocol.")
+		return nil, failure.New(failure.CONNECT_ERROR, "Failed to connect to %v: %v", hostAndPort, err.Error())
 	}
-    */
+	connected := time.Now()
+	/*
+		if !util.SliceContainsString(supportedProtocols, conn.ConnectionState().NegotiatedProtocol) {
+			return nil, fmt.Errorf("Server does not support HTTP/2 protocol.")
+		}
+	*/
 	_, err = conn.Write([]byte(CLIENT_PREFACE))
 	if err != nil {
-		return nil, fmt.Errorf("Failed to write client preface to %v: %v", hostAndPort, err.Error())
+		return nil, failure.New(failure.CONNECT_ERROR, "Failed to write client preface to %v: %v", hostAndPort, err.Error())
+	}
+	c := newConnection(conn, host, port, incomingFrameFilters, outgoingFrameFilters, writtenFrameObservers, keepWireBytes, acceptPushPromise, eventBus, h)
+	c.connectTimings = commands.ConnectTimings{
+		Started:   connectStarted,
+		Connected: connected,
 	}
-	c := newConnection(conn, host, port, incomingFrameFilters, outgoingFrameFilters)
+	go c.runFrameWriter()
 	c.Write(frames.NewSettingsFrame(0, false))
 	return c, nil
 }
 
 func (conn *connection) ExecuteHttpCommand(cmd *commands.HttpCommand) {
+	cmd.Timings.Connect = conn.connectTimings
 	if conn.error() != nil {
 		cmd.CompleteWithError(conn.error())
+		return
+	}
+	if conn.goAway != nil {
+		cmd.CompleteWithError(conn.goAway)
+		return
 	}
 	switch cmd.Request.GetHeader(":method") {
 	case "GET":
@@ -101,7 +159,7 @@ func (conn *connection) ExecuteHttpCommand(cmd *commands.HttpCommand) {
 }
 
 func (conn *connection) executeGetCommand(cmd *commands.HttpCommand) {
-	stream := conn.findStreamCreatedWithPushPromise(cmd.Request.GetHeader(":path"))
+	stream := conn.findStreamCreatedWithPushPromise(cmd.Request.GetHeaders())
 	if stream != nil {
 		// Remove from cache -> Push Promises only used once
 		delete(conn.promisedStreamCache, stream.StreamId())
@@ -133,55 +191,117 @@ func (conn *connection) doRequest(cmd *commands.HttpCommand) {
 	}
 }
 
+// The body is passed to the stream as a single DATA frame.
+// The stream cuts it into pieces that fit the flow-control window and the server's MAX_FRAME_SIZE at send time.
 func (conn *connection) sendDataFrames(data []byte, stream stream.Stream) {
-	// chunkSize := uint32(len(data)) // use this to provoke GOAWAY frame with FRAME_SIZE_ERROR
-	chunkSize := conn.serverFrameSize() // TODO: Query chunk size with each iteration -> allow changes during loop
-	nChunksSent := uint32(0)
-	total := uint32(len(data))
-	for nChunksSent*chunkSize < total {
-		nextChunk := data[nChunksSent*chunkSize : min((nChunksSent+1)*chunkSize, total)]
-		nChunksSent = nChunksSent + 1
-		isLast := nChunksSent*chunkSize >= total
-		dataFrame := frames.NewDataFrame(stream.StreamId(), nextChunk, isLast)
-		stream.SendFrame(dataFrame)
-	}
-}
-
-func min(a, b uint32) uint32 {
-	if a < b {
-		return a
-	}
-	return b
+	stream.SendFrame(frames.NewDataFrame(stream.StreamId(), data, true))
 }
 
 func (c *connection) ExecuteMonitoringCommand(cmd *commands.MonitoringCommand) {
 	for _, s := range c.streams {
-		_, isCachedPushPromise := c.promisedStreamCache[s.StreamId()]
-		cmd.Result.AddStreamInfo(s.StreamId(), findHeader(":method", s.RequestHeaders()), findHeader(":path", s.RequestHeaders()), s.GetState(), isCachedPushPromise)
+		info := commands.StreamInfo{
+			StreamId:                   s.StreamId(),
+			HttpMethod:                 util.FindHeader(":method", s.RequestHeaders()),
+			Path:                       util.FindHeader(":path", s.RequestHeaders()),
+			State:                      s.GetState(),
+			RequestHeaders:             s.RequestHeaders(),
+			ResponseStatus:             util.FindHeader(":status", s.ResponseHeaders()),
+			ResponseSize:               len(s.ResponseBody()),
+			RemainingSendWindowSize:    s.RemainingSendWindowSize(),
+			RemainingReceiveWindowSize: s.RemainingReceiveWindowSize(),
+		}
+		if pushPromise, isCached := c.promisedStreamCache[s.StreamId()]; isCached {
+			info.IsCachedPushPromise = true
+			info.PushPromiseAge = time.Since(pushPromise.receivedAt)
+		}
+		cmd.Result.AddStreamInfo(info)
 	}
+	cmd.Result.RemainingSendWindowSize = c.remainingSendWindowSize
+	cmd.Result.RemainingReceiveWindowSize = c.remainingReceiveWindowSize
 	cmd.CompleteSuccessfully()
 }
 
-func (c *connection) findStreamCreatedWithPushPromise(path string) stream.Stream {
+// Find a cached push promise for the request. The push promise matches if the request has the same URL,
+// i.e. :scheme, :authority, and :path must be equal. If there are multiple matches, the oldest push promise is used.
+func (c *connection) findStreamCreatedWithPushPromise(requestHeaders []hpack.HeaderField) stream.Stream {
 	var result stream.Stream = nil
-	for _, stream := range c.promisedStreamCache {
-		if findHeader(":method", stream.RequestHeaders()) == "GET" &&
-			findHeader(":path", stream.RequestHeaders()) == path {
-			result = stream
+	for _, pushPromise := range c.promisedStreamCache {
+		s := pushPromise.stream
+		if util.FindHeader(":method", s.RequestHeaders()) == "GET" && sameUrl(s.RequestHeaders(), requestHeaders) {
+			if result == nil || s.StreamId() < result.StreamId() {
+				result = s
+			}
 		}
 	}
 	return result
 }
 
+func (c *connection) ExecutePushCancelCommand(cmd *commands.PushCancelCommand) {
+	for id, pushPromise := range c.promisedStreamCache {
+		if id == cmd.StreamId || (cmd.StreamId == 0 && sameUrl(pushPromise.stream.RequestHeaders(), cmd.RequestHeaders)) {
+			delete(c.promisedStreamCache, id)
+			// If the push promise is already completely received, the stream is closed and no RST_STREAM is sent.
+			pushPromise.stream.CloseWithError(frames.CANCEL, "Push promise canceled.")
+			cmd.CanceledStreamIds = append(cmd.CanceledStreamIds, id)
+		}
+	}
+	cmd.CompleteSuccessfully()
+}
+
+// sameUrl compares the :scheme, :authority, and :path pseudo headers of two requests.
+// Default ports are ignored, i.e. "localhost:443" is the same authority as "localhost" for https.
+func sameUrl(a, b []hpack.HeaderField) bool {
+	scheme := strings.ToLower(util.FindHeader(":scheme", a))
+	return scheme == strings.ToLower(util.FindHeader(":scheme", b)) &&
+		normalizeAuthority(scheme, util.FindHeader(":authority", a)) == normalizeAuthority(scheme, util.FindHeader(":authority", b)) &&
+		util.FindHeader(":path", a) == util.FindHeader(":path", b)
+}
+
+func normalizeAuthority(scheme, authority string) string {
+	authority = strings.ToLower(authority)
+	switch {
+	case scheme == "http" && strings.HasSuffix(authority, ":80"):
+		return strings.TrimSuffix(authority, ":80")
+	case scheme == "https" && strings.HasSuffix(authority, ":443"):
+		return strings.TrimSuffix(authority, ":443")
+	default:
+		return authority
+	}
+}
+
 func (c *connection) ExecutePingCommand(cmd *commands.PingCommand) {
+	if c.error() != nil {
+		cmd.CompleteWithError(c.error())
+		return
+	}
 	pingFrame := frames.NewPingFrame(0, c.nextPingId, false)
 	c.nextPingId = c.nextPingId + 1
-	c.pendingPingCommands[pingFrame.Payload] = cmd
+	c.pendingPings[pingFrame.Payload] = &pendingPing{
+		cmd:    cmd,
+		sentAt: time.Now(),
+	}
 	c.Write(pingFrame)
 }
 
-func newConnection(conn net.Conn, host string, port int, incomingFrameFilters []func(frames.Frame) frames.Frame, outgoingFrameFilters []func(frames.Frame) frames.Frame) *connection {
-	return &connection{
+// ExecuteSendFrameCommand writes the frame as is, bypassing the stream state machine.
+// If the frame is on a client stream that does not exist yet, the stream becomes a raw stream:
+// Frames received on raw streams are ignored, except for connection flow control. They are visible in the frame dump only.
+// New requests use stream ids above the raw streams.
+func (c *connection) ExecuteSendFrameCommand(cmd *commands.SendFrameCommand) {
+	if c.error() != nil {
+		cmd.CompleteWithError(c.error())
+		return
+	}
+	streamId := cmd.Frame.GetStreamId()
+	if _, exists := c.streams[streamId]; !exists && streamId%2 == 1 {
+		c.rawStreams[streamId] = true
+	}
+	c.Write(cmd.Frame)
+	cmd.CompleteSuccessfully()
+}
+
+func newConnection(conn net.Conn, host string, port int, incomingFrameFilters []func(frames.Frame) []frames.Frame, outgoingFrameFilters []func(frames.Frame) []frames.Frame, writtenFrameObservers []func(frames.Frame), keepWireBytes bool, acceptPushPromise func(requestHeaders []hpack.HeaderField) bool, eventBus *events.Bus, h *history.History) *connection {
+	c := &connection{
 		info: &info{
 			host: host,
 			port: port,
@@ -192,26 +312,42 @@ func newConnection(conn net.Conn, host string, port int, incomingFrameFilters []
 			initialReceiveWindowSizeForNewStreams: 2<<15 - 1,
 		},
 		streams:                    make(map[uint32]stream.Stream),
-		promisedStreamCache:        make(map[uint32]stream.Stream),
-		pendingPingCommands:        make(map[uint64]*commands.PingCommand),
-		isShutdown:                 false,
+		promisedStreamCache:        make(map[uint32]*cachedPushPromise),
+		rawStreams:                 make(map[uint32]bool),
+		acceptPushPromise:          acceptPushPromise,
+		events:                     eventBus,
+		history:                    h,
+		pendingPings:               make(map[uint64]*pendingPing),
 		conn:                       conn,
-		encodingContext:            frames.NewEncodingContext(),
-		decodingContext:            frames.NewDecodingContext(),
+		scheduler:                  newWriteScheduler(),
+		writeErrors:                make(chan error, 1),
+		delayedIncomingFrames:      make(chan frames.Frame),
+		done:                       make(chan bool),
+		reader:                     frames.NewReader(conn, frames.NewDecodingContext()),
+		writer:                     frames.NewWriter(conn, frames.NewEncodingContext()),
 		remainingSendWindowSize:    2<<15 - 1,
 		remainingReceiveWindowSize: 2<<15 - 1,
 		incomingFrameFilters:       incomingFrameFilters,
 		outgoingFrameFilters:       outgoingFrameFilters,
+		writtenFrameObservers:      writtenFrameObservers,
+		serverSettingsReceived:     make(chan bool),
 	}
+	c.serverMaxConcurrentStreams.Store(math.MaxUint32) // Initially, there is no limit.
+	c.reader.SetKeepWireBytes(keepWireBytes)
+	c.writer.SetKeepWireBytes(keepWireBytes)
+	return c
 }
 
 func (c *connection) Shutdown() {
-	c.isShutdown = true
+	c.isShutdown.Store(true)
+	c.closeDone.Do(func() {
+		close(c.done)
+	})
 	c.conn.Close()
 }
 
 func (c *connection) IsShutdown() bool {
-	return c.isShutdown
+	return c.isShutdown.Load()
 }
 
 func (c *connection) HandleIncomingFrame(frame frames.Frame) {
@@ -221,6 +357,37 @@ func (c *connection) HandleIncomingFrame(frame frames.Frame) {
 	} else {
 		c.handleFrameForStream(frame)
 	}
+	c.shutdownIfGoAwayCompleted()
+}
+
+// handleGoAwayFrame implements the graceful shutdown, see RFC 7540 section 6.8:
+// Streams initiated by h2c with an id above the last stream id were not processed by the server and fail.
+// Streams up to the last stream id may still complete. No new streams are opened,
+// and the connection is shut down as soon as the remaining streams are closed.
+// If the server sends another GOAWAY with a lower last stream id, more streams fail.
+func (c *connection) handleGoAwayFrame(frame *frames.GoAwayFrame) {
+	c.events.Publish(events.New(events.GOAWAY, 0, "last stream id %v, error code %v", frame.LastStreamId, frame.ErrorCode))
+	c.goAway = failure.NewWithErrorCode(failure.GOAWAY, frame.ErrorCode, "Server sent %v with error code %v, last stream id %v.", frame.Type(), frame.ErrorCode, frame.LastStreamId)
+	for id, s := range c.streams {
+		if id%2 == 1 && id > frame.LastStreamId {
+			s.AbortWithError(c.goAway)
+		}
+	}
+}
+
+// shutdownIfGoAwayCompleted shuts down the connection if the server sent GOAWAY and no stream is active anymore.
+// Pending pings fail, because the server will not respond after the connection is shut down.
+func (c *connection) shutdownIfGoAwayCompleted() {
+	if c.goAway == nil || c.IsShutdown() {
+		return
+	}
+	for _, s := range c.streams {
+		if !s.GetState().In(streamstate.IDLE, streamstate.CLOSED) {
+			return
+		}
+	}
+	c.failPendingCommands(c.goAway)
+	c.Shutdown()
 }
 
 func (c *connection) handleFrameForConnection(frame frames.Frame) {
@@ -229,10 +396,11 @@ func (c *connection) handleFrameForConnection(frame frames.Frame) {
 		c.handleSettingsFrame(frame)
 	case *frames.PingFrame:
 		if frame.Ack {
-			pendingPingCommand, exists := c.pendingPingCommands[frame.Payload]
+			ping, exists := c.pendingPings[frame.Payload]
 			if exists {
-				delete(c.pendingPingCommands, frame.Payload)
-				pendingPingCommand.CompleteSuccessfully()
+				delete(c.pendingPings, frame.Payload)
+				c.events.Publish(events.New(events.PING_RTT, 0, "%v", time.Since(ping.sentAt)))
+				ping.cmd.CompleteSuccessfully()
 			}
 		} else {
 			pingFrame := frames.NewPingFrame(0, frame.Payload, true)
@@ -241,22 +409,40 @@ func (c *connection) handleFrameForConnection(frame frames.Frame) {
 	case *frames.WindowUpdateFrame:
 		c.handleWindowUpdateFrame(frame)
 	case *frames.GoAwayFrame:
-		c.Shutdown()
+		c.handleGoAwayFrame(frame)
 	default:
 		msg := fmt.Sprintf("Received %v frame with stream identifier 0x00.", frame.Type())
 		c.connectionError(frames.PROTOCOL_ERROR, msg)
 	}
 }
 
+// connectionError sends GOAWAY, and all pending and subsequent commands fail with a PROTOCOL_ERROR failure.
+// The connection is shut down when the server closes it in response to the GOAWAY.
+// TODO: Send msg as additional debug data.
 func (c *connection) connectionError(errorCode frames.ErrorCode, msg string) {
-	// TODO:
-	//   * Find highest stream id that was successfully processed
-	//   * Send GO_AWAY frame with error code (maybe msg as additional debug data)
-	//   * Shut down connection
-	fmt.Fprintf(os.Stderr, "%v Should send GOAWAY frame with error code %v, but this is not implemented yet.\n", msg, errorCode)
+	if c.error() != nil {
+		return // GOAWAY already sent
+	}
+	c.Write(frames.NewGoAwayFrame(0, c.lastServerStreamId(), errorCode))
+	c.failPendingCommands(failure.NewWithErrorCode(failure.PROTOCOL_ERROR, errorCode, "%v", msg))
+}
+
+// The highest stream id initiated by the server, i.e. the last promised stream. 0 if there is none.
+func (c *connection) lastServerStreamId() uint32 {
+	result := uint32(0)
+	for id := range c.streams {
+		if id%2 == 0 && id > result {
+			result = id
+		}
+	}
+	return result
 }
 
 func (c *connection) handleFrameForStream(frame frames.Frame) {
+	if c.rawStreams[frame.GetStreamId()] {
+		c.handleFrameForRawStream(frame)
+		return
+	}
 	switch frame := frame.(type) {
 	case *frames.PushPromiseFrame:
 		c.handleIncomingPushPromiseFrame(frame)
@@ -269,6 +455,15 @@ func (c *connection) handleFrameForStream(frame frames.Frame) {
 	}
 }
 
+func (c *connection) handleFrameForRawStream(frame frames.Frame) {
+	switch frame := frame.(type) {
+	case *frames.DataFrame:
+		c.flowControlForIncomingDataFrame(frame)
+	case *frames.PushPromiseFrame:
+		c.rawStreams[frame.PromisedStreamId] = true
+	}
+}
+
 func (c *connection) handleIncomingDataFrame(frame *frames.DataFrame) {
 	c.flowControlForIncomingDataFrame(frame)
 	c.getOrCreateStream(frame.StreamId).ReceiveFrame(frame)
@@ -279,6 +474,7 @@ func (c *connection) handleIncomingRstStreamFrame(frame *frames.RstStreamFrame)
 	if stream.GetState().In(streamstate.IDLE) {
 		c.connectionError(frames.PROTOCOL_ERROR, fmt.Sprintf("Received %v for strem in IDLE state.", frame.Type()))
 	} else {
+		c.events.Publish(events.New(events.RST_STREAM, frame.StreamId, "error code %v", frame.ErrorCode))
 		stream.ReceiveFrame(frame)
 	}
 }
@@ -295,21 +491,21 @@ func (c *connection) handleIncomingPushPromiseFrame(frame *frames.PushPromiseFra
 	}
 	promisedStream := c.getOrCreateStream(frame.PromisedStreamId)
 	promisedStream.ReceiveFrame(frame)
-	method := findHeader(":method", frame.Headers)
+	method := util.FindHeader(":method", frame.Headers)
 	if method != "GET" {
 		promisedStream.CloseWithError(frames.REFUSED_STREAM, fmt.Sprintf("%v with method %v not supported.", frame.Type(), method))
 		return
 	}
-	c.promisedStreamCache[promisedStream.StreamId()] = promisedStream
-}
-
-func findHeader(name string, headers []hpack.HeaderField) string {
-	for _, header := range headers {
-		if header.Name == name {
-			return header.Value
-		}
+	if c.acceptPushPromise != nil && !c.acceptPushPromise(frame.Headers) {
+		c.events.Publish(events.New(events.PUSH_PROMISE, promisedStream.StreamId(), "%v %v (refused by push policy)", method, util.FindHeader(":path", frame.Headers)))
+		promisedStream.CloseWithError(frames.REFUSED_STREAM, fmt.Sprintf("%v for %v refused by push policy.", frame.Type(), util.FindHeader(":path", frame.Headers)))
+		return
+	}
+	c.events.Publish(events.New(events.PUSH_PROMISE, promisedStream.StreamId(), "%v %v://%v%v", method, util.FindHeader(":scheme", frame.Headers), util.FindHeader(":authority", frame.Headers), util.FindHeader(":path", frame.Headers)))
+	c.promisedStreamCache[promisedStream.StreamId()] = &cachedPushPromise{
+		stream:     promisedStream,
+		receivedAt: time.Now(),
 	}
-	return ""
 }
 
 // Just a quick implementation to make large downloads work.
@@ -338,13 +534,29 @@ func (c *connection) handleSettingsFrame(frame *frames.SettingsFrame) {
 		// TODO: See Section 6.9.2 in the spec.
 		c.settings.initialSendWindowSizeForNewStreams = frames.SETTINGS_INITIAL_WINDOW_SIZE.Get(frame)
 	}
+	if frames.SETTINGS_MAX_CONCURRENT_STREAMS.IsSet(frame) {
+		c.serverMaxConcurrentStreams.Store(frames.SETTINGS_MAX_CONCURRENT_STREAMS.Get(frame))
+	}
 	// TODO: Implement other settings, like HEADER_TABLE_SIZE.
 	// TODO: Send PROTOCOL_ERROR if ACK is set but length > 0
 	if !frame.Ack {
 		c.Write(frames.NewSettingsFrame(0, true))
+		select {
+		case <-c.serverSettingsReceived:
+		default:
+			close(c.serverSettingsReceived)
+		}
 	}
 }
 
+func (c *connection) ServerSettingsReceived() <-chan bool {
+	return c.serverSettingsReceived
+}
+
+func (c *connection) ServerMaxConcurrentStreams() uint32 {
+	return c.serverMaxConcurrentStreams.Load()
+}
+
 func (c *connection) handleWindowUpdateFrame(frame *frames.WindowUpdateFrame) {
 	c.increaseSendFlowControlWindow(int64(frame.WindowSizeIncrement))
 	for _, s := range c.streams {
@@ -352,8 +564,8 @@ func (c *connection) handleWindowUpdateFrame(frame *frames.WindowUpdateFrame) {
 	}
 }
 
-func (c *connection) RemainingSendFlowControlWindowIsEnough(nBytesToWrite int64) bool {
-	return c.remainingSendWindowSize > nBytesToWrite
+func (c *connection) RemainingSendFlowControlWindow() int64 {
+	return c.remainingSendWindowSize
 }
 
 func (c *connection) DecreaseSendFlowControlWindow(nBytesToWrite int64) {
@@ -364,27 +576,185 @@ func (c *connection) increaseSendFlowControlWindow(nBytes int64) {
 	c.remainingSendWindowSize += nBytes
 }
 
+// Write schedules the frame for sending and returns immediately.
+// The frame is encoded and written to the socket by the frame writer go routine.
 func (c *connection) Write(frame frames.Frame) {
-	encodedFrame, err := frame.Encode(c.encodingContext)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to encode frame: %v", err.Error())
-		os.Exit(-1)
+	if c.IsShutdown() {
+		return
+	}
+	c.scheduler.schedule(frame)
+}
+
+// WriteAndNotify is like Write, but onSent is called in the frame writer go routine when the frame is written and flushed.
+// onSent is not called if the frame is not sent, e.g. because the connection is shut down or an outgoing filter dropped the frame.
+func (c *connection) WriteAndNotify(frame frames.Frame, onSent func(sent time.Time)) {
+	if c.IsShutdown() {
+		return
 	}
-	if c.outgoingFrameFilters != nil {
-		for _, filter := range c.outgoingFrameFilters {
-			frame = filter(frame)
+	c.scheduler.scheduleAndNotify(frame, onSent)
+}
+
+// runFrameWriter takes the frames from the writeScheduler and writes them to the socket.
+// It runs in its own go routine, so a slow socket does not block the event loop.
+// The writer's HPACK encoding context is only used here, because the HPACK state must follow the order of frames on the wire.
+// All frames that are available are written in one batch, and the batch is flushed when the queue is empty.
+func (c *connection) runFrameWriter() {
+	for {
+		select {
+		case <-c.scheduler.frameAvailable:
+		case <-c.done:
+			return
+		}
+		// Read the flag before taking the frames, so that all frames scheduled before closeAfterPendingWrites() are written.
+		closeAfterWrites := c.closeAfterWrites.Load()
+		notifications := make([]func(sent time.Time), 0)
+		for {
+			frame, ok := c.scheduler.next()
+			if !ok {
+				break
+			}
+			onSent := c.scheduler.takeOnSent(frame)
+			written, err := c.writeFrame(frame, onSent)
+			if err != nil {
+				c.reportWriteError(err)
+				return
+			}
+			if onSent != nil && written {
+				notifications = append(notifications, onSent)
+			}
+		}
+		err := c.writer.Flush()
+		if err != nil {
+			c.reportWriteError(fmt.Errorf("Failed to write frames: %v", err.Error()))
+			return
+		}
+		sent := time.Now()
+		for _, onSent := range notifications {
+			onSent(sent)
+		}
+		if closeAfterWrites {
+			c.reportWriteError(fmt.Errorf("Connection closed after the last frame was sent."))
+			return
 		}
 	}
-	_, err = c.conn.Write(encodedFrame)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to write frame: %v", err.Error())
+}
+
+// closeAfterPendingWrites shuts down the connection as soon as the frames scheduled so far are written,
+// e.g. to make sure a GOAWAY frame reaches the server before the connection is closed.
+// The frame writer reports an error, so the shutdown happens in HandleWriteError(), which keeps the original connection error.
+func (c *connection) closeAfterPendingWrites() {
+	c.closeAfterWrites.Store(true)
+	c.scheduler.wakeUp()
+}
+
+func (c *connection) reportWriteError(err error) {
+	select {
+	case c.writeErrors <- err:
+	case <-c.done:
+	}
+}
+
+// The outgoing filters run before the frame is encoded, so they can change what is sent, see applyFilters().
+// The observers run after the frame is encoded, so they see the frame's WireBytes() if keepWireBytes is set.
+// The result is false if the filters dropped or delayed the frame. A delayed frame is scheduled again with onSent when the delay is over.
+func (c *connection) writeFrame(frame frames.Frame, onSent func(sent time.Time)) (bool, error) {
+	var filtered []frames.Frame
+	if f, ok := frame.(*filteredFrame); ok {
+		filtered = []frames.Frame{f.Frame}
+	} else {
+		filtered = applyFilters(c.outgoingFrameFilters, frame, func(delayed frames.Frame) {
+			if onSent != nil {
+				c.WriteAndNotify(&filteredFrame{delayed}, onSent)
+			} else {
+				c.Write(&filteredFrame{delayed})
+			}
+		})
+	}
+	for _, f := range filtered {
+		err := c.writer.WriteFrame(f)
+		if err != nil {
+			return false, fmt.Errorf("Failed to write %v frame: %v", f.Type(), err.Error())
+		}
+		for _, observer := range c.writtenFrameObservers {
+			observer(f)
+		}
+	}
+	return len(filtered) > 0, nil
+}
+
+// applyFilters runs the filters one after the other. Each filter is called for each frame returned by the previous filter.
+// A filter returns the frame itself, a modified frame, no frame to drop it, or multiple frames to duplicate it.
+// A filter may delay a frame by returning NewDelayedFrame(). When the delay is over, the remaining filters are applied
+// in a timer go routine, and the resulting frames are passed to deliverLater.
+func applyFilters(filters []func(frames.Frame) []frames.Frame, frame frames.Frame, deliverLater func(frames.Frame)) []frames.Frame {
+	result := []frames.Frame{frame}
+	for i, filter := range filters {
+		filtered := make([]frames.Frame, 0, len(result))
+		for _, f := range result {
+			for _, g := range filter(f) {
+				if delayed, ok := g.(*delayedFrame); ok {
+					remainingFilters := filters[i+1:]
+					time.AfterFunc(delayed.delay, func() {
+						for _, h := range applyFilters(remainingFilters, delayed.Frame, deliverLater) {
+							deliverLater(h)
+						}
+					})
+				} else {
+					filtered = append(filtered, g)
+				}
+			}
+		}
+		result = filtered
+	}
+	return result
+}
+
+func (c *connection) WriteErrors() <-chan error {
+	return c.writeErrors
+}
+
+func (c *connection) DelayedIncomingFrames() <-chan frames.Frame {
+	return c.delayedIncomingFrames
+}
+
+// HandleWriteError is called in the event loop when the frame writer failed.
+// This is treated as a connection error: All pending commands fail, and the connection is shut down.
+func (c *connection) HandleWriteError(err error) {
+	c.failPendingCommands(failure.New(failure.CONNECTION_ERROR, "Connection error: %v", err.Error()))
+	c.Shutdown()
+}
+
+// HandleReadError is called in the event loop when the frame reader failed, e.g. because the server closed the connection.
+// All pending commands fail, and the connection is shut down.
+// If the server sent a frame larger than SETTINGS_MAX_FRAME_SIZE, GOAWAY with FRAME_SIZE_ERROR is sent before the connection is closed.
+func (c *connection) HandleReadError(err error) {
+	var frameSizeError *frames.FrameSizeError
+	if errors.As(err, &frameSizeError) {
+		c.connectionError(frameSizeError.ErrorCode(), frameSizeError.Error())
+		c.closeAfterPendingWrites()
+		return
+	}
+	c.failPendingCommands(failure.New(failure.CONNECTION_ERROR, "Connection closed: %v", err.Error()))
+	c.Shutdown()
+}
+
+// failPendingCommands completes all pending requests and pings with err.
+// The connection cannot be used for new requests anymore. If the connection already failed, the original error is kept.
+func (c *connection) failPendingCommands(err *failure.Error) {
+	err = c.setError(err)
+	for _, s := range c.streams {
+		s.AbortWithError(err)
+	}
+	for payload, ping := range c.pendingPings {
+		delete(c.pendingPings, payload)
+		ping.cmd.CompleteWithError(err)
 	}
 }
 
 func (c *connection) getOrCreateStream(streamId uint32) stream.Stream {
 	result, exists := c.getStreamIfExists(streamId)
 	if !exists {
-		result = stream.New(streamId, nil, c.settings.initialSendWindowSizeForNewStreams, c.settings.initialReceiveWindowSizeForNewStreams, c)
+		result = stream.New(streamId, nil, c.settings.initialSendWindowSizeForNewStreams, c.settings.initialReceiveWindowSizeForNewStreams, c, c.events, c.history)
 		c.streams[streamId] = result
 	}
 	return result
@@ -403,11 +773,16 @@ func (c *connection) newStream(cmd *commands.HttpCommand) stream.Stream {
 			streamIdsInUse = append(streamIdsInUse, id)
 		}
 	}
+	for id := range c.rawStreams {
+		if id%2 == 1 {
+			streamIdsInUse = append(streamIdsInUse, id)
+		}
+	}
 	nextStreamId := uint32(1)
 	if len(streamIdsInUse) > 0 {
 		nextStreamId = max(streamIdsInUse) + 2
 	}
-	c.streams[nextStreamId] = stream.New(nextStreamId, cmd, c.settings.initialSendWindowSizeForNewStreams, c.settings.initialReceiveWindowSizeForNewStreams, c)
+	c.streams[nextStreamId] = stream.New(nextStreamId, cmd, c.settings.initialSendWindowSizeForNewStreams, c.settings.initialReceiveWindowSizeForNewStreams, c, c.events, c.history)
 	return c.streams[nextStreamId]
 }
 
@@ -424,7 +799,7 @@ func max(numbers []uint32) uint32 {
 	return result
 }
 
-func (c *connection) serverFrameSize() uint32 {
+func (c *connection) MaxFrameSize() uint32 {
 	return c.settings.serverFrameSize
 }
 
@@ -441,31 +816,37 @@ func (c *connection) port() int {
 }
 
 func (c *connection) error() error {
+	c.errMutex.Lock()
+	defer c.errMutex.Unlock()
 	return c.err
 }
 
+// setError sets the connection error unless it is already set, and returns the connection error.
+func (c *connection) setError(err *failure.Error) *failure.Error {
+	c.errMutex.Lock()
+	defer c.errMutex.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+	return c.err.(*failure.Error)
+}
+
 // TODO: This is called in another thread, which is confusing. Should have a different Handler for things that are not called from the event loop.
+// Frames dropped by the incoming filters are skipped, and duplicated frames are returned one by one in the following calls.
 func (c *connection) ReadNextFrame() (frames.Frame, error) {
-	headerData := make([]byte, 9) // Frame starts with a 9 Bytes header
-	_, err := io.ReadFull(c.conn, headerData)
-	if err != nil {
-		return nil, err
-	}
-	header := frames.DecodeHeader(headerData)
-	payload := make([]byte, header.Length)
-	_, err = io.ReadFull(c.conn, payload)
-	if err != nil {
-		return nil, err
-	}
-	decodeFunc := frames.FindDecoder(frames.Type(header.HeaderType))
-	if decodeFunc == nil {
-		return nil, fmt.Errorf("%v: Unknown frame type.", header.HeaderType)
-	}
-	frame, err := decodeFunc(header.Flags, header.StreamId, payload, c.decodingContext)
-	if c.incomingFrameFilters != nil {
-		for _, filter := range c.incomingFrameFilters {
-			frame = filter(frame)
+	for len(c.pendingIncomingFrames) == 0 {
+		frame, err := c.reader.ReadNextFrame()
+		if err != nil {
+			return nil, err
 		}
+		c.pendingIncomingFrames = applyFilters(c.incomingFrameFilters, frame, func(delayed frames.Frame) {
+			select {
+			case c.delayedIncomingFrames <- delayed:
+			case <-c.done:
+			}
+		})
 	}
-	return frame, err
+	frame := c.pendingIncomingFrames[0]
+	c.pendingIncomingFrames = c.pendingIncomingFrames[1:]
+	return frame, nil
 }
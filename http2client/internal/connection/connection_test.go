@@ -0,0 +1,137 @@
+package connection
+
+import (
+	"net"
+	neturl "net/url"
+	"testing"
+	"time"
+
+	"github.com/fstab/h2c/http2client/failure"
+	"github.com/fstab/h2c/http2client/frames"
+	"github.com/fstab/h2c/http2client/internal/eventloop/commands"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestGoAwayOnFrameSizeError(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	c := newConnection(client, "localhost", 8080, nil, nil, nil, false, nil, nil, nil)
+	go c.runFrameWriter()
+	c.HandleReadError(&frames.FrameSizeError{FrameType: frames.DATA_TYPE, Length: 1 << 20, MaxFrameSize: frames.DEFAULT_MAX_FRAME_SIZE})
+	frame, err := frames.NewReader(server, frames.NewDecodingContext()).ReadNextFrame()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	goAway, ok := frame.(*frames.GoAwayFrame)
+	if !ok || goAway.ErrorCode != frames.FRAME_SIZE_ERROR {
+		t.Fatalf("Expected GOAWAY with %v, but got %#v.", frames.FRAME_SIZE_ERROR, frame)
+	}
+	select {
+	case err = <-c.WriteErrors():
+		c.HandleWriteError(err)
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the connection to be closed after the GOAWAY frame.")
+	}
+	if !c.IsShutdown() {
+		t.Errorf("Expected connection to be shut down.")
+	}
+	if err := failure.Of(c.error()); err == nil || err.Code != frames.FRAME_SIZE_ERROR.String() {
+		t.Errorf("Expected connection error with %v, but got %v.", frames.FRAME_SIZE_ERROR, c.error())
+	}
+}
+
+func TestGracefulShutdownOnGoAway(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	c := newConnection(client, "localhost", 8080, nil, nil, nil, false, nil, nil, nil)
+	url, _ := neturl.Parse("http://localhost:8080/")
+	processed, unprocessed := commands.NewHttpCommand("GET", url), commands.NewHttpCommand("GET", url)
+	c.ExecuteHttpCommand(processed)   // stream 1
+	c.ExecuteHttpCommand(unprocessed) // stream 3
+	c.HandleIncomingFrame(frames.NewGoAwayFrame(0, 1, frames.NO_ERROR))
+	if err := failure.Of(unprocessed.AwaitCompletion(1)); err == nil || err.Kind != failure.GOAWAY {
+		t.Errorf("Expected stream 3 to fail with %v, but got %v.", failure.GOAWAY, err)
+	}
+	rejected := commands.NewHttpCommand("GET", url)
+	c.ExecuteHttpCommand(rejected)
+	if err := failure.Of(rejected.AwaitCompletion(1)); err == nil || err.Kind != failure.GOAWAY {
+		t.Errorf("Expected new request to fail with %v, but got %v.", failure.GOAWAY, err)
+	}
+	if c.IsShutdown() {
+		t.Fatalf("Expected connection to stay open until stream 1 is complete.")
+	}
+	c.HandleIncomingFrame(frames.NewHeadersFrame(1, []hpack.HeaderField{{Name: ":status", Value: "200"}}))
+	if err := processed.AwaitCompletion(1); err != nil {
+		t.Errorf("Expected stream 1 to complete, but got %v.", err)
+	}
+	if !c.IsShutdown() {
+		t.Errorf("Expected connection to be shut down after the last stream was closed.")
+	}
+}
+
+func TestDelayedFrameDoesNotBlockWriter(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	delayPing := func(frame frames.Frame) []frames.Frame {
+		if frame.Type() == frames.PING_TYPE {
+			return []frames.Frame{NewDelayedFrame(frame, 100*time.Millisecond)}
+		}
+		return []frames.Frame{frame}
+	}
+	observed := make(chan frames.Frame, 2)
+	observer := func(frame frames.Frame) {
+		observed <- frame
+	}
+	c := newConnection(client, "localhost", 8080, nil, []func(frames.Frame) []frames.Frame{delayPing}, []func(frames.Frame){observer}, false, nil, nil, nil)
+	defer c.Shutdown()
+	go c.runFrameWriter()
+	c.Write(frames.NewPingFrame(0, 1, false))
+	c.Write(frames.NewWindowUpdateFrame(0, 100))
+	reader := frames.NewReader(server, frames.NewDecodingContext())
+	for _, expected := range []frames.Type{frames.WINDOW_UPDATE_TYPE, frames.PING_TYPE} {
+		frame, err := reader.ReadNextFrame()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if frame.Type() != expected {
+			t.Fatalf("Expected %v, but got %v.", expected, frame.Type())
+		}
+		if _, ok := (<-observed).(*filteredFrame); ok {
+			t.Errorf("Expected the observer to see the delayed frame itself.")
+		}
+	}
+}
+
+func TestDelayedFrameDoesNotBlockReader(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	delayPing := func(frame frames.Frame) []frames.Frame {
+		if frame.Type() == frames.PING_TYPE {
+			return []frames.Frame{NewDelayedFrame(frame, 100*time.Millisecond)}
+		}
+		return []frames.Frame{frame}
+	}
+	c := newConnection(client, "localhost", 8080, []func(frames.Frame) []frames.Frame{delayPing}, nil, nil, false, nil, nil, nil)
+	defer c.Shutdown()
+	go func() {
+		writer := frames.NewWriter(server, frames.NewEncodingContext())
+		writer.WriteFrame(frames.NewPingFrame(0, 1, false))
+		writer.WriteFrame(frames.NewWindowUpdateFrame(0, 100))
+		writer.Flush()
+	}()
+	frame, err := c.ReadNextFrame()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if frame.Type() != frames.WINDOW_UPDATE_TYPE {
+		t.Fatalf("Expected %v, but got %v.", frames.WINDOW_UPDATE_TYPE, frame.Type())
+	}
+	select {
+	case frame = <-c.DelayedIncomingFrames():
+		if _, ok := frame.(*frames.PingFrame); !ok {
+			t.Errorf("Expected the delayed PING frame, but got %v.", frame.Type())
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Delayed PING frame not received.")
+	}
+}
@@ -0,0 +1,29 @@
+package connection
+
+import (
+	"time"
+
+	"github.com/fstab/h2c/http2client/frames"
+)
+
+// delayedFrame is returned by a frame filter to deliver the frame later, see NewDelayedFrame().
+type delayedFrame struct {
+	frames.Frame
+	delay time.Duration
+}
+
+// NewDelayedFrame may be returned by a frame filter to pass the frame on after the delay.
+// Unlike a filter that blocks, this does not hold back the frames that follow, so they may overtake the delayed frame.
+// The filters after the delaying filter are applied when the delay is over, see applyFilters().
+func NewDelayedFrame(frame frames.Frame, delay time.Duration) frames.Frame {
+	return &delayedFrame{
+		Frame: frame,
+		delay: delay,
+	}
+}
+
+// filteredFrame is an outgoing frame that was delayed. The outgoing filters have already been applied,
+// so the frame writer writes it as is.
+type filteredFrame struct {
+	frames.Frame
+}
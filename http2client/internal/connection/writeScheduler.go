@@ -0,0 +1,167 @@
+package connection
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fstab/h2c/http2client/frames"
+)
+
+// writeScheduler is the queue between the event loop and the frame writer go routine.
+//
+// Frames are taken from the queue in the following order:
+//  1. Control frames (SETTINGS, PING, RST_STREAM, WINDOW_UPDATE, GOAWAY) in the order they were scheduled.
+//  2. Other non-DATA frames, like HEADERS, in the order they were scheduled.
+//  3. DATA frames. The streams take turns, so a large upload on one stream does not starve the others.
+//     DATA frames of the same stream are sent in the order they were scheduled.
+//
+// As HEADERS are always taken before DATA, a stream's HEADERS frame always precedes its DATA frames.
+// Control frames for a stream whose HEADERS frame is still in the queue, like RST_STREAM or WINDOW_UPDATE,
+// are queued after the HEADERS frame, because they must not be sent before the stream is opened.
+//
+// The writeScheduler is thread safe: Frames are scheduled by the event loop,
+// and taken from the queue by the frame writer go routine.
+type writeScheduler struct {
+	mutex          sync.Mutex
+	control        []frames.Frame
+	other          []frames.Frame
+	data           map[uint32][]*frames.DataFrame        // StreamID -> pending DATA frames
+	dataStreams    []uint32                              // Round robin queue of StreamIDs with pending DATA frames
+	onSent         map[frames.Frame]func(sent time.Time) // see scheduleAndNotify()
+	frameAvailable chan bool
+}
+
+func newWriteScheduler() *writeScheduler {
+	return &writeScheduler{
+		control:        make([]frames.Frame, 0),
+		other:          make([]frames.Frame, 0),
+		data:           make(map[uint32][]*frames.DataFrame),
+		dataStreams:    make([]uint32, 0),
+		onSent:         make(map[frames.Frame]func(sent time.Time)),
+		frameAvailable: make(chan bool, 1),
+	}
+}
+
+func isControlFrame(frame frames.Frame) bool {
+	switch frame.Type() {
+	case frames.SETTINGS_TYPE, frames.PING_TYPE, frames.RST_STREAM_TYPE, frames.WINDOW_UPDATE_TYPE, frames.GOAWAY_TYPE:
+		return true
+	default:
+		return false
+	}
+}
+
+// schedule adds a frame to the queue and wakes up the frame writer.
+func (s *writeScheduler) schedule(frame frames.Frame) {
+	s.mutex.Lock()
+	switch frame := frame.(type) {
+	case *frames.DataFrame:
+		pending, exists := s.data[frame.StreamId]
+		if !exists {
+			s.dataStreams = append(s.dataStreams, frame.StreamId)
+		}
+		s.data[frame.StreamId] = append(pending, frame)
+	case *frames.RstStreamFrame:
+		// The stream is closed, pending DATA frames must not be sent after the RST_STREAM.
+		s.dropDataFrames(frame.StreamId)
+		s.scheduleControlFrame(frame)
+	default:
+		if isControlFrame(frame) {
+			s.scheduleControlFrame(frame)
+		} else {
+			s.other = append(s.other, frame)
+		}
+	}
+	s.mutex.Unlock()
+	s.wakeUp()
+}
+
+// scheduleAndNotify is like schedule, but the frame writer calls onSent when the frame is written and flushed, see takeOnSent().
+func (s *writeScheduler) scheduleAndNotify(frame frames.Frame, onSent func(sent time.Time)) {
+	s.mutex.Lock()
+	s.onSent[frame] = onSent
+	s.mutex.Unlock()
+	s.schedule(frame)
+}
+
+// takeOnSent returns the callback passed to scheduleAndNotify(), or nil if there is none.
+func (s *writeScheduler) takeOnSent(frame frames.Frame) func(sent time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	onSent := s.onSent[frame]
+	delete(s.onSent, frame)
+	return onSent
+}
+
+// wakeUp notifies the frame writer.
+func (s *writeScheduler) wakeUp() {
+	select {
+	case s.frameAvailable <- true:
+	default:
+		// The frame writer has already been notified.
+	}
+}
+
+// must be called while holding the mutex.
+func (s *writeScheduler) scheduleControlFrame(frame frames.Frame) {
+	if frame.GetStreamId() != 0 && s.hasOtherFrames(frame.GetStreamId()) {
+		s.other = append(s.other, frame)
+	} else {
+		s.control = append(s.control, frame)
+	}
+}
+
+// must be called while holding the mutex.
+func (s *writeScheduler) hasOtherFrames(streamId uint32) bool {
+	for _, frame := range s.other {
+		if frame.GetStreamId() == streamId {
+			return true
+		}
+	}
+	return false
+}
+
+// next removes the next frame from the queue. Returns false if the queue is empty.
+func (s *writeScheduler) next() (frames.Frame, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var frame frames.Frame
+	switch {
+	case len(s.control) > 0:
+		frame, s.control = s.control[0], s.control[1:]
+	case len(s.other) > 0:
+		frame, s.other = s.other[0], s.other[1:]
+	case len(s.dataStreams) > 0:
+		streamId := s.dataStreams[0]
+		s.dataStreams = s.dataStreams[1:]
+		pending := s.data[streamId]
+		frame = pending[0]
+		if len(pending) > 1 {
+			s.data[streamId] = pending[1:]
+			s.dataStreams = append(s.dataStreams, streamId) // Move to the end of the round robin queue.
+		} else {
+			delete(s.data, streamId)
+		}
+	default:
+		return nil, false
+	}
+	return frame, true
+}
+
+// must be called while holding the mutex.
+func (s *writeScheduler) dropDataFrames(streamId uint32) {
+	if _, exists := s.data[streamId]; !exists {
+		return
+	}
+	for _, frame := range s.data[streamId] {
+		delete(s.onSent, frame)
+	}
+	delete(s.data, streamId)
+	remaining := make([]uint32, 0, len(s.dataStreams))
+	for _, id := range s.dataStreams {
+		if id != streamId {
+			remaining = append(remaining, id)
+		}
+	}
+	s.dataStreams = remaining
+}
@@ -0,0 +1,98 @@
+package connection
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fstab/h2c/http2client/frames"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestControlFramesFirst(t *testing.T) {
+	s := newWriteScheduler()
+	s.schedule(frames.NewDataFrame(1, []byte("a"), false))
+	s.schedule(frames.NewHeadersFrame(3, []hpack.HeaderField{}))
+	s.schedule(frames.NewWindowUpdateFrame(0, 100))
+	s.schedule(frames.NewPingFrame(0, 1, true))
+	assertNextFrameType(t, s, frames.WINDOW_UPDATE_TYPE, 0)
+	assertNextFrameType(t, s, frames.PING_TYPE, 0)
+	assertNextFrameType(t, s, frames.HEADERS_TYPE, 3)
+	assertNextFrameType(t, s, frames.DATA_TYPE, 1)
+	assertEmpty(t, s)
+}
+
+func TestDataFramesRoundRobin(t *testing.T) {
+	s := newWriteScheduler()
+	s.schedule(frames.NewDataFrame(1, []byte("a"), false))
+	s.schedule(frames.NewDataFrame(1, []byte("b"), false))
+	s.schedule(frames.NewDataFrame(1, []byte("c"), true))
+	s.schedule(frames.NewDataFrame(3, []byte("x"), false))
+	s.schedule(frames.NewDataFrame(3, []byte("y"), true))
+	expected := []struct {
+		streamId uint32
+		data     string
+	}{
+		{1, "a"}, {3, "x"}, {1, "b"}, {3, "y"}, {1, "c"},
+	}
+	for _, e := range expected {
+		frame, ok := s.next()
+		if !ok {
+			t.Fatalf("Expected DATA frame for stream %v, but queue is empty.", e.streamId)
+		}
+		dataFrame := frame.(*frames.DataFrame)
+		if dataFrame.StreamId != e.streamId || string(dataFrame.Data) != e.data {
+			t.Errorf("Expected %q on stream %v, but got %q on stream %v.", e.data, e.streamId, dataFrame.Data, dataFrame.StreamId)
+		}
+	}
+	assertEmpty(t, s)
+}
+
+func TestRstStreamDropsPendingData(t *testing.T) {
+	s := newWriteScheduler()
+	s.schedule(frames.NewDataFrame(1, []byte("a"), false))
+	s.schedule(frames.NewDataFrame(3, []byte("x"), false))
+	s.schedule(frames.NewRstStreamFrame(1, frames.CANCEL))
+	assertNextFrameType(t, s, frames.RST_STREAM_TYPE, 1)
+	assertNextFrameType(t, s, frames.DATA_TYPE, 3)
+	assertEmpty(t, s)
+}
+
+func TestRstStreamDropsOnSent(t *testing.T) {
+	s := newWriteScheduler()
+	data := frames.NewDataFrame(1, []byte("a"), true)
+	s.scheduleAndNotify(data, func(sent time.Time) {})
+	s.schedule(frames.NewRstStreamFrame(1, frames.CANCEL))
+	if len(s.onSent) != 0 {
+		t.Errorf("Expected the callback for the dropped DATA frame to be removed.")
+	}
+}
+
+func TestStreamControlFramesAfterHeaders(t *testing.T) {
+	s := newWriteScheduler()
+	s.schedule(frames.NewHeadersFrame(1, []hpack.HeaderField{}))
+	s.schedule(frames.NewDataFrame(1, []byte("a"), false))
+	s.schedule(frames.NewWindowUpdateFrame(1, 100))
+	s.schedule(frames.NewRstStreamFrame(1, frames.CANCEL))
+	s.schedule(frames.NewRstStreamFrame(3, frames.CANCEL))
+	assertNextFrameType(t, s, frames.RST_STREAM_TYPE, 3)
+	assertNextFrameType(t, s, frames.HEADERS_TYPE, 1)
+	assertNextFrameType(t, s, frames.WINDOW_UPDATE_TYPE, 1)
+	assertNextFrameType(t, s, frames.RST_STREAM_TYPE, 1)
+	assertEmpty(t, s)
+}
+
+func assertNextFrameType(t *testing.T, s *writeScheduler, frameType frames.Type, streamId uint32) {
+	frame, ok := s.next()
+	if !ok {
+		t.Fatalf("Expected %v frame, but queue is empty.", frameType)
+	}
+	if frame.Type() != frameType || frame.GetStreamId() != streamId {
+		t.Errorf("Expected %v(%v), but got %v(%v).", frameType, streamId, frame.Type(), frame.GetStreamId())
+	}
+}
+
+func assertEmpty(t *testing.T, s *writeScheduler) {
+	if frame, ok := s.next(); ok {
+		t.Errorf("Expected empty queue, but got %v frame.", frame.Type())
+	}
+}
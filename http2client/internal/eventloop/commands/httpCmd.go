@@ -6,21 +6,47 @@ import (
 	"golang.org/x/net/http2/hpack"
 	neturl "net/url"
 	"strconv"
+	"time"
 )
 
 type HttpCommand struct {
+	Url      *neturl.URL // the URL the request was created for, the pseudo-headers may be replaced with other values
 	Request  *httpMsg
 	Response *httpMsg
+	Timings  Timings // set when the response is complete
+	StreamId uint32  // set when the response is complete
 	callback *util.AsyncTask
 }
 
 type httpMsg struct {
-	headers []hpack.HeaderField
-	body    []byte
+	headers  []hpack.HeaderField
+	trailers []hpack.HeaderField
+	body     []byte
+}
+
+// Timings of a request/response exchange, see history.Entry.
+// Enqueued is set by the Http2Client, Connect is set by the connection, the other fields are set by the stream.
+type Timings struct {
+	Enqueued          time.Time // HttpCommand sent to the event loop.
+	Started           time.Time // Stream created.
+	HeadersSent       time.Time
+	RequestSent       time.Time // END_STREAM sent, i.e. the last DATA frame, or the HEADERS frame if there is no body.
+	ResponseStarted   time.Time // First response HEADERS received.
+	FirstDataReceived time.Time // Zero if the response has no body.
+	Completed         time.Time // Stream closed, i.e. END_STREAM received.
+	Connect           ConnectTimings
+}
+
+// ConnectTimings of the connection that was used for the request.
+type ConnectTimings struct {
+	Started          time.Time // Dialing started.
+	Connected        time.Time // TCP connection established.
+	TlsHandshakeDone time.Time // Always zero, because h2c supports only cleartext connections.
 }
 
 func NewHttpCommand(method string, url *neturl.URL) *HttpCommand {
 	result := &HttpCommand{
+		Url:      url,
 		Request:  newHttpMsg(),
 		Response: newHttpMsg(),
 		callback: util.NewAsyncTask(),
@@ -34,8 +60,9 @@ func NewHttpCommand(method string, url *neturl.URL) *HttpCommand {
 
 func newHttpMsg() *httpMsg {
 	return &httpMsg{
-		headers: make([]hpack.HeaderField, 0),
-		body:    make([]byte, 0),
+		headers:  make([]hpack.HeaderField, 0),
+		trailers: make([]hpack.HeaderField, 0),
+		body:     make([]byte, 0),
 	}
 }
 
@@ -43,6 +70,17 @@ func (m *httpMsg) AddHeader(name, value string) {
 	m.headers = append(m.headers, hpack.HeaderField{Name: name, Value: value})
 }
 
+// ReplaceHeader sets the value of the first header with that name, or adds the header if there is none.
+func (m *httpMsg) ReplaceHeader(name, value string) {
+	for i, header := range m.headers {
+		if header.Name == name {
+			m.headers[i].Value = value
+			return
+		}
+	}
+	m.AddHeader(name, value)
+}
+
 func (m *httpMsg) GetHeaders() []hpack.HeaderField {
 	return m.headers
 }
@@ -56,6 +94,14 @@ func (m *httpMsg) GetHeader(name string) string {
 	return ""
 }
 
+func (m *httpMsg) AddTrailer(name, value string) {
+	m.trailers = append(m.trailers, hpack.HeaderField{Name: name, Value: value})
+}
+
+func (m *httpMsg) GetTrailers() []hpack.HeaderField {
+	return m.trailers
+}
+
 func (m *httpMsg) SetBody(data []byte, addContentLengthHeader bool) {
 	m.body = data
 	if addContentLengthHeader {
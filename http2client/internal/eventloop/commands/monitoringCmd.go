@@ -3,28 +3,38 @@ package commands
 import (
 	"github.com/fstab/h2c/http2client/internal/streamstate"
 	"github.com/fstab/h2c/http2client/internal/util"
+	"golang.org/x/net/http2/hpack"
 	"sort"
+	"time"
 )
 
-// As of now, the "monitoring" is just use to retrieve info about stream states.
-// However, it could be extended to retrieve other info, like available window sizes, response times, etc.
+// As of now, the "monitoring" is just use to retrieve info about stream states and flow-control windows.
+// However, it could be extended to retrieve other info, like response times, etc.
 type MonitoringCommand struct {
 	Result   *monitoringCommandResult
 	callback *util.AsyncTask
 }
 
 type monitoringCommandResult struct {
-	StreamInfo sortableStreamInfoSlice
+	StreamInfo                 sortableStreamInfoSlice
+	RemainingSendWindowSize    int64 // connection flow-control window
+	RemainingReceiveWindowSize int64 // connection flow-control window
 }
 
 type sortableStreamInfoSlice []StreamInfo
 
 type StreamInfo struct {
-	StreamId            uint32
-	HttpMethod          string
-	Path                string
-	State               streamstate.StreamState
-	IsCachedPushPromise bool
+	StreamId                   uint32
+	HttpMethod                 string
+	Path                       string
+	State                      streamstate.StreamState
+	IsCachedPushPromise        bool
+	RequestHeaders             []hpack.HeaderField
+	ResponseStatus             string        // empty if no response HEADERS received yet
+	ResponseSize               int           // number of body bytes received so far
+	PushPromiseAge             time.Duration // time since the PUSH_PROMISE was received, only set for cached push promises
+	RemainingSendWindowSize    int64
+	RemainingReceiveWindowSize int64
 }
 
 func NewMonitoringCommand() *MonitoringCommand {
@@ -40,14 +50,8 @@ func newMonitoringCommandResult() *monitoringCommandResult {
 	}
 }
 
-func (res *monitoringCommandResult) AddStreamInfo(streamID uint32, httpMethod string, path string, state streamstate.StreamState, isCachedPushPromise bool) {
-	res.StreamInfo = append(res.StreamInfo, StreamInfo{
-		StreamId:            streamID,
-		HttpMethod:          httpMethod,
-		Path:                path,
-		State:               state,
-		IsCachedPushPromise: isCachedPushPromise,
-	})
+func (res *monitoringCommandResult) AddStreamInfo(info StreamInfo) {
+	res.StreamInfo = append(res.StreamInfo, info)
 	sort.Sort(res.StreamInfo)
 }
 
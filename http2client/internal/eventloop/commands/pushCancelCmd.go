@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"github.com/fstab/h2c/http2client/internal/util"
+	"golang.org/x/net/http2/hpack"
+	neturl "net/url"
+)
+
+// PushCancelCommand cancels a cached push promise by sending RST_STREAM with error code CANCEL.
+// The push promise is identified either by the promised stream id, or by the URL of the pushed request.
+type PushCancelCommand struct {
+	StreamId          uint32              // 0 if the push promise is identified by URL
+	RequestHeaders    []hpack.HeaderField // :scheme, :authority, and :path of the pushed request
+	CanceledStreamIds []uint32
+	callback          *util.AsyncTask
+}
+
+func NewPushCancelCommandForStreamId(streamId uint32) *PushCancelCommand {
+	return &PushCancelCommand{
+		StreamId:          streamId,
+		RequestHeaders:    make([]hpack.HeaderField, 0),
+		CanceledStreamIds: make([]uint32, 0),
+		callback:          util.NewAsyncTask(),
+	}
+}
+
+func NewPushCancelCommandForUrl(url *neturl.URL) *PushCancelCommand {
+	cmd := NewPushCancelCommandForStreamId(0)
+	cmd.RequestHeaders = []hpack.HeaderField{
+		{Name: ":scheme", Value: url.Scheme},
+		{Name: ":authority", Value: url.Host},
+		{Name: ":path", Value: url.RequestURI()},
+	}
+	return cmd
+}
+
+func (cmd *PushCancelCommand) CompleteWithError(err error) {
+	cmd.callback.CompleteWithError(err)
+}
+
+func (cmd *PushCancelCommand) CompleteSuccessfully() {
+	cmd.callback.CompleteSuccessfully()
+}
+
+func (cmd *PushCancelCommand) AwaitCompletion(timeoutInSeconds int) error {
+	return cmd.callback.WaitForCompletion(timeoutInSeconds)
+}
@@ -0,0 +1,31 @@
+package commands
+
+import (
+	"github.com/fstab/h2c/http2client/frames"
+	"github.com/fstab/h2c/http2client/internal/util"
+)
+
+// SendFrameCommand writes a frame on the connection without passing it through the stream state machine.
+type SendFrameCommand struct {
+	Frame    frames.Frame
+	callback *util.AsyncTask
+}
+
+func NewSendFrameCommand(frame frames.Frame) *SendFrameCommand {
+	return &SendFrameCommand{
+		Frame:    frame,
+		callback: util.NewAsyncTask(),
+	}
+}
+
+func (cmd *SendFrameCommand) CompleteWithError(err error) {
+	cmd.callback.CompleteWithError(err)
+}
+
+func (cmd *SendFrameCommand) CompleteSuccessfully() {
+	cmd.callback.CompleteSuccessfully()
+}
+
+func (cmd *SendFrameCommand) AwaitCompletion(timeoutInSeconds int) error {
+	return cmd.callback.WaitForCompletion(timeoutInSeconds)
+}
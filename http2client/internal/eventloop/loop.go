@@ -1,31 +1,37 @@
 package eventloop
 
 import (
-	"fmt"
+	"errors"
+
+	"github.com/fstab/h2c/http2client/events"
 	"github.com/fstab/h2c/http2client/frames"
+	"github.com/fstab/h2c/http2client/history"
 	"github.com/fstab/h2c/http2client/internal/connection"
 	"github.com/fstab/h2c/http2client/internal/eventloop/commands"
-	"os"
+	"golang.org/x/net/http2/hpack"
 )
 
 type Loop struct {
 	HttpCommands       chan (*commands.HttpCommand)
 	MonitoringCommands chan (*commands.MonitoringCommand)
 	PingCommands       chan (*commands.PingCommand)
+	PushCancelCommands chan (*commands.PushCancelCommand)
+	SendFrameCommands  chan (*commands.SendFrameCommand)
 	IncomingFrames     chan (frames.Frame)
 	Shutdown           chan (bool)
+	Done               chan (bool) // closed when the event loop is terminated, so that senders don't block forever
 	Host               string
 	Port               int
-	terminated         bool
+	conn               connection.Connection
 }
 
 // Start starts the event loop managing the HTTP/2 communication with a server.
 //
 // A lot of HTTP/2 features are hard to implement in a thread safe way:
-//  * Push promises arriving while the client sends a request at the same time.
-//  * Window updates increase the flow control window while the client sends data
-//    and decreases the flow control window at the same time.
-//  * etc.
+//   - Push promises arriving while the client sends a request at the same time.
+//   - Window updates increase the flow control window while the client sends data
+//     and decreases the flow control window at the same time.
+//   - etc.
 //
 // Therefore, each HTTP/2 connection is handled single thread in h2c
 // (that is, h2c avoids concurrency problems by being single-threaded per connection).
@@ -38,58 +44,73 @@ type Loop struct {
 //
 // 1. Command line: A user types a comand in order to send a GET, POST, ... request.
 // 2. Network Socket: Frames received from the server.
-func Start(host string, port int, incomingFrameFilters []func(frames.Frame) frames.Frame, outgoingFrameFilters []func(frames.Frame) frames.Frame) (*Loop, error) {
+func Start(host string, port int, incomingFrameFilters []func(frames.Frame) []frames.Frame, outgoingFrameFilters []func(frames.Frame) []frames.Frame, writtenFrameObservers []func(frames.Frame), keepWireBytes bool, acceptPushPromise func(requestHeaders []hpack.HeaderField) bool, eventBus *events.Bus, h *history.History) (*Loop, error) {
 	l := &Loop{
 		HttpCommands:       make(chan (*commands.HttpCommand)),
 		MonitoringCommands: make(chan (*commands.MonitoringCommand)),
 		PingCommands:       make(chan (*commands.PingCommand)),
+		PushCancelCommands: make(chan (*commands.PushCancelCommand)),
+		SendFrameCommands:  make(chan (*commands.SendFrameCommand)),
 		IncomingFrames:     make(chan (frames.Frame)),
 		Shutdown:           make(chan (bool)),
+		Done:               make(chan (bool)),
 		Host:               host,
 		Port:               port,
-		terminated:         false,
 	}
-	conn, err := connection.Start(host, port, incomingFrameFilters, outgoingFrameFilters)
-	stopFrameReader := false
+	conn, err := connection.Start(host, port, incomingFrameFilters, outgoingFrameFilters, writtenFrameObservers, keepWireBytes, acceptPushPromise, eventBus, h)
+	readErrors := make(chan error, 1) // buffered, because the event loop may already be terminated
 	if err != nil {
 		return nil, err
 	}
+	l.conn = conn
 	// Start event loop
 	go func() {
 		for {
 			select {
 			case frame := <-l.IncomingFrames:
 				conn.HandleIncomingFrame(frame)
+			case frame := <-conn.DelayedIncomingFrames():
+				conn.HandleIncomingFrame(frame)
 			case cmd := <-l.HttpCommands:
 				conn.ExecuteHttpCommand(cmd)
 			case cmd := <-l.PingCommands:
 				conn.ExecutePingCommand(cmd)
 			case cmd := <-l.MonitoringCommands:
 				conn.ExecuteMonitoringCommand(cmd)
+			case cmd := <-l.PushCancelCommands:
+				conn.ExecutePushCancelCommand(cmd)
+			case cmd := <-l.SendFrameCommands:
+				conn.ExecuteSendFrameCommand(cmd)
+			case err := <-conn.WriteErrors():
+				conn.HandleWriteError(err)
+			case err := <-readErrors:
+				conn.HandleReadError(err)
 			case <-l.Shutdown:
 				conn.Shutdown()
 			}
 			if conn.IsShutdown() {
-				stopFrameReader = true // Would this change be visible in the other go function?
-				l.terminated = true
+				close(l.Done)
 				return
 			}
 		}
 	}()
-	// Read frames from network socket and provide them to the IncomingFrames channel
+	// Read frames from network socket and provide them to the IncomingFrames channel.
+	// Frames of unknown types are skipped, as required by RFC 7540 section 4.1.
 	go func() {
 		for {
 			frame, err := conn.ReadNextFrame()
-			if stopFrameReader {
-				return
+			var unknownFrameType *frames.UnknownFrameTypeError
+			if errors.As(err, &unknownFrameType) {
+				continue
 			}
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error while reading next frame: %v\n", err.Error()) // TODO: Error handling
-				conn.Shutdown()
-				l.terminated = true
+				readErrors <- err
+				return
+			}
+			select {
+			case l.IncomingFrames <- frame:
+			case <-l.Done:
 				return
-			} else {
-				l.IncomingFrames <- frame
 			}
 		}
 	}()
@@ -97,5 +118,20 @@ func Start(host string, port int, incomingFrameFilters []func(frames.Frame) fram
 }
 
 func (l *Loop) IsTerminated() bool {
-	return l.terminated
+	select {
+	case <-l.Done:
+		return true
+	default:
+		return false
+	}
+}
+
+// ServerSettingsReceived is closed when the server's first SETTINGS frame is received.
+func (l *Loop) ServerSettingsReceived() <-chan bool {
+	return l.conn.ServerSettingsReceived()
+}
+
+// ServerMaxConcurrentStreams is the server's SETTINGS_MAX_CONCURRENT_STREAMS, or math.MaxUint32 if there is no limit.
+func (l *Loop) ServerMaxConcurrentStreams() uint32 {
+	return l.conn.ServerMaxConcurrentStreams()
 }
@@ -0,0 +1,59 @@
+package eventloop
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fstab/h2c/http2client/frames"
+	"github.com/fstab/h2c/http2client/internal/connection"
+)
+
+// The server sends a frame of an unknown type followed by a PING. The client must ignore the unknown frame and answer the PING.
+func TestUnknownFrameTypeIsIgnored(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	l, err := Start("127.0.0.1", listener.Addr().(*net.TCPAddr).Port, nil, nil, nil, false, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		select {
+		case l.Shutdown <- true:
+		case <-l.Done:
+		}
+	}()
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err = io.ReadFull(server, make([]byte, len(connection.CLIENT_PREFACE))); err != nil {
+		t.Fatal(err)
+	}
+	writer := frames.NewWriter(server, frames.NewEncodingContext())
+	writer.WriteFrame(frames.NewSettingsFrame(0, false))
+	writer.WriteFrame(frames.NewRawFrame(frames.Type(0xbe), 0, 0, []byte("unknown")))
+	writer.WriteFrame(frames.NewPingFrame(0, 42, false))
+	if err = writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reader := frames.NewReader(server, frames.NewDecodingContext())
+	for {
+		frame, err := reader.ReadNextFrame()
+		if err != nil {
+			t.Fatalf("Expected PING ACK, but got %v", err)
+		}
+		if ping, ok := frame.(*frames.PingFrame); ok && ping.Ack {
+			if ping.Payload != 42 {
+				t.Errorf("Expected PING ACK with payload 42, but got %v.", ping.Payload)
+			}
+			return
+		}
+	}
+}
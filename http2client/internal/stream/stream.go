@@ -3,11 +3,17 @@ package stream
 import (
 	"bytes"
 	"fmt"
+	"github.com/fstab/h2c/http2client/events"
+	"github.com/fstab/h2c/http2client/failure"
 	"github.com/fstab/h2c/http2client/frames"
+	"github.com/fstab/h2c/http2client/history"
 	"github.com/fstab/h2c/http2client/internal/eventloop/commands"
 	"github.com/fstab/h2c/http2client/internal/streamstate"
+	"github.com/fstab/h2c/http2client/internal/util"
 	"golang.org/x/net/http2/hpack"
 	"os"
+	"sync"
+	"time"
 )
 
 type Stream interface {
@@ -16,7 +22,13 @@ type Stream interface {
 	SetState(state streamstate.StreamState)
 
 	RequestHeaders() []hpack.HeaderField
-	// ResponseHeaders() []hpack.HeaderField
+	ResponseHeaders() []hpack.HeaderField
+	// HEADERS received after the response headers.
+	ResponseTrailers() []hpack.HeaderField
+
+	// Remaining flow-control windows of this stream (without the connection's flow-control window).
+	RemainingSendWindowSize() int64
+	RemainingReceiveWindowSize() int64
 
 	// Get the received HTTP body (concatenated payloads of DATA frames).
 	ResponseBody() []byte
@@ -27,7 +39,8 @@ type Stream interface {
 	AssociateWithCommand(cmd *commands.HttpCommand) error
 
 	// SendFrame doesn't mean the frame is sent directly.
-	// DATA frames can be postponed by flow control.
+	// DATA frames can be postponed by flow control, and may be split into smaller DATA frames
+	// to fit the flow-control window and the server's MAX_FRAME_SIZE.
 	// However, this method will return immediately, postponed frames will be cached and
 	// handled under the hood as soon as a WINDOW_UPDATE is received.
 	SendFrame(frame frames.Frame)
@@ -37,34 +50,27 @@ type Stream interface {
 	CloseWithError(errorCode frames.ErrorCode, msg string)
 	// Called by the connection if a WINDOW_UPDATE for the connection is received.
 	ProcessPendingDataFrames()
+	// Called by the connection if the connection failed. Closes the stream without sending RST_STREAM.
+	AbortWithError(err error)
 }
 
 type FlowControlledFrameWriter interface {
 	Write(frame frames.Frame)
-	RemainingSendFlowControlWindowIsEnough(nBytesToWrite int64) bool
+	// Like Write, but onSent is called from another go routine when the frame is written to the socket.
+	WriteAndNotify(frame frames.Frame, onSent func(sent time.Time))
+	RemainingSendFlowControlWindow() int64
 	DecreaseSendFlowControlWindow(nBytesToWrite int64)
-}
-
-type streamError struct {
-	msg string
-}
-
-func (err *streamError) Error() string {
-	return err.msg
-}
-
-func newStreamError(format string, a ...interface{}) *streamError {
-	return &streamError{
-		msg: fmt.Sprintf(format, a...),
-	}
+	// The server's SETTINGS_MAX_FRAME_SIZE. Queried for each DATA frame, because the server may change it at any time.
+	MaxFrameSize() uint32
 }
 
 type stream struct {
 	state                      streamstate.StreamState
 	requestHeaders             []hpack.HeaderField
 	responseHeaders            []hpack.HeaderField
+	responseTrailers           []hpack.HeaderField
 	responseBody               bytes.Buffer
-	err                        *streamError // RST_STREAM sent or received.
+	err                        *failure.Error // RST_STREAM sent or received, or connection failed.
 	cmd                        *commands.HttpCommand
 	initialSendWindowSize      int64
 	remainingSendWindowSize    int64
@@ -73,21 +79,34 @@ type stream struct {
 	pendingDataFrameWrites     []*frames.DataFrame
 	streamId                   uint32
 	out                        FlowControlledFrameWriter
-}
-
-func New(streamId uint32, cmd *commands.HttpCommand, initialSendWindowSize uint32, initialReceiveWindowSize uint32, out FlowControlledFrameWriter) *stream {
+	events                     *events.Bus      // may be nil
+	history                    *history.History // may be nil
+	started                    time.Time
+	sentMutex                  sync.Mutex // headersSent and requestSent are set by the frame writer go routine
+	headersSent                time.Time
+	requestSent                time.Time
+	responseStarted            time.Time
+	firstDataReceived          time.Time
+	completed                  time.Time
+}
+
+func New(streamId uint32, cmd *commands.HttpCommand, initialSendWindowSize uint32, initialReceiveWindowSize uint32, out FlowControlledFrameWriter, eventBus *events.Bus, h *history.History) *stream {
 	return &stream{
-		state:           streamstate.IDLE,
-		requestHeaders:  make([]hpack.HeaderField, 0),
-		responseHeaders: make([]hpack.HeaderField, 0),
-		streamId:        streamId,
-		cmd:             cmd,
+		state:                      streamstate.IDLE,
+		requestHeaders:             make([]hpack.HeaderField, 0),
+		responseHeaders:            make([]hpack.HeaderField, 0),
+		responseTrailers:           make([]hpack.HeaderField, 0),
+		streamId:                   streamId,
+		cmd:                        cmd,
 		initialSendWindowSize:      int64(initialSendWindowSize),
 		remainingSendWindowSize:    int64(initialSendWindowSize),
 		initialReceiveWindowSize:   int64(initialReceiveWindowSize),
 		remainingReceiveWindowSize: int64(initialReceiveWindowSize),
 		pendingDataFrameWrites:     make([]*frames.DataFrame, 0),
-		out: out,
+		out:                        out,
+		events:                     eventBus,
+		history:                    h,
+		started:                    time.Now(),
 	}
 }
 
@@ -95,7 +114,7 @@ func (s *stream) ReceiveFrame(frame frames.Frame) {
 	wasClosedBefore := s.state == streamstate.CLOSED
 	err := streamstate.HandleIncomingFrame(s, frame)
 	if err != nil {
-		s.CloseWithError(err.ErrorCode, err.Message)
+		s.closeWithFailure(err.ErrorCode, failure.NewWithErrorCode(failure.PROTOCOL_ERROR, err.ErrorCode, "%v", err.Message))
 		return
 	}
 	switch frame := frame.(type) {
@@ -116,11 +135,16 @@ func (s *stream) ReceiveFrame(frame frames.Frame) {
 		fmt.Fprintf(os.Stderr, "Received unknown frame type %v\n", frame.Type())
 	}
 	if s.state == streamstate.CLOSED && !wasClosedBefore {
+		s.completed = time.Now()
+		s.recordHistory()
 		s.finalizeCommand()
 	}
 }
 
 func (s *stream) receiveDataFrame(frame *frames.DataFrame) {
+	if s.firstDataReceived.IsZero() {
+		s.firstDataReceived = time.Now()
+	}
 	s.flowControlForIncomingDataFrame(frame)
 	s.appendResponseBody(frame.Data)
 }
@@ -129,15 +153,25 @@ func (s *stream) receiveHeadersFrame(frame *frames.HeadersFrame) {
 	if !frame.EndHeaders {
 		s.CloseWithError(frames.REFUSED_STREAM, fmt.Sprintf("Unable to process %v without the END_HEADERS flag, because CONTINUATIONs are not implemented yet.", frame.Type()))
 	} else {
-		s.addResponseHeaders(frame.Headers...)
+		switch {
+		case s.responseStarted.IsZero():
+			s.responseStarted = time.Now()
+			s.addResponseHeaders(frame.Headers...)
+		case isInformational(s.responseHeaders):
+			// Interim responses like 103 Early Hints are followed by the final response, see RFC 7540 section 8.1.
+			s.responseHeaders = make([]hpack.HeaderField, 0, len(frame.Headers))
+			s.addResponseHeaders(frame.Headers...)
+		default:
+			s.addResponseTrailers(frame.Headers...)
+		}
 	}
 }
 
 func (s *stream) receiveRstStreamFrame(frame *frames.RstStreamFrame) {
 	if frame.ErrorCode == frames.NO_ERROR {
-		s.err = newStreamError("Server sent %v.", frame.Type())
+		s.err = failure.NewWithErrorCode(failure.STREAM_ERROR, frame.ErrorCode, "Server sent %v.", frame.Type())
 	} else {
-		s.err = newStreamError("Server sent %v with error code %v.", frame.Type(), frame.ErrorCode)
+		s.err = failure.NewWithErrorCode(failure.STREAM_ERROR, frame.ErrorCode, "Server sent %v with error code %v.", frame.Type(), frame.ErrorCode)
 	}
 }
 
@@ -146,6 +180,10 @@ func (s *stream) receivePushPromiseFrame(frame *frames.PushPromiseFrame) {
 		s.CloseWithError(frames.REFUSED_STREAM, fmt.Sprintf("%v with multiple header frames not supported.", frame.Type()))
 	} else {
 		s.addRequestHeaders(frame.Headers...)
+		s.sentMutex.Lock()
+		s.headersSent = s.started
+		s.requestSent = s.started
+		s.sentMutex.Unlock()
 	}
 }
 
@@ -154,49 +192,84 @@ func (s *stream) notImplementedYet(frame frames.Frame) {
 }
 
 func (s *stream) CloseWithError(errorCode frames.ErrorCode, msg string) {
+	s.closeWithFailure(errorCode, failure.NewWithErrorCode(failure.STREAM_ERROR, errorCode, "%v", msg))
+}
+
+// Send RST_STREAM. The pending command fails with err.
+func (s *stream) closeWithFailure(errorCode frames.ErrorCode, err *failure.Error) {
 	if s.state == streamstate.CLOSED {
 		return
 	}
-	rstStream := frames.NewRstStreamFrame(s.streamId, errorCode)
-	s.err = newStreamError("%v", msg)
-	s.SendFrame(rstStream)
+	s.err = err
+	s.SendFrame(frames.NewRstStreamFrame(s.streamId, errorCode))
+}
+
+func (s *stream) AbortWithError(err error) {
+	if s.state == streamstate.CLOSED {
+		return
+	}
+	s.SetState(streamstate.CLOSED)
+	s.err = failure.Of(err)
+	if s.err == nil {
+		s.err = failure.New(failure.CONNECTION_ERROR, "%v", err.Error())
+	}
+	s.pendingDataFrameWrites = make([]*frames.DataFrame, 0)
+	s.finalizeCommand()
 }
 
 func (s *stream) SendFrame(frame frames.Frame) {
 	wasClosedBefore := s.state == streamstate.CLOSED
 	switch frame := frame.(type) {
 	case *frames.DataFrame:
-		firstInQueue := len(s.pendingDataFrameWrites) == 0
-		s.sendDataFrame(frame, firstInQueue)
+		s.scheduleDataFrameWrite(frame)
+		s.ProcessPendingDataFrames()
 	case *frames.HeadersFrame:
 		s.addRequestHeaders(frame.Headers...)
+		endStream := frame.EndStream
 		streamstate.HandleOutgoingFrame(s, frame)
-		s.out.Write(frame)
+		s.out.WriteAndNotify(frame, func(sent time.Time) {
+			s.sentMutex.Lock()
+			defer s.sentMutex.Unlock()
+			s.headersSent = sent
+			if endStream {
+				s.requestSent = sent
+			}
+		})
 	default:
 		streamstate.HandleOutgoingFrame(s, frame)
 		s.out.Write(frame)
 	}
 	if s.state == streamstate.CLOSED && !wasClosedBefore {
+		s.completed = time.Now()
+		s.recordHistory()
 		s.finalizeCommand()
 	}
 }
 
-// The frame will only be sent immediately if firstInQueue is true.
-// If the frame is not firstInQueue, it will be postponed so that the order of outgoing DATA frames is preserved.
-func (s *stream) sendDataFrame(frame *frames.DataFrame, firstInQueue bool) {
-	size := int64(len(frame.Data))
-	if firstInQueue && s.RemainingSendFlowControlWindowIsEnough(size) {
-		s.DecreaseSendFlowControlWindow(size)
-		streamstate.HandleOutgoingFrame(s, frame)
-		s.out.Write(frame)
+func (s *stream) sendDataFrame(frame *frames.DataFrame) {
+	s.DecreaseSendFlowControlWindow(int64(len(frame.Data)))
+	streamstate.HandleOutgoingFrame(s, frame)
+	if frame.EndStream {
+		s.out.WriteAndNotify(frame, func(sent time.Time) {
+			s.sentMutex.Lock()
+			defer s.sentMutex.Unlock()
+			s.requestSent = sent
+		})
 	} else {
-		s.scheduleDataFrameWrite(frame)
+		s.out.Write(frame)
 	}
 }
 
-func (s *stream) RemainingSendFlowControlWindowIsEnough(nBytesToWrite int64) bool {
-	fmt.Fprintf(os.Stderr, "Stream: RemainingSendFlowControlWindowIsEnough(%v): %v > %v = %v\n", nBytesToWrite, s.remainingSendWindowSize, nBytesToWrite, s.remainingSendWindowSize > nBytesToWrite)
-	return s.remainingSendWindowSize > nBytesToWrite && s.out.RemainingSendFlowControlWindowIsEnough(nBytesToWrite)
+// sentTimes returns the time when the HEADERS frame and the frame with END_STREAM were written, zero if not written yet.
+func (s *stream) sentTimes() (headersSent time.Time, requestSent time.Time) {
+	s.sentMutex.Lock()
+	defer s.sentMutex.Unlock()
+	return s.headersSent, s.requestSent
+}
+
+// The number of bytes that may be sent, which is limited by the stream's and the connection's flow-control window.
+func (s *stream) remainingSendFlowControlWindow() int64 {
+	return minInt64(s.remainingSendWindowSize, s.out.RemainingSendFlowControlWindow())
 }
 
 func (s *stream) DecreaseSendFlowControlWindow(nBytesToWrite int64) {
@@ -223,15 +296,40 @@ func (s *stream) flowControlForIncomingDataFrame(frame *frames.DataFrame) {
 	}
 }
 
+// ProcessPendingDataFrames sends as much of the pending DATA as the flow-control windows allow.
+// The size of each chunk is calculated at send time, so a partially open window is used completely,
+// and a changed SETTINGS_MAX_FRAME_SIZE is respected for the next chunk.
 func (s *stream) ProcessPendingDataFrames() {
+	if s.state == streamstate.CLOSED {
+		s.pendingDataFrameWrites = make([]*frames.DataFrame, 0) // RST_STREAM sent or received, DATA will never be sent.
+		return
+	}
 	for len(s.pendingDataFrameWrites) > 0 {
 		nextFrame := s.pendingDataFrameWrites[0]
-		if !s.RemainingSendFlowControlWindowIsEnough(int64(len(nextFrame.Data))) {
+		size := minInt64(int64(len(nextFrame.Data)), s.remainingSendFlowControlWindow(), int64(s.out.MaxFrameSize()))
+		if size <= 0 && len(nextFrame.Data) > 0 {
 			break // must stop here, because data frames must be sent in the right order
 		}
-		s.pendingDataFrameWrites = s.pendingDataFrameWrites[1:] // TODO: Memory Leak ???
-		s.sendDataFrame(nextFrame, true)
+		if size == int64(len(nextFrame.Data)) {
+			s.pendingDataFrameWrites[0] = nil
+			s.pendingDataFrameWrites = s.pendingDataFrameWrites[1:]
+			s.sendDataFrame(nextFrame)
+		} else {
+			chunk := frames.NewDataFrame(s.streamId, nextFrame.Data[:size], false)
+			nextFrame.Data = nextFrame.Data[size:]
+			s.sendDataFrame(chunk)
+		}
+	}
+}
+
+func minInt64(first int64, others ...int64) int64 {
+	result := first
+	for _, n := range others {
+		if n < result {
+			result = n
+		}
 	}
+	return result
 }
 
 func (s *stream) scheduleDataFrameWrite(frame *frames.DataFrame) {
@@ -250,10 +348,47 @@ func (s *stream) addResponseHeaders(headers ...hpack.HeaderField) {
 	}
 }
 
+// isInformational is true if the :status is 1xx.
+func isInformational(headers []hpack.HeaderField) bool {
+	status := util.FindHeader(":status", headers)
+	return len(status) == 3 && status[0] == '1'
+}
+
+func (s *stream) addResponseTrailers(headers ...hpack.HeaderField) {
+	for _, header := range headers {
+		s.responseTrailers = append(s.responseTrailers, header)
+	}
+}
+
 func (s *stream) appendResponseBody(data []byte) {
 	s.responseBody.Write(data)
 }
 
+// Called when the stream is closed. Only successful exchanges are recorded.
+func (s *stream) recordHistory() {
+	if s.history == nil || s.err != nil || len(s.responseHeaders) == 0 {
+		return
+	}
+	_, requestSent := s.sentTimes()
+	entry := &history.Entry{
+		StreamId:         s.streamId,
+		Pushed:           s.streamId%2 == 0, // Streams initiated by the server have even-numbered stream identifiers.
+		RequestHeaders:   s.requestHeaders,
+		RequestBody:      make([]byte, 0),
+		ResponseHeaders:  s.responseHeaders,
+		ResponseTrailers: s.responseTrailers,
+		ResponseBody:     s.responseBody.Bytes(),
+		Started:          s.started,
+		RequestSent:      requestSent,
+		ResponseStarted:  s.responseStarted,
+		Completed:        s.completed,
+	}
+	if s.cmd != nil {
+		entry.RequestBody = s.cmd.Request.GetBody()
+	}
+	s.history.Add(entry)
+}
+
 func (s *stream) finalizeCommand() {
 	if s.cmd != nil {
 		if s.err != nil {
@@ -262,7 +397,16 @@ func (s *stream) finalizeCommand() {
 			for _, header := range s.responseHeaders {
 				s.cmd.Response.AddHeader(header.Name, header.Value)
 			}
+			for _, trailer := range s.responseTrailers {
+				s.cmd.Response.AddTrailer(trailer.Name, trailer.Value)
+			}
 			s.cmd.Response.SetBody(s.responseBody.Bytes(), false)
+			s.cmd.Timings.Started = s.started
+			s.cmd.Timings.HeadersSent, s.cmd.Timings.RequestSent = s.sentTimes()
+			s.cmd.Timings.ResponseStarted = s.responseStarted
+			s.cmd.Timings.FirstDataReceived = s.firstDataReceived
+			s.cmd.Timings.Completed = s.completed
+			s.cmd.StreamId = s.streamId
 			s.cmd.CompleteSuccessfully()
 		}
 	}
@@ -272,6 +416,22 @@ func (s *stream) RequestHeaders() []hpack.HeaderField {
 	return s.requestHeaders
 }
 
+func (s *stream) ResponseHeaders() []hpack.HeaderField {
+	return s.responseHeaders
+}
+
+func (s *stream) ResponseTrailers() []hpack.HeaderField {
+	return s.responseTrailers
+}
+
+func (s *stream) RemainingSendWindowSize() int64 {
+	return s.remainingSendWindowSize
+}
+
+func (s *stream) RemainingReceiveWindowSize() int64 {
+	return s.remainingReceiveWindowSize
+}
+
 func (s *stream) ResponseBody() []byte {
 	return s.responseBody.Bytes()
 }
@@ -285,6 +445,9 @@ func (s *stream) GetState() streamstate.StreamState {
 }
 
 func (s *stream) SetState(state streamstate.StreamState) {
+	if state != s.state {
+		s.events.Publish(events.New(events.STREAM_STATE, s.streamId, "%v -> %v", s.state, state))
+	}
 	s.state = state
 }
 
@@ -0,0 +1,178 @@
+package stream
+
+import (
+	neturl "net/url"
+	"testing"
+	"time"
+
+	"github.com/fstab/h2c/http2client/failure"
+	"github.com/fstab/h2c/http2client/frames"
+	"github.com/fstab/h2c/http2client/internal/eventloop/commands"
+	"golang.org/x/net/http2/hpack"
+)
+
+type mockWriter struct {
+	written                 []frames.Frame
+	remainingSendWindowSize int64
+	maxFrameSize            uint32
+}
+
+func (w *mockWriter) Write(frame frames.Frame) {
+	w.written = append(w.written, frame)
+}
+
+// WriteAndNotify calls onSent immediately, as if the frame was written to the socket.
+func (w *mockWriter) WriteAndNotify(frame frames.Frame, onSent func(sent time.Time)) {
+	w.Write(frame)
+	onSent(time.Now())
+}
+
+func (w *mockWriter) RemainingSendFlowControlWindow() int64 {
+	return w.remainingSendWindowSize
+}
+
+func (w *mockWriter) DecreaseSendFlowControlWindow(nBytesToWrite int64) {
+	w.remainingSendWindowSize -= nBytesToWrite
+}
+
+func (w *mockWriter) MaxFrameSize() uint32 {
+	return w.maxFrameSize
+}
+
+func newOpenStream(out *mockWriter, initialSendWindowSize uint32) *stream {
+	s := New(1, nil, initialSendWindowSize, 65535, out, nil, nil)
+	headersFrame := frames.NewHeadersFrame(1, []hpack.HeaderField{})
+	headersFrame.EndStream = false
+	s.SendFrame(headersFrame)
+	out.written = nil
+	return s
+}
+
+func TestDataFrameSplitToFitWindow(t *testing.T) {
+	out := &mockWriter{remainingSendWindowSize: 65535, maxFrameSize: 16384}
+	s := newOpenStream(out, 16383)
+	s.SendFrame(frames.NewDataFrame(1, make([]byte, 16384), true))
+	assertDataFrames(t, out.written, []int{16383}, false)
+	s.ReceiveFrame(frames.NewWindowUpdateFrame(1, 100))
+	assertDataFrames(t, out.written, []int{16383, 1}, true)
+}
+
+func TestDataFrameSplitToFitMaxFrameSize(t *testing.T) {
+	out := &mockWriter{remainingSendWindowSize: 65535, maxFrameSize: 16384}
+	s := newOpenStream(out, 65535)
+	s.SendFrame(frames.NewDataFrame(1, make([]byte, 40000), true))
+	assertDataFrames(t, out.written, []int{16384, 16384, 7232}, true)
+}
+
+func TestDataFrameWaitsForConnectionWindow(t *testing.T) {
+	out := &mockWriter{remainingSendWindowSize: 10, maxFrameSize: 16384}
+	s := newOpenStream(out, 65535)
+	s.SendFrame(frames.NewDataFrame(1, make([]byte, 30), true))
+	assertDataFrames(t, out.written, []int{10}, false)
+	out.remainingSendWindowSize += 5
+	s.ProcessPendingDataFrames()
+	assertDataFrames(t, out.written, []int{10, 5}, false)
+	out.remainingSendWindowSize += 100
+	s.ProcessPendingDataFrames()
+	assertDataFrames(t, out.written, []int{10, 5, 15}, true)
+}
+
+func TestTrailers(t *testing.T) {
+	cmd := newGetCommand()
+	s := New(1, cmd, 65535, 65535, &mockWriter{remainingSendWindowSize: 65535, maxFrameSize: 16384}, nil, nil)
+	s.SendFrame(frames.NewHeadersFrame(1, cmd.Request.GetHeaders()))
+	headersFrame := frames.NewHeadersFrame(1, []hpack.HeaderField{{Name: ":status", Value: "200"}})
+	headersFrame.EndStream = false
+	s.ReceiveFrame(headersFrame)
+	s.ReceiveFrame(frames.NewDataFrame(1, []byte("hello"), false))
+	s.ReceiveFrame(frames.NewHeadersFrame(1, []hpack.HeaderField{{Name: "grpc-status", Value: "0"}}))
+	if err := cmd.AwaitCompletion(1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cmd.Response.GetHeaders()) != 1 || cmd.Response.GetHeader(":status") != "200" {
+		t.Errorf("Unexpected response headers %v", cmd.Response.GetHeaders())
+	}
+	if len(cmd.Response.GetTrailers()) != 1 || cmd.Response.GetTrailers()[0].Name != "grpc-status" {
+		t.Errorf("Unexpected response trailers %v", cmd.Response.GetTrailers())
+	}
+	if string(cmd.Response.GetBody()) != "hello" {
+		t.Errorf("Unexpected response body %v", string(cmd.Response.GetBody()))
+	}
+}
+
+func TestInformationalResponse(t *testing.T) {
+	cmd := newGetCommand()
+	s := New(1, cmd, 65535, 65535, &mockWriter{remainingSendWindowSize: 65535, maxFrameSize: 16384}, nil, nil)
+	s.SendFrame(frames.NewHeadersFrame(1, cmd.Request.GetHeaders()))
+	for _, status := range []string{"100", "103"} {
+		headersFrame := frames.NewHeadersFrame(1, []hpack.HeaderField{{Name: ":status", Value: status}})
+		headersFrame.EndStream = false
+		s.ReceiveFrame(headersFrame)
+	}
+	s.ReceiveFrame(frames.NewHeadersFrame(1, []hpack.HeaderField{{Name: ":status", Value: "200"}}))
+	if err := cmd.AwaitCompletion(1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cmd.Response.GetHeaders()) != 1 || cmd.Response.GetHeader(":status") != "200" {
+		t.Errorf("Unexpected response headers %v", cmd.Response.GetHeaders())
+	}
+	if len(cmd.Response.GetTrailers()) != 0 {
+		t.Errorf("Unexpected response trailers %v", cmd.Response.GetTrailers())
+	}
+}
+
+func TestTimings(t *testing.T) {
+	cmd := newGetCommand()
+	s := New(1, cmd, 65535, 65535, &mockWriter{remainingSendWindowSize: 65535, maxFrameSize: 16384}, nil, nil)
+	s.SendFrame(frames.NewHeadersFrame(1, cmd.Request.GetHeaders()))
+	headersFrame := frames.NewHeadersFrame(1, []hpack.HeaderField{{Name: ":status", Value: "200"}})
+	headersFrame.EndStream = false
+	s.ReceiveFrame(headersFrame)
+	s.ReceiveFrame(frames.NewDataFrame(1, []byte("hello"), false))
+	s.ReceiveFrame(frames.NewDataFrame(1, []byte(" world"), true))
+	if err := cmd.AwaitCompletion(1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	timings := cmd.Timings
+	ordered := []time.Time{timings.Started, timings.HeadersSent, timings.RequestSent, timings.ResponseStarted, timings.FirstDataReceived, timings.Completed}
+	for i, timestamp := range ordered {
+		if timestamp.IsZero() {
+			t.Fatalf("Timestamp %v not set: %+v", i, timings)
+		}
+		if i > 0 && timestamp.Before(ordered[i-1]) {
+			t.Errorf("Timestamp %v is before timestamp %v: %+v", i, i-1, timings)
+		}
+	}
+}
+
+func TestRstStreamIsStreamError(t *testing.T) {
+	cmd := newGetCommand()
+	s := New(1, cmd, 65535, 65535, &mockWriter{remainingSendWindowSize: 65535, maxFrameSize: 16384}, nil, nil)
+	s.SendFrame(frames.NewHeadersFrame(1, cmd.Request.GetHeaders()))
+	s.ReceiveFrame(frames.NewRstStreamFrame(1, frames.CANCEL))
+	f := failure.Of(cmd.AwaitCompletion(1))
+	if f == nil || f.Kind != failure.STREAM_ERROR || f.Code != "CANCEL" {
+		t.Errorf("Expected stream error with code CANCEL, but got %v", f)
+	}
+}
+
+func newGetCommand() *commands.HttpCommand {
+	url, _ := neturl.Parse("http://localhost:8080/")
+	return commands.NewHttpCommand("GET", url)
+}
+
+func assertDataFrames(t *testing.T, written []frames.Frame, expectedSizes []int, expectEndStream bool) {
+	if len(written) != len(expectedSizes) {
+		t.Fatalf("Expected %v DATA frames, but got %v.", len(expectedSizes), len(written))
+	}
+	for i, frame := range written {
+		dataFrame := frame.(*frames.DataFrame)
+		if len(dataFrame.Data) != expectedSizes[i] {
+			t.Errorf("Expected DATA frame %v to have %v bytes, but got %v bytes.", i, expectedSizes[i], len(dataFrame.Data))
+		}
+		isLast := i == len(written)-1
+		if dataFrame.EndStream != (isLast && expectEndStream) {
+			t.Errorf("Unexpected END_STREAM flag on DATA frame %v.", i)
+		}
+	}
+}
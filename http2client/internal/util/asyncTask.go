@@ -1,8 +1,9 @@
 package util
 
 import (
-	"fmt"
 	"time"
+
+	"github.com/fstab/h2c/http2client/failure"
 )
 
 type AsyncTask struct {
@@ -28,7 +29,7 @@ func (t *AsyncTask) CompleteWithError(err error) {
 func (t *AsyncTask) WaitForCompletion(timeoutInSeconds int) error {
 	go func() {
 		time.Sleep(time.Duration(timeoutInSeconds) * time.Second)
-		t.error <- fmt.Errorf("Timeout after %v seconds.", timeoutInSeconds)
+		t.error <- failure.New(failure.TIMEOUT, "Timeout after %v seconds.", timeoutInSeconds)
 	}()
 	select {
 	case <-t.success:
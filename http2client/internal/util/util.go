@@ -1,5 +1,7 @@
 package util
 
+import "golang.org/x/net/http2/hpack"
+
 func SliceContainsString(slice []string, s string) bool {
 	for _, element := range slice {
 		if element == s {
@@ -8,3 +10,13 @@ func SliceContainsString(slice []string, s string) bool {
 	}
 	return false
 }
+
+// FindHeader returns the value of the first header with the name, or "" if there is no such header.
+func FindHeader(name string, headers []hpack.HeaderField) string {
+	for _, header := range headers {
+		if header.Name == name {
+			return header.Value
+		}
+	}
+	return ""
+}
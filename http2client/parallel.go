@@ -0,0 +1,129 @@
+package http2client
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fstab/h2c/http2client/internal/eventloop/commands"
+	"golang.org/x/net/http2/hpack"
+)
+
+// ParallelResult is the outcome of one of the requests sent with GetParallel().
+type ParallelResult struct {
+	Path     string
+	Response *Response // nil if Err != nil
+	Err      error
+	Started  time.Time     // time when the request was passed to the connection
+	Duration time.Duration // time from Started until the response was complete or failed
+}
+
+// ParallelResults are the results of GetParallel(), in the order in which the requests completed.
+type ParallelResults []*ParallelResult
+
+// GetParallel sends GET requests for all paths at once, so that they are multiplexed on the current connection.
+// If not connected, and the first path is a full URL, it connects to the server.
+// onComplete is called for each request as soon as it completes, which may be in a different order than paths.
+// The headers are sent with each request, see Get().
+func (h2c *Http2Client) GetParallel(paths []string, headers []hpack.HeaderField, timeoutInSeconds int, onComplete func(*ParallelResult)) (ParallelResults, error) {
+	if h2c.err != nil {
+		return nil, h2c.err
+	}
+	cmds := make([]*commands.HttpCommand, 0, len(paths))
+	for _, path := range paths {
+		cmd, err := h2c.newHttpCommand("GET", path, headers, nil)
+		if err != nil {
+			return nil, err // nothing was sent yet
+		}
+		cmds = append(cmds, cmd)
+	}
+	completed := make(chan *ParallelResult, len(cmds))
+	for i, cmd := range cmds {
+		if err := h2c.submitHttpCommand(cmd); err != nil {
+			completed <- &ParallelResult{Path: paths[i], Started: cmd.Timings.Enqueued, Err: err}
+			continue
+		}
+		go func(path string, cmd *commands.HttpCommand) {
+			result := &ParallelResult{Path: path, Started: cmd.Timings.Enqueued}
+			result.Err = h2c.awaitHttpCommand(cmd, timeoutInSeconds)
+			result.Duration = time.Since(result.Started)
+			if result.Err == nil {
+				result.Response = newResponse(cmd)
+			}
+			completed <- result
+		}(paths[i], cmd)
+	}
+	results := make(ParallelResults, 0, len(cmds))
+	for range cmds {
+		result := <-completed
+		results = append(results, result)
+		if onComplete != nil {
+			onComplete(result)
+		}
+	}
+	return results, nil
+}
+
+// ParallelSummary shows how much the requests overlapped.
+type ParallelSummary struct {
+	Requests             int
+	Failed               int
+	MaxConcurrentStreams int           // maximum number of requests that were in progress at the same time
+	Elapsed              time.Duration // from the first request sent until the last request completed
+	SumOfDurations       time.Duration // how long it would have taken to send the requests one after the other
+	MinDuration          time.Duration
+	MaxDuration          time.Duration
+}
+
+func (results ParallelResults) Summary() *ParallelSummary {
+	summary := &ParallelSummary{Requests: len(results)}
+	var first, last time.Time
+	type event struct {
+		time  time.Time
+		delta int
+	}
+	streamEvents := make([]event, 0, 2*len(results))
+	for i, result := range results {
+		if result.Err != nil {
+			summary.Failed++
+		}
+		summary.SumOfDurations += result.Duration
+		if i == 0 || result.Duration < summary.MinDuration {
+			summary.MinDuration = result.Duration
+		}
+		if result.Duration > summary.MaxDuration {
+			summary.MaxDuration = result.Duration
+		}
+		completed := result.Started.Add(result.Duration)
+		if first.IsZero() || result.Started.Before(first) {
+			first = result.Started
+		}
+		if completed.After(last) {
+			last = completed
+		}
+		streamEvents = append(streamEvents, event{result.Started, 1}, event{completed, -1})
+	}
+	summary.Elapsed = duration(first, last)
+	// Count the requests in progress at each point in time. Requests completing at the same time as others start do not overlap.
+	sort.SliceStable(streamEvents, func(i, j int) bool {
+		if streamEvents[i].time.Equal(streamEvents[j].time) {
+			return streamEvents[i].delta < streamEvents[j].delta
+		}
+		return streamEvents[i].time.Before(streamEvents[j].time)
+	})
+	concurrent := 0
+	for _, e := range streamEvents {
+		concurrent += e.delta
+		if concurrent > summary.MaxConcurrentStreams {
+			summary.MaxConcurrentStreams = concurrent
+		}
+	}
+	return summary
+}
+
+// String looks like "3 requests, 0 failed, max 3 concurrent streams, 1.2s elapsed, 3.5s sum of response times (min 1.1s, max 1.2s)"
+func (s *ParallelSummary) String() string {
+	return fmt.Sprintf("%v requests, %v failed, max %v concurrent streams, %v elapsed, %v sum of response times (min %v, max %v)",
+		s.Requests, s.Failed, s.MaxConcurrentStreams, s.Elapsed.Round(100*time.Microsecond), s.SumOfDurations.Round(100*time.Microsecond),
+		s.MinDuration.Round(100*time.Microsecond), s.MaxDuration.Round(100*time.Microsecond))
+}
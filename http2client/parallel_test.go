@@ -0,0 +1,31 @@
+package http2client
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParallelSummary(t *testing.T) {
+	started := time.Now()
+	results := ParallelResults{
+		{Path: "/a", Started: started, Duration: 2 * time.Millisecond},
+		{Path: "/b", Started: started, Duration: 5 * time.Millisecond},
+		{Path: "/c", Started: started.Add(2 * time.Millisecond), Duration: 6 * time.Millisecond},
+		{Path: "/d", Started: started.Add(1 * time.Millisecond), Duration: 1 * time.Millisecond, Err: errors.New("Timeout.")},
+	}
+	summary := results.Summary()
+	if summary.Requests != 4 || summary.Failed != 1 {
+		t.Errorf("Expected 4 requests with 1 failure, but got %+v", summary)
+	}
+	// /c starts when /a and /d complete, so at most 3 requests overlap.
+	if summary.MaxConcurrentStreams != 3 {
+		t.Errorf("Expected 3 concurrent streams, but got %v", summary.MaxConcurrentStreams)
+	}
+	if summary.Elapsed != 8*time.Millisecond || summary.SumOfDurations != 14*time.Millisecond {
+		t.Errorf("Unexpected elapsed time %v or sum of durations %v", summary.Elapsed, summary.SumOfDurations)
+	}
+	if summary.MinDuration != 1*time.Millisecond || summary.MaxDuration != 6*time.Millisecond {
+		t.Errorf("Unexpected min duration %v or max duration %v", summary.MinDuration, summary.MaxDuration)
+	}
+}
@@ -0,0 +1,55 @@
+package http2client
+
+import (
+	"path"
+	"strings"
+
+	"github.com/fstab/h2c/http2client/internal/util"
+	"golang.org/x/net/http2/hpack"
+)
+
+// PushPolicy decides which push promises are accepted.
+// Push promises that are not accepted are refused with RST_STREAM error code REFUSED_STREAM.
+type PushPolicy struct {
+	RefuseAll    bool
+	MaxPushes    int      // Maximum number of push promises accepted on a connection. 0 means unlimited.
+	AllowedPaths []string // Patterns as in path.Match(), like "/static/*". If empty, all paths are allowed.
+}
+
+// Create a new function for each connection, because the number of accepted push promises is counted per connection.
+func (p *PushPolicy) newAcceptFunc() func(requestHeaders []hpack.HeaderField) bool {
+	if p == nil {
+		return nil // accept all
+	}
+	nAccepted := 0
+	return func(requestHeaders []hpack.HeaderField) bool {
+		if p.RefuseAll {
+			return false
+		}
+		if p.MaxPushes > 0 && nAccepted >= p.MaxPushes {
+			return false
+		}
+		if len(p.AllowedPaths) > 0 && !p.isPathAllowed(util.FindHeader(":path", requestHeaders)) {
+			return false
+		}
+		nAccepted++
+		return true
+	}
+}
+
+func (p *PushPolicy) isPathAllowed(requestPath string) bool {
+	for _, pattern := range p.AllowedPaths {
+		if matched, _ := path.Match(pattern, stripQuery(requestPath)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// "/index.html?lang=en" -> "/index.html"
+func stripQuery(requestPath string) string {
+	if i := strings.IndexAny(requestPath, "?#"); i >= 0 {
+		return requestPath[:i]
+	}
+	return requestPath
+}
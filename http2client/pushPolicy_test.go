@@ -0,0 +1,52 @@
+package http2client
+
+import (
+	"testing"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+func pushRequest(path string) []hpack.HeaderField {
+	return []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":path", Value: path},
+	}
+}
+
+func TestNilPushPolicyAcceptsAll(t *testing.T) {
+	var policy *PushPolicy
+	if policy.newAcceptFunc() != nil {
+		t.Error("Expected nil accept function for nil push policy.")
+	}
+}
+
+func TestRefuseAll(t *testing.T) {
+	accept := (&PushPolicy{RefuseAll: true}).newAcceptFunc()
+	if accept(pushRequest("/index.html")) {
+		t.Error("Push promise should be refused.")
+	}
+}
+
+func TestMaxPushes(t *testing.T) {
+	accept := (&PushPolicy{MaxPushes: 2}).newAcceptFunc()
+	for i, expected := range []bool{true, true, false} {
+		if accept(pushRequest("/index.html")) != expected {
+			t.Errorf("Push promise %v: expected accepted=%v", i+1, expected)
+		}
+	}
+}
+
+func TestAllowedPaths(t *testing.T) {
+	accept := (&PushPolicy{AllowedPaths: []string{"/css/*", "/favicon.ico"}}).newAcceptFunc()
+	for path, expected := range map[string]bool{
+		"/css/main.css":        true,
+		"/css/main.css?v=1":    true,
+		"/favicon.ico":         true,
+		"/js/main.js":          false,
+		"/css/vendor/base.css": false,
+	} {
+		if accept(pushRequest(path)) != expected {
+			t.Errorf("%v: expected accepted=%v", path, expected)
+		}
+	}
+}
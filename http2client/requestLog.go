@@ -0,0 +1,159 @@
+package http2client
+
+import (
+	"fmt"
+	neturl "net/url"
+	"time"
+
+	"github.com/fstab/h2c/http2client/internal/eventloop/commands"
+	"golang.org/x/net/http2/hpack"
+)
+
+// If the request log has more entries, the oldest entries are dropped.
+const MAX_LOGGED_REQUESTS = 1000
+
+// loggedRequest is a request sent by the user, as shown in 'h2c history'.
+// Unlike the HAR history, failed requests are logged as well, so that they can be replayed.
+type loggedRequest struct {
+	index    int
+	method   string
+	url      *neturl.URL         // the URL of the request, not affected by pseudo-headers set with 'h2c set'
+	headers  []hpack.HeaderField // including the headers set with 'h2c set' at the time of the request
+	body     []byte              // nil if the request had no body
+	status   string              // empty if no response was received
+	size     int
+	duration time.Duration
+	err      error
+}
+
+func (h2c *Http2Client) logRequest(cmd *commands.HttpCommand, duration time.Duration, err error) {
+	h2c.requestLogMutex.Lock()
+	defer h2c.requestLogMutex.Unlock()
+	entry := &loggedRequest{
+		index:    h2c.nextRequestIndex,
+		method:   cmd.Request.GetHeader(":method"),
+		url:      cmd.Url,
+		headers:  cmd.Request.GetHeaders(),
+		duration: duration,
+		err:      err,
+	}
+	if cmd.Request.GetHeader("content-length") != "" {
+		entry.body = cmd.Request.GetBody()
+	}
+	if err == nil {
+		entry.status = cmd.Response.GetHeader(":status")
+		entry.size = len(cmd.Response.GetBody())
+	}
+	h2c.nextRequestIndex++
+	if len(h2c.requestLog) >= MAX_LOGGED_REQUESTS {
+		h2c.requestLog[0] = nil
+		h2c.requestLog = h2c.requestLog[1:]
+	}
+	h2c.requestLog = append(h2c.requestLog, entry)
+}
+
+func (h2c *Http2Client) findLoggedRequest(index int) (*loggedRequest, error) {
+	h2c.requestLogMutex.Lock()
+	defer h2c.requestLogMutex.Unlock()
+	for _, entry := range h2c.requestLog {
+		if entry.index == index {
+			return entry, nil
+		}
+	}
+	return nil, fmt.Errorf("%v: No such request. Run 'h2c history' to see the available requests.", index)
+}
+
+// LoggedRequest is an entry in the History().
+type LoggedRequest struct {
+	Index    int
+	Method   string
+	Url      string
+	Status   string // empty if no response was received
+	Size     int
+	Duration time.Duration
+	Err      error // nil if a response was received
+}
+
+// RequestLog is the result of History().
+type RequestLog []LoggedRequest
+
+// History lists the requests sent so far, oldest first.
+func (h2c *Http2Client) History() RequestLog {
+	h2c.requestLogMutex.Lock()
+	defer h2c.requestLogMutex.Unlock()
+	result := make(RequestLog, 0, len(h2c.requestLog))
+	for _, entry := range h2c.requestLog {
+		result = append(result, LoggedRequest{
+			Index:    entry.index,
+			Method:   entry.method,
+			Url:      entry.url.String(),
+			Status:   entry.status,
+			Size:     entry.size,
+			Duration: entry.duration,
+			Err:      entry.err,
+		})
+	}
+	return result
+}
+
+// String has one line per request, like "3: POST /api/items 201 (18 bytes, 4.2ms)"
+func (log RequestLog) String() string {
+	result := ""
+	for _, entry := range log {
+		if result != "" {
+			result = result + "\n"
+		}
+		path := entry.Url
+		if url, err := neturl.Parse(entry.Url); err == nil {
+			path = url.RequestURI()
+		}
+		if entry.Err != nil {
+			result = result + fmt.Sprintf("%v: %v %v failed (%v, %v)", entry.Index, entry.Method, path, entry.Err.Error(), entry.Duration.Round(100*time.Microsecond))
+		} else {
+			result = result + fmt.Sprintf("%v: %v %v %v (%v bytes, %v)", entry.Index, entry.Method, path, entry.Status, entry.Size, entry.Duration.Round(100*time.Microsecond))
+		}
+	}
+	return result
+}
+
+// Replay re-sends a logged request with the same headers and body.
+// Pseudo-headers that were replaced in the original request, like an :authority set with 'h2c set', are replaced as well.
+// The request is sent on the current connection. If not connected, h2c connects to the server of the original request.
+// The replayed request is logged as a new request.
+func (h2c *Http2Client) Replay(index int, timeoutInSeconds int) (*Response, error) {
+	if h2c.err != nil {
+		return nil, h2c.err
+	}
+	entry, err := h2c.findLoggedRequest(index)
+	if err != nil {
+		return nil, err
+	}
+	path := entry.url.RequestURI()
+	if !h2c.isConnected() {
+		path = entry.url.String()
+	}
+	url, err := h2c.connectForUrl(path)
+	if err != nil {
+		return nil, err
+	}
+	cmd := commands.NewHttpCommand(entry.method, url)
+	original := commands.NewHttpCommand(entry.method, entry.url)
+	for _, header := range entry.headers {
+		switch {
+		case isRequestPseudoHeader(header.Name):
+			if header.Value != original.Request.GetHeader(header.Name) {
+				cmd.Request.ReplaceHeader(header.Name, header.Value)
+			}
+		case header.Name != "content-length":
+			cmd.Request.AddHeader(header.Name, header.Value)
+		}
+	}
+	if entry.body != nil {
+		cmd.Request.SetBody(entry.body, true)
+	}
+	err = h2c.executeHttpCommand(cmd, timeoutInSeconds)
+	if err != nil {
+		return nil, err
+	}
+	return newResponse(cmd), nil
+}
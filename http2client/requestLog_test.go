@@ -0,0 +1,35 @@
+package http2client
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fstab/h2c/http2client/internal/util"
+)
+
+func TestReplayKeepsPseudoHeaders(t *testing.T) {
+	host, port := startTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-authority", r.Host)
+	})
+	client := New()
+	if _, err := client.Connect("http", host, port, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer client.Disconnect()
+	if _, err := client.SetHeader(":authority", "example.com", "", ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := client.Get("/", nil, 5); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := client.UnsetHeader([]string{":authority"}, "", ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	response, err := client.Replay(1, 5)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if authority := util.FindHeader("x-authority", response.Headers); authority != "example.com" {
+		t.Errorf("Expected :authority example.com in the replayed request, but got %v.", authority)
+	}
+}
@@ -0,0 +1,115 @@
+package http2client
+
+import (
+	"time"
+
+	"github.com/fstab/h2c/http2client/internal/eventloop/commands"
+	"github.com/fstab/h2c/http2client/internal/util"
+	"golang.org/x/net/http2/hpack"
+)
+
+// Response to a request sent with Get(), Put(), Post(), or Replay().
+// A response with an HTTP error status like 500 is a regular Response, not an error.
+type Response struct {
+	StreamId uint32
+	Headers  []hpack.HeaderField // including the :status pseudo-header
+	Trailers []hpack.HeaderField // HEADERS received after the response headers
+	Body     []byte
+	Timings  Timings
+}
+
+// Timings of a request/response exchange, see history.Entry. Zero if unknown.
+// For responses pushed by the server, Started, HeadersSent, and RequestSent are the time when the PUSH_PROMISE was received,
+// which may be before the request was Enqueued.
+type Timings struct {
+	Enqueued          time.Time // Request passed to the connection's event loop.
+	Started           time.Time // Stream created.
+	HeadersSent       time.Time // HEADERS frame written and flushed to the socket.
+	RequestSent       time.Time // END_STREAM written and flushed, i.e. the last DATA frame, or the HEADERS frame if there is no body.
+	ResponseStarted   time.Time // First response HEADERS received.
+	FirstDataReceived time.Time // Zero if the response has no body.
+	Completed         time.Time // END_STREAM received.
+	// The connection used for the request, which may have been established for an earlier request.
+	ConnectStarted   time.Time
+	Connected        time.Time
+	TlsHandshakeDone time.Time // Always zero, because h2c supports only cleartext connections.
+}
+
+func newResponse(cmd *commands.HttpCommand) *Response {
+	return &Response{
+		StreamId: cmd.StreamId,
+		Headers:  cmd.Response.GetHeaders(),
+		Trailers: cmd.Response.GetTrailers(),
+		Body:     cmd.Response.GetBody(),
+		Timings: Timings{
+			Enqueued:          cmd.Timings.Enqueued,
+			Started:           cmd.Timings.Started,
+			HeadersSent:       cmd.Timings.HeadersSent,
+			RequestSent:       cmd.Timings.RequestSent,
+			ResponseStarted:   cmd.Timings.ResponseStarted,
+			FirstDataReceived: cmd.Timings.FirstDataReceived,
+			Completed:         cmd.Timings.Completed,
+			ConnectStarted:    cmd.Timings.Connect.Started,
+			Connected:         cmd.Timings.Connect.Connected,
+			TlsHandshakeDone:  cmd.Timings.Connect.TlsHandshakeDone,
+		},
+	}
+}
+
+// Status is the value of the :status pseudo-header, like "200".
+func (r *Response) Status() string {
+	return util.FindHeader(":status", r.Headers)
+}
+
+// Format the response as shown on the command line: The body, preceded by the headers and trailers if includeHeaders is true.
+func (r *Response) Format(includeHeaders bool) string {
+	result := ""
+	if includeHeaders {
+		for _, header := range r.Headers {
+			result = result + header.Name + ": " + header.Value + "\n"
+		}
+		for _, trailer := range r.Trailers {
+			result = result + trailer.Name + ": " + trailer.Value + "\n"
+		}
+	}
+	if len(r.Body) > 0 {
+		result = result + string(r.Body)
+	}
+	return result
+}
+
+// Start is the time when the request was Enqueued, or Started if Enqueued is unknown.
+// Durations like Since(t.HeadersSent) are measured from Start.
+func (t Timings) Start() time.Time {
+	if t.Enqueued.IsZero() {
+		return t.Started
+	}
+	return t.Enqueued
+}
+
+// Since is the time from Start to the given time, or 0 if unknown.
+func (t Timings) Since(to time.Time) time.Duration {
+	return duration(t.Start(), to)
+}
+
+// Total is the time from Start to Completed.
+func (t Timings) Total() time.Duration {
+	return t.Since(t.Completed)
+}
+
+// Connect is the time needed to establish the TCP connection.
+func (t Timings) Connect() time.Duration {
+	return duration(t.ConnectStarted, t.Connected)
+}
+
+// TlsHandshake is the time needed for the TLS handshake, always 0 for cleartext connections.
+func (t Timings) TlsHandshake() time.Duration {
+	return duration(t.Connected, t.TlsHandshakeDone)
+}
+
+func duration(from time.Time, to time.Time) time.Duration {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return 0
+	}
+	return to.Sub(from)
+}
@@ -0,0 +1,29 @@
+package http2client
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"golang.org/x/net/http2"
+	h2cserver "golang.org/x/net/http2/h2c"
+)
+
+// startTestServer starts a local HTTP/2 cleartext server. It is stopped when the test is complete.
+func startTestServer(t *testing.T, handler http.HandlerFunc) (string, int) {
+	return startTestServerWithConfig(t, &http2.Server{}, handler)
+}
+
+// startTestServerWithConfig is like startTestServer, but with settings like MaxConcurrentStreams.
+func startTestServerWithConfig(t *testing.T, config *http2.Server, handler http.HandlerFunc) (string, int) {
+	server := httptest.NewServer(h2cserver.NewHandler(handler, config))
+	t.Cleanup(server.Close)
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	portNumber, _ := strconv.Atoi(port)
+	return host, portNumber
+}
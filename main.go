@@ -9,10 +9,11 @@ import (
 
 func main() {
 	msg, err := cli.Run()
+	if msg != "" {
+		fmt.Println(msg) // may be set along with err, e.g. the error as JSON object if the command was run with --json
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err.Error())
-		os.Exit(-1)
-	} else if msg != "" {
-		fmt.Println(msg)
+		os.Exit(cli.ExitCode(err))
 	}
 }